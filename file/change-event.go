@@ -0,0 +1,52 @@
+/* For license and copyright information please see LEGAL file in repository */
+
+package file
+
+import (
+	"../event"
+	"../time/unix"
+)
+
+// ChangeOperation indicate which change on a file or directory cause a ChangeEvent.
+type ChangeOperation uint8
+
+const (
+	ChangeOperation_Unset ChangeOperation = iota
+	ChangeOperation_Created
+	ChangeOperation_Modified
+	ChangeOperation_Renamed
+	ChangeOperation_Deleted
+	// ChangeOperation_Overflow means some changes lost, so listeners must read the whole watched directory again.
+	ChangeOperation_Overflow
+)
+
+// ChangeEvent dispatch by directory watchers on any change in a watched directory.
+// Listeners must add by ChangeEvent_MediaType.ID() as the domain.
+type ChangeEvent struct {
+	event.Event
+
+	operation  ChangeOperation
+	uriPath    string
+	oldURIPath string
+	directory  bool
+}
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (e *ChangeEvent) Init(op ChangeOperation, uriPath, oldURIPath string, directory bool) {
+	e.operation = op
+	e.uriPath = uriPath
+	e.oldURIPath = oldURIPath
+	e.directory = directory
+	e.Event.Init(&ChangeEvent_MediaType, [16]byte{}, unix.Now())
+}
+
+func (e *ChangeEvent) Operation() ChangeOperation { return e.operation }
+
+// URIPath return the changed path relative to the watched directory e.g. "pages/home/home.html".
+func (e *ChangeEvent) URIPath() string { return e.uriPath }
+
+// OldURIPath return the path before rename. It is empty for other operations.
+func (e *ChangeEvent) OldURIPath() string { return e.oldURIPath }
+
+// Directory report the changed path is a directory.
+func (e *ChangeEvent) Directory() bool { return e.directory }
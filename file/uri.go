@@ -3,50 +3,183 @@
 package file
 
 import (
-	"path/filepath"
+	"strings"
 
 	"../convert"
 	"../protocol"
+	"../uri"
 )
 
-// URI implement protocol.URI and protocol.FileURI interface
+// URI implement protocol.URI and protocol.FileURI interface by RFC 8089.
+// https://datatracker.ietf.org/doc/html/rfc8089
+//   - path is decoded and always absolute, uri is the serialized form with percent-encoded path.
+//   - Minimal "file:/path" and non-standard forms of RFC 8089 appendix E e.g. DOS drive letters and
+//     UNC strings parse too, but URI() always serialize to "file://" form.
+//   - A file URI has no userinfo or port, so authority is just the host.
 type URI struct {
 	uri       string
-	domain    string
+	authority string // host, "" or "localhost" for local files
 	path      string
+	query     string // encoded, without '?'
+	fragment  string // encoded, without '#'
 	name      string
 	extension string
 }
 
-func (uri *URI) Init(u string) {
-	var dir, fileName = filepath.Split(u)
-	uri.path = dir
-	uri.Rename(fileName)
-	// TODO::: decode more data
+// Init parse a file URI e.g. "file:///path/to/file" or a local absolute path e.g. "/path/to/file" that OS APIs return.
+func (u *URI) Init(s string) (err protocol.Error) {
+	if !hasFileScheme(s) {
+		if s == "" || s[0] != '/' {
+			return &uri.ErrParse
+		}
+		u.Set("file", "", s, "", "")
+		return
+	}
+
+	var hier, query, fragment = splitQueryFragment(s[len("file:"):])
+	var authority, path string
+	if strings.HasPrefix(hier, "//") {
+		hier = hier[2:]
+		if strings.HasPrefix(hier, "//") {
+			// UNC string with 4 or 5 slashes e.g. "file:////host.example.com/path/to/file", RFC 8089 appendix E.3.2
+			hier = strings.TrimPrefix(hier[2:], "/")
+		}
+		if i := strings.IndexByte(hier, '/'); i < 0 {
+			authority, path = hier, "/"
+		} else {
+			authority, path = hier[:i], hier[i:]
+		}
+	} else {
+		path = hier
+	}
+
+	if path == "" {
+		return &uri.ErrParse
+	}
+	// DOS drive letter e.g. "file:c:/path/to/file", RFC 8089 appendix E.2
+	if path[0] != '/' {
+		if !isDriveLetter(path) {
+			return &uri.ErrParse
+		}
+		path = "/" + path
+	}
+	if isDriveLetter(path[1:]) && path[2] == '|' {
+		path = path[:2] + ":" + path[3:]
+	}
+
+	authority, err = uri.Unescape(authority, uri.EscapeMode_Host)
+	if err != nil {
+		return
+	}
+	path, err = uri.Unescape(path, uri.EscapeMode_Path)
+	if err != nil {
+		return
+	}
+	u.Set("file", authority, path, query, fragment)
+	return
+}
+
+// Set ignore the scheme that is always "file". path is the decoded path.
+func (u *URI) Set(scheme, authority, path, query, fragment string) {
+	if path == "" {
+		path = "/"
+	}
+	u.authority, u.query, u.fragment = authority, query, fragment
+	u.setPath(path)
+}
+
+// ResolveFrom set u to the reference that is relative to the directory e.g. "../css/main.css", "./a.txt" or "/b.txt".
+// reference can be a full file URI too. Dot segments remove as RFC 3986 section 5.2.4.
+func (u *URI) ResolveFrom(dir protocol.FileDirectory, reference string) (err protocol.Error) {
+	if hasFileScheme(reference) {
+		return u.Init(reference)
+	}
+	var ref, query, fragment = splitQueryFragment(reference)
+	var path string
+	path, err = uri.Unescape(ref, uri.EscapeMode_Path)
+	if err != nil {
+		return
+	}
+	var base = dir.Metadata().URI()
+	if !strings.HasPrefix(path, "/") {
+		var basePath = base.Path()
+		if !strings.HasSuffix(basePath, "/") {
+			basePath += "/"
+		}
+		path = basePath + path
+	}
+	u.Set("file", base.Domain(), removeDotSegments(path), query, fragment)
+	return
+}
+
+func (u *URI) URI() string       { return u.uri }
+func (u *URI) Scheme() string    { return "file" }
+func (u *URI) Authority() string { return u.authority }
+func (u *URI) Userinfo() string  { return "" }
+func (u *URI) Username() string  { return "" }
+func (u *URI) Password() string  { return "" }
+func (u *URI) Host() string      { return u.authority }
+func (u *URI) Port() string      { return "" }
+func (u *URI) Path() string      { return u.path }
+func (u *URI) Query() string     { return u.query }
+func (u *URI) Fragment() string  { return u.fragment }
+
+func (u *URI) Domain() string    { return u.authority }
+func (u *URI) Name() string      { return u.name }
+func (u *URI) Extension() string { return u.extension }
+func (u *URI) NameWithoutExtension() string {
+	if u.extension == "" {
+		return u.name
+	}
+	return u.name[:len(u.name)-len(u.extension)-1]
 }
+func (u *URI) IsDirectory() bool   { return IsPathDirectory(u.path) }
+func (u *URI) PathParts() []string { return FilePathParts(u.path) }
 
-func (uri *URI) URI() string                  { return uri.uri }
-func (uri *URI) Scheme() string               { return "file" }
-func (uri *URI) Domain() string               { return uri.domain }
-func (uri *URI) Path() string                 { return uri.path }
-func (uri *URI) Name() string                 { return uri.name }
-func (uri *URI) NameWithoutExtension() string { return uri.name[:len(uri.name)-len(uri.extension)] }
-func (uri *URI) Extension() string            { return uri.extension }
-func (uri *URI) IsDirectory() bool            { return IsPathDirectory(uri.path) }
-func (uri *URI) PathParts() []string          { return FilePathParts(uri.path) }
+// IsLocal report whether the file is on the local machine. RFC 8089 section 2 treat "localhost" same as no authority.
+func (u *URI) IsLocal() bool { return u.authority == "" || strings.EqualFold(u.authority, "localhost") }
 
-func IsPathDirectory(uriPath string) bool { return uriPath[len(uriPath)-1] == '/' }
+// DirectoryPath return the path of the directory that the file is in it, or the path itself if it is a directory.
+func (u *URI) DirectoryPath() string { return u.path[:strings.LastIndexByte(u.path, '/')+1] }
 
 // Rename just rename the file name
-func (uri *URI) Rename(newName string) {
-	uri.name = newName
-	for i := len(newName) - 1; i >= 0; i-- {
-		if newName[i] == '.' {
-			uri.extension = newName[i+1:]
+func (u *URI) Rename(newName string) {
+	var path = strings.TrimSuffix(u.path, "/")
+	path = path[:strings.LastIndexByte(path, '/')+1] + newName
+	if u.IsDirectory() {
+		path += "/"
+	}
+	u.setPath(path)
+}
+
+func (u *URI) setPath(path string) {
+	u.path = path
+	var name = strings.TrimSuffix(path, "/")
+	u.name = name[strings.LastIndexByte(name, '/')+1:]
+	u.extension = ""
+	if !u.IsDirectory() {
+		if i := strings.LastIndexByte(u.name, '.'); i > 0 {
+			u.extension = u.name[i+1:]
 		}
 	}
+
+	var b strings.Builder
+	b.WriteString("file://")
+	b.WriteString(uri.Escape(u.authority, uri.EscapeMode_Host))
+	b.WriteString(uri.Escape(u.path, uri.EscapeMode_Path))
+	if u.query != "" {
+		b.WriteByte('?')
+		b.WriteString(u.query)
+	}
+	if u.fragment != "" {
+		b.WriteByte('#')
+		b.WriteString(u.fragment)
+	}
+	u.uri = b.String()
 }
 
+func IsPathDirectory(uriPath string) bool { return uriPath != "" && uriPath[len(uriPath)-1] == '/' }
+
 func FilePathParts(uriPath string) (parts []string) {
 	parts = make([]string, 0, 4)
 	for i := 0; i < len(uriPath); i++ {
@@ -60,31 +193,64 @@ func FilePathParts(uriPath string) (parts []string) {
 	return
 }
 
-/*
-********** protocol.Codec interface **********
- */
+func hasFileScheme(s string) bool { return len(s) >= 5 && strings.EqualFold(s[:5], "file:") }
 
-func (uri *URI) MediaType() string    { return "application/uri" }
-func (uri *URI) CompressType() string { return "" }
+// isDriveLetter report whether path start with a DOS drive letter e.g. "c:" or "c|".
+func isDriveLetter(path string) bool {
+	if len(path) < 2 || (path[1] != ':' && path[1] != '|') || (len(path) > 2 && path[2] != '/') {
+		return false
+	}
+	var c = path[0] | 0x20
+	return 'a' <= c && c <= 'z'
+}
 
-// Marshal enecodes and return whole file data!
-func (uri *URI) Marshal() (data []byte) {
-	var ln = 5
-	data = make([]byte, 0, ln)
+func splitQueryFragment(s string) (rest, query, fragment string) {
+	rest = s
+	if i := strings.IndexByte(rest, '#'); i >= 0 {
+		rest, fragment = rest[:i], rest[i+1:]
+	}
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		rest, query = rest[:i], rest[i+1:]
+	}
 	return
 }
 
-// MarshalTo enecodes whole file data to given data and return it with new len!
-func (uri *URI) MarshalTo(data []byte) []byte {
-	return data
+// removeDotSegments resolve "." and ".." segments of an absolute path. ".." never go up from the root.
+func removeDotSegments(path string) string {
+	var parts = strings.Split(path[1:], "/")
+	var out = make([]string, 0, len(parts))
+	for _, part := range parts {
+		switch part {
+		case ".":
+		case "..":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, part)
+		}
+	}
+	path = "/" + strings.Join(out, "/")
+	if last := parts[len(parts)-1]; (last == "." || last == "..") && len(out) > 0 {
+		path += "/"
+	}
+	return path
 }
 
-// Unmarshal save given data to the file. It will overwritten exiting data.
-func (uri *URI) Unmarshal(data []byte) (err protocol.Error) {
-	var dataAsString = convert.UnsafeByteSliceToString(data)
-	var dir, fileName = filepath.Split(dataAsString)
-	uri.path = dir
-	uri.name = fileName
-	// TODO::: decode more data
-	return
+/*
+********** protocol.Codec interface **********
+ */
+
+func (u *URI) MediaType() string    { return "application/uri" }
+func (u *URI) CompressType() string { return "" }
+
+// Marshal return the serialized file URI.
+func (u *URI) Marshal() (data []byte) { return []byte(u.uri) }
+
+// MarshalTo append the serialized file URI to given data and return it with new len.
+func (u *URI) MarshalTo(data []byte) []byte { return append(data, u.uri...) }
+
+// Unmarshal parse given file URI to u. It will overwritten exiting data.
+func (u *URI) Unmarshal(data []byte) (err protocol.Error) {
+	return u.Init(convert.UnsafeByteSliceToString(data))
 }
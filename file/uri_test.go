@@ -0,0 +1,97 @@
+/* For license and copyright information please see LEGAL file in repository */
+
+package file
+
+import (
+	"testing"
+)
+
+// Examples of RFC 8089 appendix B and appendix E.
+var uriTests = []struct {
+	name      string
+	raw       string
+	uri       string
+	authority string
+	path      string
+	local     bool
+}{
+	{"local file", "file:///path/to/file", "file:///path/to/file", "", "/path/to/file", true},
+	{"minimal local file", "file:/path/to/file", "file:///path/to/file", "", "/path/to/file", true},
+	{"localhost", "file://localhost/path/to/file", "file://localhost/path/to/file", "localhost", "/path/to/file", true},
+	{"non-local file", "file://host.example.com/path/to/file", "file://host.example.com/path/to/file", "host.example.com", "/path/to/file", false},
+	{"dos drive letter", "file:c:/path/to/file", "file:///c:/path/to/file", "", "/c:/path/to/file", true},
+	{"dos drive letter with slash", "file:///c:/path/to/file", "file:///c:/path/to/file", "", "/c:/path/to/file", true},
+	{"dos vertical line", "file:///c|/path/to/file", "file:///c:/path/to/file", "", "/c:/path/to/file", true},
+	{"unc with 4 slashes", "file:////host.example.com/path/to/file", "file://host.example.com/path/to/file", "host.example.com", "/path/to/file", false},
+	{"unc with 5 slashes", "file://///host.example.com/path/to/file", "file://host.example.com/path/to/file", "host.example.com", "/path/to/file", false},
+	{"percent-encoding", "file:///path/to/my%20file%23.txt", "file:///path/to/my%20file%23.txt", "", "/path/to/my file#.txt", true},
+	{"upper case scheme", "FILE:///path/", "file:///path/", "", "/path/", true},
+	{"os path", "/path/to/file", "file:///path/to/file", "", "/path/to/file", true},
+}
+
+func TestURI_Init(t *testing.T) {
+	for _, tt := range uriTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var u URI
+			var err = u.Init(tt.raw)
+			if err != nil {
+				t.Fatalf("Init(%q) error = %v", tt.raw, err)
+			}
+			if u.URI() != tt.uri || u.Authority() != tt.authority || u.Path() != tt.path || u.IsLocal() != tt.local {
+				t.Errorf("Init(%q) = %q, %q, %q, %v\n\twant %q, %q, %q, %v", tt.raw,
+					u.URI(), u.Authority(), u.Path(), u.IsLocal(), tt.uri, tt.authority, tt.path, tt.local)
+			}
+
+			// Serialized form must parse to the same URI.
+			var again URI
+			again.Init(u.URI())
+			if again.URI() != u.URI() || again.Path() != u.Path() || again.Authority() != u.Authority() {
+				t.Errorf("round trip of %q = %q, %q", u.URI(), again.URI(), again.Path())
+			}
+		})
+	}
+}
+
+func TestURI_Init_error(t *testing.T) {
+	for _, raw := range []string{"", "file:", "file:path/to/file", "http://host/path", "file:///bad%2"} {
+		var u URI
+		if u.Init(raw) == nil {
+			t.Errorf("Init(%q) error = nil", raw)
+		}
+	}
+}
+
+func TestURI_name(t *testing.T) {
+	var u URI
+	u.Init("file:///www/main.min.js")
+	if u.Name() != "main.min.js" || u.Extension() != "js" || u.NameWithoutExtension() != "main.min" || u.IsDirectory() {
+		t.Errorf("Name() = %q, Extension() = %q, NameWithoutExtension() = %q", u.Name(), u.Extension(), u.NameWithoutExtension())
+	}
+	u.Rename("app.css")
+	if u.URI() != "file:///www/app.css" || u.Extension() != "css" {
+		t.Errorf("Rename() = %q, %q", u.URI(), u.Extension())
+	}
+	if u.DirectoryPath() != "/www/" {
+		t.Errorf("DirectoryPath() = %q", u.DirectoryPath())
+	}
+	u.Init("file:///www/.config/")
+	if u.Name() != ".config" || u.Extension() != "" || !u.IsDirectory() {
+		t.Errorf("directory Name() = %q, Extension() = %q", u.Name(), u.Extension())
+	}
+}
+
+func TestRemoveDotSegments(t *testing.T) {
+	var tests = map[string]string{
+		"/a/b/c/./../../g": "/a/g",
+		"/a/b/../c/":       "/a/c/",
+		"/a/b/..":          "/a/",
+		"/a/b/.":           "/a/b/",
+		"/../a":            "/a",
+		"/..":              "/",
+	}
+	for in, want := range tests {
+		if got := removeDotSegments(in); got != want {
+			t.Errorf("removeDotSegments(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package modules
+
+import (
+	cmd "libgo/command"
+	"libgo/detail"
+	"libgo/mediatype"
+	"libgo/protocol"
+	"libgo/service"
+)
+
+// command implement protocol.Command when embed to a command of this package that implements ServeCLA.
+// Its name and other details set in the locale files.
+type command struct {
+	cmd.Command
+	service.Service
+	detail.Details
+	mediatype.MT
+}
+
+func (c *command) init(mediaType string, parent protocol.Command, subCommands ...protocol.Command) (err protocol.Error) {
+	err = c.MT.Init(mediaType)
+	if err != nil {
+		return
+	}
+	err = c.Command.Init(parent, subCommands...)
+	return
+}
+
+//libgo:impl libgo/protocol.MediaType
+func (c *command) FileExtension() string               { return "" }
+func (c *command) Status() protocol.SoftwareStatus     { return protocol.Software_PreAlpha }
+func (c *command) ReferenceURI() string                { return "" }
+func (c *command) IssueDate() protocol.Time            { return nil }
+func (c *command) ExpiryDate() protocol.Time           { return nil }
+func (c *command) ExpireInFavorOf() protocol.MediaType { return nil }
+
+//libgo:impl libgo/protocol.Object
+func (c *command) Fields() []protocol.DataType         { return nil }
+func (c *command) Methods() []protocol.DataType_Method { return nil }
@@ -0,0 +1,18 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package modules
+
+import (
+	er "libgo/error"
+)
+
+// Errors
+var (
+	ErrStoragesNotSet er.Error
+	ErrFileNotOpen    er.Error
+)
+
+func init() {
+	ErrStoragesNotSet.Init("domain/libgo.scm.geniuses.group; type=error; package=modules; name=storages-not-set")
+	ErrFileNotOpen.Init("domain/libgo.scm.geniuses.group; type=error; package=modules; name=file-not-open")
+}
@@ -0,0 +1,38 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package modules
+
+import (
+	"strconv"
+
+	cmd "libgo/command"
+	"libgo/datatype"
+	"libgo/protocol"
+)
+
+// stringField is a string flag of a command. Its name and other details set in the locale files.
+type stringField struct {
+	datatype.DataType
+	value string
+}
+
+//libgo:impl libgo/protocol.Stringer
+func (f *stringField) ToString() string                         { return f.value }
+func (f *stringField) FromString(s string) (err protocol.Error) { f.value = s; return }
+
+// uint64Field is an unsigned integer flag of a command. Its name and other details set in the locale files.
+type uint64Field struct {
+	datatype.DataType
+	value uint64
+}
+
+//libgo:impl libgo/protocol.Stringer
+func (f *uint64Field) ToString() string { return strconv.FormatUint(f.value, 10) }
+func (f *uint64Field) FromString(s string) (err protocol.Error) {
+	var v, goErr = strconv.ParseUint(s, 10, 64)
+	if goErr != nil {
+		return &cmd.ErrFlagBadSyntax
+	}
+	f.value = v
+	return
+}
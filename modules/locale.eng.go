@@ -0,0 +1,117 @@
+//go:build lang_eng
+
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package modules
+
+import (
+	"libgo/detail"
+	"libgo/protocol"
+)
+
+const domainEnglish = "Modules"
+
+func init() {
+	RootCommand.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("libgo").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("libgo tool").
+		SetOverview("Tools to develop and manage apps made by libgo").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	StorageCommand.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("storage").
+		SetAbbreviation("stg").
+		SetAliases([]string{}).
+		SetSummary("Manage app storages").
+		SetOverview("Backup local storages of the app to a portable snapshot or restore them from it").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	StorageCommand.dump.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("dump").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Dump local storages to a snapshot").
+		SetOverview("Write key-values, objects, records with all retained versions and files of the local storages to a snapshot. Use -o to write to a file and -compress to compress it by a registered compress type.").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	StorageCommand.restore.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("restore").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Restore local storages from a snapshot").
+		SetOverview("Apply a snapshot on the local storages entry by entry. Use -i to read from a file and -skip to resume a failed restore.").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+
+	StorageCommand.dump.output.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("output").
+		SetAbbreviation("o").
+		SetAliases([]string{}).
+		SetSummary("Snapshot file path").
+		SetOverview("Write the snapshot to given file path. It writes to stdout if not set.").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	StorageCommand.dump.compress.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("compress").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Compress type").
+		SetOverview("Content encoding of a registered compress type e.g. gzip to compress the snapshot by it.").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	StorageCommand.restore.input.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("input").
+		SetAbbreviation("i").
+		SetAliases([]string{}).
+		SetSummary("Snapshot file path").
+		SetOverview("Read the snapshot from given file path. It reads from stdin if not set.").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	StorageCommand.restore.skip.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("skip").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Skip entries").
+		SetOverview("Number of entries that a failed restore returned to resume it.").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+
+	ErrStoragesNotSet.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Storages Not Set").
+		SetOverview("protocol.STG isn't assigned, so there is no storages to dump or restore").
+		SetUserNote("").
+		SetDevNote("Assign an object that implement protocol.Storages to protocol.STG in main.go").
+		SetTAGS([]string{}),
+	)
+	ErrFileNotOpen.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("File Not Open").
+		SetOverview("Given file path can't open or create").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+}
@@ -0,0 +1,31 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package modules
+
+import (
+	cmd "libgo/command"
+	"libgo/protocol"
+)
+
+// RootCommand is the libgo command that serve the libgo tool arguments.
+var RootCommand rootCommand
+
+type rootCommand struct {
+	command
+}
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (rc *rootCommand) Init() (err protocol.Error) {
+	err = StorageCommand.Init(rc)
+	if err != nil {
+		return
+	}
+	err = rc.init("domain/libgo.scm.geniuses.group; type=command; name=libgo", nil, &StorageCommand)
+	return
+}
+
+//libgo:impl libgo/protocol.CommandHandler
+func (rc *rootCommand) ServeCLA(arguments []string) (err protocol.Error) {
+	err = cmd.ServeCLA(rc, arguments)
+	return
+}
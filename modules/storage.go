@@ -0,0 +1,140 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package modules
+
+import (
+	"io"
+	"os"
+	"strconv"
+
+	cmd "libgo/command"
+	"libgo/log"
+	"libgo/protocol"
+	"libgo/storage"
+)
+
+// StorageCommand serve `libgo storage dump` and `libgo storage restore` on protocol.STG local storages.
+var StorageCommand storageCommand
+
+type storageCommand struct {
+	command
+	dump    storageDumpCommand
+	restore storageRestoreCommand
+}
+
+func (sc *storageCommand) Init(parent protocol.Command) (err protocol.Error) {
+	err = sc.dump.init("domain/libgo.scm.geniuses.group; type=command; name=storage-dump", sc)
+	if err != nil {
+		return
+	}
+	err = sc.restore.init("domain/libgo.scm.geniuses.group; type=command; name=storage-restore", sc)
+	if err != nil {
+		return
+	}
+	err = sc.init("domain/libgo.scm.geniuses.group; type=command; name=storage", parent, &sc.dump, &sc.restore)
+	return
+}
+
+//libgo:impl libgo/protocol.CommandHandler
+func (sc *storageCommand) ServeCLA(arguments []string) (err protocol.Error) {
+	err = cmd.ServeCLA(sc, arguments)
+	return
+}
+
+// storageDumpCommand write a storage.Snapshot of the local storages to a file or stdout.
+type storageDumpCommand struct {
+	command
+	output   stringField // snapshot file path, stdout if not set
+	compress stringField // content encoding of a registered compress type e.g. gzip
+}
+
+func (c *storageDumpCommand) Runnable() bool { return true }
+
+//libgo:impl libgo/protocol.Object
+func (c *storageDumpCommand) Fields() []protocol.DataType {
+	return []protocol.DataType{&c.output, &c.compress}
+}
+
+//libgo:impl libgo/protocol.CommandHandler
+func (c *storageDumpCommand) ServeCLA(arguments []string) (err protocol.Error) {
+	_, err = cmd.FromCLA(c, arguments)
+	if err != nil {
+		return
+	}
+	if protocol.STG == nil {
+		return &ErrStoragesNotSet
+	}
+
+	var s storage.Snapshot
+	if c.compress.value != "" {
+		s.CompressType, err = protocol.OS.GetCompressTypeByContentEncoding(c.compress.value)
+		if err != nil {
+			return
+		}
+		s.CompressOptions.CompressLevel = protocol.CompressLevel_Default
+	}
+
+	var w io.Writer = os.Stdout
+	if c.output.value != "" {
+		var f, goErr = os.Create(c.output.value)
+		if goErr != nil {
+			return &ErrFileNotOpen
+		}
+		defer f.Close()
+		w = f
+	}
+
+	var num uint64
+	num, err = s.Dump(protocol.STG, w)
+	if err != nil {
+		log.Warn(c, "dump failed after "+strconv.FormatUint(num, 10)+" entries")
+		return
+	}
+	log.Info(c, "dumped "+strconv.FormatUint(num, 10)+" entries")
+	return
+}
+
+// storageRestoreCommand apply a storage.Snapshot from a file or stdin on the local storages.
+type storageRestoreCommand struct {
+	command
+	input stringField // snapshot file path, stdin if not set
+	skip  uint64Field // number of entries restored by a failed restore to resume it
+}
+
+func (c *storageRestoreCommand) Runnable() bool { return true }
+
+//libgo:impl libgo/protocol.Object
+func (c *storageRestoreCommand) Fields() []protocol.DataType {
+	return []protocol.DataType{&c.input, &c.skip}
+}
+
+//libgo:impl libgo/protocol.CommandHandler
+func (c *storageRestoreCommand) ServeCLA(arguments []string) (err protocol.Error) {
+	_, err = cmd.FromCLA(c, arguments)
+	if err != nil {
+		return
+	}
+	if protocol.STG == nil {
+		return &ErrStoragesNotSet
+	}
+
+	var r io.Reader = os.Stdin
+	if c.input.value != "" {
+		var f, goErr = os.Open(c.input.value)
+		if goErr != nil {
+			return &ErrFileNotOpen
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var s storage.Snapshot
+	var num uint64
+	num, err = s.Restore(protocol.STG, r, c.skip.value)
+	if err != nil {
+		log.Warn(c, "restore failed, resume it by: "+cmd.CommandPath(c)+" -i <snapshot> -skip "+strconv.FormatUint(num, 10))
+		return
+	}
+	log.Info(c, "restored "+strconv.FormatUint(num-c.skip.value, 10)+" entries")
+	return
+}
@@ -0,0 +1,223 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+import (
+	"libgo/protocol"
+	"libgo/time/monotonic"
+	"libgo/timer"
+)
+
+// bbr implement BBR v1 congestion control that model the path by its bottleneck bandwidth (max delivery rate)
+// and round-trip propagation time (min RTT), and pace the stream at the bandwidth with about one BDP in flight.
+// It estimates the delivery rate once per round trip from the acknowledged bytes, not per segment.
+// https://datatracker.ietf.org/doc/html/draft-cardwell-iccrg-bbr-congestion-control-00
+type bbr struct {
+	mss        uint32
+	mode       bbrMode
+	cwnd       uint32
+	priorCwnd  uint32 // cwnd before ProbeRTT or RTO, to restore it
+	pacingGain float64
+	cwndGain   float64
+
+	// Bottleneck bandwidth max filter over last bbr_BtlBwFilterRounds rounds
+	btlBwSamples [bbr_BtlBwFilterRounds]uint64
+	btlBw        uint64 // bytes per second
+
+	// Round-trip propagation time min filter over last bbr_RTpropFilter
+	rtProp      protocol.Duration
+	rtPropStamp monotonic.Time
+
+	// Round trip counting
+	delivered           uint64 // bytes acknowledged from stream start
+	round               uint64
+	roundStart          monotonic.Time
+	roundStartDelivered uint64
+	nextRoundDelivered  uint64
+
+	// Full pipe detection in Startup
+	fullBw      uint64
+	fullBwCount int
+	filledPipe  bool
+
+	cycleIndex   int
+	cycleStamp   monotonic.Time
+	probeRTTDone monotonic.Time // 0 means ProbeRTT wait for inFlight to drain
+}
+
+type bbrMode uint8
+
+const (
+	bbrMode_Startup bbrMode = iota
+	bbrMode_Drain
+	bbrMode_ProbeBW
+	bbrMode_ProbeRTT
+)
+
+const (
+	bbr_HighGain           = 2.885 // 2/ln(2), the min gain that double the delivery rate each round
+	bbr_BtlBwFilterRounds  = 10
+	bbr_RTpropFilter       = 10 * timer.Second
+	bbr_ProbeRTTDuration   = 200 * timer.Millisecond
+	bbr_MinPipeSegments    = 4
+	bbr_FullBwGrowth       = 1.25
+	bbr_FullBwRounds       = 3
+	bbr_CwndQuantaSegments = 3 // Headroom of cwnd for delayed and stretched ACKs
+)
+
+var bbr_PacingGainCycle = [...]float64{1.25, 0.75, 1, 1, 1, 1, 1, 1}
+
+//libgo:impl libgo/net/tcp.CongestionController
+func (b *bbr) Init(mss uint32, now monotonic.Time) {
+	*b = bbr{
+		mss:         mss,
+		cwnd:        initialWindow(mss),
+		rtPropStamp: now,
+		roundStart:  now,
+	}
+	b.enterStartup()
+}
+func (b *bbr) CongestionWindow() uint32 { return b.cwnd }
+func (b *bbr) PacingRate() uint64 {
+	// No pacing until the first bandwidth sample.
+	return uint64(b.pacingGain * float64(b.btlBw))
+}
+func (b *bbr) OnACK(acked, inFlight uint32, recovery bool, now monotonic.Time) {
+	b.delivered += uint64(acked)
+	if b.delivered >= b.nextRoundDelivered {
+		b.endRound(inFlight, now)
+	}
+
+	switch b.mode {
+	case bbrMode_Startup:
+		if b.filledPipe {
+			b.mode = bbrMode_Drain
+			b.pacingGain = 1 / bbr_HighGain
+			b.cwndGain = bbr_HighGain
+		}
+	case bbrMode_ProbeBW:
+		if protocol.Duration(now-b.cycleStamp) > b.rtProp {
+			b.cycleIndex = (b.cycleIndex + 1) % len(bbr_PacingGainCycle)
+			b.cycleStamp = now
+			b.pacingGain = bbr_PacingGainCycle[b.cycleIndex]
+		}
+	case bbrMode_ProbeRTT:
+		if b.probeRTTDone == 0 {
+			if inFlight <= bbr_MinPipeSegments*b.mss {
+				b.probeRTTDone = now
+				b.probeRTTDone.Add(bbr_ProbeRTTDuration)
+			}
+		} else if now.Pass(b.probeRTTDone) {
+			b.rtPropStamp = now
+			if b.cwnd < b.priorCwnd {
+				b.cwnd = b.priorCwnd
+			}
+			if b.filledPipe {
+				b.enterProbeBW(now)
+			} else {
+				b.enterStartup()
+			}
+		}
+	}
+	if b.mode == bbrMode_Drain && inFlight <= b.bdp(1) {
+		b.enterProbeBW(now)
+	}
+
+	b.setCwnd(acked)
+}
+func (b *bbr) OnRTTSample(rtt protocol.Duration, now monotonic.Time) {
+	var expired = protocol.Duration(now-b.rtPropStamp) > bbr_RTpropFilter
+	if b.rtProp == 0 || rtt <= b.rtProp || expired {
+		b.rtProp = rtt
+		b.rtPropStamp = now
+	}
+	if expired && b.mode != bbrMode_ProbeRTT {
+		b.mode = bbrMode_ProbeRTT
+		b.pacingGain = 1
+		b.cwndGain = 1
+		b.priorCwnd = b.cwnd
+		b.probeRTTDone = 0
+	}
+}
+func (b *bbr) OnLoss(inFlight uint32, timeout bool, now monotonic.Time) {
+	// BBR doesn't take losses as congestion signal, but after RTO all in flight data count as lost,
+	// so it start again from one segment and grow back to the model cwnd.
+	if timeout {
+		b.priorCwnd = b.cwnd
+		b.cwnd = b.mss
+	}
+}
+
+// endRound update the bandwidth filter by the delivery rate of the ended round and start a new round.
+func (b *bbr) endRound(inFlight uint32, now monotonic.Time) {
+	var interval = protocol.Duration(now - b.roundStart)
+	if interval > 0 {
+		var rate = (b.delivered - b.roundStartDelivered) * uint64(timer.Second) / uint64(interval)
+		b.btlBwSamples[b.round%bbr_BtlBwFilterRounds] = rate
+		b.btlBw = 0
+		for _, sample := range b.btlBwSamples {
+			if sample > b.btlBw {
+				b.btlBw = sample
+			}
+		}
+	}
+	b.round++
+	b.roundStart = now
+	b.roundStartDelivered = b.delivered
+	b.nextRoundDelivered = b.delivered + uint64(inFlight)
+
+	if !b.filledPipe {
+		if float64(b.btlBw) >= float64(b.fullBw)*bbr_FullBwGrowth {
+			b.fullBw = b.btlBw
+			b.fullBwCount = 0
+		} else {
+			b.fullBwCount++
+			b.filledPipe = b.fullBwCount >= bbr_FullBwRounds
+		}
+	}
+	// Clear the sample of the next round that is bbr_BtlBwFilterRounds old now.
+	b.btlBwSamples[b.round%bbr_BtlBwFilterRounds] = 0
+}
+
+func (b *bbr) enterStartup() {
+	b.mode = bbrMode_Startup
+	b.pacingGain = bbr_HighGain
+	b.cwndGain = bbr_HighGain
+}
+
+func (b *bbr) enterProbeBW(now monotonic.Time) {
+	b.mode = bbrMode_ProbeBW
+	b.cwndGain = 2
+	// The draft start the cycle at a random phase except the 0.75 one, a fixed phase just after it is enough.
+	b.cycleIndex = 2
+	b.cycleStamp = now
+	b.pacingGain = bbr_PacingGainCycle[b.cycleIndex]
+}
+
+// bdp return the bandwidth-delay product multiply by gain in bytes. It returns the initial window without a model.
+func (b *bbr) bdp(gain float64) uint32 {
+	if b.btlBw == 0 || b.rtProp == 0 {
+		return initialWindow(b.mss)
+	}
+	return uint32(gain * float64(b.btlBw) * float64(b.rtProp) / float64(timer.Second))
+}
+
+func (b *bbr) setCwnd(acked uint32) {
+	if b.mode == bbrMode_ProbeRTT {
+		b.cwnd = bbr_MinPipeSegments * b.mss
+		return
+	}
+	var target = b.bdp(b.cwndGain) + bbr_CwndQuantaSegments*b.mss
+	if b.filledPipe {
+		if b.cwnd+acked < target {
+			b.cwnd += acked
+		} else {
+			b.cwnd = target
+		}
+	} else if b.cwnd < target || b.delivered < uint64(initialWindow(b.mss)) {
+		b.cwnd += acked
+	}
+	if b.cwnd < bbr_MinPipeSegments*b.mss {
+		b.cwnd = bbr_MinPipeSegments * b.mss
+	}
+}
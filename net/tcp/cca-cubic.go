@@ -0,0 +1,109 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+import (
+	"math"
+
+	"libgo/protocol"
+	"libgo/time/monotonic"
+	"libgo/timer"
+)
+
+// cubic implement CUBIC congestion control that grow the window by a cubic function of the time since last
+// congestion event, so it is independent of RTT and scale well on long fat networks.
+// https://www.rfc-editor.org/rfc/rfc8312
+type cubic struct {
+	mss      float64
+	cwnd     float64 // bytes
+	ssthresh float64 // bytes
+
+	wMax       float64        // segments, window before last reduction
+	wLastMax   float64        // segments, wMax before last reduction for fast convergence
+	k          float64        // seconds, time to reach wMax again
+	wEst       float64        // segments, estimated window of standard TCP for TCP-friendly region
+	epochStart monotonic.Time // 0 means a new congestion avoidance epoch must start
+	minRTT     protocol.Duration
+}
+
+const (
+	cubic_C    = 0.4
+	cubic_Beta = 0.7
+	// alpha of the AIMD in TCP-friendly region to achieve the same average window of standard TCP.
+	cubic_AlphaAIMD = 3 * (1 - cubic_Beta) / (1 + cubic_Beta)
+)
+
+//libgo:impl libgo/net/tcp.CongestionController
+func (c *cubic) Init(mss uint32, now monotonic.Time) {
+	*c = cubic{
+		mss:      float64(mss),
+		cwnd:     float64(initialWindow(mss)),
+		ssthresh: math.MaxUint32,
+	}
+}
+func (c *cubic) CongestionWindow() uint32 { return uint32(c.cwnd) }
+func (c *cubic) PacingRate() uint64       { return 0 }
+func (c *cubic) OnACK(acked, inFlight uint32, recovery bool, now monotonic.Time) {
+	if recovery {
+		return
+	}
+	if c.cwnd < c.ssthresh {
+		c.cwnd += math.Min(float64(acked), c.mss)
+		return
+	}
+
+	var cwnd = c.cwnd / c.mss
+	if c.epochStart == 0 {
+		c.epochStart = now
+		if c.wMax <= cwnd {
+			c.k = 0
+			c.wMax = cwnd
+		} else {
+			c.k = math.Cbrt((c.wMax - cwnd) / cubic_C)
+		}
+		c.wEst = cwnd
+	}
+
+	var t = seconds(protocol.Duration(now - c.epochStart))
+	var target = cubic_C*math.Pow(t+seconds(c.minRTT)-c.k, 3) + c.wMax
+	// Don't grow more than 50% per RTT.
+	if target > 1.5*cwnd {
+		target = 1.5 * cwnd
+	}
+
+	var ackedSegments = float64(acked) / c.mss
+	c.wEst += cubic_AlphaAIMD * ackedSegments / cwnd
+	if c.wEst > target {
+		// TCP-friendly region
+		target = c.wEst
+	}
+	if target > cwnd {
+		c.cwnd += c.mss * (target - cwnd) / cwnd * ackedSegments
+	}
+}
+func (c *cubic) OnRTTSample(rtt protocol.Duration, now monotonic.Time) {
+	if c.minRTT == 0 || rtt < c.minRTT {
+		c.minRTT = rtt
+	}
+}
+func (c *cubic) OnLoss(inFlight uint32, timeout bool, now monotonic.Time) {
+	var cwnd = c.cwnd / c.mss
+	// Fast convergence release bandwidth for new flows when the window shrink.
+	if cwnd < c.wLastMax {
+		c.wLastMax = cwnd
+		c.wMax = cwnd * (1 + cubic_Beta) / 2
+	} else {
+		c.wLastMax = cwnd
+		c.wMax = cwnd
+	}
+	c.epochStart = 0
+
+	c.ssthresh = math.Max(c.cwnd*cubic_Beta, 2*c.mss)
+	if timeout {
+		c.cwnd = c.mss
+	} else {
+		c.cwnd = c.ssthresh
+	}
+}
+
+func seconds(d protocol.Duration) float64 { return float64(d) / float64(timer.Second) }
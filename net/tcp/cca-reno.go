@@ -0,0 +1,63 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+import (
+	"libgo/protocol"
+	"libgo/time/monotonic"
+)
+
+// reno implement NewReno congestion control: slow start, congestion avoidance and multiplicative decrease on loss.
+// The NewReno part (retransmit on partial ACKs in fast recovery) do by the stream itself.
+// https://www.rfc-editor.org/rfc/rfc5681
+// https://www.rfc-editor.org/rfc/rfc6582
+type reno struct {
+	mss      uint32
+	cwnd     uint32
+	ssthresh uint32
+	acked    uint32 // bytes acknowledged in congestion avoidance since last cwnd increase
+}
+
+//libgo:impl libgo/net/tcp.CongestionController
+func (r *reno) Init(mss uint32, now monotonic.Time) {
+	r.mss = mss
+	r.cwnd = initialWindow(mss)
+	r.ssthresh = ^uint32(0)
+	r.acked = 0
+}
+func (r *reno) CongestionWindow() uint32 { return r.cwnd }
+func (r *reno) PacingRate() uint64       { return 0 }
+func (r *reno) OnACK(acked, inFlight uint32, recovery bool, now monotonic.Time) {
+	if recovery {
+		return
+	}
+	if r.cwnd < r.ssthresh {
+		// Slow start, RFC 3465 appropriate byte counting with L = 1*SMSS
+		if acked > r.mss {
+			acked = r.mss
+		}
+		r.cwnd += acked
+		return
+	}
+	// Congestion avoidance, increase cwnd by one SMSS per RTT.
+	r.acked += acked
+	if r.acked >= r.cwnd {
+		r.acked -= r.cwnd
+		r.cwnd += r.mss
+	}
+}
+func (r *reno) OnRTTSample(rtt protocol.Duration, now monotonic.Time) {}
+func (r *reno) OnLoss(inFlight uint32, timeout bool, now monotonic.Time) {
+	// ssthresh = max(FlightSize / 2, 2*SMSS)
+	r.ssthresh = inFlight / 2
+	if r.ssthresh < 2*r.mss {
+		r.ssthresh = 2 * r.mss
+	}
+	r.acked = 0
+	if timeout {
+		// Loss window
+		r.cwnd = r.mss
+	} else {
+		r.cwnd = r.ssthresh
+	}
+}
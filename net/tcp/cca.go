@@ -2,6 +2,11 @@
 
 package tcp
 
+import (
+	"libgo/protocol"
+	"libgo/time/monotonic"
+)
+
 // CCA or CongestionControlAlgorithm
 // https://en.wikipedia.org/wiki/TCP_congestion_control
 type CCA uint8
@@ -23,3 +28,54 @@ const (
 	// congestion windows, binary search increase provides TCP friendliness.
 	CongestionControlAlgorithm_BIC
 )
+
+// CongestionController is a congestion-control algorithm that limit how much and how fast a stream
+// send data into the network. Stream call its methods just under the stream lock, so it doesn't need any lock.
+// Stream detect losses (fast retransmit and RTO) and do the retransmissions itself, so algorithms just
+// decide about the window and the pacing rate.
+type CongestionController interface {
+	// Init reset the algorithm state for a new stream. mss is the max segment size in bytes.
+	Init(mss uint32, now monotonic.Time)
+
+	// CongestionWindow return the max bytes that can be in flight (sent but not acknowledged).
+	CongestionWindow() uint32
+	// PacingRate return the max bytes per second that stream can send. Zero means no pacing.
+	PacingRate() uint64
+
+	// OnACK call when an ACK acknowledge new data. acked is the newly acknowledged bytes and
+	// inFlight is the bytes still in flight after it. recovery is true if the stream is in loss recovery.
+	OnACK(acked, inFlight uint32, recovery bool, now monotonic.Time)
+	// OnRTTSample call for each valid round-trip time measurement.
+	OnRTTSample(rtt protocol.Duration, now monotonic.Time)
+	// OnLoss call once for each loss event. timeout is true if the loss detected by RTO expiry,
+	// otherwise it detected by duplicate ACKs or SACK and fast recovery started.
+	OnLoss(inFlight uint32, timeout bool, now monotonic.Time)
+}
+
+// NewCongestionController return a new instance of the algorithm. It must pass to Stream.SetCongestionController().
+func NewCongestionController(cca CCA) (cc CongestionController, err protocol.Error) {
+	switch cca {
+	case CongestionControlAlgorithm_Reno:
+		cc = &reno{}
+	case CongestionControlAlgorithm_CUBIC:
+		cc = &cubic{}
+	case CongestionControlAlgorithm_BBR:
+		cc = &bbr{}
+	default:
+		err = &ErrCCANotSupported
+	}
+	return
+}
+
+// initialWindow return the initial congestion window as RFC 6928 says.
+func initialWindow(mss uint32) (iw uint32) {
+	iw = 10 * mss
+	var limit uint32 = 14600
+	if 2*mss > limit {
+		limit = 2 * mss
+	}
+	if iw > limit {
+		iw = limit
+	}
+	return
+}
@@ -0,0 +1,148 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+import (
+	"testing"
+
+	"libgo/time/monotonic"
+	"libgo/timer"
+)
+
+var (
+	_ CongestionController = &reno{}
+	_ CongestionController = &cubic{}
+	_ CongestionController = &bbr{}
+)
+
+func TestReno(t *testing.T) {
+	var r reno
+	r.Init(1000, 0)
+	if r.CongestionWindow() != 10000 {
+		t.Fatalf("initial CongestionWindow() = %v, want 10000", r.CongestionWindow())
+	}
+
+	// Slow start count at most one MSS per ACK.
+	r.OnACK(3000, 0, false, 0)
+	if r.CongestionWindow() != 11000 {
+		t.Errorf("slow start CongestionWindow() = %v, want 11000", r.CongestionWindow())
+	}
+
+	r.OnLoss(11000, false, 0)
+	if r.CongestionWindow() != 5500 || r.ssthresh != 5500 {
+		t.Errorf("OnLoss() cwnd, ssthresh = %v, %v, want 5500, 5500", r.CongestionWindow(), r.ssthresh)
+	}
+	r.OnACK(5500, 0, true, 0)
+	if r.CongestionWindow() != 5500 {
+		t.Errorf("CongestionWindow() grow in recovery = %v, want 5500", r.CongestionWindow())
+	}
+	// Congestion avoidance grow one MSS for each cwnd acknowledged bytes.
+	r.OnACK(3000, 0, false, 0)
+	r.OnACK(3000, 0, false, 0)
+	if r.CongestionWindow() != 6500 {
+		t.Errorf("congestion avoidance CongestionWindow() = %v, want 6500", r.CongestionWindow())
+	}
+
+	r.OnLoss(1000, true, 0)
+	if r.CongestionWindow() != 1000 || r.ssthresh != 2000 {
+		t.Errorf("RTO OnLoss() cwnd, ssthresh = %v, %v, want 1000, 2000", r.CongestionWindow(), r.ssthresh)
+	}
+}
+
+func TestCUBIC(t *testing.T) {
+	const rtt = 100 * timer.Millisecond
+	var c cubic
+	var now monotonic.Time
+	c.Init(1000, now)
+	c.OnRTTSample(rtt, now)
+
+	c.OnLoss(10000, false, now)
+	if c.CongestionWindow() != 7000 || c.wMax != 10 {
+		t.Fatalf("OnLoss() cwnd, wMax = %v, %v, want 7000, 10", c.CongestionWindow(), c.wMax)
+	}
+
+	var last = c.CongestionWindow()
+	for i := 0; i < 50; i++ {
+		now.Add(rtt)
+		c.OnACK(c.CongestionWindow(), 0, false, now)
+		if c.CongestionWindow() < last {
+			t.Fatalf("CongestionWindow() decreased from %v to %v", last, c.CongestionWindow())
+		}
+		last = c.CongestionWindow()
+	}
+	if last <= 10000 {
+		t.Errorf("CongestionWindow() after 5s = %v, want more than wMax", last)
+	}
+	var k = c.k
+	if k < 1.95 || k > 1.96 {
+		// cbrt(10 * 0.3 / 0.4)
+		t.Errorf("K = %v, want 1.957", k)
+	}
+
+	// Fast convergence
+	c.OnLoss(last, false, now)
+	c.wLastMax = 1 << 20
+	var cwnd = float64(c.CongestionWindow()) / 1000
+	c.OnLoss(c.CongestionWindow(), false, now)
+	if want := cwnd * (1 + cubic_Beta) / 2; c.wMax < want-0.001 || c.wMax > want+0.001 {
+		t.Errorf("fast convergence wMax = %v, want %v", c.wMax, want)
+	}
+
+	c.OnLoss(c.CongestionWindow(), true, now)
+	if c.CongestionWindow() != 1000 {
+		t.Errorf("RTO OnLoss() CongestionWindow() = %v, want 1000", c.CongestionWindow())
+	}
+}
+
+func TestBBR(t *testing.T) {
+	// A path with 1MB/s bottleneck and 100ms RTT, so the BDP is 100KB.
+	const (
+		rtt = 100 * timer.Millisecond
+		bdp = 100000
+	)
+	var b bbr
+	var now monotonic.Time
+	b.Init(1000, now)
+	if b.mode != bbrMode_Startup || b.PacingRate() != 0 {
+		t.Fatalf("Init() mode, PacingRate() = %v, %v, want Startup, 0", b.mode, b.PacingRate())
+	}
+
+	for i := 0; i < 30; i++ {
+		now.Add(rtt)
+		var acked = b.CongestionWindow()
+		if acked > bdp {
+			acked = bdp
+		}
+		b.OnRTTSample(rtt, now)
+		b.OnACK(acked, acked, false, now)
+	}
+	if b.mode != bbrMode_ProbeBW || !b.filledPipe {
+		t.Fatalf("mode, filledPipe = %v, %v, want ProbeBW, true", b.mode, b.filledPipe)
+	}
+	if b.btlBw != 1000000 {
+		t.Errorf("btlBw = %v, want 1000000", b.btlBw)
+	}
+	if rate := b.PacingRate(); rate < 750000 || rate > 1250000 {
+		t.Errorf("PacingRate() = %v, want about 1000000", rate)
+	}
+	// 2*BDP and the quanta
+	if b.CongestionWindow() != 2*bdp+3000 {
+		t.Errorf("CongestionWindow() = %v, want %v", b.CongestionWindow(), 2*bdp+3000)
+	}
+
+	// RTprop not seen again for 10s
+	now.Add(bbr_RTpropFilter + 1)
+	b.OnRTTSample(2*rtt, now)
+	if b.mode != bbrMode_ProbeRTT {
+		t.Fatalf("mode after RTprop expired = %v, want ProbeRTT", b.mode)
+	}
+	b.OnACK(1000, 1000, false, now)
+	if b.CongestionWindow() != bbr_MinPipeSegments*1000 {
+		t.Errorf("ProbeRTT CongestionWindow() = %v, want %v", b.CongestionWindow(), bbr_MinPipeSegments*1000)
+	}
+	now.Add(bbr_ProbeRTTDuration + 1)
+	b.OnACK(1000, 1000, false, now)
+	if b.mode != bbrMode_ProbeBW || b.CongestionWindow() < bdp {
+		t.Errorf("after ProbeRTT mode, CongestionWindow() = %v, %v, want ProbeBW and restored cwnd", b.mode, b.CongestionWindow())
+	}
+}
@@ -68,6 +68,9 @@ const (
 const (
 	// default congestion-control algorithm to be used for new tcp sockets
 	CNF_CongestionControlAlgorithm = CongestionControlAlgorithm_Reno
+	// The number of duplicate ACKs that start fast retransmit and fast recovery.
+	// https://www.rfc-editor.org/rfc/rfc5681#section-3.2
+	CNF_DupACKThreshold = 3
 
 	// When enabled, connectivity to some destinations could be
 	// affected due to older, misbehaving middle boxes along the
@@ -150,6 +153,10 @@ const (
 	// close the socket immediately without waiting for the end
 	// of the TIME_WAIT period.
 	CNF_Timeout_RFC1337 = false
+	// MSL or Maximum Segment Lifetime is the time a segment can exist in the network.
+	// A stream stay in TIME_WAIT state for 2*MSL to be sure the peer received the ACK of its FIN
+	// and any delayed segment of the stream dropped from the network.
+	CNF_Timeout_MSL = 30 * timer.Second
 
 	// The maximum number of sockets in TIME_WAIT state allowed
 	// in the system.  This limit exists only to prevent simple
@@ -181,6 +188,23 @@ const (
 	CNF_Timeout_Linger = -1
 )
 
+// Retransmission config values
+// https://www.rfc-editor.org/rfc/rfc6298
+const (
+	// The RTO before any round-trip time measured.
+	CNF_RTO_Initial = 1 * timer.Second
+	// RFC 6298 suggest 1 second as the minimum RTO, but like Linux use 200 milliseconds
+	// to recover faster on low latency networks.
+	CNF_RTO_Min = 200 * timer.Millisecond
+	// The maximum RTO that exponential backoff can reach. It must be at least 60 seconds.
+	CNF_RTO_Max = 120 * timer.Second
+	// The granularity of the clock that measure round-trip times.
+	CNF_RTO_ClockGranularity = 1 * timer.Millisecond
+	// The maximum number of times the RTO expired for a segment before the stream reset.
+	// The default value of 15 is like Linux tcp_retries2 that corresponds to approximately 15 minutes.
+	CNF_RTO_Retries = 15
+)
+
 // FIN config values
 const (
 	// This specifies how many seconds to wait for a final FIN
@@ -193,6 +217,22 @@ const (
 	CNF_FinTimeout = 60 * timer.Second
 )
 
+// Window config values
+const (
+	// The receive window advertise to the peer in each segment.
+	// Windows larger than 65535 need window scaling and advertise just 65535 if the peer doesn't support it.
+	CNF_ReceiveWindow uint32 = 1 << 20
+)
+
+// TCP Extensions for High Performance config values
+// https://www.rfc-editor.org/rfc/rfc7323
+const (
+	// Enable RFC 7323 window scaling to advertise windows larger than 64KB.
+	CNF_WindowScale = true
+	// Enable RFC 7323 timestamps for round-trip time measurement and protection against wrapped sequences.
+	CNF_Timestamps = true
+)
+
 // segment config values
 const (
 	CNF_Segment_MinSize = 20 // 5words * 4bit
@@ -10,9 +10,21 @@ import (
 var (
 	ErrSegmentTooShort    er.Error
 	ErrSegmentWrongLength er.Error
+
+	ErrNoSender      er.Error
+	ErrStreamClosing er.Error
+	ErrStreamReset   er.Error
+
+	ErrCCANotSupported er.Error
 )
 
 func init() {
 	ErrSegmentTooShort.Init("domain/tcp.protocol; type=error; name=packet-too-short")
 	ErrSegmentWrongLength.Init("domain/tcp.protocol; type=error; name=packet-wrong-length")
+
+	ErrNoSender.Init("domain/tcp.protocol; type=error; name=no-sender")
+	ErrStreamClosing.Init("domain/tcp.protocol; type=error; name=stream-closing")
+	ErrStreamReset.Init("domain/tcp.protocol; type=error; name=stream-reset")
+
+	ErrCCANotSupported.Init("domain/tcp.protocol; type=error; name=congestion-control-algorithm-not-supported")
 }
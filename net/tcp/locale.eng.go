@@ -23,4 +23,30 @@ func init() {
 		"",
 		"",
 		nil)
+
+	ErrNoSender.SetDetail(protocol.LanguageEnglish, domainEnglish,
+		"No Sender",
+		"Stream has no lower layer to send its segments",
+		"",
+		"Call SetSender() before use the stream",
+		nil)
+	ErrStreamClosing.SetDetail(protocol.LanguageEnglish, domainEnglish,
+		"Stream Closing",
+		"Stream closed by the local user before and can't send anymore",
+		"",
+		"",
+		nil)
+	ErrStreamReset.SetDetail(protocol.LanguageEnglish, domainEnglish,
+		"Stream Reset",
+		"Stream aborted by a reset from the peer or the local side",
+		"",
+		"",
+		nil)
+
+	ErrCCANotSupported.SetDetail(protocol.LanguageEnglish, domainEnglish,
+		"Congestion Control Algorithm Not Supported",
+		"Requested congestion control algorithm not implemented yet",
+		"",
+		"Use one of Reno, CUBIC or BBR algorithms or implement CongestionController yourself",
+		nil)
 }
@@ -2,5 +2,57 @@
 
 package tcp
 
+import (
+	"libgo/binary"
+	"libgo/protocol"
+)
+
 // TCP Selective Acknowledgment Options
 // https://datatracker.ietf.org/doc/html/rfc2018
+/*
+	type optionSACK struct {
+		Length byte
+		Blocks []struct {
+			LeftEdge  uint32 // first sequence number of the block
+			RightEdge uint32 // sequence number immediately following the last sequence number of the block
+		}
+	}
+*/
+type optionSACK []byte
+
+func (o optionSACK) Length() byte { return o[0] }
+func (o optionSACK) Blocks() int  { return int(o[0]-2) / 8 }
+func (o optionSACK) Block(i int) (block sackBlock) {
+	block.left = binary.BigEndian(o[1+i*8:]).Uint32()
+	block.right = binary.BigEndian(o[5+i*8:]).Uint32()
+	return
+}
+func (o optionSACK) NextOption() []byte { return o[o[0]-1:] }
+
+// Process mark the reported blocks in the retransmission queue as the RFC 6675 scoreboard.
+func (o optionSACK) Process(s *Stream) (err protocol.Error) {
+	if !s.sack.permitted {
+		return
+	}
+	for i := 0; i < o.Blocks(); i++ {
+		var block = o.Block(i)
+		// Ignore D-SACK and bogus blocks.
+		if seqLEQ(block.right, block.left) || seqLEQ(block.right, s.send.una) || seqGT(block.right, s.send.next) {
+			continue
+		}
+		s.sack.sacked += s.send.queue.SACK(block.left, block.right)
+	}
+	return
+}
+
+// appendSACK append the blocks as SACK option aligned to 4 bytes by two leading NOP.
+func appendSACK(b []byte, blocks []sackBlock) []byte {
+	b = append(b, byte(OptionKind_Nop), byte(OptionKind_Nop), byte(OptionKind_SACK), byte(2+8*len(blocks)))
+	for _, block := range blocks {
+		var ln = len(b)
+		b = append(b, make([]byte, 8)...)
+		binary.BigEndian(b[ln:]).PutUint32(block.left)
+		binary.BigEndian(b[ln+4:]).PutUint32(block.right)
+	}
+	return b
+}
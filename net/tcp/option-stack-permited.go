@@ -13,6 +13,16 @@ func (o optionSACKPermitted) Length() byte { return o[0] }
 // func (o optionSACKPermitted) SACKPermitted() uint16 { return binary.BigEndian.Uint16(o[1:]) }
 func (o optionSACKPermitted) NextOption() []byte { return o[1:] }
 
+// Process enable SACK if we support it too. It is valid just in a SYN, so it ignores out of the handshake.
 func (o optionSACKPermitted) Process(s *Stream) (err protocol.Error) {
+	var ss = s.status.Load()
+	if ss == StreamStatus_Listen || ss == StreamStatus_SynSent {
+		s.sack.permitted = CNF_Sack
+	}
 	return
 }
+
+// appendSACKPermitted append SACK-permitted option aligned to 4 bytes by two leading NOP.
+func appendSACKPermitted(b []byte) []byte {
+	return append(b, byte(OptionKind_Nop), byte(OptionKind_Nop), byte(OptionKind_SACKPermitted), 2)
+}
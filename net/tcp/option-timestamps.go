@@ -5,14 +5,46 @@ package tcp
 import (
 	"libgo/binary"
 	"libgo/protocol"
+	"libgo/time/monotonic"
 )
 
+/*
+	type optionTimestamps struct {
+		Length byte
+		TSval  uint32 // timestamp value of the sender clock
+		TSecr  uint32 // timestamp echo reply, the recent TSval received from the peer
+	}
+*/
 type optionTimestamps []byte
 
 func (o optionTimestamps) Length() byte       { return o[0] }
-func (o optionTimestamps) Timestamps() uint16 { return binary.BigEndian.Uint16(o[1:]) }
-func (o optionTimestamps) NextOption() []byte { return o[8:] }
+func (o optionTimestamps) TSval() uint32      { return binary.BigEndian(o[1:]).Uint32() }
+func (o optionTimestamps) TSecr() uint32      { return binary.BigEndian(o[5:]).Uint32() }
+func (o optionTimestamps) NextOption() []byte { return o[9:] }
 
+// Process keep the timestamps of the processing segment, and enable timestamps if it is in the handshake
+// and we support it too.
 func (o optionTimestamps) Process(s *Stream) (err protocol.Error) {
+	var ss = s.status.Load()
+	if ss == StreamStatus_Listen || ss == StreamStatus_SynSent {
+		if !CNF_Timestamps {
+			return
+		}
+		s.ts.enabled = true
+		s.ts.recent = o.TSval()
+		s.ts.recentAge = monotonic.Now()
+	}
+	s.ts.received = true
+	s.ts.val = o.TSval()
+	s.ts.ecr = o.TSecr()
 	return
 }
+
+// appendTimestamps append timestamps option aligned to 4 bytes by two leading NOP.
+func appendTimestamps(b []byte, val, ecr uint32) []byte {
+	var ln = len(b)
+	b = append(b, byte(OptionKind_Nop), byte(OptionKind_Nop), byte(OptionKind_Timestamps), 10, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian(b[ln+4:]).PutUint32(val)
+	binary.BigEndian(b[ln+8:]).PutUint32(ecr)
+	return b
+}
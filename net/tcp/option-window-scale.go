@@ -3,17 +3,38 @@
 package tcp
 
 import (
-	"libgo/binary"
 	"libgo/protocol"
 )
 
+/*
+	type optionWindowScale struct {
+		Length      byte
+		WindowScale uint8 // shift count
+	}
+*/
 type optionWindowScale []byte
 
-func (o optionWindowScale) Length() byte        { return o[0] }
-func (o optionWindowScale) WindowScale() uint16 { return binary.BigEndian.Uint16(o[1:]) }
-func (o optionWindowScale) NextOption() []byte  { return o[2:] }
+func (o optionWindowScale) Length() byte       { return o[0] }
+func (o optionWindowScale) WindowScale() uint8 { return o[1] }
+func (o optionWindowScale) NextOption() []byte { return o[2:] }
 
-// handler options -> stream
+// Process enable window scaling if we support it too. It is valid just in a SYN, so it ignores out of the handshake.
 func (o optionWindowScale) Process(s *Stream) (err protocol.Error) {
+	var ss = s.status.Load()
+	if !CNF_WindowScale || (ss != StreamStatus_Listen && ss != StreamStatus_SynSent) {
+		return
+	}
+	var shift = o.WindowScale()
+	// RFC 7323 section 2.3: use 14 instead of any larger shift count.
+	if shift > windowScale_MaxShift {
+		shift = windowScale_MaxShift
+	}
+	s.wscale.enabled = true
+	s.wscale.send = shift
 	return
 }
+
+// appendWindowScale append window scale option aligned to 4 bytes by a leading NOP.
+func appendWindowScale(b []byte, shift uint8) []byte {
+	return append(b, byte(OptionKind_Nop), byte(OptionKind_WindowScale), 3, shift)
+}
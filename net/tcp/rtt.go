@@ -0,0 +1,82 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+import (
+	"libgo/protocol"
+)
+
+// rttEstimator compute the retransmission timeout (RTO) of a stream from its round-trip time (RTT) samples.
+// Caller must not give samples of retransmitted segments (Karn's algorithm), because it can't know
+// which transmission acknowledged, unless the sample measured by the timestamps option.
+// https://www.rfc-editor.org/rfc/rfc6298
+type rttEstimator struct {
+	measured bool              // any sample measured yet
+	srtt     protocol.Duration // smoothed round-trip time
+	rttvar   protocol.Duration // round-trip time variation
+	rto      protocol.Duration
+	backoffs int // number of RTO expired since last sample
+}
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (re *rttEstimator) Init() (err protocol.Error) {
+	re.rto = CNF_RTO_Initial
+	return
+}
+func (re *rttEstimator) Reinit() (err protocol.Error) {
+	*re = rttEstimator{rto: CNF_RTO_Initial}
+	return
+}
+func (re *rttEstimator) Deinit() (err protocol.Error) {
+	return
+}
+
+func (re *rttEstimator) SRTT() protocol.Duration   { return re.srtt }
+func (re *rttEstimator) RTTVAR() protocol.Duration { return re.rttvar }
+func (re *rttEstimator) RTO() protocol.Duration    { return re.rto }
+func (re *rttEstimator) Backoffs() int             { return re.backoffs }
+
+// Sample update the estimation by a new RTT measurement and compute the RTO again as RFC 6298 section 2 says.
+// It also collapse any backoff applied on the RTO.
+func (re *rttEstimator) Sample(r protocol.Duration) {
+	if r < 0 {
+		return
+	}
+	if !re.measured {
+		re.measured = true
+		re.srtt = r
+		re.rttvar = r / 2
+	} else {
+		var delta = re.srtt - r
+		if delta < 0 {
+			delta = -delta
+		}
+		// RTTVAR <- (1 - beta) * RTTVAR + beta * |SRTT - R'| with beta = 1/4
+		re.rttvar = (3*re.rttvar + delta) / 4
+		// SRTT <- (1 - alpha) * SRTT + alpha * R' with alpha = 1/8
+		re.srtt = (7*re.srtt + r) / 8
+	}
+	re.backoffs = 0
+
+	var variance = 4 * re.rttvar
+	if variance < CNF_RTO_ClockGranularity {
+		variance = CNF_RTO_ClockGranularity
+	}
+	re.rto = clampRTO(re.srtt + variance)
+}
+
+// Backoff double the RTO after the retransmission timer expired as RFC 6298 section 5.5 says.
+func (re *rttEstimator) Backoff() {
+	re.rto = clampRTO(2 * re.rto)
+	re.backoffs++
+}
+
+func clampRTO(rto protocol.Duration) protocol.Duration {
+	if rto < CNF_RTO_Min {
+		return CNF_RTO_Min
+	}
+	if rto > CNF_RTO_Max {
+		return CNF_RTO_Max
+	}
+	return rto
+}
@@ -0,0 +1,85 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+import (
+	"testing"
+
+	"libgo/timer"
+)
+
+func TestRTTEstimator(t *testing.T) {
+	var re rttEstimator
+	re.Init()
+	if re.RTO() != CNF_RTO_Initial {
+		t.Fatalf("RTO() before any sample = %v, want %v", re.RTO(), CNF_RTO_Initial)
+	}
+
+	re.Sample(400 * timer.Millisecond)
+	if re.SRTT() != 400*timer.Millisecond || re.RTTVAR() != 200*timer.Millisecond {
+		t.Errorf("first Sample() SRTT, RTTVAR = %v, %v, want 400ms, 200ms", re.SRTT(), re.RTTVAR())
+	}
+	// SRTT + 4*RTTVAR
+	if re.RTO() != 1200*timer.Millisecond {
+		t.Errorf("RTO() = %v, want 1.2s", re.RTO())
+	}
+
+	re.Sample(800 * timer.Millisecond)
+	// RTTVAR = 3/4*200 + 1/4*|400-800| = 250, SRTT = 7/8*400 + 1/8*800 = 450
+	if re.SRTT() != 450*timer.Millisecond || re.RTTVAR() != 250*timer.Millisecond {
+		t.Errorf("second Sample() SRTT, RTTVAR = %v, %v, want 450ms, 250ms", re.SRTT(), re.RTTVAR())
+	}
+
+	var rto = re.RTO()
+	re.Backoff()
+	re.Backoff()
+	if re.RTO() != 4*rto || re.Backoffs() != 2 {
+		t.Errorf("RTO() after two Backoff() = %v, %v, want %v, 2", re.RTO(), re.Backoffs(), 4*rto)
+	}
+	for i := 0; i < 20; i++ {
+		re.Backoff()
+	}
+	if re.RTO() != CNF_RTO_Max {
+		t.Errorf("RTO() after many Backoff() = %v, want CNF_RTO_Max", re.RTO())
+	}
+
+	// New sample collapse the backoff.
+	re.Sample(10 * timer.Millisecond)
+	if re.Backoffs() != 0 || re.RTO() >= CNF_RTO_Max {
+		t.Errorf("Sample() after Backoff() RTO, Backoffs = %v, %v", re.RTO(), re.Backoffs())
+	}
+	re.Reinit()
+	re.Sample(0)
+	if re.RTO() != CNF_RTO_Min {
+		t.Errorf("RTO() of zero sample = %v, want CNF_RTO_Min", re.RTO())
+	}
+}
+
+func TestRetransmissionQueue(t *testing.T) {
+	var q retransmissionQueue
+	var end = q.Push(100, flag_ACK, make([]byte, 10), 1)
+	end = q.Push(end, flag_ACK, make([]byte, 10), 2)
+	end = q.Push(end, flag_FIN|flag_ACK, nil, 3)
+	if end != 121 {
+		t.Fatalf("Push() end = %v, want 121", end)
+	}
+
+	q.First().retransmitted = true
+	// Karn's algorithm: the first segment retransmitted, so its acknowledgment doesn't measure RTT.
+	var rtt, measured = q.Acknowledge(115, 10)
+	if measured {
+		t.Errorf("Acknowledge() of retransmitted segment must not measure RTT")
+	}
+	if q.Len() != 2 || q.First().seq != 115 || len(q.First().payload) != 5 {
+		t.Errorf("Acknowledge() must trim the partially acknowledged segment, got %+v", q.First())
+	}
+
+	rtt, measured = q.Acknowledge(120, 20)
+	if !measured || rtt != 18 {
+		t.Errorf("Acknowledge() = %v, %v, want 18, true", rtt, measured)
+	}
+	q.First().retransmitted = true
+	if _, measured = q.Acknowledge(121, 30); measured || q.Len() != 0 {
+		t.Errorf("Acknowledge() of retransmitted FIN = %v, len %v", measured, q.Len())
+	}
+}
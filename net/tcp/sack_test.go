@@ -0,0 +1,126 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReassemblyQueue(t *testing.T) {
+	var q reassemblyQueue
+	q.Insert(300, make([]byte, 100))
+	q.Insert(100, make([]byte, 100))
+	// Overlap both queued segments, just [200, 300) and [400, 450) are new.
+	q.Insert(150, make([]byte, 300))
+	if q.Len() != 4 {
+		t.Fatalf("Len() = %v, want 4", q.Len())
+	}
+
+	q.Insert(600, make([]byte, 50))
+	var blocks = q.Blocks(nil, sack_MaxBlocks)
+	var want = []sackBlock{{600, 650}, {100, 450}}
+	if !reflect.DeepEqual(blocks, want) {
+		t.Errorf("Blocks() = %v, want %v", blocks, want)
+	}
+	q.Insert(120, make([]byte, 10))
+	blocks = q.Blocks(blocks[:0], 1)
+	want = []sackBlock{{100, 450}}
+	if !reflect.DeepEqual(blocks, want) {
+		t.Errorf("Blocks() with the most recent block not last = %v, want %v", blocks, want)
+	}
+
+	if p := q.Pop(50); p != nil {
+		t.Errorf("Pop() before the queued data = %v bytes, want nil", len(p))
+	}
+	var next uint32 = 120
+	for p := q.Pop(next); p != nil; p = q.Pop(next) {
+		next += uint32(len(p))
+	}
+	if next != 450 || q.Len() != 1 {
+		t.Errorf("Pop() until gap next, Len() = %v, %v, want 450, 1", next, q.Len())
+	}
+}
+
+func TestRetransmissionQueue_SACK(t *testing.T) {
+	const mss = 100
+	var q retransmissionQueue
+	var next uint32 = 1000
+	for i := 0; i < 6; i++ {
+		next = q.Push(next, flag_ACK, make([]byte, mss), 0)
+	}
+	// Segments 1000 and 1200 lost, peer SACK others.
+	if sacked := q.SACK(1100, 1200) + q.SACK(1300, 1600); sacked != 400 {
+		t.Fatalf("SACK() = %v, want 400", sacked)
+	}
+	if q.SACK(1300, 1400) != 0 {
+		t.Errorf("SACK() again, want no newly SACKed bytes")
+	}
+
+	// 4 SACKed segments above 1000 and 3 above 1200
+	if !q.IsLost(0, mss) || !q.IsLost(2, mss) {
+		t.Errorf("IsLost() = false, want true")
+	}
+	// Lost and SACKed segments are not in the network.
+	if pipe := q.Pipe(mss, 1000); pipe != 0 {
+		t.Errorf("Pipe() = %v, want 0", pipe)
+	}
+	var qs = q.NextSeg(mss, 1000)
+	if qs == nil || qs.seq != 1000 {
+		t.Fatalf("NextSeg() = %v, want 1000", qs)
+	}
+	qs = q.NextSeg(mss, qs.end())
+	if qs == nil || qs.seq != 1200 {
+		t.Fatalf("NextSeg() after retransmit 1000 = %v, want 1200", qs)
+	}
+	if pipe := q.Pipe(mss, qs.end()); pipe != 2*mss {
+		t.Errorf("Pipe() after retransmit both = %v, want %v", pipe, 2*mss)
+	}
+	if qs = q.NextSeg(mss, qs.end()); qs != nil {
+		t.Errorf("NextSeg() after retransmit all lost = %v, want nil", qs.seq)
+	}
+
+	q.ClearSACK()
+	if q.IsLost(0, mss) {
+		t.Errorf("IsLost() after ClearSACK() = true, want false")
+	}
+}
+
+func TestOptionSACK(t *testing.T) {
+	var blocks = []sackBlock{{1, 2}, {0xFFFFFFF0, 10}}
+	var b = appendSACK(nil, blocks)
+	if len(b)%4 != 0 || Options(b[2:]).Kind() != OptionKind_SACK {
+		t.Fatalf("appendSACK() = %v", b)
+	}
+	var o = optionSACK(Options(b[2:]).Payload())
+	if o.Blocks() != 2 || o.Block(0) != blocks[0] || o.Block(1) != blocks[1] || len(o.NextOption()) != 0 {
+		t.Errorf("optionSACK = %v, want %v", o, blocks)
+	}
+}
+
+func TestStream_SACKOutOfWindow(t *testing.T) {
+	const mss = 100
+	var s, _ = testStream(t, StreamStatus_Established, 4000, false)
+	s.sack.permitted = true
+	var next uint32 = 4000
+	for i := 0; i < 4; i++ {
+		next = s.send.queue.Push(next, flag_ACK, make([]byte, mss), 0)
+	}
+	s.send.next = next
+
+	var options = appendSACK(nil, []sackBlock{{4100, 4200}})
+	if err := s.Receive(testSegment(flag_ACK, 1000+CNF_ReceiveWindow, 4000, options)); err != nil {
+		t.Fatalf("Stream.Receive() error = %v", err)
+	}
+	if s.sack.sacked != 0 || s.send.queue.SACK(4100, 4200) != mss {
+		t.Errorf("Stream.Receive() of out of window segment SACKed = %v, want 0", s.sack.sacked)
+	}
+	s.send.queue.ClearSACK()
+
+	if err := s.Receive(testSegment(flag_ACK, 1000, 4000, options)); err != nil {
+		t.Fatalf("Stream.Receive() error = %v", err)
+	}
+	if s.sack.sacked != mss {
+		t.Errorf("Stream.Receive() of acceptable segment SACKed = %v, want %v", s.sack.sacked, mss)
+	}
+}
@@ -38,6 +38,19 @@ func (s Segment) UrgentPointer() uint16   { return binary.BigEndian.Uint16(s[18:
 func (s Segment) Options() []byte         { return s[20:s.DataOffset()] }
 func (s Segment) Payload() []byte         { return s[s.DataOffset():] }
 
+// SequenceLength return SEG.LEN as RFC 793 says, the number of octets occupied by the payload
+// counting SYN and FIN flags.
+func (s Segment) SequenceLength() (ln uint32) {
+	ln = uint32(len(s.Payload()))
+	if s.FlagSYN() {
+		ln++
+	}
+	if s.FlagFIN() {
+		ln++
+	}
+	return
+}
+
 /*
 ********** Set Methods **********
  */
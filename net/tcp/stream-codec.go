@@ -52,10 +52,21 @@ func (s *Stream) Unmarshal(data []byte) (n int, err protocol.Error) {
 			return
 		default:
 			var sendNumber int
+			s.sync.Lock()
 			sendNumber, err = s.sendPayload(data)
+			s.sync.Unlock()
 			if err != nil {
 				return
 			}
+			if sendNumber == 0 {
+				// Window is full, wait for the peer to acknowledge some data.
+				select {
+				case <-s.writeTimer.Signal():
+					return
+				case <-s.send.window:
+				}
+				continue
+			}
 			n += sendNumber
 			data = data[sendNumber:]
 		}
@@ -0,0 +1,154 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+import (
+	"libgo/protocol"
+	"libgo/time/monotonic"
+	"libgo/timer"
+)
+
+// SetCongestionController replace the congestion control algorithm of the stream e.g. by one that
+// NewCongestionController() return. It can call in any state, but the new one start from its initial window.
+func (s *Stream) SetCongestionController(cc CongestionController) {
+	s.sync.Lock()
+	cc.Init(uint32(s.mss), monotonic.Now())
+	s.cc = cc
+	s.sync.Unlock()
+}
+
+// SetRateLimit limit the stream to send at most bytesPerSecond. 0 means no limit.
+// The limit mix with the pacing rate of the congestion control algorithm and the stricter one apply.
+func (s *Stream) SetRateLimit(bytesPerSecond uint64) {
+	s.sync.Lock()
+	s.rateLimit = bytesPerSecond
+	s.sync.Unlock()
+}
+
+// sendWindow return the bytes that the stream can send now by the peer window and the congestion window.
+func (s *Stream) sendWindow() (wnd uint32) {
+	wnd = s.send.wnd
+	if cwnd := s.cc.CongestionWindow(); cwnd < wnd {
+		wnd = cwnd
+	}
+	var inFlight = s.inFlight()
+	if inFlight >= wnd {
+		return 0
+	}
+	return wnd - inFlight
+}
+
+// pacingRate return the stricter of the congestion control pacing rate and the rate limit. 0 means no pacing.
+func (s *Stream) pacingRate() (rate uint64) {
+	rate = s.cc.PacingRate()
+	if s.rateLimit != 0 && (rate == 0 || s.rateLimit < rate) {
+		rate = s.rateLimit
+	}
+	return
+}
+
+// paced report whether the pacing doesn't allow to send now. It schedules the stream timer to wake the writer.
+func (s *Stream) paced(now monotonic.Time) bool {
+	if !s.send.nextSend.Pass(now) {
+		return false
+	}
+	s.timing.schedule(now, s.timing.pc.Start(s.send.nextSend, now))
+	return true
+}
+
+// sent advance the pacing time by the time that n bytes take at the pacing rate.
+func (s *Stream) sent(n int, now monotonic.Time) {
+	var rate = s.pacingRate()
+	if rate == 0 {
+		s.send.nextSend = 0
+		return
+	}
+	if !s.send.nextSend.Pass(now) {
+		// Don't let an idle time give a burst.
+		s.send.nextSend = now
+	}
+	s.send.nextSend.Add(protocol.Duration(uint64(n) * uint64(timer.Second) / rate))
+}
+
+// duplicateACK count duplicate ACKs as RFC 5681 section 2 defines them, or as RFC 6675 section 2 defines them
+// if SACK permitted, and start fast retransmit and fast recovery on CNF_DupACKThreshold of them.
+// It must call before the segment update the send window.
+// https://www.rfc-editor.org/rfc/rfc6582#section-3.2
+// https://www.rfc-editor.org/rfc/rfc6675#section-5
+func (s *Stream) duplicateACK(segment Segment) {
+	if s.send.queue.Len() == 0 || segment.AckNumber() != s.send.una {
+		return
+	}
+	if s.sack.permitted {
+		if s.sack.sacked == 0 {
+			return
+		}
+	} else if len(segment.Payload()) != 0 || segment.FlagSYN() || segment.FlagFIN() || s.segmentWindow(segment) != s.send.wnd {
+		return
+	}
+	s.send.dupACKs++
+	if s.send.recovery {
+		if s.sack.permitted {
+			s.sackRecovery()
+		}
+		return
+	}
+	if s.send.dupACKs < CNF_DupACKThreshold && !(s.sack.permitted && s.send.queue.IsLost(0, uint32(s.mss))) {
+		return
+	}
+	// Don't start a new recovery for the losses of the data that sent before the last one.
+	if seqLT(s.send.una, s.send.recover) {
+		return
+	}
+	s.send.recovery = true
+	s.send.recover = s.send.next
+	s.sack.highRxt = s.send.una
+	s.cc.OnLoss(s.send.next-s.send.una, false, monotonic.Now())
+	var qs = s.send.queue.First()
+	var err = s.retransmit(qs)
+	if err != nil {
+		// TODO::: Lower layer can't send now, the retransmission timer will retransmit it.
+		return
+	}
+	if s.sack.permitted {
+		s.sack.highRxt = qs.end()
+		s.sackRecovery()
+	}
+}
+
+// recoveryACK exit the fast recovery on a full ACK, or on a partial ACK retransmit the next lost segments
+// by the SACK scoreboard or the next unacknowledged segment as NewReno does. It must call after una updated by the ACK.
+func (s *Stream) recoveryACK() {
+	if seqGEQ(s.send.una, s.send.recover) {
+		s.send.recovery = false
+		return
+	}
+	if s.sack.permitted {
+		if seqLT(s.sack.highRxt, s.send.una) {
+			s.sack.highRxt = s.send.una
+		}
+		s.sackRecovery()
+		return
+	}
+	var qs = s.send.queue.First()
+	if qs == nil {
+		return
+	}
+	var err = s.retransmit(qs)
+	if err != nil {
+		// TODO::: Lower layer can't send now, the retransmission timer will retransmit it.
+	}
+}
+
+// timeoutLoss tell the congestion control about the RTO expiry. Just the first expiry of a segment is a new loss event.
+// https://www.rfc-editor.org/rfc/rfc5681#section-3.1
+func (s *Stream) timeoutLoss(now monotonic.Time) {
+	if s.timing.rt.rtt.Backoffs() == 0 {
+		s.cc.OnLoss(s.send.next-s.send.una, true, now)
+	}
+	s.send.dupACKs = 0
+	s.send.recovery = false
+	s.send.queue.ClearSACK()
+	// Duplicate ACKs of the data that sent before the timeout must not start a fast retransmit.
+	s.send.recover = s.send.next
+}
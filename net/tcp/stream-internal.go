@@ -6,19 +6,35 @@ import (
 	"syscall"
 
 	"libgo/protocol"
+	"libgo/time/monotonic"
 )
 
 func (s *Stream) checkStream() (err protocol.Error) {
-	if s != nil {
+	if s == nil {
 		err = syscall.EINVAL
 	}
 	return
 }
 
 func (s *Stream) incomeSegmentOnListenState(segment Segment) (err protocol.Error) {
+	if segment.FlagRST() {
+		return
+	}
+	if segment.FlagACK() {
+		// Nothing sent yet to be acknowledged.
+		err = s.sendResetFor(segment)
+		return
+	}
 	if segment.FlagSYN() {
-		// err = s.sendSYNandACK()
+		s.recv.irs = segment.SequenceNumber()
+		s.recv.next = s.recv.irs + 1
+		err = s.handleOptions(segment.Options())
+		if err != nil {
+			return
+		}
+		s.windowScaleNegotiated()
 		s.status.Store(StreamStatus_SynReceived)
+		err = s.sendQueued(flag_SYN|flag_ACK, nil)
 
 		// TODO::: set ACK timeout timer
 
@@ -33,8 +49,36 @@ func (s *Stream) incomeSegmentOnListenState(segment Segment) (err protocol.Error
 }
 
 func (s *Stream) incomeSegmentOnSynSentState(segment Segment) (err protocol.Error) {
+	if segment.FlagACK() {
+		var ack = segment.AckNumber()
+		if seqLEQ(ack, s.send.iss) || seqGT(ack, s.send.next) {
+			if !segment.FlagRST() {
+				err = s.sendResetFor(segment)
+			}
+			return
+		}
+	}
+	if segment.FlagRST() {
+		// RST is acceptable just if it acknowledge our SYN.
+		if segment.FlagACK() {
+			err = s.receiveRST()
+		}
+		return
+	}
 	if segment.FlagSYN() && segment.FlagACK() {
+		s.recv.irs = segment.SequenceNumber()
+		s.recv.next = s.recv.irs + 1
+		err = s.handleOptions(segment.Options())
+		if err != nil {
+			return
+		}
+		s.windowScaleNegotiated()
+		_, err = s.processACK(segment)
+		if err != nil {
+			return
+		}
 		s.status.Store(StreamStatus_Established)
+		err = s.sendQuickACK()
 		// TODO::: anything else??
 		return
 	}
@@ -44,18 +88,289 @@ func (s *Stream) incomeSegmentOnSynSentState(segment Segment) (err protocol.Erro
 }
 
 func (s *Stream) incomeSegmentOnSynReceivedState(segment Segment) (err protocol.Error) {
+	var ok bool
+	ok, err = s.checkSynchronized(segment)
+	if !ok {
+		return
+	}
+	// Our SYN acknowledged by checkSynchronized().
+	s.status.Store(StreamStatus_Established)
 
+	var fin bool
+	fin, err = s.receive(segment)
+	if fin {
+		s.status.Store(StreamStatus_CloseWait)
+	}
 	return
 }
 
 func (s *Stream) incomeSegmentOnEstablishedState(segment Segment) (err protocol.Error) {
+	var ok bool
+	ok, err = s.checkSynchronized(segment)
+	if !ok {
+		return
+	}
+
+	var fin bool
+	fin, err = s.receive(segment)
+	if fin {
+		// Passive close: peer has no more data to send, but we can send until the user call close().
+		s.status.Store(StreamStatus_CloseWait)
+	}
+	return
+}
+
+// incomeSegmentOnFinWait1State handle the segments after we sent our FIN in active close.
+// If the peer FIN receive before the ACK of our FIN, both sides close simultaneously and stream go to CLOSING.
+func (s *Stream) incomeSegmentOnFinWait1State(segment Segment) (err protocol.Error) {
+	var ok bool
+	ok, err = s.checkSynchronized(segment)
+	if !ok {
+		return
+	}
+	var finAcked = s.send.finAcked()
+
+	var fin bool
+	fin, err = s.receive(segment)
+	switch {
+	case fin && finAcked:
+		s.enterTimeWait()
+	case fin:
+		s.status.Store(StreamStatus_Closing)
+	case finAcked:
+		s.enterFinWait2()
+	}
+	return
+}
+
+func (s *Stream) incomeSegmentOnFinWait2State(segment Segment) (err protocol.Error) {
+	var ok bool
+	ok, err = s.checkSynchronized(segment)
+	if !ok {
+		return
+	}
+
+	var fin bool
+	fin, err = s.receive(segment)
+	if fin {
+		s.enterTimeWait()
+	}
+	return
+}
+
+// incomeSegmentOnCloseState represents no connection, so answer any segment except a RST by a RST.
+func (s *Stream) incomeSegmentOnCloseState(segment Segment) (err protocol.Error) {
+	if segment.FlagRST() {
+		return
+	}
+	err = s.sendResetFor(segment)
+	return
+}
+
+// incomeSegmentOnCloseWaitState just process ACKs, because the peer sent its FIN and must not send any data.
+// A retransmitted FIN is not acceptable and acknowledged again by checkSynchronized().
+func (s *Stream) incomeSegmentOnCloseWaitState(segment Segment) (err protocol.Error) {
+	_, err = s.checkSynchronized(segment)
+	return
+}
+
+func (s *Stream) incomeSegmentOnClosingState(segment Segment) (err protocol.Error) {
+	var ok bool
+	ok, err = s.checkSynchronized(segment)
+	if ok && s.send.finAcked() {
+		s.enterTimeWait()
+	}
+	return
+}
+
+func (s *Stream) incomeSegmentOnLastAckState(segment Segment) (err protocol.Error) {
+	var ok bool
+	ok, err = s.checkSynchronized(segment)
+	if ok && s.send.finAcked() {
+		err = s.closed()
+	}
+	return
+}
+
+// incomeSegmentOnTimeWaitState handle the only thing that can arrive in this state, a retransmission of the peer FIN.
+// Acknowledge it and restart the 2*MSL timeout.
+func (s *Stream) incomeSegmentOnTimeWaitState(segment Segment) (err protocol.Error) {
+	if segment.FlagRST() {
+		// RFC 1337 TIME-WAIT assassination hazards
+		if !CNF_Timeout_RFC1337 && s.acceptable(segment) {
+			err = s.closed()
+		}
+		return
+	}
+	if segment.FlagFIN() {
+		err = s.sendQuickACK()
+		s.enterTimeWait()
+	}
+	return
+}
+
+// checkSynchronized do the first steps of "SEGMENT ARRIVES" in synchronized states as RFC 793 says:
+// check the sequence number, RST and SYN flags, and process the ACK field.
+// In SYN-RECEIVED state a segment that doesn't acknowledge our SYN answer by a RST.
+// ok is false if the segment must drop without any more process.
+// https://datatracker.ietf.org/doc/html/rfc793#page-69
+func (s *Stream) checkSynchronized(segment Segment) (ok bool, err protocol.Error) {
+	err = s.handleOptions(segment.Options())
+	if err != nil {
+		return
+	}
+	var now = monotonic.Now()
+	// PAWS check before the sequence number as RFC 7323 section 5.3 says.
+	// handleOptions() just keep the timestamps of the segment for it, and TS.Recent update after both checks.
+	if !s.ts.Accept(segment.FlagRST(), now) || !s.acceptable(segment) {
+		if !segment.FlagRST() {
+			err = s.sendQuickACK()
+		}
+		return
+	}
+	s.ts.Update(segment.SequenceNumber(), now)
+
+	if segment.FlagRST() {
+		err = s.receiveRST()
+		return
+	}
+	if segment.FlagSYN() {
+		// A SYN in the window is an error.
+		err = s.reset()
+		return
+	}
+	if !segment.FlagACK() {
+		return
+	}
+	if s.status.Load() == StreamStatus_SynReceived && !s.acknowledgeSYN(segment) {
+		// <SEQ=SEG.ACK><CTL=RST>
+		err = s.sendResetFor(segment)
+		return
+	}
+	// Mark SACK blocks just for an acceptable segment, so an old or forged one can't change the scoreboard.
+	if s.sack.option != nil {
+		err = s.sack.option.Process(s)
+		if err != nil {
+			return
+		}
+	}
+	ok, err = s.processACK(segment)
+	return
+}
+
+// acknowledgeSYN check SND.UNA < SEG.ACK =< SND.NXT in SYN-RECEIVED state, so the segment acknowledge our SYN.
+func (s *Stream) acknowledgeSYN(segment Segment) bool {
+	var ack = segment.AckNumber()
+	return seqGT(ack, s.send.una) && seqLEQ(ack, s.send.next)
+}
+
+// acceptable check the segment occupy any portion of the receive window as RFC 793 section 3.3 says.
+func (s *Stream) acceptable(segment Segment) bool {
+	var sn = segment.SequenceNumber()
+	var ln = segment.SequenceLength()
+	var next = s.recv.next
+	var wnd = s.recv.wnd
+	if wnd == 0 {
+		return ln == 0 && sn == next
+	}
+	var inWindow = seqLEQ(next, sn) && seqLT(sn, next+wnd)
+	if ln == 0 || inWindow {
+		return inWindow
+	}
+	var last = sn + ln - 1
+	return seqLEQ(next, last) && seqLT(last, next+wnd)
+}
+
+// processACK update SND.UNA and the send window by the segment. ok is false if the segment must drop.
+func (s *Stream) processACK(segment Segment) (ok bool, err protocol.Error) {
+	var sn = segment.SequenceNumber()
+	var ack = segment.AckNumber()
+	if seqGT(ack, s.send.next) {
+		// ACK something not yet sent
+		err = s.sendQuickACK()
+		return
+	}
+	if seqGT(ack, s.send.una) {
+		var acked = ack - s.send.una
+		s.send.una = ack
+		s.acknowledged(acked)
+	} else {
+		s.duplicateACK(segment)
+	}
+	if seqLT(s.send.wl1, sn) || (s.send.wl1 == sn && seqLEQ(s.send.wl2, ack)) {
+		s.send.wnd = s.segmentWindow(segment)
+		s.send.wl1 = sn
+		s.send.wl2 = ack
+		s.send.signalWindow()
+	}
+	ok = true
+	return
+}
+
+// acknowledged remove acknowledged segments from the retransmission queue, measure the RTT,
+// manage the retransmission timer as RFC 6298 section 5 says and feed the congestion control.
+// acked is the newly acknowledged bytes and una is updated before call it.
+func (s *Stream) acknowledged(acked uint32) {
+	var now = monotonic.Now()
+	var rtt, measured = s.send.queue.Acknowledge(s.send.una, now)
+	if s.ts.enabled {
+		// RTTM by timestamps is valid for retransmitted segments too, so it replace Karn's sample if it exists.
+		if r, ok := s.ts.RTT(now); ok {
+			rtt, measured = r, ok
+		}
+	}
+	if measured {
+		s.timing.rt.rtt.Sample(rtt)
+		s.cc.OnRTTSample(rtt, now)
+	}
+	s.send.dupACKs = 0
+	var recovery = s.send.recovery
+	if recovery {
+		s.recoveryACK()
+	}
+	s.cc.OnACK(acked, s.send.next-s.send.una, recovery, now)
+	if s.send.queue.Len() == 0 {
+		s.timing.rt.Stop()
+	} else {
+		s.timing.schedule(now, s.timing.rt.Start(now))
+	}
+	s.send.signalWindow()
+}
+
+// receive process the payload and the FIN of an acceptable segment.
+// fin is true if the peer FIN received in order and acknowledged.
+func (s *Stream) receive(segment Segment) (fin bool, err protocol.Error) {
+	err = s.receivePayload(segment)
+	if err != nil {
+		return
+	}
+	fin, err = s.receiveFIN(segment)
+	return
+}
+
+func (s *Stream) receivePayload(segment Segment) (err protocol.Error) {
 	var payload = segment.Payload()
+	if len(payload) == 0 {
+		return
+	}
 	var sn = segment.SequenceNumber()
 	var exceptedNext = s.recv.next
+	if seqLT(sn, exceptedNext) {
+		// Drop the part that received before.
+		payload = payload[exceptedNext-sn:]
+		sn = exceptedNext
+	}
 	if sn == exceptedNext {
-		s.sendACK()
-
 		_, err = s.recv.buf.Write(payload)
+		if err != nil {
+			return
+		}
+		s.recv.next += uint32(len(payload))
+		err = s.deliverQueued()
+		if err != nil {
+			return
+		}
+		s.sendACK()
 
 		// TODO::: Due to CongestionControlAlgorithm, if a segment with push flag not send again
 		if segment.FlagPSH() {
@@ -74,42 +389,60 @@ func (s *Stream) incomeSegmentOnEstablishedState(segment Segment) (err protocol.
 	return
 }
 
-func (s *Stream) incomeSegmentOnFinWait1State(segment Segment) (err protocol.Error) {
-
-	return
-}
-
-func (s *Stream) incomeSegmentOnFinWait2State(segment Segment) (err protocol.Error) {
-
-	return
-}
-
-func (s *Stream) incomeSegmentOnCloseState(segment Segment) (err protocol.Error) {
-
+// receiveFIN acknowledge the FIN of the segment if all data before it received.
+// Otherwise the FIN drop and the peer must retransmit it.
+func (s *Stream) receiveFIN(segment Segment) (fin bool, err protocol.Error) {
+	if !segment.FlagFIN() {
+		return
+	}
+	var finSequence = segment.SequenceNumber() + uint32(len(segment.Payload()))
+	if finSequence != s.recv.next {
+		return
+	}
+	s.recv.next++
+	err = s.sendQuickACK()
+	s.recv.sendFlagSignal(flag_FIN)
+	fin = true
 	return
 }
 
-func (s *Stream) incomeSegmentOnCloseWaitState(segment Segment) (err protocol.Error) {
-
+// receiveRST abort the stream by the peer request without send any segment to it.
+func (s *Stream) receiveRST() (err protocol.Error) {
+	s.err = &ErrStreamReset
+	s.recv.sendFlagSignal(flag_RST)
+	err = s.closed()
 	return
 }
 
-func (s *Stream) incomeSegmentOnClosingState(segment Segment) (err protocol.Error) {
-
-	return
+func (s *Stream) enterFinWait2() {
+	s.status.Store(StreamStatus_FinWait2)
+	var now = monotonic.Now()
+	s.timing.schedule(now, s.timing.tw.Start(now, CNF_FinTimeout))
 }
 
-func (s *Stream) incomeSegmentOnLastAckState(segment Segment) (err protocol.Error) {
-
-	return
+// enterTimeWait (re)start 2*MSL timeout in TIME_WAIT state, the stream closed by the stream timing after it.
+func (s *Stream) enterTimeWait() {
+	s.status.Store(StreamStatus_TimeWait)
+	var now = monotonic.Now()
+	s.timing.schedule(now, s.timing.tw.Start(now, 2*CNF_Timeout_MSL))
 }
 
-func (s *Stream) incomeSegmentOnTimeWaitState(segment Segment) (err protocol.Error) {
-
+// closed move the stream to CLOSED state and release its resources (delete TCB).
+func (s *Stream) closed() (err protocol.Error) {
+	s.status.Store(StreamStatus_Close)
+	err = s.Deinit()
 	return
 }
 
+// handleOptions process the options of a received segment.
+// It stops on a malformed option, because the options after it can't be located.
+// SACK option keep in s.sack.option and checkSynchronized() process it after the segment accepted.
 func (s *Stream) handleOptions(opts []byte) (err protocol.Error) {
+	// Reset the state of the last processed segment.
+	s.sack.sacked = 0
+	s.sack.option = nil
+	s.ts.received = false
+
 	for len(opts) > 0 {
 		var options = Options(opts)
 		var optionsKind = options.Kind()
@@ -117,47 +450,120 @@ func (s *Stream) handleOptions(opts []byte) (err protocol.Error) {
 		case OptionKind_EndList:
 			return
 		case OptionKind_Nop:
-			// var opt Option
+			opts = opts[1:]
+			continue
+		}
 
-			// opts = options.NextOption()
+		// Other kinds have a length that count the kind and the length bytes too.
+		if len(opts) < 2 || opts[1] < 2 || int(opts[1]) > len(opts) {
+			return
+		}
+		var ln = opts[1]
+		switch optionsKind {
 		case OptionKind_MSS:
+			if ln != 4 {
+				return
+			}
 			var optionMSS = optionMSS(options.Payload())
 			err = optionMSS.Process(s)
 			if err != nil {
 				return
 			}
 			opts = optionMSS.NextOption()
+		case OptionKind_WindowScale:
+			if ln != 3 {
+				return
+			}
+			var optionWindowScale = optionWindowScale(options.Payload())
+			err = optionWindowScale.Process(s)
+			if err != nil {
+				return
+			}
+			opts = optionWindowScale.NextOption()
+		case OptionKind_Timestamps:
+			if ln != 10 {
+				return
+			}
+			var optionTimestamps = optionTimestamps(options.Payload())
+			err = optionTimestamps.Process(s)
+			if err != nil {
+				return
+			}
+			opts = optionTimestamps.NextOption()
+		case OptionKind_SACKPermitted:
+			if ln != 2 {
+				return
+			}
+			var optionSACKPermitted = optionSACKPermitted(options.Payload())
+			err = optionSACKPermitted.Process(s)
+			if err != nil {
+				return
+			}
+			opts = optionSACKPermitted.NextOption()
+		case OptionKind_SACK:
+			if (ln-2)%8 != 0 {
+				return
+			}
+			s.sack.option = optionSACK(options.Payload())
+			opts = s.sack.option.NextOption()
 		default:
-			// TODO:::
+			// TODO::: Process other kinds
+			opts = opts[ln:]
 		}
 	}
 	return
 }
 
-// reset the stream and tell peer about reset
-func (s *Stream) reset() {
-	// TODO:::
+// reset abort the stream and tell peer about reset if the stream state need it.
+func (s *Stream) reset() (err protocol.Error) {
+	if s.needReset() {
+		err = s.sendRST()
+	}
+	s.err = &ErrStreamReset
+	s.recv.sendFlagSignal(flag_RST)
+	var closeErr = s.closed()
+	if err == nil {
+		err = closeErr
+	}
+	return
 }
 
+// close do the CLOSE call of the user as RFC 793 says. It means the user has no more data to send,
+// but the stream continue to receive until the peer send its FIN too.
 func (s *Stream) close() (err protocol.Error) {
-	// TODO:::
-	err = s.sendFIN()
-	if err != nil {
-		return
+	switch s.status.Load() {
+	case StreamStatus_Listen, StreamStatus_SynSent:
+		err = s.closed()
+	case StreamStatus_SynReceived, StreamStatus_Established:
+		err = s.sendFIN()
+		if err != nil {
+			return
+		}
+		s.status.Store(StreamStatus_FinWait1)
+	case StreamStatus_CloseWait:
+		err = s.sendFIN()
+		if err != nil {
+			return
+		}
+		s.status.Store(StreamStatus_LastAck)
+	default:
+		err = &ErrStreamClosing
 	}
-	err = s.Deinit()
 	return
 }
 
 // sendSYN sending a segment with SYN flag on
 func (s *Stream) sendSYN() (err protocol.Error) {
-	// TODO:::
+	// TODO::: Select ISS as RFC 6528 says.
+	s.send.una = s.send.iss
+	s.send.next = s.send.iss
+	s.send.recover = s.send.iss
+	err = s.sendQueued(flag_SYN, nil)
 	return
 }
 
 // sendACK sending ACKs in SYN-RECV and TIME-WAIT states
 func (s *Stream) sendACK() (err protocol.Error) {
-	s.recv.next++
 	// TODO:::
 	if CNF_DelayedAcknowledgment && s.delayedACK {
 		// go to queue
@@ -169,34 +575,92 @@ func (s *Stream) sendACK() (err protocol.Error) {
 
 // sendQuickACK sending ACKs in SYN-RECV and TIME-WAIT states without respect CNF_DelayedAcknowledgment.
 func (s *Stream) sendQuickACK() (err protocol.Error) {
-	// TODO:::
+	err = s.sendSegment(s.makeSegment(flag_ACK, s.send.next, nil))
 	return
 }
 
 // sendRST sending RST flag on segment to other side of the stream
 func (s *Stream) sendRST() (err protocol.Error) {
-	// TODO:::
+	err = s.sendSegment(s.makeSegment(flag_RST, s.send.next, nil))
+	return
+}
+
+// sendResetFor sending RST in reply to a segment that doesn't belong to the stream state as RFC 793 says.
+// The segment must not has RST flag.
+func (s *Stream) sendResetFor(segment Segment) (err protocol.Error) {
+	var rst Segment
+	if segment.FlagACK() {
+		rst = s.makeSegment(flag_RST, segment.AckNumber(), nil)
+	} else {
+		rst = s.makeSegment(flag_RST|flag_ACK, 0, nil)
+		rst.SetAckNumber(segment.SequenceNumber() + segment.SequenceLength())
+	}
+	err = s.sendSegment(rst)
 	return
 }
 
 // sendFIN sending FIN flag on segment to other side of the stream
 func (s *Stream) sendFIN() (err protocol.Error) {
-	// TODO:::
+	err = s.sendQueued(flag_FIN|flag_ACK, nil)
+	if err != nil {
+		return
+	}
+	s.send.fin = true
 	return
 }
 
-// ValidateSequence: validates sequence number of the segment
-// Return: TRUE if acceptable, FALSE if not acceptable
+// sendQueued send a segment that occupy the sequence space from SND.NXT and keep it in the retransmission queue
+// until acknowledged. It start the retransmission timer if it is not running as RFC 6298 section 5.1 says.
+func (s *Stream) sendQueued(flags flag, payload []byte) (err protocol.Error) {
+	var seq = s.send.next
+	err = s.sendSegment(s.makeSegment(flags, seq, payload))
+	if err != nil {
+		return
+	}
+	var now = monotonic.Now()
+	s.send.next = s.send.queue.Push(seq, flags, payload, now)
+	if !s.timing.rt.Running() {
+		s.timing.schedule(now, s.timing.rt.Start(now))
+	}
+	return
+}
+
+// retransmit send the queued segment again with the last acknowledgment number and window.
+func (s *Stream) retransmit(qs *queuedSegment) (err protocol.Error) {
+	qs.retransmitted = true
+	err = s.sendSegment(s.makeSegment(qs.flags, qs.seq, qs.payload))
+	return
+}
+
+// validateSequence keep the out-of-order payload of an acceptable segment in the reassembly queue and
+// send a duplicate ACK immediately to let the peer detect the loss as RFC 5681 section 4.2 says.
 func (s *Stream) validateSequence(segment Segment) (err protocol.Error) {
-	// TODO::: Change func args if no more data need
 	var payload = segment.Payload()
 	var sn = segment.SequenceNumber()
-	var exceptedNext = s.recv.next
-	// TODO::: Due to CongestionControlAlgorithm make a decision to change next
-	err = s.recv.buf.WriteIn(payload, (sn - exceptedNext))
+	var windowEnd = s.recv.next + s.recv.wnd
+	if seqGT(sn+uint32(len(payload)), windowEnd) {
+		payload = payload[:windowEnd-sn]
+	}
+	s.recv.ooo.Insert(sn, payload)
+	err = s.sendQuickACK()
 	return
 }
 
+// deliverQueued move the data of the reassembly queue that is in order now to the receive buffer.
+func (s *Stream) deliverQueued() (err protocol.Error) {
+	for {
+		var payload = s.recv.ooo.Pop(s.recv.next)
+		if payload == nil {
+			return
+		}
+		_, err = s.recv.buf.Write(payload)
+		if err != nil {
+			return
+		}
+		s.recv.next += uint32(len(payload))
+	}
+}
+
 // ValidateSequence: validates sequence number of the segment
 // Return: TRUE if acceptable, FALSE if not acceptable
 func (s *Stream) validateSequenceTemp(cur_ts uint32, p Segment, seq uint32, ack_seq uint32, payloadlen int) bool {
@@ -212,8 +676,45 @@ func (s *Stream) needReset() bool {
 		ss == StreamStatus_FinWait1 || ss == StreamStatus_FinWait2 || ss == StreamStatus_SynReceived
 }
 
+// sendPayload send as much of b as the peer window, the congestion window and the MSS allow in one segment.
+// n is zero if the windows are full or the pacing doesn't allow to send now,
+// so the caller must wait for s.send.window signal.
 func (s *Stream) sendPayload(b []byte) (n int, err protocol.Error) {
+	if s.send.fin {
+		err = &ErrStreamClosing
+		return
+	}
+	var ss = s.status.Load()
+	if ss != StreamStatus_Established && ss != StreamStatus_CloseWait {
+		return
+	}
 
+	var now = monotonic.Now()
+	var wnd = s.sendWindow()
+	if wnd == 0 || s.paced(now) {
+		return
+	}
+	n = len(b)
+	if n > s.mss {
+		n = s.mss
+	}
+	if uint32(n) > wnd {
+		n = int(wnd)
+	}
+
+	var flags = flag_ACK
+	if n == len(b) {
+		flags |= flag_PSH
+	}
+	// Copy the payload, because the caller can reuse b before the peer acknowledge it.
+	var payload = make([]byte, n)
+	copy(payload, b)
+	err = s.sendQueued(flags, payload)
+	if err != nil {
+		n = 0
+		return
+	}
+	s.sent(n, now)
 	return
 }
 
@@ -237,7 +738,7 @@ loop:
 				break loop
 			case flag_RST:
 				s.readTimer.Stop()
-				// err = TODO:::
+				err = s.err
 				break loop
 			case flag_PSH, flag_URG:
 				break loop
@@ -0,0 +1,164 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+import (
+	"reflect"
+	"testing"
+
+	"libgo/protocol"
+	"libgo/time/monotonic"
+)
+
+// testSender record the segments that the stream sends.
+type testSender struct {
+	segments []Segment
+}
+
+func (ts *testSender) SendSegment(segment Segment) (err protocol.Error) {
+	ts.segments = append(ts.segments, segment)
+	return
+}
+
+// flags return the flags of the sent segments.
+func (ts *testSender) flags() (flags []flag) {
+	for _, segment := range ts.segments {
+		flags = append(flags, flag(segment[13]))
+	}
+	return
+}
+
+// testStream return a stream in the status that expect 1000 from the peer and sent until 4001.
+// 4000 is our SYN in SYN-RECEIVED state and our FIN if fin is true.
+func testStream(t *testing.T, ss streamStatus, una uint32, fin bool) (s *Stream, sender *testSender) {
+	s = new(Stream)
+	if err := s.Init(0); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	sender = new(testSender)
+	s.sender = sender
+	s.status.Store(ss)
+	s.recv.next = 1000
+	s.send.una = una
+	s.send.next = 4001
+	s.send.wl1 = 1000
+	s.send.wl2 = una
+	s.send.fin = fin
+	return
+}
+
+// testSegment make a segment that the peer sent.
+func testSegment(flags flag, seq, ack uint32, options []byte) (segment Segment) {
+	segment = make(Segment, CNF_Segment_MinSize+len(options))
+	segment.SetSequenceNumber(seq)
+	segment.SetAckNumber(ack)
+	segment.SetDataOffset(uint8(len(segment)))
+	segment.SetFlagPartTwo(byte(flags))
+	segment.SetWindow(0xFFFF)
+	segment.SetOptions(options)
+	return
+}
+
+func TestStream_Receive(t *testing.T) {
+	var wantRST = StreamStatus_Close
+	if CNF_Timeout_RFC1337 {
+		wantRST = StreamStatus_TimeWait
+	}
+
+	tests := []struct {
+		name     string
+		status   streamStatus
+		una      uint32
+		fin      bool
+		segment  Segment
+		want     streamStatus
+		wantSent []flag
+	}{
+		{"SYN-RECEIVED ACK of SYN", StreamStatus_SynReceived, 4000, false,
+			testSegment(flag_ACK, 1000, 4001, nil), StreamStatus_Established, nil},
+		{"SYN-RECEIVED ACK before SYN", StreamStatus_SynReceived, 4000, false,
+			testSegment(flag_ACK, 1000, 4000, nil), StreamStatus_SynReceived, []flag{flag_RST}},
+		{"SYN-RECEIVED ACK after SYN", StreamStatus_SynReceived, 4000, false,
+			testSegment(flag_ACK, 1000, 5000, nil), StreamStatus_SynReceived, []flag{flag_RST}},
+		{"FIN-WAIT-1 ACK of FIN", StreamStatus_FinWait1, 4000, true,
+			testSegment(flag_ACK, 1000, 4001, nil), StreamStatus_FinWait2, nil},
+		{"FIN-WAIT-1 FIN", StreamStatus_FinWait1, 4000, true,
+			testSegment(flag_FIN|flag_ACK, 1000, 4000, nil), StreamStatus_Closing, []flag{flag_ACK}},
+		{"FIN-WAIT-1 FIN and ACK of FIN", StreamStatus_FinWait1, 4000, true,
+			testSegment(flag_FIN|flag_ACK, 1000, 4001, nil), StreamStatus_TimeWait, []flag{flag_ACK}},
+		{"FIN-WAIT-1 RST", StreamStatus_FinWait1, 4000, true,
+			testSegment(flag_RST, 1000, 0, nil), StreamStatus_Close, nil},
+		{"FIN-WAIT-2 FIN", StreamStatus_FinWait2, 4001, true,
+			testSegment(flag_FIN|flag_ACK, 1000, 4001, nil), StreamStatus_TimeWait, []flag{flag_ACK}},
+		{"FIN-WAIT-2 RST", StreamStatus_FinWait2, 4001, true,
+			testSegment(flag_RST, 1000, 0, nil), StreamStatus_Close, nil},
+		{"CLOSING ACK", StreamStatus_Closing, 4000, true,
+			testSegment(flag_ACK, 1000, 4000, nil), StreamStatus_Closing, nil},
+		{"CLOSING ACK of FIN", StreamStatus_Closing, 4000, true,
+			testSegment(flag_ACK, 1000, 4001, nil), StreamStatus_TimeWait, nil},
+		{"LAST-ACK ACK of FIN", StreamStatus_LastAck, 4000, true,
+			testSegment(flag_ACK, 1000, 4001, nil), StreamStatus_Close, nil},
+		{"LAST-ACK RST", StreamStatus_LastAck, 4000, true,
+			testSegment(flag_RST, 1000, 0, nil), StreamStatus_Close, nil},
+		{"TIME-WAIT retransmitted FIN", StreamStatus_TimeWait, 4001, true,
+			testSegment(flag_FIN|flag_ACK, 999, 4001, nil), StreamStatus_TimeWait, []flag{flag_ACK}},
+		{"TIME-WAIT RST", StreamStatus_TimeWait, 4001, true,
+			testSegment(flag_RST, 1000, 0, nil), wantRST, nil},
+		{"TIME-WAIT RST out of window", StreamStatus_TimeWait, 4001, true,
+			testSegment(flag_RST, 1000+CNF_ReceiveWindow, 0, nil), StreamStatus_TimeWait, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s, sender = testStream(t, tt.status, tt.una, tt.fin)
+			if err := s.Receive(tt.segment); err != nil {
+				t.Fatalf("Stream.Receive() error = %v", err)
+			}
+			if got := s.status.Load(); got != tt.want {
+				t.Errorf("Stream.Receive() status = %v, want %v", got, tt.want)
+			}
+			if got := sender.flags(); !reflect.DeepEqual(got, tt.wantSent) {
+				t.Errorf("Stream.Receive() sent = %v, want %v", got, tt.wantSent)
+			}
+			if tt.wantSent != nil && tt.wantSent[0] == flag_RST && sender.segments[0].SequenceNumber() != tt.segment.AckNumber() {
+				t.Errorf("Stream.Receive() RST sequence = %v, want SEG.ACK %v", sender.segments[0].SequenceNumber(), tt.segment.AckNumber())
+			}
+		})
+	}
+}
+
+func TestStream_TimeWaitTimeout(t *testing.T) {
+	var s, _ = testStream(t, StreamStatus_FinWait1, 4000, true)
+	if err := s.Receive(testSegment(flag_FIN|flag_ACK, 1000, 4001, nil)); err != nil {
+		t.Fatalf("Stream.Receive() error = %v", err)
+	}
+	var now = monotonic.Now()
+	if next := s.timing.tw.CheckInterval(s, now); next <= 0 || s.status.Load() != StreamStatus_TimeWait {
+		t.Errorf("CheckInterval() before 2*MSL = %v, status = %v, want TIME-WAIT", next, s.status.Load())
+	}
+	now.Add(2*CNF_Timeout_MSL + 1)
+	s.timing.tw.CheckInterval(s, now)
+	if s.status.Load() != StreamStatus_Close {
+		t.Errorf("CheckInterval() after 2*MSL status = %v, want CLOSED", s.status.Load())
+	}
+}
+
+// Stream timings run on the timer goroutine at the same time that the stream worker call Receive(), run it with -race.
+func TestStream_TimerHandlerRace(t *testing.T) {
+	var s, _ = testStream(t, StreamStatus_Established, 4001, false)
+	var done = make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			s.timing.TimerHandler()
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		if err := s.Receive(testSegment(flag_ACK, 1000, 4001, nil)); err != nil {
+			t.Fatalf("Stream.Receive() error = %v", err)
+		}
+	}
+	<-done
+	if s.status.Load() != StreamStatus_Established {
+		t.Errorf("status = %v, want ESTABLISHED", s.status.Load())
+	}
+}
@@ -37,7 +37,9 @@ func (s *Stream) Close() (err error) {
 		return
 	}
 
+	s.sync.Lock()
 	err = s.close()
+	s.sync.Unlock()
 	return
 }
 func (s *Stream) LocalAddr() net.Addr {
@@ -78,7 +80,7 @@ func (s *Stream) SetWriteDeadline(t time.Time) (err error) {
 
 //libgo:impl std/net.TCPConn
 func (s *Stream) CloseRead() (err error)                         { return }
-func (s *Stream) CloseWrite() (err error)                        { return }
+func (s *Stream) CloseWrite() (err error)                        { return s.CloseSending() }
 func (s *Stream) SetLinger(sec int) (err error)                  { return }
 func (s *Stream) SetKeepAlive(keepalive bool) (err error)        { return }
 func (s *Stream) SetKeepAlivePeriod(d time.Duration) (err error) { return }
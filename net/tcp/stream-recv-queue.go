@@ -0,0 +1,101 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+// reassemblyQueue hold out-of-order received data until the missing data before it arrive.
+// Its ranges are the blocks that the stream report to the peer by the SACK option.
+type reassemblyQueue struct {
+	segments []receivedSegment // sorted by seq and not overlapped
+	last     uint32            // seq of the most recently received data, to report its block first
+}
+
+type receivedSegment struct {
+	seq     uint32
+	payload []byte
+}
+
+func (rs *receivedSegment) end() uint32 { return rs.seq + uint32(len(rs.payload)) }
+
+func (q *reassemblyQueue) Len() int { return len(q.segments) }
+
+// Insert copy the parts of the payload that aren't in the queue already.
+// The caller must not pass any data before the receive next.
+func (q *reassemblyQueue) Insert(seq uint32, payload []byte) {
+	if len(payload) == 0 {
+		return
+	}
+	q.last = seq
+
+	var segments = make([]receivedSegment, 0, len(q.segments)+1)
+	for _, rs := range q.segments {
+		if len(payload) > 0 && seqLT(seq, rs.seq) {
+			var ln = uint32(len(payload))
+			if gap := rs.seq - seq; ln > gap {
+				ln = gap
+			}
+			segments = append(segments, receivedSegment{seq, append([]byte(nil), payload[:ln]...)})
+			payload = payload[ln:]
+			seq += ln
+		}
+		segments = append(segments, rs)
+		// Drop the part that the queue already has.
+		if len(payload) > 0 && seqLT(seq, rs.end()) {
+			var dup = rs.end() - seq
+			if dup >= uint32(len(payload)) {
+				payload = nil
+			} else {
+				payload = payload[dup:]
+				seq = rs.end()
+			}
+		}
+	}
+	if len(payload) > 0 {
+		segments = append(segments, receivedSegment{seq, append([]byte(nil), payload...)})
+	}
+	q.segments = segments
+}
+
+// Pop remove and return the queued data that is in order by next, or nil if the data at next not received yet.
+// The caller must call it again with the new next until it returns nil.
+func (q *reassemblyQueue) Pop(next uint32) (payload []byte) {
+	for len(q.segments) > 0 {
+		var rs = q.segments[0]
+		if seqGT(rs.seq, next) {
+			return nil
+		}
+		q.segments = q.segments[1:]
+		if seqGT(rs.end(), next) {
+			return rs.payload[next-rs.seq:]
+		}
+	}
+	return nil
+}
+
+// Blocks append at most max blocks of the contiguous queued data. The first block contains the most recently
+// received data and the others are in descending order, as RFC 2018 section 4 says.
+func (q *reassemblyQueue) Blocks(blocks []sackBlock, max int) []sackBlock {
+	var first = -1
+	var start = len(blocks)
+	for i := len(q.segments) - 1; i >= 0; i-- {
+		var rs = &q.segments[i]
+		if len(blocks) > start && blocks[len(blocks)-1].left == rs.end() {
+			blocks[len(blocks)-1].left = rs.seq
+		} else {
+			blocks = append(blocks, sackBlock{rs.seq, rs.end()})
+		}
+		if seqLEQ(rs.seq, q.last) && seqLT(q.last, rs.end()) {
+			first = len(blocks) - 1
+		}
+	}
+	if first > start {
+		var recent = blocks[first]
+		copy(blocks[start+1:first+1], blocks[start:first])
+		blocks[start] = recent
+	}
+	if len(blocks)-start > max {
+		blocks = blocks[:start+max]
+	}
+	return blocks
+}
+
+func (q *reassemblyQueue) Reset() { q.segments = nil }
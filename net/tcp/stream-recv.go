@@ -13,11 +13,11 @@ type recv struct {
 	readTimer timer.Sync // read deadline timer
 
 	next uint32 // receive next
-	wnd  uint16 // receive window
+	wnd  uint32 // receive window
 	up   bool   // receive urgent pointer
 	irs  uint32 // initial receive sequence number
-	// TODO::: not in order segments
-	buf buffer.Queue
+	buf  buffer.Queue
+	ooo  reassemblyQueue // out-of-order received data
 
 	// TODO::: Send more than these flags: push, reset, finish, urgent
 	// TODO::: byte is not enough here to distinguish between flags in first byte or second one
@@ -27,6 +27,7 @@ type recv struct {
 //libgo:impl libgo/protocol.ObjectLifeCycle
 func (r *recv) Init(timeout protocol.Duration) (err protocol.Error) {
 	r.flag = make(chan flag, 1) // 1 buffer slot??
+	r.wnd = CNF_ReceiveWindow
 
 	err = r.readTimer.Init()
 	err = r.readTimer.Start(timeout)
@@ -40,6 +41,7 @@ func (r *recv) Reinit() (err protocol.Error) {
 }
 func (r *recv) Deinit() (err protocol.Error) {
 	// TODO:::
+	r.ooo.Reset()
 	err = r.readTimer.Deinit()
 	return
 }
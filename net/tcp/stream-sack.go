@@ -0,0 +1,65 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+// sack hold the Selective Acknowledgment state of a stream.
+// https://datatracker.ietf.org/doc/html/rfc2018
+// https://datatracker.ietf.org/doc/html/rfc6675
+type sack struct {
+	permitted bool // both sides sent SACK-permitted option in their SYN
+	// sacked is the bytes that SACK options of the processing segment newly SACKed.
+	sacked uint32
+	// option is the SACK option of the processing segment, nil if it has no one.
+	option optionSACK
+	// highRxt is the sequence number after the last octet retransmitted in the current loss recovery.
+	highRxt uint32
+	blocks  []sackBlock // reuse to make the SACK option of the outgoing segments
+}
+
+type sackBlock struct {
+	left  uint32 // first sequence number of the block
+	right uint32 // sequence number immediately following the last sequence number of the block
+}
+
+const (
+	// The max blocks that fit in the 40 bytes of the options with two leading NOP.
+	// One less block fit with the timestamps option.
+	sack_MaxBlocks = 4
+)
+
+// inFlight return the bytes that the stream consider in the network. In SACK loss recovery it is
+// the pipe as RFC 6675 section 4 says, otherwise all sent and unacknowledged bytes.
+func (s *Stream) inFlight() uint32 {
+	if s.sack.permitted && s.send.recovery {
+		return s.send.queue.Pipe(uint32(s.mss), s.sack.highRxt)
+	}
+	return s.send.next - s.send.una
+}
+
+// sackRecovery retransmit segments that the scoreboard consider lost as long as the congestion window allow,
+// as RFC 6675 section 5 steps (C) says. New data send by the writers.
+func (s *Stream) sackRecovery() {
+	var cwnd = s.cc.CongestionWindow()
+	for {
+		var pipe = s.send.queue.Pipe(uint32(s.mss), s.sack.highRxt)
+		if pipe+uint32(s.mss) > cwnd {
+			return
+		}
+		var qs = s.send.queue.NextSeg(uint32(s.mss), s.sack.highRxt)
+		if qs == nil {
+			return
+		}
+		var err = s.retransmit(qs)
+		if err != nil {
+			// TODO::: Lower layer can't send now, the retransmission timer will retransmit it.
+			return
+		}
+		s.sack.highRxt = qs.end()
+	}
+}
+
+// sackBlocks return at most max blocks of the out-of-order received data to report in the SACK option.
+func (s *Stream) sackBlocks(max int) []sackBlock {
+	s.sack.blocks = s.recv.ooo.Blocks(s.sack.blocks[:0], max)
+	return s.sack.blocks
+}
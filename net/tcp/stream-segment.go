@@ -0,0 +1,80 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+import (
+	"libgo/protocol"
+	"libgo/time/monotonic"
+)
+
+// SegmentSender is the lower layer (e.g. IPv4 or IPv6) that deliver the stream segments to the peer.
+// It must set the checksum, because the checksum depends on the pseudo header of the lower layer.
+// The stream never reuse the segment after pass it, so the sender can hold it.
+type SegmentSender interface {
+	SendSegment(segment Segment) (err protocol.Error)
+}
+
+// SetSender set the lower layer that the stream use to send its segments.
+func (s *Stream) SetSender(sender SegmentSender) { s.sender = sender }
+
+// makeSegment make a segment with given flags that carry the payload from seq.
+// The acknowledgment number set just if flags has flag_ACK.
+func (s *Stream) makeSegment(flags flag, seq uint32, payload []byte) (segment Segment) {
+	var options = s.makeOptions(flags)
+	var dataOffset = CNF_Segment_MinSize + len(options)
+	segment = make(Segment, dataOffset+len(payload))
+	segment.SetSourcePort(s.sourcePort)
+	segment.SetDestinationPort(s.destinationPort)
+	segment.SetSequenceNumber(seq)
+	if flags&flag_ACK != 0 {
+		segment.SetAckNumber(s.recv.next)
+		s.ts.lastACKSent = s.recv.next
+	}
+	segment.SetDataOffset(uint8(dataOffset))
+	segment.SetFlagPartTwo(byte(flags))
+	segment.SetOptions(options)
+	segment.SetWindow(s.advertisedWindow(flags))
+	segment.SetPayload(payload)
+	return
+}
+
+// makeOptions make the options of a segment with given flags. Each option aligned to 4 bytes by itself.
+func (s *Stream) makeOptions(flags flag) (options []byte) {
+	if flags&flag_SYN != 0 {
+		// Offer options in SYN, but answer a SYN just by the options that the peer offered.
+		var answer = flags&flag_ACK != 0
+		if CNF_Sack && (!answer || s.sack.permitted) {
+			options = appendSACKPermitted(options)
+		}
+		if CNF_WindowScale && (!answer || s.wscale.enabled) {
+			options = appendWindowScale(options, s.wscale.recv)
+		}
+		if CNF_Timestamps && (!answer || s.ts.enabled) {
+			options = appendTimestamps(options, timestampsClock(monotonic.Now()), s.ts.recent)
+		}
+		return
+	}
+	if s.ts.enabled && flags&flag_RST == 0 {
+		options = appendTimestamps(options, timestampsClock(monotonic.Now()), s.ts.recent)
+	}
+	if flags&flag_ACK != 0 && s.sack.permitted && s.recv.ooo.Len() > 0 {
+		var max = sack_MaxBlocks
+		if s.ts.enabled {
+			max--
+		}
+		options = appendSACK(options, s.sackBlocks(max))
+	}
+	return
+}
+
+func (s *Stream) sendSegment(segment Segment) (err protocol.Error) {
+	if s.sender == nil {
+		return &ErrNoSender
+	}
+	err = s.sender.SendSegment(segment)
+	if err != nil {
+		return
+	}
+	s.lastUse = monotonic.Now()
+	return
+}
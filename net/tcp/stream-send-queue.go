@@ -0,0 +1,177 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+import (
+	"libgo/protocol"
+	"libgo/time/monotonic"
+)
+
+// retransmissionQueue hold sent segments in sequence order until the peer acknowledge them.
+// It keep the flags and the payload not the segment itself, so a retransmission carry the last
+// acknowledgment number and window of the stream.
+// It is the SACK scoreboard too, each segment know if the peer SACKed it.
+type retransmissionQueue struct {
+	segments []queuedSegment
+}
+
+type queuedSegment struct {
+	seq           uint32
+	flags         flag // just flag_SYN and flag_FIN matter to the sequence space
+	payload       []byte
+	sent          monotonic.Time
+	retransmitted bool
+	sacked        bool
+}
+
+// end return the sequence number after the last octet the segment occupy.
+func (qs *queuedSegment) end() uint32 {
+	var end = qs.seq + uint32(len(qs.payload))
+	if qs.flags&flag_SYN != 0 {
+		end++
+	}
+	if qs.flags&flag_FIN != 0 {
+		end++
+	}
+	return end
+}
+
+func (q *retransmissionQueue) Len() int { return len(q.segments) }
+
+// First return the earliest unacknowledged segment or nil if the queue is empty.
+func (q *retransmissionQueue) First() *queuedSegment {
+	if len(q.segments) == 0 {
+		return nil
+	}
+	return &q.segments[0]
+}
+
+// Push add the sent segment to the queue and return the sequence number after it.
+func (q *retransmissionQueue) Push(seq uint32, flags flag, payload []byte, now monotonic.Time) (end uint32) {
+	q.segments = append(q.segments, queuedSegment{
+		seq:     seq,
+		flags:   flags,
+		payload: payload,
+		sent:    now,
+	})
+	return q.segments[len(q.segments)-1].end()
+}
+
+// Acknowledge remove all segments that ack cover entirely and trim the one it cover partially.
+// rtt is the round-trip time of the last fully acknowledged segment that never retransmitted (Karn's algorithm),
+// and measured is false if no such segment exist.
+func (q *retransmissionQueue) Acknowledge(ack uint32, now monotonic.Time) (rtt protocol.Duration, measured bool) {
+	var i int
+	for ; i < len(q.segments); i++ {
+		var qs = &q.segments[i]
+		if seqGT(qs.end(), ack) {
+			if seqGT(ack, qs.seq) {
+				// SYN is always the first octet, so a partial ACK acknowledge it.
+				var acked = ack - qs.seq
+				if qs.flags&flag_SYN != 0 {
+					qs.flags &^= flag_SYN
+					acked--
+				}
+				qs.payload = qs.payload[acked:]
+				qs.seq = ack
+			}
+			break
+		}
+		if !qs.retransmitted {
+			rtt = protocol.Duration(now - qs.sent)
+			measured = true
+		}
+	}
+	q.segments = q.segments[i:]
+	return
+}
+
+func (q *retransmissionQueue) Reset() { q.segments = nil }
+
+// SACK mark segments that the block [left, right) cover entirely and return their newly SACKed bytes.
+func (q *retransmissionQueue) SACK(left, right uint32) (sacked uint32) {
+	for i := range q.segments {
+		var qs = &q.segments[i]
+		if seqGEQ(qs.seq, right) {
+			break
+		}
+		if !qs.sacked && seqGEQ(qs.seq, left) && seqLEQ(qs.end(), right) {
+			qs.sacked = true
+			sacked += qs.end() - qs.seq
+		}
+	}
+	return
+}
+
+// ClearSACK forget all SACKed marks, because the peer can discard SACKed data (reneging), so after RTO
+// all segments must retransmit as RFC 2018 section 8 says.
+func (q *retransmissionQueue) ClearSACK() {
+	for i := range q.segments {
+		q.segments[i].sacked = false
+	}
+}
+
+// IsLost report whether the scoreboard consider the i-th segment lost as RFC 6675 section 4 says.
+func (q *retransmissionQueue) IsLost(i int, mss uint32) bool {
+	var sackedSegments, sackedBytes uint32
+	for _, qs := range q.segments[i+1:] {
+		if qs.sacked {
+			sackedSegments++
+			sackedBytes += qs.end() - qs.seq
+		}
+	}
+	return sackLost(sackedSegments, sackedBytes, mss)
+}
+
+// Pipe return the bytes that are still in the network as RFC 6675 SetPipe() says.
+// highRxt is the sequence number after the last octet retransmitted in the current loss recovery.
+func (q *retransmissionQueue) Pipe(mss, highRxt uint32) (pipe uint32) {
+	var sackedSegments, sackedBytes uint32
+	for i := len(q.segments) - 1; i >= 0; i-- {
+		var qs = &q.segments[i]
+		var ln = qs.end() - qs.seq
+		if qs.sacked {
+			sackedSegments++
+			sackedBytes += ln
+			continue
+		}
+		if !sackLost(sackedSegments, sackedBytes, mss) {
+			pipe += ln
+		}
+		if seqLT(qs.seq, highRxt) {
+			pipe += ln
+		}
+	}
+	return
+}
+
+// NextSeg return the segment to retransmit in the loss recovery or nil if nothing to retransmit,
+// as rules 1 and 3 of RFC 6675 NextSeg() say. Rule 2, send new data, is the writers job.
+func (q *retransmissionQueue) NextSeg(mss, highRxt uint32) (next *queuedSegment) {
+	var rescue *queuedSegment
+	var sackedSegments, sackedBytes uint32
+	for i := len(q.segments) - 1; i >= 0; i-- {
+		var qs = &q.segments[i]
+		if qs.sacked {
+			sackedSegments++
+			sackedBytes += qs.end() - qs.seq
+			continue
+		}
+		if seqLT(qs.seq, highRxt) {
+			break
+		}
+		if sackLost(sackedSegments, sackedBytes, mss) {
+			next = qs
+		} else if sackedSegments > 0 {
+			rescue = qs
+		}
+	}
+	if next == nil {
+		next = rescue
+	}
+	return
+}
+
+func sackLost(sackedSegments, sackedBytes, mss uint32) bool {
+	return sackedSegments >= CNF_DupACKThreshold || sackedBytes > (CNF_DupACKThreshold-1)*mss
+}
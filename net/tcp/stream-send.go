@@ -4,6 +4,7 @@ package tcp
 
 import (
 	"libgo/protocol"
+	"libgo/time/monotonic"
 	"libgo/timer"
 )
 
@@ -13,16 +14,28 @@ type send struct {
 
 	una  uint32 // send unacknowledged
 	next uint32
-	wnd  uint16 // send window
+	wnd  uint32 // send window
 	up   bool   // send urgent pointer
 	wl1  uint32 // segment sequence number used for last window update
 	wl2  uint32 // segment acknowledgment number used for last window update
 	iss  uint32 // initial send sequence number
+	fin  bool   // FIN sent and its sequence number is next-1
+
+	dupACKs  int            // duplicate ACKs received for una
+	recovery bool           // in fast recovery
+	recover  uint32         // next when the fast recovery started, NewReno exit the recovery when it acknowledged
+	nextSend monotonic.Time // the pacing allow next segment send after this time
+
+	queue retransmissionQueue
+	// window notify writers blocked on a full window that the peer acknowledged data or opened its window.
+	window chan struct{}
 	// buf    []byte Don't need it, because we don't need to copy buffer between kernel and user-space
 }
 
 //libgo:impl libgo/protocol.ObjectLifeCycle
 func (s *send) Init(timeout protocol.Duration) (err protocol.Error) {
+	s.window = make(chan struct{}, 1)
+	s.recover = s.iss
 	err = s.writeTimer.Init()
 	err = s.writeTimer.Start(timeout)
 
@@ -35,6 +48,21 @@ func (s *send) Reinit() (err protocol.Error) {
 }
 func (s *send) Deinit() (err protocol.Error) {
 	// TODO:::
+	s.queue.Reset()
+	s.dupACKs = 0
+	s.recovery = false
+	s.nextSend = 0
 	err = s.writeTimer.Deinit()
 	return
 }
+
+// signalWindow notify a blocked writer if any exist.
+func (s *send) signalWindow() {
+	select {
+	case s.window <- struct{}{}:
+	default:
+	}
+}
+
+// finAcked report whether the peer acknowledged our FIN.
+func (s *send) finAcked() bool { return s.fin && s.una == s.next }
@@ -0,0 +1,65 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+import (
+	"libgo/protocol"
+	"libgo/time/monotonic"
+	"libgo/timer"
+)
+
+// timestamps hold the timestamps state of a stream for round-trip time measurement (RTTM)
+// and protection against wrapped sequence numbers (PAWS).
+// https://www.rfc-editor.org/rfc/rfc7323#section-3
+type timestamps struct {
+	enabled     bool           // both sides sent timestamps option in their SYN
+	recent      uint32         // TS.Recent, the peer timestamp to echo
+	recentAge   monotonic.Time // when recent updated
+	lastACKSent uint32         // Last.ACK.sent, the acknowledgment number of the last sent segment
+
+	// Timestamps option of the processing segment
+	received bool
+	val      uint32
+	ecr      uint32
+}
+
+// After this idle time TS.Recent is invalid, because the peer clock may wrap, as RFC 7323 section 5.5 says.
+const timestamps_RecentMaxIdle = 24 * 24 * 3600 * timer.Second
+
+// timestampsClock return our timestamp clock at now, that ticks each millisecond.
+func timestampsClock(now monotonic.Time) uint32 {
+	return uint32(protocol.Duration(now) / timer.Millisecond)
+}
+
+// Accept report whether the processing segment pass PAWS test of RFC 7323 section 5.3 R1.
+// RST segments must be acceptable regardless of their timestamp.
+func (ts *timestamps) Accept(rst bool, now monotonic.Time) bool {
+	if !ts.enabled || !ts.received || rst {
+		return true
+	}
+	if seqGEQ(ts.val, ts.recent) {
+		return true
+	}
+	return protocol.Duration(now-ts.recentAge) > timestamps_RecentMaxIdle
+}
+
+// Update record the timestamp of the processing segment to echo it, if it is not older than TS.Recent and
+// the segment start at or before the last sent acknowledgment, as RFC 7323 section 4.3 says.
+func (ts *timestamps) Update(seq uint32, now monotonic.Time) {
+	if !ts.enabled || !ts.received || !seqGEQ(ts.val, ts.recent) || seqGT(seq, ts.lastACKSent) {
+		return
+	}
+	ts.recent = ts.val
+	ts.recentAge = now
+}
+
+// RTT measure the round-trip time by the echoed timestamp of the processing segment as RFC 7323 section 4 says.
+// It is valid even for retransmitted segments.
+func (ts *timestamps) RTT(now monotonic.Time) (rtt protocol.Duration, measured bool) {
+	if !ts.enabled || !ts.received {
+		return
+	}
+	rtt = protocol.Duration(timestampsClock(now)-ts.ecr) * timer.Millisecond
+	measured = true
+	return
+}
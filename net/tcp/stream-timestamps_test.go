@@ -0,0 +1,73 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+import (
+	"testing"
+
+	"libgo/time/monotonic"
+	"libgo/timer"
+)
+
+func TestTimestamps(t *testing.T) {
+	var now = monotonic.Time(10 * timer.Second)
+	var ts = timestamps{enabled: true, recent: 1000, recentAge: now, lastACKSent: 5000}
+
+	ts.received, ts.val = true, 999
+	if ts.Accept(false, now) {
+		t.Errorf("Accept() old timestamp = true, want false")
+	}
+	if !ts.Accept(true, now) {
+		t.Errorf("Accept() old timestamp on RST = false, want true")
+	}
+	var idle = now
+	idle.Add(timestamps_RecentMaxIdle + 1)
+	if !ts.Accept(false, idle) {
+		t.Errorf("Accept() old timestamp after TS.Recent idle = false, want true")
+	}
+
+	// Wrapped peer clock is newer.
+	ts.recent, ts.val = 0xFFFFFF00, 10
+	if !ts.Accept(false, now) {
+		t.Errorf("Accept() wrapped timestamp = false, want true")
+	}
+	ts.Update(6000, now)
+	if ts.recent != 0xFFFFFF00 {
+		t.Errorf("Update() by segment after Last.ACK.sent changed TS.Recent to %v", ts.recent)
+	}
+	ts.Update(5000, now)
+	if ts.recent != 10 {
+		t.Errorf("Update() TS.Recent = %v, want 10", ts.recent)
+	}
+
+	ts.ecr = timestampsClock(now) - 150
+	if rtt, measured := ts.RTT(now); !measured || rtt != 150*timer.Millisecond {
+		t.Errorf("RTT() = %v, %v, want 150ms", rtt, measured)
+	}
+	ts.received = false
+	if _, measured := ts.RTT(now); measured {
+		t.Errorf("RTT() without timestamps option measured")
+	}
+}
+
+func TestWindowScale(t *testing.T) {
+	var ws windowScale
+	ws.Init()
+	if CNF_ReceiveWindow>>ws.recv > 0xFFFF || (ws.recv > 0 && CNF_ReceiveWindow>>(ws.recv-1) <= 0xFFFF) {
+		t.Errorf("Init() shift = %v, not the smallest that fit %v", ws.recv, CNF_ReceiveWindow)
+	}
+
+	var b = appendTimestamps(appendWindowScale(nil, 7), 1, 2)
+	if len(b) != 16 {
+		t.Fatalf("appendWindowScale() and appendTimestamps() = %v bytes, want 16", len(b))
+	}
+	var o = optionWindowScale(Options(b[1:]).Payload())
+	if o.Length() != 3 || o.WindowScale() != 7 {
+		t.Errorf("optionWindowScale = %v, want 7", o)
+	}
+	var next = Options(o.NextOption()[2:])
+	var ot = optionTimestamps(next.Payload())
+	if next.Kind() != OptionKind_Timestamps || ot.TSval() != 1 || ot.TSecr() != 2 || len(ot.NextOption()) != 0 {
+		t.Errorf("optionTimestamps = %v, want 1, 2", ot)
+	}
+}
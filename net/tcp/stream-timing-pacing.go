@@ -0,0 +1,47 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+import (
+	"libgo/protocol"
+	"libgo/time/monotonic"
+)
+
+// timingPacing wake a writer that the pacing rate blocked it, when the pacing allow it to send again.
+type timingPacing struct {
+	nextCheck monotonic.Time // 0 means no writer wait for the pacing
+}
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (pc *timingPacing) Init(now monotonic.Time) (next protocol.Duration, err protocol.Error) {
+	return -1, nil
+}
+func (pc *timingPacing) Reinit() (err protocol.Error) {
+	pc.nextCheck = 0
+	return
+}
+func (pc *timingPacing) Deinit() (err protocol.Error) {
+	pc.nextCheck = 0
+	return
+}
+
+// Start wake the writer at the given time.
+func (pc *timingPacing) Start(at, now monotonic.Time) (next protocol.Duration) {
+	pc.nextCheck = at
+	return at.Until(now)
+}
+
+// Don't block the caller
+func (pc *timingPacing) CheckInterval(st *Stream, now monotonic.Time) (next protocol.Duration) {
+	if pc.nextCheck == 0 {
+		return -1
+	}
+
+	next = pc.nextCheck.Until(now)
+	if next > 0 {
+		return
+	}
+	pc.nextCheck = 0
+	st.send.signalWindow()
+	return -1
+}
@@ -0,0 +1,81 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+import (
+	"libgo/protocol"
+	"libgo/time/monotonic"
+)
+
+// timingRetransmission retransmit the earliest unacknowledged segment each time the RTO pass without any
+// new acknowledgment, and reset the stream when the RTO expired CNF_RTO_Retries times for the same segment.
+// It is driven by the stream timer like other stream timings, so no timer or goroutine need per segment.
+// https://www.rfc-editor.org/rfc/rfc6298#section-5
+type timingRetransmission struct {
+	rtt       rttEstimator
+	nextCheck monotonic.Time // 0 means the retransmission timer is off
+}
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (rt *timingRetransmission) Init(now monotonic.Time) (next protocol.Duration, err protocol.Error) {
+	err = rt.rtt.Init()
+	return -1, err
+}
+func (rt *timingRetransmission) Reinit() (err protocol.Error) {
+	rt.nextCheck = 0
+	err = rt.rtt.Reinit()
+	return
+}
+func (rt *timingRetransmission) Deinit() (err protocol.Error) {
+	rt.nextCheck = 0
+	err = rt.rtt.Deinit()
+	return
+}
+
+func (rt *timingRetransmission) Running() bool { return rt.nextCheck != 0 }
+
+// Start (re)start the retransmission timer so that it will expire after RTO from now.
+func (rt *timingRetransmission) Start(now monotonic.Time) (next protocol.Duration) {
+	next = rt.rtt.RTO()
+	now.Add(next)
+	rt.nextCheck = now
+	return
+}
+
+// Stop turn off the retransmission timer e.g. when all outstanding data acknowledged.
+func (rt *timingRetransmission) Stop() { rt.nextCheck = 0 }
+
+// Don't block the caller
+func (rt *timingRetransmission) CheckInterval(st *Stream, now monotonic.Time) (next protocol.Duration) {
+	if rt.nextCheck == 0 {
+		return -1
+	}
+
+	next = rt.nextCheck.Until(now)
+	if next > 0 {
+		return
+	}
+
+	var qs = st.send.queue.First()
+	if qs == nil {
+		rt.nextCheck = 0
+		return -1
+	}
+	if rt.rtt.Backoffs() >= CNF_RTO_Retries {
+		rt.nextCheck = 0
+		var err = st.reset()
+		if err != nil {
+			// TODO:::
+		}
+		return -1
+	}
+
+	st.timeoutLoss(now)
+	rt.rtt.Backoff()
+	var err = st.retransmit(qs)
+	if err != nil {
+		// TODO::: Lower layer can't send now, try again after the new RTO.
+	}
+	next = rt.Start(now)
+	return
+}
@@ -0,0 +1,56 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+import (
+	"libgo/protocol"
+	"libgo/time/monotonic"
+)
+
+// timingTimeWait close the stream when its timeout pass in TIME_WAIT state (2*MSL),
+// or in FIN_WAIT_2 state (CNF_FinTimeout) if the peer never send its FIN.
+// https://www.rfc-editor.org/rfc/rfc9293#section-3.6.1
+type timingTimeWait struct {
+	nextCheck monotonic.Time // 0 means not started
+}
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (tw *timingTimeWait) Init(now monotonic.Time) (next protocol.Duration, err protocol.Error) {
+	return -1, nil
+}
+func (tw *timingTimeWait) Reinit() (err protocol.Error) {
+	tw.nextCheck = 0
+	return
+}
+func (tw *timingTimeWait) Deinit() (err protocol.Error) {
+	return
+}
+
+// Start (re)start the timeout from now, e.g. when a retransmitted FIN received in TIME_WAIT state.
+func (tw *timingTimeWait) Start(now monotonic.Time, timeout protocol.Duration) (next protocol.Duration) {
+	now.Add(timeout)
+	tw.nextCheck = now
+	return timeout
+}
+
+// Don't block the caller
+func (tw *timingTimeWait) CheckInterval(st *Stream, now monotonic.Time) (next protocol.Duration) {
+	if tw.nextCheck == 0 {
+		return -1
+	}
+
+	next = tw.nextCheck.Until(now)
+	if next > 0 {
+		return
+	}
+	tw.nextCheck = 0
+
+	switch st.status.Load() {
+	case StreamStatus_TimeWait, StreamStatus_FinWait2:
+		var err = st.closed()
+		if err != nil {
+			// TODO:::
+		}
+	}
+	return -1
+}
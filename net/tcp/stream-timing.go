@@ -12,9 +12,13 @@ type timing struct {
 	st *Stream
 	// TODO::: one timer or many per handler or two timer for high accurate and low one??
 	streamTimer timer.Async
+	nextCheck   monotonic.Time // 0 means streamTimer is not waiting
 
 	ka timingKeepAlive
 	de delayedAcknowledgment
+	tw timingTimeWait
+	rt timingRetransmission
+	pc timingPacing
 }
 
 //libgo:impl libgo/protocol.ObjectLifeCycle
@@ -23,13 +27,15 @@ func (t *timing) Init(st *Stream) (err protocol.Error) {
 	var next protocol.Duration
 
 	t.st = st
+	err = t.streamTimer.Init(t)
+	if err != nil {
+		return
+	}
 
 	if CNF_KeepAlive {
 		var nxt protocol.Duration
 		nxt, err = t.ka.Init(now)
-		if nxt > 0 && nxt < next {
-			next = nxt
-		}
+		next = sooner(next, nxt)
 	}
 
 	if CNF_DelayedAcknowledgment {
@@ -38,15 +44,29 @@ func (t *timing) Init(st *Stream) (err protocol.Error) {
 		if err != nil {
 			return
 		}
-		if nxt > 0 && nxt < next {
-			next = nxt
-		}
+		next = sooner(next, nxt)
+	}
+
+	var nxt protocol.Duration
+	nxt, err = t.tw.Init(now)
+	if err != nil {
+		return
+	}
+	next = sooner(next, nxt)
+
+	nxt, err = t.rt.Init(now)
+	if err != nil {
+		return
 	}
+	next = sooner(next, nxt)
 
-	if next > 0 {
-		err = t.streamTimer.Init(t)
-		err = t.streamTimer.Tick(next, next)
+	nxt, err = t.pc.Init(now)
+	if err != nil {
+		return
 	}
+	next = sooner(next, nxt)
+
+	t.schedule(now, next)
 	return
 }
 func (t *timing) Reinit() (err protocol.Error) {
@@ -62,6 +82,19 @@ func (t *timing) Reinit() (err protocol.Error) {
 			return
 		}
 	}
+	err = t.tw.Reinit()
+	if err != nil {
+		return
+	}
+	err = t.rt.Reinit()
+	if err != nil {
+		return
+	}
+	err = t.pc.Reinit()
+	if err != nil {
+		return
+	}
+	t.nextCheck = 0
 	err = t.streamTimer.Stop()
 	return
 }
@@ -78,33 +111,73 @@ func (t *timing) Deinit() (err protocol.Error) {
 			return
 		}
 	}
+	err = t.tw.Deinit()
+	if err != nil {
+		return
+	}
+	err = t.rt.Deinit()
+	if err != nil {
+		return
+	}
+	err = t.pc.Deinit()
+	if err != nil {
+		return
+	}
+	t.nextCheck = 0
 	err = t.streamTimer.Stop()
 	return
 }
 
+// TimerHandler run on the timer goroutine, so it takes the stream lock to not race with the stream worker.
 // Don't block the caller
 func (t *timing) TimerHandler() {
 	var next protocol.Duration
 	var now = monotonic.Now()
 	var st = t.st
+	st.sync.Lock()
+	t.nextCheck = 0
 
 	if CNF_KeepAlive {
-		var nxt = t.ka.CheckInterval(st, now)
-		if nxt > 0 && nxt < next {
-			next = nxt
-		}
+		next = sooner(next, t.ka.CheckInterval(st, now))
 	}
 
 	if CNF_DelayedAcknowledgment {
-		var nxt = t.de.CheckInterval(st, now)
-		if nxt > 0 && nxt < next {
-			next = nxt
-		}
+		next = sooner(next, t.de.CheckInterval(st, now))
 	}
 
+	next = sooner(next, t.tw.CheckInterval(st, now))
+	next = sooner(next, t.rt.CheckInterval(st, now))
+	next = sooner(next, t.pc.CheckInterval(st, now))
+
 	// TODO::: add more handler
 
-	if next > 0 {
-		t.streamTimer.Reset(protocol.Duration(next))
+	// Stream closed by a handler and its timer stopped.
+	if st.status.Load() != StreamStatus_Close {
+		t.schedule(now, next)
+	}
+	st.sync.Unlock()
+}
+
+// schedule reset the stream timer if d is sooner than the timer is waiting for.
+// Handlers call it when they start a new timeout out of TimerHandler e.g. by a segment arrive.
+func (t *timing) schedule(now monotonic.Time, d protocol.Duration) {
+	if d <= 0 {
+		return
+	}
+	now.Add(d)
+	if t.nextCheck != 0 && !t.nextCheck.Pass(now) {
+		return
+	}
+	var err = t.streamTimer.Reset(d)
+	if err == nil {
+		t.nextCheck = now
+	}
+}
+
+// sooner return the sooner positive duration. Zero or negative duration means no timeout need.
+func sooner(d, other protocol.Duration) protocol.Duration {
+	if other > 0 && (d <= 0 || other < d) {
+		return other
 	}
+	return d
 }
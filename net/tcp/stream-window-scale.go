@@ -0,0 +1,52 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package tcp
+
+// windowScale hold the window scale state of a stream, to use windows larger than 64KB.
+// https://www.rfc-editor.org/rfc/rfc7323#section-2
+type windowScale struct {
+	enabled bool  // both sides sent window scale option in their SYN
+	send    uint8 // shift count of the peer, to scale the windows it advertise
+	recv    uint8 // our shift count, to scale the windows we advertise
+}
+
+const windowScale_MaxShift = 14
+
+// Init choose the smallest shift count that can advertise CNF_ReceiveWindow.
+func (ws *windowScale) Init() {
+	ws.enabled = false
+	ws.send = 0
+	ws.recv = 0
+	for CNF_ReceiveWindow>>ws.recv > 0xFFFF && ws.recv < windowScale_MaxShift {
+		ws.recv++
+	}
+}
+
+// windowScaleNegotiated limit the receive window to what can advertise without scaling if the peer doesn't support it.
+// It must call after the options of the peer SYN processed.
+func (s *Stream) windowScaleNegotiated() {
+	if !s.wscale.enabled && s.recv.wnd > 0xFFFF {
+		s.recv.wnd = 0xFFFF
+	}
+}
+
+// advertisedWindow return the window field of a segment with given flags. The window of a SYN is never scaled.
+func (s *Stream) advertisedWindow(flags flag) uint16 {
+	var wnd = s.recv.wnd
+	if flags&flag_SYN == 0 && s.wscale.enabled {
+		wnd >>= s.wscale.recv
+	}
+	if wnd > 0xFFFF {
+		wnd = 0xFFFF
+	}
+	return uint16(wnd)
+}
+
+// segmentWindow return the window that the peer advertised in the segment in bytes.
+func (s *Stream) segmentWindow(segment Segment) uint32 {
+	var wnd = uint32(segment.Window())
+	if !segment.FlagSYN() && s.wscale.enabled {
+		wnd <<= s.wscale.send
+	}
+	return wnd
+}
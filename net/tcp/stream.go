@@ -3,14 +3,19 @@
 package tcp
 
 import (
+	"sync"
+
 	"libgo/protocol"
 	"libgo/time/monotonic"
 	"libgo/time/utc"
 )
 
 // Stream provide some fields to hold stream states.
-// Because each stream methods just call by a fixed worker on same CPU core in sync order, don't need to lock or changed atomic any field
+// Segments arrive on the worker of the stream but its timings run on the timer goroutine, so both of them and
+// the user calls that change the stream states take the stream lock. Internal methods expect the caller hold it.
 type Stream struct {
+	sync sync.Mutex
+
 	connection      protocol.Connection
 	mtu             int
 	mss             int    // Max Segment Length
@@ -21,12 +26,21 @@ type Stream struct {
 	lastUse monotonic.Time
 
 	nextHandler protocol.NetworkCommonHandler
+	sender      SegmentSender
+
+	// cc decide the congestion window and the pacing rate of the stream.
+	cc CongestionController
+	// rateLimit is the max bytes per second that the application allow the stream to send. 0 means no limit.
+	rateLimit uint64
 
 	// TODO::: Cookie, save stream in nvm
 
 	timing
 	send
 	recv
+	sack   sack
+	wscale windowScale
+	ts     timestamps
 
 	// Stream use to send or receive data on specific connection.
 	// It can pass to logic layer to give data access to developer!
@@ -63,6 +77,12 @@ func (s *Stream) Init(timeout protocol.Duration) (err protocol.Error) {
 	if err != nil {
 		return
 	}
+	s.cc, err = NewCongestionController(CNF_CongestionControlAlgorithm)
+	if err != nil {
+		return
+	}
+	s.cc.Init(uint32(s.mss), monotonic.Now())
+	s.wscale.Init()
 	err = s.recv.Init(timeout)
 	if err != nil {
 		return
@@ -109,20 +129,25 @@ func (s *Stream) Reset() (err protocol.Error) {
 
 // Open call when a client want to open the stream on the client side.
 func (s *Stream) Open() (err protocol.Error) {
+	s.sync.Lock()
 	err = s.sendSYN()
 	s.status.Store(StreamStatus_SynSent)
+	s.sync.Unlock()
 	// TODO::: timer, retry, change status, block on status change until StreamStatus_Established
 	return
 }
 
 // CloseSending close the sending side of a stream. Much like close except that we don't receive shut down
 func (s *Stream) CloseSending() (err protocol.Error) {
+	s.sync.Lock()
+	err = s.close()
+	s.sync.Unlock()
 	return
 }
 
 // Receive Don't hold segment, So caller can reuse packet slice for any purpose.
 // It must be non blocking and just route packet not to wait for anything else.
-// for each stream upper layer must call by same CPU(core), so we don't need implement any locking mechanism.
+// for each stream upper layer must call by same CPU(core), so the stream lock just wait for the stream timings.
 // https://git.kernel.org/pub/scm/linux/kernel/git/torvalds/linux.git/tree/net/ipv4/tcp_ipv4.c#n1965
 func (s *Stream) Receive(segment Segment) (err protocol.Error) {
 	err = segment.CheckSegment()
@@ -130,6 +155,8 @@ func (s *Stream) Receive(segment Segment) (err protocol.Error) {
 		return
 	}
 
+	s.sync.Lock()
+	s.lastUse = monotonic.Now()
 	// TODO:::
 
 	switch s.status.Load() {
@@ -156,6 +183,7 @@ func (s *Stream) Receive(segment Segment) (err protocol.Error) {
 	case StreamStatus_TimeWait:
 		err = s.incomeSegmentOnTimeWaitState(segment)
 	}
+	s.sync.Unlock()
 	return
 }
 
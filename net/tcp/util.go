@@ -1,3 +1,11 @@
 /* For license and copyright information please see the LEGAL file in the code repository */
 
 package tcp
+
+// Sequence numbers compare in modulo 2^32 arithmetic as RFC 793 section 3.3 says,
+// so they remain correct after the sequence space wrapped around.
+// https://datatracker.ietf.org/doc/html/rfc793#section-3.3
+func seqLT(a, b uint32) bool  { return int32(a-b) < 0 }
+func seqLEQ(a, b uint32) bool { return int32(a-b) <= 0 }
+func seqGT(a, b uint32) bool  { return int32(a-b) > 0 }
+func seqGEQ(a, b uint32) bool { return int32(a-b) >= 0 }
@@ -0,0 +1,48 @@
+/* For license and copyright information please see LEGAL file in repository */
+
+package dos
+
+import (
+	"errors"
+	goos "os"
+	"syscall"
+
+	er "../../error"
+	"../../protocol"
+)
+
+// Errors - Storage
+var (
+	ErrStorageDeviceProblem er.Error
+	ErrStorageNotExist      er.Error
+	ErrStorageExist         er.Error
+	ErrStorageNotAuthorize  er.Error
+	ErrStorageOutOfRange    er.Error
+	ErrStorageNoSpace       er.Error
+)
+
+func init() {
+	ErrStorageDeviceProblem.Init("domain/libgo.scm.geniuses.group; package=os-default; type=error; name=storage-device-problem")
+	ErrStorageNotExist.Init("domain/libgo.scm.geniuses.group; package=os-default; type=error; name=storage-not-exist")
+	ErrStorageExist.Init("domain/libgo.scm.geniuses.group; package=os-default; type=error; name=storage-exist")
+	ErrStorageNotAuthorize.Init("domain/libgo.scm.geniuses.group; package=os-default; type=error; name=storage-not-authorize")
+	ErrStorageOutOfRange.Init("domain/libgo.scm.geniuses.group; package=os-default; type=error; name=storage-out-of-range")
+	ErrStorageNoSpace.Init("domain/libgo.scm.geniuses.group; package=os-default; type=error; name=storage-no-space")
+}
+
+// storageError map an error of the go os package to the package errors.
+func storageError(goErr error) (err protocol.Error) {
+	switch {
+	case errors.Is(goErr, goos.ErrNotExist):
+		err = &ErrStorageNotExist
+	case errors.Is(goErr, goos.ErrExist):
+		err = &ErrStorageExist
+	case errors.Is(goErr, goos.ErrPermission):
+		err = &ErrStorageNotAuthorize
+	case errors.Is(goErr, syscall.ENOSPC):
+		err = &ErrStorageNoSpace
+	default:
+		err = &ErrStorageDeviceProblem
+	}
+	return
+}
@@ -6,68 +6,88 @@ dos abbreviations for "Default Operating System"
 package dos
 
 import (
+	"errors"
+	"net/url"
 	goos "os"
 	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
-	"../../file"
 	"../../protocol"
 )
 
 // FileDirectory use to store app needed data from repo like html, css, js, ...
+// Sub directories and files load lazily on first access, so init a big tree is cheap.
+// Deleted files and directories move to the recycle bin in the root directory of the tree
+// with a freedesktop.org trash info file beside them, so they can restore manually.
+// https://specifications.freedesktop.org/trash-spec/trashspec-latest.html
 type FileDirectory struct {
 	metadata        fileDirectoryMetaData
+	path            string                    // OS path of the directory that always end with "/"
 	parentDirectory *FileDirectory            // Not nill if the directory has parent!
-	directories     map[string]*FileDirectory // map key is dir name
-	files           map[string]*File          // map key is file name
+	directories     map[string]*FileDirectory // map key is dir name, nil value means not loaded yet
+	files           map[string]*File          // map key is file name, nil value means not loaded yet
 }
 
-func (dir *FileDirectory) MetaData() protocol.FileDirectoryMetaData { return &dir.metadata }
-func (dir *FileDirectory) ParentDirectory() protocol.FileDirectory  { return dir.parentDirectory }
+const (
+	fileDirectory_RecycleBin = ".recycle-bin"
+	fileDirectory_EraseChunk = 1 << 20
+)
+
+func (dir *FileDirectory) Metadata() protocol.FileDirectoryMetadata { return &dir.metadata }
+func (dir *FileDirectory) ParentDirectory() protocol.FileDirectory {
+	if dir.parentDirectory == nil {
+		return nil
+	}
+	return dir.parentDirectory
+}
 
-// Mkdir make new directory in relative path from given directory.
+// Directories return sub directories in order by name.
 func (dir *FileDirectory) Directories(offset, limit uint64) (dirs []protocol.FileDirectory) {
-	// TODO:::
+	var names = pageNames(dir.directoryNames(), offset, limit)
+	dirs = make([]protocol.FileDirectory, 0, len(names))
+	for _, name := range names {
+		var d, err = dir.directory(name)
+		if err == nil {
+			dirs = append(dirs, d)
+		}
+	}
 	return
 }
 
 // Directory return the directory by its name or make new one if desire name not exist.
 func (dir *FileDirectory) Directory(name string) (dr protocol.FileDirectory, err protocol.Error) {
-	var goErr error
-	var exist bool
-	var dirPath = dir.metadata.uri.Path() + "/" + name + "/"
-	dr, exist = dir.directories[name]
-	if !exist {
-		goErr = goos.Mkdir(dirPath, 0700)
-		if goErr != nil {
-			// err =
-			return
-		}
+	if !validName(name) {
+		err = &ErrStorageNotAuthorize
+		return
 	}
-	if dr == nil {
-		var dir = FileDirectory{
-			parentDirectory: dir,
-		}
-		err = dir.init(dirPath)
-		if err != nil {
+	var _, exist = dir.directories[name]
+	if !exist {
+		var goErr = goos.Mkdir(dir.path+name, 0700)
+		if goErr != nil && !errors.Is(goErr, goos.ErrExist) {
+			err = storageError(goErr)
 			return
 		}
-		dir.directories[name] = &dir
+		dir.add(name, true)
 	}
+	dr, err = dir.directory(name)
 	return
 }
 
 // Files use to get all files in order by name.
 func (dir *FileDirectory) Files(offset, limit uint64) (files []protocol.File) {
-	var keys = make([]string, 0, len(dir.files))
-	for k := range dir.files {
-		keys = append(keys, k)
+	var names = make([]string, 0, len(dir.files))
+	for name := range dir.files {
+		names = append(names, name)
 	}
-	sort.Strings(keys)
+	sort.Strings(names)
+	names = pageNames(names, offset, limit)
 
-	files = make([]protocol.File, len(dir.files))
-	for i, k := range keys {
-		files[i] = dir.files[k]
+	files = make([]protocol.File, 0, len(names))
+	for _, name := range names {
+		files = append(files, dir.file(name))
 	}
 	return
 }
@@ -75,82 +95,61 @@ func (dir *FileDirectory) Files(offset, limit uint64) (files []protocol.File) {
 // File use to get a file by its full name with extension
 // And make new one if desire name not exist.
 func (dir *FileDirectory) File(name string) (file protocol.File, err protocol.Error) {
-	file, _ = dir.files[name]
-	if file == nil {
-		// make new
-		var fi = File{
-			parentDirectory: dir,
-		}
-		err = fi.init(name)
-		if err != nil {
+	if !validName(name) {
+		err = &ErrStorageNotAuthorize
+		return
+	}
+	var _, exist = dir.files[name]
+	if !exist {
+		var f, goErr = goos.OpenFile(dir.path+name, goos.O_RDWR|goos.O_CREATE, 0700)
+		if goErr != nil {
+			err = storageError(goErr)
 			return
 		}
-		dir.files[name] = &fi
+		f.Close()
+		dir.add(name, false)
 	}
+	file = dir.file(name)
 	return
 }
 
 // FileByPath use to get a file by its path in the directory
 func (dir *FileDirectory) FileByPath(uriPath string) (file protocol.File, err protocol.Error) {
-	file, err = dir.fileByPath(uriPath)
-	return
-}
-
-func (dir *FileDirectory) fileByPath(uriPath string) (file *File, err protocol.Error) {
-	var pathParts = strings.Split(uriPath, "/")
-	var pathPartsLen = len(pathParts)
-	var fullFileName = pathParts[pathPartsLen-1]
-
-	if pathPartsLen < 3 {
-		file = dir.files[fullFileName]
+	var parent, name, e = dir.resolve(uriPath)
+	if e != nil {
+		err = e
 		return
 	}
-
-	if pathParts[0] == "" {
-		pathParts = pathParts[1:]
-	}
-	var directory *FileDirectory
-	directory, err = dir.directoryByPathParts(pathParts)
-	if directory == nil || err != nil {
+	if _, exist := parent.files[name]; !exist {
+		err = &ErrStorageNotExist
 		return
 	}
-	file = directory.files[fullFileName]
+	file = parent.file(name)
 	return
 }
 
 // DirectoryByPath use to get a directory by its full path location.
 // path is the file location in FileSystems include file name
 func (dir *FileDirectory) DirectoryByPath(pathParts []string) (directory protocol.FileDirectory, err protocol.Error) {
-	directory, err = dir.directoryByPathParts(pathParts)
-	return
-}
-
-func (dir *FileDirectory) directoryByPath(uriPath string) (directory *FileDirectory, err protocol.Error) {
-	var pathParts = strings.Split(uriPath, "/")
-	if pathParts[0] == "" {
-		pathParts = pathParts[1:]
-	}
-	directory, err = dir.directoryByPathParts(pathParts)
-	return
-}
-
-func (dir *FileDirectory) directoryByPathParts(pathParts []string) (directory *FileDirectory, err protocol.Error) {
-	var pathPartsLen = len(pathParts)
-	directory = dir
-	for i := 0; i < pathPartsLen; i++ {
-		directory, _ = directory.directories[pathParts[i]]
-		if directory == nil {
+	var d = dir
+	for _, part := range pathParts {
+		if part == "" {
+			continue
+		}
+		d, err = d.directory(part)
+		if err != nil {
 			return
 		}
 	}
+	directory = d
 	return
 }
 
 // FindFiles use to get a file by some part of its name!
 func (dir *FileDirectory) FindFiles(partName string, num uint) (files []protocol.File) {
-	for fileName, file := range dir.files {
+	for fileName := range dir.files {
 		if strings.Contains(fileName, partName) {
-			files = append(files, file)
+			files = append(files, dir.file(fileName))
 			if len(files) == int(num) {
 				return
 			}
@@ -160,10 +159,10 @@ func (dir *FileDirectory) FindFiles(partName string, num uint) (files []protocol
 }
 
 // FindFiles use to get a file by some part of its name!
-func (dir *FileDirectory) FindFile(partName string) (files protocol.File) {
-	for fileName, file := range dir.files {
+func (dir *FileDirectory) FindFile(partName string) (file protocol.File) {
+	for fileName := range dir.files {
 		if strings.Contains(fileName, partName) {
-			return file
+			return dir.file(fileName)
 		}
 	}
 	return
@@ -171,109 +170,453 @@ func (dir *FileDirectory) FindFile(partName string) (files protocol.File) {
 
 // FindFileRecursively use to get a file by its ful name with extension in recursively!
 func (dir *FileDirectory) FindFileRecursively(partName string) (file *File) {
-	file = dir.files[partName]
-	if file != nil {
-		return
+	if _, exist := dir.files[partName]; exist {
+		return dir.file(partName)
 	}
-	if dir.directories != nil {
-		for _, dep := range dir.directories {
-			file = dep.FindFileRecursively(partName)
-			if file != nil {
-				return
-			}
+	for name := range dir.directories {
+		var dep, err = dir.directory(name)
+		if err != nil {
+			continue
+		}
+		file = dep.FindFileRecursively(partName)
+		if file != nil {
+			return
 		}
 	}
 	return nil
 }
 
+// Rename change the name of a file or directory. newURIPath must be in the same directory as oldURIPath.
 func (dir *FileDirectory) Rename(oldURIPath, newURIPath string) (err protocol.Error) {
-	// TODO:::
+	var parent, name, e = dir.resolve(oldURIPath)
+	if e != nil {
+		return e
+	}
+	var newParent *FileDirectory
+	var newName string
+	newParent, newName, err = dir.resolve(newURIPath)
+	if err != nil {
+		return
+	}
+	if parent != newParent {
+		return &ErrStorageNotAuthorize
+	}
+	err = parent.move(name, newParent, newName, false)
 	return
 }
 
+// Copy copy a file or a directory recursively. If newURIPath end with "/" it is the destination directory,
+// otherwise it is the new path include the name.
 func (dir *FileDirectory) Copy(uriPath, newURIPath string) (err protocol.Error) {
-	// var file = File{
-	// 	Directory: f.Directory,
-	// 	Path:      f.Path,
-	// 	FullName:  f.FullName,
-	// 	Name:      f.Name,
-	// 	Extension: f.Extension,
-	// 	mediaType: f.mediaType,
-	// 	State:     f.State,
-	// 	data:      f.data,
-	// }
+	var src, name, e = dir.resolve(uriPath)
+	if e != nil {
+		return e
+	}
+	var des *FileDirectory
+	var desName string
+	des, desName, err = dir.destination(newURIPath, name)
+	if err != nil {
+		return
+	}
+	if !src.exist(name) {
+		return &ErrStorageNotExist
+	}
+	if des.exist(desName) {
+		return &ErrStorageExist
+	}
+	var _, isDir = src.directories[name]
+	err = copyPath(src.path+name, des.path+desName, isDir)
+	if err != nil {
+		return
+	}
+	des.add(desName, isDir)
 	return
 }
 
+// Move move a file or a directory to other place even on other device. If newURIPath end with "/" it is
+// the destination directory, otherwise it is the new path include the name.
 func (dir *FileDirectory) Move(uriPath, newURIPath string) (err protocol.Error) {
-	// var file = File{
-	// 	Directory: f.Directory,
-	// 	Path:      f.Path,
-	// 	FullName:  f.FullName,
-	// 	Name:      f.Name,
-	// 	Extension: f.Extension,
-	// 	mediaType: f.mediaType,
-	// 	State:     f.State,
-	// 	data:      make([]byte, len(f.data)),
-	// }
-	// copy(file.data, f.data)
+	var src *FileDirectory
+	var name string
+	src, name, err = dir.resolve(uriPath)
+	if err != nil {
+		return
+	}
+	var des *FileDirectory
+	var desName string
+	des, desName, err = dir.destination(newURIPath, name)
+	if err != nil {
+		return
+	}
+	err = src.move(name, des, desName, true)
 	return
 }
 
+// Delete make the file or directory invisible by move it to the recycle bin.
 func (dir *FileDirectory) Delete(uriPath string) (err protocol.Error) {
-	goos.Remove(uriPath)
-	if file.IsPathDirectory(uriPath) {
-		var dir, _ = dir.directoryByPath(uriPath)
-		delete(dir.parentDirectory.directories, dir.metadata.URI().Name())
-	} else {
-		var file, _ = dir.fileByPath(uriPath)
-		delete(file.parentDirectory.files, file.metadata.URI().Name())
+	var parent, name, e = dir.resolve(uriPath)
+	if e != nil {
+		return e
+	}
+	if !parent.exist(name) {
+		return &ErrStorageNotExist
+	}
+
+	var root = dir
+	for root.parentDirectory != nil {
+		root = root.parentDirectory
+	}
+	var bin = root.path + fileDirectory_RecycleBin + "/"
+	var goErr = goos.MkdirAll(bin+"files", 0700)
+	if goErr == nil {
+		goErr = goos.MkdirAll(bin+"info", 0700)
 	}
+	if goErr != nil {
+		return storageError(goErr)
+	}
+
+	// Reserve a unique name by create its info file exclusively.
+	var binName = name
+	var info *goos.File
+	for i := 2; ; i++ {
+		info, goErr = goos.OpenFile(bin+"info/"+binName+".trashinfo", goos.O_WRONLY|goos.O_CREATE|goos.O_EXCL, 0600)
+		if !errors.Is(goErr, goos.ErrExist) {
+			break
+		}
+		binName = name + "." + strconv.Itoa(i)
+	}
+	if goErr != nil {
+		return storageError(goErr)
+	}
+	var infoPath = url.URL{Path: strings.TrimPrefix(parent.path+name, root.path)}
+	_, goErr = info.WriteString("[Trash Info]\nPath=" + infoPath.EscapedPath() +
+		"\nDeletionDate=" + time.Now().Format("2006-01-02T15:04:05") + "\n")
+	info.Close()
+	if goErr == nil {
+		goErr = goos.Rename(parent.path+name, bin+"files/"+binName)
+	}
+	if goErr != nil {
+		goos.Remove(bin + "info/" + binName + ".trashinfo")
+		return storageError(goErr)
+	}
+	parent.forget(name)
 	return
 }
 
-func (dir *FileDirectory) Wipe(uriPath string) (err protocol.Error) {
-	// TODO::: first write null data to uri path
-	err = dir.Delete(uriPath)
+// PermanentlyDelete make the file or directory invisible by remove it from the file system index.
+// Its data remain on the device until the OS reuse its blocks.
+func (dir *FileDirectory) PermanentlyDelete(uriPath string) (err protocol.Error) {
+	var parent, name, e = dir.resolve(uriPath)
+	if e != nil {
+		return e
+	}
+	if !parent.exist(name) {
+		return &ErrStorageNotExist
+	}
+	var goErr = goos.RemoveAll(parent.path + name)
+	if goErr != nil {
+		return storageError(goErr)
+	}
+	parent.forget(name)
+	return
+}
+
+// Erase write zero data to all files of the uri path and then remove them from the file system index.
+// Journaling or copy-on-write file systems and SSDs may keep old data in other blocks anyway.
+func (dir *FileDirectory) Erase(uriPath string) (err protocol.Error) {
+	var parent, name, e = dir.resolve(uriPath)
+	if e != nil {
+		return e
+	}
+	if !parent.exist(name) {
+		return &ErrStorageNotExist
+	}
+	err = erasePath(parent.path + name)
+	if err != nil {
+		return
+	}
+	err = parent.PermanentlyDelete(name)
 	return
 }
 
 // GetDependencyRecursively use to get a dependency by its name in recursively!
 func (dir *FileDirectory) GetDependencyRecursively(name string) *FileDirectory {
-	var t *FileDirectory
-	var ok bool
-	if dir.directories != nil {
-		t, ok = dir.directories[name]
-		if !ok {
-			for _, dep := range dir.directories {
-				t = dep.GetDependencyRecursively(name)
-				if t != nil {
-					break
-				}
-			}
+	if _, exist := dir.directories[name]; exist {
+		var t, _ = dir.directory(name)
+		return t
+	}
+	for depName := range dir.directories {
+		var dep, err = dir.directory(depName)
+		if err != nil {
+			continue
+		}
+		var t = dep.GetDependencyRecursively(name)
+		if t != nil {
+			return t
 		}
 	}
-	return t
+	return nil
 }
 
 // init use to read||update Directory from disk.
 func (dir *FileDirectory) init(path string) (err protocol.Error) {
-	dir.metadata.URI().Init(path)
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	dir.path = path
+	dir.metadata.uri.Init(path)
 	dir.files = make(map[string]*File)
 	dir.directories = make(map[string]*FileDirectory)
+	dir.metadata.dirNum = 0
+	dir.metadata.fileNum = 0
 
-	var dirEntry, goErr = goos.ReadDir(dir.metadata.uri.Path())
+	var dirEntry, goErr = goos.ReadDir(path)
 	if goErr != nil {
-		// err =
-		return
+		return storageError(goErr)
 	}
 	for _, file := range dirEntry {
 		var fileName = file.Name()
-		if file.IsDir() {
-			dir.directories[fileName] = nil
-		} else {
-			dir.files[fileName] = nil
+		if dir.parentDirectory == nil && fileName == fileDirectory_RecycleBin {
+			continue
+		}
+		dir.add(fileName, file.IsDir())
+	}
+	return
+}
+
+// directory return the loaded sub directory and load it if it isn't loaded yet.
+func (dir *FileDirectory) directory(name string) (child *FileDirectory, err protocol.Error) {
+	var exist bool
+	child, exist = dir.directories[name]
+	if !exist {
+		err = &ErrStorageNotExist
+		return
+	}
+	if child == nil {
+		child = &FileDirectory{parentDirectory: dir}
+		err = child.init(dir.path + name)
+		if err != nil {
+			return nil, err
+		}
+		dir.directories[name] = child
+	}
+	return
+}
+
+// file return the file and make its descriptor if it isn't loaded yet. Caller must check the file exist.
+func (dir *FileDirectory) file(name string) (f *File) {
+	f = dir.files[name]
+	if f == nil {
+		f = &File{parentDirectory: dir}
+		f.init(dir.path + name)
+		dir.files[name] = f
+	}
+	return
+}
+
+func (dir *FileDirectory) directoryNames() (names []string) {
+	names = make([]string, 0, len(dir.directories))
+	for name := range dir.directories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+func (dir *FileDirectory) exist(name string) (exist bool) {
+	if _, exist = dir.files[name]; exist {
+		return
+	}
+	_, exist = dir.directories[name]
+	return
+}
+
+// add register the name in the index to load lazily by next access.
+func (dir *FileDirectory) add(name string, isDir bool) {
+	if isDir {
+		if _, exist := dir.directories[name]; !exist {
+			dir.directories[name] = nil
+			dir.metadata.dirNum++
+		}
+	} else if _, exist := dir.files[name]; !exist {
+		dir.files[name] = nil
+		dir.metadata.fileNum++
+	}
+}
+
+// forget remove the name from the index.
+func (dir *FileDirectory) forget(name string) {
+	if _, exist := dir.directories[name]; exist {
+		delete(dir.directories, name)
+		dir.metadata.dirNum--
+	}
+	if _, exist := dir.files[name]; exist {
+		delete(dir.files, name)
+		dir.metadata.fileNum--
+	}
+}
+
+// move rename the name in dir to desName in des, and copy then remove it if they are on different devices and crossDevice is true.
+func (dir *FileDirectory) move(name string, des *FileDirectory, desName string, crossDevice bool) (err protocol.Error) {
+	if !dir.exist(name) {
+		return &ErrStorageNotExist
+	}
+	if des.exist(desName) {
+		return &ErrStorageExist
+	}
+	var _, isDir = dir.directories[name]
+	var goErr = goos.Rename(dir.path+name, des.path+desName)
+	if errors.Is(goErr, syscall.EXDEV) && crossDevice {
+		err = copyPath(dir.path+name, des.path+desName, isDir)
+		if err != nil {
+			goos.RemoveAll(des.path + desName)
+			return
+		}
+		goErr = goos.RemoveAll(dir.path + name)
+	}
+	if goErr != nil {
+		return storageError(goErr)
+	}
+	dir.forget(name)
+	des.add(desName, isDir)
+	return
+}
+
+// resolve return the parent directory and the name of the last part of the uri path that is relative to dir.
+// Paths that escape from dir by ".." are not authorized.
+func (dir *FileDirectory) resolve(uriPath string) (parent *FileDirectory, name string, err protocol.Error) {
+	var parts = strings.Split(strings.Trim(uriPath, "/"), "/")
+	name = parts[len(parts)-1]
+	for _, part := range parts {
+		if !validName(part) {
+			err = &ErrStorageNotAuthorize
+			return
+		}
+	}
+	parent = dir
+	for _, part := range parts[:len(parts)-1] {
+		parent, err = parent.directory(part)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// destination resolve the target of Copy() and Move(). A uri path end with "/" is the destination directory
+// and the name remain the same.
+func (dir *FileDirectory) destination(uriPath, name string) (des *FileDirectory, desName string, err protocol.Error) {
+	if strings.HasSuffix(uriPath, "/") {
+		var d protocol.FileDirectory
+		d, err = dir.DirectoryByPath(strings.Split(strings.Trim(uriPath, "/"), "/"))
+		if err != nil {
+			return
 		}
+		return d.(*FileDirectory), name, nil
+	}
+	des, desName, err = dir.resolve(uriPath)
+	return
+}
+
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsRune(name, '/')
+}
+
+func pageNames(names []string, offset, limit uint64) []string {
+	var ln = uint64(len(names))
+	if offset >= ln {
+		return nil
+	}
+	var end = offset + limit
+	if end > ln || end < offset {
+		end = ln
+	}
+	return names[offset:end]
+}
+
+// copyPath copy a file or a directory recursively with the same permissions.
+func copyPath(src, des string, isDir bool) (err protocol.Error) {
+	var info, goErr = goos.Lstat(src)
+	if goErr != nil {
+		return storageError(goErr)
+	}
+	if !isDir {
+		var data []byte
+		data, goErr = goos.ReadFile(src)
+		if goErr == nil {
+			goErr = goos.WriteFile(des, data, info.Mode().Perm())
+		}
+		if goErr != nil {
+			return storageError(goErr)
+		}
+		return
+	}
+
+	goErr = goos.Mkdir(des, info.Mode().Perm())
+	if goErr != nil {
+		return storageError(goErr)
+	}
+	var entries []goos.DirEntry
+	entries, goErr = goos.ReadDir(src)
+	if goErr != nil {
+		return storageError(goErr)
+	}
+	for _, entry := range entries {
+		err = copyPath(src+"/"+entry.Name(), des+"/"+entry.Name(), entry.IsDir())
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// erasePath write zero data to the file or all files in the directory recursively and flush them to the device.
+func erasePath(path string) (err protocol.Error) {
+	var info, goErr = goos.Lstat(path)
+	if goErr != nil {
+		return storageError(goErr)
+	}
+	if info.IsDir() {
+		var entries []goos.DirEntry
+		entries, goErr = goos.ReadDir(path)
+		if goErr != nil {
+			return storageError(goErr)
+		}
+		for _, entry := range entries {
+			err = erasePath(path + "/" + entry.Name())
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
+	if !info.Mode().IsRegular() {
+		return
+	}
+
+	var file *goos.File
+	file, goErr = goos.OpenFile(path, goos.O_WRONLY, 0)
+	if goErr != nil {
+		return storageError(goErr)
+	}
+	var size = info.Size()
+	var zeros = make([]byte, fileDirectory_EraseChunk)
+	for offset := int64(0); offset < size && goErr == nil; offset += fileDirectory_EraseChunk {
+		var ln = size - offset
+		if ln > fileDirectory_EraseChunk {
+			ln = fileDirectory_EraseChunk
+		}
+		_, goErr = file.WriteAt(zeros[:ln], offset)
+	}
+	if goErr == nil {
+		goErr = file.Sync()
+	}
+	var closeErr = file.Close()
+	if goErr == nil {
+		goErr = closeErr
+	}
+	if goErr != nil {
+		return storageError(goErr)
 	}
 	return
 }
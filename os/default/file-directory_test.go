@@ -0,0 +1,148 @@
+/* For license and copyright information please see LEGAL file in repository */
+
+package dos
+
+import (
+	goos "os"
+	"strings"
+	"testing"
+)
+
+func TestFileDirectory_Metadata(t *testing.T) {
+	var root = t.TempDir()
+	goos.Mkdir(root+"/assets", 0700)
+	goos.WriteFile(root+"/index.html", []byte("<p>home</p>"), 0600)
+	goos.WriteFile(root+"/app.js", []byte("run()"), 0600)
+
+	var dir FileDirectory
+	if err := dir.init(root); err != nil {
+		t.Fatalf("init() error = %v", err)
+	}
+	var md = dir.Metadata()
+	if md.DirNum() != 1 || md.FileNum() != 2 {
+		t.Errorf("Metadata() DirNum() = %v, FileNum() = %v, want 1 and 2", md.DirNum(), md.FileNum())
+	}
+	var file, err = dir.File("index.html")
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	if name := file.Metadata().URI().Name(); name != "index.html" {
+		t.Errorf("File().Metadata().URI().Name() = %v, want index.html", name)
+	}
+
+	var assets, _ = dir.Directory("assets")
+	if assets.Metadata().DirNum() != 0 || assets.Metadata().FileNum() != 0 {
+		t.Errorf("empty Directory() Metadata() = %v, %v", assets.Metadata().DirNum(), assets.Metadata().FileNum())
+	}
+}
+
+func TestFile_Rename(t *testing.T) {
+	var root = t.TempDir()
+	goos.WriteFile(root+"/old.txt", []byte("data"), 0600)
+	goos.WriteFile(root+"/exist.txt", []byte("other"), 0600)
+	var dir FileDirectory
+	dir.init(root)
+
+	var file, _ = dir.File("old.txt")
+	file.Rename("new.txt")
+	if data, _ := goos.ReadFile(root + "/new.txt"); string(data) != "data" {
+		t.Errorf("Rename() don't rename the file on the file system, new.txt = %q", data)
+	}
+	if _, goErr := goos.Stat(root + "/old.txt"); goErr == nil {
+		t.Errorf("Rename() keep the old file on the file system")
+	}
+	if file.Metadata().URI().Name() != "new.txt" || dir.exist("old.txt") {
+		t.Errorf("Rename() Name() = %v, old name exist = %v", file.Metadata().URI().Name(), dir.exist("old.txt"))
+	}
+	if f, _ := dir.FileByPath("new.txt"); f != file {
+		t.Errorf("FileByPath() after Rename() return other file")
+	}
+
+	// Rename to an exist name must not change anything.
+	file.Rename("exist.txt")
+	if data, _ := goos.ReadFile(root + "/exist.txt"); string(data) != "other" || file.Metadata().URI().Name() != "new.txt" {
+		t.Errorf("Rename() to exist name overwrite it, exist.txt = %q, Name() = %v", data, file.Metadata().URI().Name())
+	}
+	if dir.Metadata().FileNum() != 2 {
+		t.Errorf("FileNum() after Rename() = %v, want 2", dir.Metadata().FileNum())
+	}
+}
+
+func TestFileDirectory_Move(t *testing.T) {
+	var root = t.TempDir()
+	goos.MkdirAll(root+"/a/b", 0700)
+	goos.WriteFile(root+"/a/x.txt", []byte("hello"), 0600)
+	var dir FileDirectory
+	dir.init(root)
+
+	if err := dir.Rename("a/x.txt", "a/b/x.txt"); err != &ErrStorageNotAuthorize {
+		t.Errorf("Rename() to other directory error = %v, want ErrStorageNotAuthorize", err)
+	}
+	if err := dir.Rename("../x", "y"); err != &ErrStorageNotAuthorize {
+		t.Errorf("Rename() out of the directory error = %v, want ErrStorageNotAuthorize", err)
+	}
+	if err := dir.Copy("a/x.txt", "a/b/"); err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+	if err := dir.Move("a/x.txt", "z.txt"); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	if data, _ := goos.ReadFile(root + "/z.txt"); string(data) != "hello" {
+		t.Errorf("Move() data = %q, want hello", data)
+	}
+	if err := dir.Move("a/b/x.txt", "z.txt"); err != &ErrStorageExist {
+		t.Errorf("Move() to exist name error = %v, want ErrStorageExist", err)
+	}
+	if err := dir.Move("a/b", "c"); err != nil {
+		t.Fatalf("Move() of directory error = %v", err)
+	}
+	if f, err := dir.FileByPath("c/x.txt"); err != nil || f == nil {
+		t.Errorf("FileByPath() in moved directory error = %v", err)
+	}
+	var a, _ = dir.directory("a")
+	if dir.Metadata().DirNum() != 2 || dir.Metadata().FileNum() != 1 || a.Metadata().DirNum() != 0 || a.Metadata().FileNum() != 0 {
+		t.Errorf("Metadata() after Move() root = %v, %v, a = %v, %v", dir.Metadata().DirNum(), dir.Metadata().FileNum(),
+			a.Metadata().DirNum(), a.Metadata().FileNum())
+	}
+}
+
+func TestFileDirectory_Delete(t *testing.T) {
+	var root = t.TempDir()
+	goos.MkdirAll(root+"/a", 0700)
+	goos.WriteFile(root+"/a/x.txt", []byte("hello"), 0600)
+	var dir FileDirectory
+	dir.init(root)
+
+	if err := dir.Delete("a/x.txt"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	goos.WriteFile(root+"/a/x.txt", []byte("again"), 0600)
+	var a, _ = dir.directory("a")
+	a.add("x.txt", false)
+	if err := dir.Delete("a/x.txt"); err != nil {
+		t.Fatalf("second Delete() error = %v", err)
+	}
+	if data, _ := goos.ReadFile(root + "/" + fileDirectory_RecycleBin + "/files/x.txt.2"); string(data) != "again" {
+		t.Errorf("Delete() of same name again = %q, want again", data)
+	}
+	var info, _ = goos.ReadFile(root + "/" + fileDirectory_RecycleBin + "/info/x.txt.trashinfo")
+	if !strings.HasPrefix(string(info), "[Trash Info]\nPath=a/x.txt\nDeletionDate=") {
+		t.Errorf("Delete() trash info = %q", info)
+	}
+
+	var reloaded FileDirectory
+	reloaded.init(root)
+	if reloaded.exist(fileDirectory_RecycleBin) {
+		t.Errorf("init() list the recycle bin")
+	}
+
+	if err := dir.Erase("a"); err != nil {
+		t.Fatalf("Erase() error = %v", err)
+	}
+	if _, goErr := goos.Stat(root + "/a"); goErr == nil || dir.exist("a") {
+		t.Errorf("Erase() keep the directory")
+	}
+	if err := dir.PermanentlyDelete("a"); err != &ErrStorageNotExist {
+		t.Errorf("PermanentlyDelete() of not exist error = %v, want ErrStorageNotExist", err)
+	}
+}
@@ -0,0 +1,324 @@
+//go:build linux
+
+/* For license and copyright information please see LEGAL file in repository */
+
+package dos
+
+import (
+	"errors"
+	goos "os"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"../../event"
+	"../../file"
+	"../../protocol"
+)
+
+// FileWatcher watch a FileDirectory subtree by inotify and dispatch file.ChangeEvent through its EventTarget.
+//   - Changes on a path in Debounce period merge to one event, e.g. many writes of an editor dispatch one modified event.
+//   - Sub directories that make after Init() watch automatically.
+//   - Events dispatch from the watcher goroutine in order of the first change of each path,
+//     so listeners must not block it for long.
+//   - It doesn't change the watched FileDirectory, listeners must update any loaded data by themselves.
+type FileWatcher struct {
+	// Debounce is the quiet period to wait after the last change before dispatch events.
+	// Zero means fileWatcher_DefaultDebounce.
+	Debounce protocol.Duration
+
+	event.EventTarget
+
+	root    string
+	skip    string // name in the root directory that must not watch e.g. the recycle bin
+	fd      int    // inotify descriptor, use it instead of inotify.Fd() that make the file blocking
+	inotify *goos.File
+	watches map[int32]string // watch descriptor to uri path of the directory, "" for the root directory
+	pending map[string]*fileChange
+	order   []string // uri paths of pending changes in order of their first change
+	moved   *fileMove
+	done    chan struct{}
+}
+
+type fileChange struct {
+	operation  file.ChangeOperation
+	oldURIPath string
+	directory  bool
+}
+
+// fileMove is an IN_MOVED_FROM event that wait for its IN_MOVED_TO pair.
+type fileMove struct {
+	cookie    uint32
+	uriPath   string
+	directory bool
+}
+
+const (
+	fileWatcher_DefaultDebounce = protocol.Duration(100 * time.Millisecond)
+	// fileWatcher_MaxDelay is the max number of Debounce periods that changes can wait when they never stop.
+	fileWatcher_MaxDelay   = 8
+	fileWatcher_BufferSize = 64 << 10
+	fileWatcher_Mask       = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+		syscall.IN_ONLYDIR | syscall.IN_DONT_FOLLOW | syscall.IN_EXCL_UNLINK
+)
+
+// Init start to watch all directories in the subtree of dir.
+//
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (fw *FileWatcher) Init(dir *FileDirectory) (err protocol.Error) {
+	if fw.Debounce < 1 {
+		fw.Debounce = fileWatcher_DefaultDebounce
+	}
+	err = fw.EventTarget.Init()
+	if err != nil {
+		return
+	}
+	fw.root = dir.path
+	if dir.parentDirectory == nil {
+		fw.skip = fileDirectory_RecycleBin
+	}
+	fw.watches = make(map[int32]string)
+	fw.pending = make(map[string]*fileChange)
+
+	// Non-blocking descriptor let go runtime poll it, so Deinit() can stop the reader by close it.
+	var goErr error
+	fw.fd, goErr = syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if goErr != nil {
+		return storageError(goErr)
+	}
+	fw.inotify = goos.NewFile(uintptr(fw.fd), "inotify")
+	err = fw.addWatches("", false)
+	if err != nil {
+		fw.inotify.Close()
+		return
+	}
+	fw.done = make(chan struct{})
+	go fw.read()
+	return
+}
+
+// Deinit stop watching and wait for the watcher goroutine to dispatch pending events and exit.
+func (fw *FileWatcher) Deinit() (err protocol.Error) {
+	var goErr = fw.inotify.Close()
+	<-fw.done
+	if goErr != nil {
+		err = storageError(goErr)
+	}
+	return
+}
+
+// read is the watcher goroutine that read inotify events and dispatch them after debounce.
+func (fw *FileWatcher) read() {
+	defer close(fw.done)
+	var debounce = time.Duration(fw.Debounce)
+	var buf = make([]byte, fileWatcher_BufferSize)
+	var first, last time.Time
+	for {
+		var deadline time.Time
+		if len(fw.order) > 0 || fw.moved != nil {
+			deadline = last.Add(debounce)
+			if limit := first.Add(fileWatcher_MaxDelay * debounce); limit.Before(deadline) {
+				deadline = limit
+			}
+		}
+		fw.inotify.SetReadDeadline(deadline)
+
+		var n, goErr = fw.inotify.Read(buf)
+		if goErr != nil {
+			fw.dispatch()
+			if errors.Is(goErr, goos.ErrDeadlineExceeded) {
+				continue
+			}
+			return
+		}
+
+		last = time.Now()
+		if len(fw.order) == 0 && fw.moved == nil {
+			first = last
+		}
+		fw.parse(buf[:n])
+	}
+}
+
+// parse handle all inotify events in buf.
+func (fw *FileWatcher) parse(buf []byte) {
+	for len(buf) >= syscall.SizeofInotifyEvent {
+		var ie = (*syscall.InotifyEvent)(unsafe.Pointer(&buf[0]))
+		var end = syscall.SizeofInotifyEvent + int(ie.Len)
+		if end > len(buf) {
+			return
+		}
+		var name = strings.TrimRight(string(buf[syscall.SizeofInotifyEvent:end]), "\x00")
+		fw.handle(ie.Wd, ie.Mask, ie.Cookie, name)
+		buf = buf[end:]
+	}
+}
+
+func (fw *FileWatcher) handle(wd int32, mask, cookie uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		fw.change(file.ChangeOperation_Overflow, "", "", true)
+		return
+	}
+	var dirPath, ok = fw.watches[wd]
+	if !ok {
+		return
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(fw.watches, wd)
+		return
+	}
+	if dirPath == "" && name == fw.skip {
+		return
+	}
+
+	var uriPath = joinURIPath(dirPath, name)
+	var isDir = mask&syscall.IN_ISDIR != 0
+
+	// IN_MOVED_TO always come right after its IN_MOVED_FROM pair if both paths are watched.
+	var moved = fw.moved
+	fw.moved = nil
+	if moved != nil && (mask&syscall.IN_MOVED_TO == 0 || moved.cookie != cookie) {
+		fw.movedOut(moved)
+		moved = nil
+	}
+
+	switch {
+	case mask&syscall.IN_CREATE != 0:
+		fw.change(file.ChangeOperation_Created, uriPath, "", isDir)
+		if isDir {
+			fw.addWatches(uriPath, true)
+		}
+	case mask&syscall.IN_MODIFY != 0:
+		fw.change(file.ChangeOperation_Modified, uriPath, "", isDir)
+	case mask&syscall.IN_DELETE != 0:
+		fw.change(file.ChangeOperation_Deleted, uriPath, "", isDir)
+	case mask&syscall.IN_MOVED_FROM != 0:
+		fw.moved = &fileMove{cookie: cookie, uriPath: uriPath, directory: isDir}
+	case mask&syscall.IN_MOVED_TO != 0:
+		if moved == nil {
+			// Moved in from a path that isn't watched.
+			fw.change(file.ChangeOperation_Created, uriPath, "", isDir)
+			if isDir {
+				fw.addWatches(uriPath, true)
+			}
+			return
+		}
+		if p := fw.pending[moved.uriPath]; p != nil && p.operation == file.ChangeOperation_Created {
+			// Created and renamed in one debounce period is just created with the new name.
+			p.operation = file.ChangeOperation_Unset
+			fw.change(file.ChangeOperation_Created, uriPath, "", isDir)
+		} else {
+			fw.change(file.ChangeOperation_Renamed, uriPath, moved.uriPath, isDir)
+		}
+		if isDir {
+			// Watch descriptors follow the directory, so just their paths must change.
+			for wd, path := range fw.watches {
+				if path == moved.uriPath || strings.HasPrefix(path, moved.uriPath+"/") {
+					fw.watches[wd] = uriPath + path[len(moved.uriPath):]
+				}
+			}
+		}
+	}
+}
+
+// movedOut handle an IN_MOVED_FROM without pair that means the path moved out of the watched subtree.
+func (fw *FileWatcher) movedOut(moved *fileMove) {
+	fw.change(file.ChangeOperation_Deleted, moved.uriPath, "", moved.directory)
+	if !moved.directory {
+		return
+	}
+	for wd, path := range fw.watches {
+		if path == moved.uriPath || strings.HasPrefix(path, moved.uriPath+"/") {
+			syscall.InotifyRmWatch(fw.fd, uint32(wd))
+			delete(fw.watches, wd)
+		}
+	}
+}
+
+// change merge the change to the pending change of the path if exist.
+func (fw *FileWatcher) change(op file.ChangeOperation, uriPath, oldURIPath string, isDir bool) {
+	var c = fw.pending[uriPath]
+	if c == nil {
+		fw.pending[uriPath] = &fileChange{operation: op, oldURIPath: oldURIPath, directory: isDir}
+		fw.order = append(fw.order, uriPath)
+		return
+	}
+
+	switch {
+	case op == file.ChangeOperation_Modified &&
+		(c.operation == file.ChangeOperation_Created || c.operation == file.ChangeOperation_Renamed):
+		// Still created or renamed, but with new data.
+	case op == file.ChangeOperation_Deleted && c.operation == file.ChangeOperation_Created:
+		c.operation = file.ChangeOperation_Unset
+	case op == file.ChangeOperation_Deleted && c.operation == file.ChangeOperation_Renamed:
+		c.operation = file.ChangeOperation_Unset
+		fw.change(file.ChangeOperation_Deleted, c.oldURIPath, "", isDir)
+	case op == file.ChangeOperation_Created && c.operation == file.ChangeOperation_Deleted:
+		c.operation = file.ChangeOperation_Modified
+	default:
+		c.operation, c.oldURIPath = op, oldURIPath
+	}
+	c.directory = isDir
+}
+
+// dispatch all pending changes as events.
+func (fw *FileWatcher) dispatch() {
+	if fw.moved != nil {
+		fw.movedOut(fw.moved)
+		fw.moved = nil
+	}
+	var order = fw.order
+	var pending = fw.pending
+	fw.order = nil
+	fw.pending = make(map[string]*fileChange)
+
+	for _, uriPath := range order {
+		var c = pending[uriPath]
+		if c.operation == file.ChangeOperation_Unset {
+			continue
+		}
+		var e file.ChangeEvent
+		e.Init(c.operation, uriPath, c.oldURIPath, c.directory)
+		fw.DispatchEvent(&e)
+	}
+}
+
+// addWatches watch the directory and all its sub directories. Entries of a new directory must report as created,
+// because they can make before the watch added.
+func (fw *FileWatcher) addWatches(uriPath string, report bool) (err protocol.Error) {
+	var wd, goErr = syscall.InotifyAddWatch(fw.fd, fw.root+uriPath, fileWatcher_Mask)
+	if goErr != nil {
+		return storageError(goErr)
+	}
+	fw.watches[int32(wd)] = uriPath
+
+	var entries []goos.DirEntry
+	entries, goErr = goos.ReadDir(fw.root + uriPath)
+	if goErr != nil {
+		return storageError(goErr)
+	}
+	for _, entry := range entries {
+		if uriPath == "" && entry.Name() == fw.skip {
+			continue
+		}
+		var entryPath = joinURIPath(uriPath, entry.Name())
+		if report {
+			fw.change(file.ChangeOperation_Created, entryPath, "", entry.IsDir())
+		}
+		if entry.IsDir() {
+			err = fw.addWatches(entryPath, report)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func joinURIPath(dirPath, name string) string {
+	if dirPath == "" {
+		return name
+	}
+	return dirPath + "/" + name
+}
@@ -0,0 +1,155 @@
+//go:build linux
+
+/* For license and copyright information please see LEGAL file in repository */
+
+package dos
+
+import (
+	goos "os"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"../../file"
+	"../../protocol"
+)
+
+type fileWatcherChange struct {
+	operation  file.ChangeOperation
+	uriPath    string
+	oldURIPath string
+}
+
+// fileWatcherListener record all dispatched changes.
+type fileWatcherListener struct {
+	sync    sync.Mutex
+	changes []fileWatcherChange
+}
+
+func (l *fileWatcherListener) EventHandler(event protocol.Event) {
+	var e = event.(*file.ChangeEvent)
+	l.sync.Lock()
+	l.changes = append(l.changes, fileWatcherChange{e.Operation(), e.URIPath(), e.OldURIPath()})
+	l.sync.Unlock()
+}
+
+// wait return recorded changes after num changes recorded or timeout, and clear them.
+func (l *fileWatcherListener) wait(num int, timeout time.Duration) (changes []fileWatcherChange) {
+	var deadline = time.Now().Add(timeout)
+	for {
+		l.sync.Lock()
+		if len(l.changes) >= num || time.Now().After(deadline) {
+			changes = l.changes
+			l.changes = nil
+			l.sync.Unlock()
+			return
+		}
+		l.sync.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFileWatcher(t *testing.T) {
+	var root = t.TempDir()
+	var outside = t.TempDir()
+	goos.Mkdir(root+"/a", 0700)
+	var dir FileDirectory
+	dir.init(root)
+
+	var listener fileWatcherListener
+	var fw = FileWatcher{Debounce: protocol.Duration(50 * time.Millisecond)}
+	if err := fw.Init(&dir); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	fw.AddEventListener(file.ChangeEvent_MediaType.ID(), &listener, protocol.AddEventListenerOptions{})
+
+	var steps = []struct {
+		name   string
+		change func()
+		want   []fileWatcherChange
+	}{
+		{"debounce writes", func() {
+			goos.WriteFile(root+"/a/x.txt", []byte("1"), 0600)
+			goos.WriteFile(root+"/a/x.txt", []byte("2"), 0600)
+		}, []fileWatcherChange{{file.ChangeOperation_Created, "a/x.txt", ""}}},
+		{"rename pair", func() {
+			goos.Rename(root+"/a/x.txt", root+"/a/y.txt")
+		}, []fileWatcherChange{{file.ChangeOperation_Renamed, "a/y.txt", "a/x.txt"}}},
+		{"new directory", func() {
+			goos.Mkdir(root+"/b", 0700)
+			goos.WriteFile(root+"/b/c.txt", nil, 0600)
+		}, []fileWatcherChange{{file.ChangeOperation_Created, "b", ""}, {file.ChangeOperation_Created, "b/c.txt", ""}}},
+		{"recursive watch", func() {
+			goos.WriteFile(root+"/b/c.txt", []byte("data"), 0600)
+		}, []fileWatcherChange{{file.ChangeOperation_Modified, "b/c.txt", ""}}},
+		{"rename directory", func() {
+			goos.Rename(root+"/b", root+"/d")
+			goos.WriteFile(root+"/d/e.txt", nil, 0600)
+		}, []fileWatcherChange{{file.ChangeOperation_Renamed, "d", "b"}, {file.ChangeOperation_Created, "d/e.txt", ""}}},
+		{"move out", func() {
+			goos.Rename(root+"/a/y.txt", outside+"/y.txt")
+		}, []fileWatcherChange{{file.ChangeOperation_Deleted, "a/y.txt", ""}}},
+		{"delete to recycle bin", func() {
+			// Watcher doesn't change the directory, so add the new one as a listener must do.
+			dir.add("d", true)
+			dir.Delete("d")
+		}, []fileWatcherChange{{file.ChangeOperation_Deleted, "d", ""}}},
+	}
+	for _, step := range steps {
+		step.change()
+		var got = listener.wait(len(step.want), 2*time.Second)
+		// Wait a debounce period more to catch any unexpected change.
+		got = append(got, listener.wait(len(step.want)+1, 150*time.Millisecond)...)
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: changes = %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	if err := fw.Deinit(); err != nil {
+		t.Errorf("Deinit() error = %v", err)
+	}
+}
+
+func TestFileWatcher_Handle(t *testing.T) {
+	var listener fileWatcherListener
+	var fw FileWatcher
+	fw.EventTarget.Init()
+	fw.AddEventListener(file.ChangeEvent_MediaType.ID(), &listener, protocol.AddEventListenerOptions{})
+	fw.watches = map[int32]string{1: "", 2: "a"}
+	fw.pending = make(map[string]*fileChange)
+
+	var tests = []struct {
+		name   string
+		events []syscall.InotifyEvent
+		names  []string
+		want   []fileWatcherChange
+	}{
+		{"created and deleted", []syscall.InotifyEvent{{Wd: 1, Mask: syscall.IN_CREATE}, {Wd: 1, Mask: syscall.IN_DELETE}},
+			[]string{"x", "x"}, nil},
+		{"deleted and created", []syscall.InotifyEvent{{Wd: 1, Mask: syscall.IN_DELETE}, {Wd: 1, Mask: syscall.IN_CREATE}},
+			[]string{"x", "x"}, []fileWatcherChange{{file.ChangeOperation_Modified, "x", ""}}},
+		{"move pair", []syscall.InotifyEvent{{Wd: 1, Mask: syscall.IN_MOVED_FROM, Cookie: 7}, {Wd: 2, Mask: syscall.IN_MOVED_TO, Cookie: 7}},
+			[]string{"x", "y"}, []fileWatcherChange{{file.ChangeOperation_Renamed, "a/y", "x"}}},
+		{"move cookies mismatch", []syscall.InotifyEvent{{Wd: 1, Mask: syscall.IN_MOVED_FROM, Cookie: 7}, {Wd: 2, Mask: syscall.IN_MOVED_TO, Cookie: 8}},
+			[]string{"x", "y"}, []fileWatcherChange{{file.ChangeOperation_Deleted, "x", ""}, {file.ChangeOperation_Created, "a/y", ""}}},
+		{"created and renamed", []syscall.InotifyEvent{{Wd: 1, Mask: syscall.IN_CREATE}, {Wd: 1, Mask: syscall.IN_MOVED_FROM, Cookie: 9},
+			{Wd: 1, Mask: syscall.IN_MOVED_TO, Cookie: 9}}, []string{"x", "x", "y"}, []fileWatcherChange{{file.ChangeOperation_Created, "y", ""}}},
+		{"renamed and deleted", []syscall.InotifyEvent{{Wd: 1, Mask: syscall.IN_MOVED_FROM, Cookie: 10}, {Wd: 1, Mask: syscall.IN_MOVED_TO, Cookie: 10},
+			{Wd: 1, Mask: syscall.IN_DELETE}}, []string{"x", "y", "y"}, []fileWatcherChange{{file.ChangeOperation_Deleted, "x", ""}}},
+		{"overflow", []syscall.InotifyEvent{{Wd: -1, Mask: syscall.IN_Q_OVERFLOW}}, []string{""},
+			[]fileWatcherChange{{file.ChangeOperation_Overflow, "", ""}}},
+		{"unknown watch", []syscall.InotifyEvent{{Wd: 3, Mask: syscall.IN_CREATE}}, []string{"x"}, nil},
+	}
+	for _, tt := range tests {
+		for i, e := range tt.events {
+			fw.handle(e.Wd, e.Mask, e.Cookie, tt.names[i])
+		}
+		fw.dispatch()
+		var got = listener.wait(0, 0)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: changes = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -23,7 +23,7 @@ type File struct {
 	data            []byte
 }
 
-func (f *File) MetaData() protocol.FileMetaData         { return &f.metadata }
+func (f *File) Metadata() protocol.FileMetadata         { return &f.metadata }
 func (f *File) Data() protocol.FileData                 { return f }
 func (f *File) ParentDirectory() protocol.FileDirectory { return f.parentDirectory }
 
@@ -33,11 +33,14 @@ func (f *File) init(path string) (err protocol.Error) {
 	return
 }
 
+// path return the OS path of the file.
+func (f *File) path() string { return f.parentDirectory.path + f.metadata.uri.Name() }
+
 // Save use to write file to the file system!
 func (f *File) Save() (err protocol.Error) {
 	// Just write changed file
 	if f.data != nil {
-		var goErr = goos.WriteFile(f.metadata.uri.Path(), f.data, 0700)
+		var goErr = goos.WriteFile(f.path(), f.data, 0700)
 		if goErr != nil {
 			// err =
 		}
@@ -47,8 +50,12 @@ func (f *File) Save() (err protocol.Error) {
 
 // Rename rename file name and full name
 func (f *File) Rename(newName string) {
-	delete(f.parentDirectory.files, f.metadata.uri.Name())
-	f.parentDirectory.files[newName] = f
+	var dir = f.parentDirectory
+	var oldName = f.metadata.uri.Name()
+	if dir.Rename(oldName, newName) != nil {
+		return
+	}
+	dir.files[newName] = f
 	f.metadata.uri.Rename(newName)
 }
 
@@ -138,7 +145,7 @@ func (f *File) Append(data []byte) {
 	} else {
 		var goErr error
 		var file *goos.File
-		file, goErr = goos.OpenFile(f.metadata.URI().URI(), goos.O_APPEND|goos.O_WRONLY, 0700)
+		file, goErr = goos.OpenFile(f.path(), goos.O_APPEND|goos.O_WRONLY, 0700)
 		if goErr != nil {
 			// if goos.IsNotExist(goErr) {
 			// 	return ErrStorageNotExist
@@ -183,7 +190,7 @@ func (f *File) Marshal() (data []byte) {
 	if f.data != nil {
 		return f.data
 	}
-	data, _ = goos.ReadFile(f.metadata.uri.Path())
+	data, _ = goos.ReadFile(f.path())
 	return
 }
 
@@ -0,0 +1,75 @@
+//go:build lang_eng
+
+/* For license and copyright information please see LEGAL file in repository */
+
+package dos
+
+import (
+	"../../detail"
+	"../../protocol"
+)
+
+const domainEnglish = "Default OS"
+
+func init() {
+	ErrStorageDeviceProblem.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Storage Device Problem").
+		SetOverview("Requested data exist on the device that had problem to access it!").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrStorageNotExist.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Storage Not Exist").
+		SetOverview("Requested file, directory or storage device not exist").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrStorageExist.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Storage Exist").
+		SetOverview("A file or directory with requested name exist already").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrStorageNotAuthorize.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Storage Not Authorized").
+		SetOverview("OS not let the app access to requested file, directory or storage device").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrStorageOutOfRange.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Storage Out Of Range").
+		SetOverview("Requested offset or limit is out of the storage capacity").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrStorageNoSpace.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Storage No Space").
+		SetOverview("Storage can't extend more than its device capacity").
+		SetUserNote("Free some space on the device").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+}
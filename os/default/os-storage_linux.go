@@ -0,0 +1,94 @@
+//go:build linux
+
+/* For license and copyright information please see LEGAL file in repository */
+
+package dos
+
+import (
+	goos "os"
+	"strconv"
+	"sync"
+
+	"../../log"
+	"../../protocol"
+)
+
+// StorageBlockFileName is the file next to the app binary that Storage() use as the app block storage.
+// Change it before first call to Storage() e.g. to a raw block device like "/dev/sdb".
+var StorageBlockFileName = "storage.block"
+
+var (
+	storageBlock     StorageBlock
+	storageBlockOnce sync.Once
+)
+
+// Storage return the app block storage that open on first call.
+//
+//libgo:impl libgo/protocol.OperatingSystem_Storage
+func (os *os) Storage() protocol.StorageBlock {
+	storageBlockOnce.Do(func() {
+		var path = StorageBlockFileName
+		if path == "" || path[0] != '/' {
+			path = os.appFileURI.DirectoryPath() + path
+		}
+		var err = storageBlock.Init(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+	return &storageBlock
+}
+
+// StorageDevices return details of all block devices that linux expose in /sys/block.
+func (os *os) StorageDevices() (devices []protocol.StorageBlockDetails) {
+	var dirEntry, goErr = goos.ReadDir("/sys/block")
+	if goErr != nil {
+		return
+	}
+	devices = make([]protocol.StorageBlockDetails, 0, len(dirEntry))
+	for _, entry := range dirEntry {
+		var sd = storageDevice{name: entry.Name()}
+		sd.init("/sys/block/" + sd.name)
+		devices = append(devices, &sd)
+	}
+	return
+}
+
+// storageDevice implement protocol.StorageBlockDetails
+type storageDevice struct {
+	name              string
+	capacity          uint64
+	logicalBlockSize  uint
+	physicalBlockSize uint
+	rotational        bool
+	removable         bool
+	readOnly          bool
+}
+
+// init read device details from its sysfs directory.
+// Linux always report size in 512 byte sectors regardless of the device block size.
+func (sd *storageDevice) init(sysPath string) {
+	sd.capacity = readSysUint(sysPath+"/size") * 512
+	sd.logicalBlockSize = uint(readSysUint(sysPath + "/queue/logical_block_size"))
+	sd.physicalBlockSize = uint(readSysUint(sysPath + "/queue/physical_block_size"))
+	sd.rotational = readSysUint(sysPath+"/queue/rotational") == 1
+	sd.removable = readSysUint(sysPath+"/removable") == 1
+	sd.readOnly = readSysUint(sysPath+"/ro") == 1
+}
+
+//libgo:impl libgo/protocol.StorageBlockDetails
+func (sd *storageDevice) Name() string            { return sd.name }
+func (sd *storageDevice) Capacity() uint64        { return sd.capacity }
+func (sd *storageDevice) LogicalBlockSize() uint  { return sd.logicalBlockSize }
+func (sd *storageDevice) PhysicalBlockSize() uint { return sd.physicalBlockSize }
+func (sd *storageDevice) Rotational() bool        { return sd.rotational }
+func (sd *storageDevice) Removable() bool         { return sd.removable }
+func (sd *storageDevice) ReadOnly() bool          { return sd.readOnly }
+
+func readSysUint(path string) (num uint64) {
+	var value, ok = readSysFile(path)
+	if ok {
+		num, _ = strconv.ParseUint(value, 10, 64)
+	}
+	return
+}
@@ -0,0 +1,55 @@
+//go:build linux
+
+/* For license and copyright information please see LEGAL file in repository */
+
+package dos
+
+import (
+	goos "os"
+	"testing"
+)
+
+func TestStorageDevice(t *testing.T) {
+	var sysPath = t.TempDir() + "/sdb"
+	goos.MkdirAll(sysPath+"/queue", 0700)
+	var files = map[string]string{
+		"size":                      "2048\n",
+		"removable":                 "1\n",
+		"ro":                        "0\n",
+		"queue/logical_block_size":  "512\n",
+		"queue/physical_block_size": "4096\n",
+		"queue/rotational":          "1\n",
+	}
+	for name, value := range files {
+		goos.WriteFile(sysPath+"/"+name, []byte(value), 0600)
+	}
+
+	var sd = storageDevice{name: "sdb"}
+	sd.init(sysPath)
+	if sd.Name() != "sdb" || sd.Capacity() != 2048*512 {
+		t.Errorf("init() Name() = %v, Capacity() = %v", sd.Name(), sd.Capacity())
+	}
+	if sd.LogicalBlockSize() != 512 || sd.PhysicalBlockSize() != 4096 {
+		t.Errorf("init() LogicalBlockSize() = %v, PhysicalBlockSize() = %v", sd.LogicalBlockSize(), sd.PhysicalBlockSize())
+	}
+	if !sd.Rotational() || !sd.Removable() || sd.ReadOnly() {
+		t.Errorf("init() Rotational() = %v, Removable() = %v, ReadOnly() = %v", sd.Rotational(), sd.Removable(), sd.ReadOnly())
+	}
+}
+
+func TestOS_StorageDevices(t *testing.T) {
+	var entries, goErr = goos.ReadDir("/sys/block")
+	if goErr != nil {
+		t.Skip("/sys/block is not available:", goErr)
+	}
+	var o os
+	var devices = o.StorageDevices()
+	if len(devices) != len(entries) {
+		t.Fatalf("StorageDevices() return %v devices, want %v", len(devices), len(entries))
+	}
+	for i, device := range devices {
+		if device.Name() != entries[i].Name() {
+			t.Errorf("StorageDevices()[%v].Name() = %v, want %v", i, device.Name(), entries[i].Name())
+		}
+	}
+}
@@ -0,0 +1,281 @@
+//go:build linux
+
+/* For license and copyright information please see LEGAL file in repository */
+
+package dos
+
+import (
+	"bytes"
+	"io"
+	goos "os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"../../protocol"
+)
+
+// StorageBlock implement protocol.StorageBlock on a linux regular file or a raw block device e.g. /dev/sdb.
+// - Regular file extend by Extend() or any Write() out of capacity, but a block device capacity is fixed.
+// - Flush() call fsync, so all changes before it are on the device after it returns.
+type StorageBlock struct {
+	file      *goos.File
+	device    bool // true if file is a block device
+	blockSize int
+	cap       int
+	sync      sync.Mutex
+}
+
+// storageBlockChunk is the max buffer size use in Erase, Copy, Move and Search to not load all data to RAM.
+const storageBlockChunk = 1 << 20
+
+// Init open the file or block device in given path, It will make the file if not exist.
+//
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (sb *StorageBlock) Init(path string) (err protocol.Error) {
+	var goErr error
+	sb.file, goErr = goos.OpenFile(path, goos.O_RDWR|goos.O_CREATE, 0600)
+	if goErr != nil {
+		return storageError(goErr)
+	}
+
+	var stat syscall.Stat_t
+	goErr = syscall.Fstat(int(sb.file.Fd()), &stat)
+	if goErr != nil {
+		return storageError(goErr)
+	}
+	sb.device = stat.Mode&syscall.S_IFMT == syscall.S_IFBLK
+	if sb.device {
+		// Size of a block device is not in stat, so seek to the end of it.
+		var size int64
+		size, goErr = sb.file.Seek(0, io.SeekEnd)
+		if goErr != nil {
+			return storageError(goErr)
+		}
+		sb.cap = int(size)
+		var rdev = uint64(stat.Rdev)
+		var major = ((rdev >> 8) & 0xfff) | ((rdev >> 32) & 0xfffff000)
+		var minor = (rdev & 0xff) | ((rdev >> 12) & 0xffffff00)
+		sb.blockSize = deviceBlockSize("/sys/dev/block/" + strconv.FormatUint(major, 10) + ":" + strconv.FormatUint(minor, 10))
+	} else {
+		sb.cap = int(stat.Size)
+		sb.blockSize = int(stat.Blksize)
+	}
+	if sb.blockSize < 1 {
+		sb.blockSize = 4096
+	}
+	return
+}
+func (sb *StorageBlock) Deinit() (err protocol.Error) {
+	err = sb.Flush()
+	if err != nil {
+		return
+	}
+	var goErr = sb.file.Close()
+	if goErr != nil {
+		err = storageError(goErr)
+	}
+	return
+}
+
+func (sb *StorageBlock) BlockSize() int { return sb.blockSize }
+
+//libgo:impl libgo/protocol.StorageBlockVolatile
+func (sb *StorageBlock) Cap() (c int) {
+	sb.sync.Lock()
+	c = sb.cap
+	sb.sync.Unlock()
+	return
+}
+
+// Extend round up cap to the block size and grow the file to it. Block devices can't extend more than their size.
+func (sb *StorageBlock) Extend(cap int) (extended int, err protocol.Error) {
+	sb.sync.Lock()
+	extended, err = sb.extend(cap)
+	sb.sync.Unlock()
+	return
+}
+func (sb *StorageBlock) Read(offset int, data []byte) (err protocol.Error) {
+	if offset < 0 || offset+len(data) > sb.Cap() {
+		return &ErrStorageOutOfRange
+	}
+	var _, goErr = sb.file.ReadAt(data, int64(offset))
+	if goErr != nil {
+		err = storageError(goErr)
+	}
+	return
+}
+func (sb *StorageBlock) Write(offset int, data []byte) (err protocol.Error) {
+	if offset < 0 {
+		return &ErrStorageOutOfRange
+	}
+	sb.sync.Lock()
+	if offset+len(data) > sb.cap {
+		_, err = sb.extend(offset + len(data))
+	}
+	sb.sync.Unlock()
+	if err != nil {
+		return
+	}
+	var _, goErr = sb.file.WriteAt(data, int64(offset))
+	if goErr != nil {
+		err = storageError(goErr)
+	}
+	return
+}
+
+// Erase overwrite the range with zero data. It doesn't punch hole, so the data really gone from the device after Flush().
+func (sb *StorageBlock) Erase(offset, limit int) (err protocol.Error) {
+	if offset < 0 || limit < 0 || offset+limit > sb.Cap() {
+		return &ErrStorageOutOfRange
+	}
+	var zeros = make([]byte, minInt(limit, storageBlockChunk))
+	for limit > 0 {
+		var ln = minInt(limit, len(zeros))
+		var _, goErr = sb.file.WriteAt(zeros[:ln], int64(offset))
+		if goErr != nil {
+			return storageError(goErr)
+		}
+		offset += ln
+		limit -= ln
+	}
+	return
+}
+
+// Copy copy data in chunks and support overlap ranges like memmove.
+func (sb *StorageBlock) Copy(desOffset, srcOffset int, limit int) (err protocol.Error) {
+	if desOffset < 0 || srcOffset < 0 || limit < 0 || srcOffset+limit > sb.Cap() {
+		return &ErrStorageOutOfRange
+	}
+	if desOffset+limit > sb.Cap() {
+		_, err = sb.Extend(desOffset + limit)
+		if err != nil {
+			return
+		}
+	}
+
+	var buf = make([]byte, minInt(limit, storageBlockChunk))
+	// Copy backward if destination is after the source and overlap it, to not overwrite source before read it.
+	var backward = desOffset > srcOffset && desOffset < srcOffset+limit
+	for done := 0; done < limit; {
+		var ln = minInt(limit-done, len(buf))
+		var pos = done
+		if backward {
+			pos = limit - done - ln
+		}
+		var _, goErr = sb.file.ReadAt(buf[:ln], int64(srcOffset+pos))
+		if goErr != nil {
+			return storageError(goErr)
+		}
+		_, goErr = sb.file.WriteAt(buf[:ln], int64(desOffset+pos))
+		if goErr != nil {
+			return storageError(goErr)
+		}
+		done += ln
+	}
+	return
+}
+
+// Move copy data to destination and write zero to any part of source that not overwritten by the destination.
+func (sb *StorageBlock) Move(desOffset, srcOffset int, limit int) (err protocol.Error) {
+	err = sb.Copy(desOffset, srcOffset, limit)
+	if err != nil {
+		return
+	}
+	var srcEnd = srcOffset + limit
+	var desEnd = desOffset + limit
+	switch {
+	case desEnd <= srcOffset || desOffset >= srcEnd:
+		err = sb.Erase(srcOffset, limit)
+	case desOffset > srcOffset:
+		err = sb.Erase(srcOffset, desOffset-srcOffset)
+	default:
+		err = sb.Erase(desEnd, srcEnd-desEnd)
+	}
+	return
+}
+
+// Search return location of first match of data from offset, or -1 if not found.
+// It reads the storage in chunks that overlap by len(data)-1 to find matches on chunk borders.
+func (sb *StorageBlock) Search(data []byte, offset int) (loc int, err protocol.Error) {
+	loc = -1
+	var cap = sb.Cap()
+	if offset < 0 || offset > cap {
+		err = &ErrStorageOutOfRange
+		return
+	}
+	if len(data) == 0 {
+		return offset, nil
+	}
+
+	var buf = make([]byte, storageBlockChunk+len(data))
+	for offset+len(data) <= cap {
+		var ln = minInt(cap-offset, len(buf))
+		var _, goErr = sb.file.ReadAt(buf[:ln], int64(offset))
+		if goErr != nil {
+			err = storageError(goErr)
+			return
+		}
+		var i = bytes.Index(buf[:ln], data)
+		if i >= 0 {
+			return offset + i, nil
+		}
+		if offset+ln == cap {
+			break
+		}
+		offset += ln - len(data) + 1
+	}
+	return
+}
+
+//libgo:impl libgo/protocol.StorageBlock
+func (sb *StorageBlock) Flush() (err protocol.Error) {
+	var goErr = sb.file.Sync()
+	if goErr != nil {
+		err = storageError(goErr)
+	}
+	return
+}
+
+// Caller must hold the lock.
+func (sb *StorageBlock) extend(cap int) (extended int, err protocol.Error) {
+	if cap <= sb.cap {
+		return sb.cap, nil
+	}
+	if sb.device {
+		return sb.cap, &ErrStorageNoSpace
+	}
+	extended = (cap + sb.blockSize - 1) / sb.blockSize * sb.blockSize
+	var goErr = sb.file.Truncate(int64(extended))
+	if goErr != nil {
+		return sb.cap, storageError(goErr)
+	}
+	sb.cap = extended
+	return
+}
+
+// deviceBlockSize read logical block size of a block device or its parent disk if it is a partition.
+func deviceBlockSize(sysPath string) (size int) {
+	var value, ok = readSysFile(sysPath + "/queue/logical_block_size")
+	if !ok {
+		value, _ = readSysFile(sysPath + "/../queue/logical_block_size")
+	}
+	size, _ = strconv.Atoi(value)
+	return
+}
+
+func readSysFile(path string) (value string, ok bool) {
+	var data, goErr = goos.ReadFile(path)
+	if goErr != nil {
+		return
+	}
+	return strings.TrimSpace(string(data)), true
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
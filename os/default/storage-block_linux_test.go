@@ -0,0 +1,134 @@
+//go:build linux
+
+/* For license and copyright information please see LEGAL file in repository */
+
+package dos
+
+import (
+	"bytes"
+	goos "os"
+	"testing"
+)
+
+func TestStorageBlock(t *testing.T) {
+	var path = t.TempDir() + "/storage.block"
+	var sb StorageBlock
+	if err := sb.Init(path); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	if sb.Cap() != 0 || sb.BlockSize() < 1 {
+		t.Fatalf("Init() of new file Cap() = %v, BlockSize() = %v", sb.Cap(), sb.BlockSize())
+	}
+
+	var data = []byte("libgo storage block data")
+	if err := sb.Write(10, data); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if c := sb.Cap(); c < 10+len(data) || c%sb.BlockSize() != 0 {
+		t.Errorf("Write() out of capacity don't extend to the block size, Cap() = %v", c)
+	}
+	var got = make([]byte, len(data))
+	if err := sb.Read(10, got); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Read() = %q, %v", got, err)
+	}
+	if err := sb.Read(sb.Cap()-1, got); err != &ErrStorageOutOfRange {
+		t.Errorf("Read() out of capacity error = %v, want ErrStorageOutOfRange", err)
+	}
+	if loc, _ := sb.Search([]byte("block"), 0); loc != 10+bytes.Index(data, []byte("block")) {
+		t.Errorf("Search() = %v", loc)
+	}
+	if loc, _ := sb.Search([]byte("nothing"), 0); loc != -1 {
+		t.Errorf("Search() of not exist data = %v, want -1", loc)
+	}
+
+	// Overlap ranges must copy like memmove in both directions.
+	if err := sb.Copy(14, 10, len(data)); err != nil {
+		t.Fatalf("Copy() forward error = %v", err)
+	}
+	sb.Read(14, got)
+	if !bytes.Equal(got, data) {
+		t.Errorf("Read() after Copy() forward = %q", got)
+	}
+	if err := sb.Copy(10, 14, len(data)); err != nil {
+		t.Fatalf("Copy() backward error = %v", err)
+	}
+	sb.Read(10, got)
+	if !bytes.Equal(got, data) {
+		t.Errorf("Read() after Copy() backward = %q", got)
+	}
+
+	if err := sb.Move(100, 10, len(data)); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	var moved = make([]byte, 100+len(data)-10)
+	sb.Read(10, moved)
+	if !bytes.Equal(moved[90:], data) || !bytes.Equal(moved[:len(data)], make([]byte, len(data))) {
+		t.Errorf("Read() after Move() = %q", moved)
+	}
+	if err := sb.Erase(100, len(data)); err != nil {
+		t.Fatalf("Erase() error = %v", err)
+	}
+	if loc, _ := sb.Search(data, 0); loc != -1 {
+		t.Errorf("Erase() don't write zero data, Search() = %v", loc)
+	}
+
+	if err := sb.Write(200, data); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	var cap = sb.Cap()
+	if err := sb.Deinit(); err != nil {
+		t.Fatalf("Deinit() error = %v", err)
+	}
+	var reopened StorageBlock
+	if err := reopened.Init(path); err != nil {
+		t.Fatalf("reopen Init() error = %v", err)
+	}
+	defer reopened.Deinit()
+	if reopened.Cap() != cap {
+		t.Errorf("reopen Cap() = %v, want %v", reopened.Cap(), cap)
+	}
+	reopened.Read(200, got)
+	if !bytes.Equal(got, data) {
+		t.Errorf("reopen Read() = %q", got)
+	}
+}
+
+func TestStorageBlock_SearchChunkBorder(t *testing.T) {
+	var sb StorageBlock
+	if err := sb.Init(t.TempDir() + "/storage.block"); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer sb.Deinit()
+
+	var data = []byte("cross chunk border")
+	var offset = storageBlockChunk - 5
+	sb.Write(offset, data)
+	if loc, err := sb.Search(data, 0); loc != offset || err != nil {
+		t.Errorf("Search() = %v, %v, want %v", loc, err, offset)
+	}
+}
+
+func TestStorageBlock_InitError(t *testing.T) {
+	var sb StorageBlock
+	if err := sb.Init(t.TempDir() + "/not-exist/storage.block"); err != &ErrStorageNotExist {
+		t.Errorf("Init() in not exist directory error = %v, want ErrStorageNotExist", err)
+	}
+}
+
+func TestDeviceBlockSize(t *testing.T) {
+	// Partitions don't have queue directory, so it must read from the parent disk.
+	var disk = t.TempDir() + "/sda"
+	goos.MkdirAll(disk+"/queue", 0700)
+	goos.MkdirAll(disk+"/sda1", 0700)
+	goos.WriteFile(disk+"/queue/logical_block_size", []byte("4096\n"), 0600)
+
+	if size := deviceBlockSize(disk); size != 4096 {
+		t.Errorf("deviceBlockSize() of disk = %v, want 4096", size)
+	}
+	if size := deviceBlockSize(disk + "/sda1"); size != 4096 {
+		t.Errorf("deviceBlockSize() of partition = %v, want 4096", size)
+	}
+	if size := deviceBlockSize(disk + "/not-exist"); size != 0 {
+		t.Errorf("deviceBlockSize() of not exist device = %v, want 0", size)
+	}
+}
@@ -0,0 +1,14 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package protocol
+
+// StorageBatch is the common part of any storage batch.
+// Batch methods just queue changes and may return error early if a change is invalid by itself e.g. nil key,
+// but checks that need storage state (e.g. exist or locked) must be done in Commit().
+// A batch can't be reused after Commit() or Discard().
+type StorageBatch interface {
+	// Commit apply all queued changes in one atomic operation. If any change fails, none of them apply.
+	Commit() (err Error)
+	// Discard drop all queued changes. It is safe to call it after Commit() e.g. in defer.
+	Discard()
+}
@@ -12,9 +12,9 @@ type StorageBlockVolatile interface {
 	Extend(cap int) (extended int, err Error)
 
 	// Change the return data not flush to any non-volatile storages. Use Write() to change data.
-	Read(offset, data []byte) (err Error)
+	Read(offset int, data []byte) (err Error)
 	// Write at more than block capacity cause block extend. extend capacity isn't equal to write length.
-	Write(offset, data []byte) (err Error)
+	Write(offset int, data []byte) (err Error)
 	Erase(offset, limit int) (err Error)
 
 	Copy(desOffset, srcOffset int, limit int) (err Error)
@@ -31,3 +31,17 @@ type StorageBlock interface {
 	// Flush force the storage device to write any changes to data (store in cache) before call Flush.
 	Flush() (err Error)
 }
+
+// StorageBlockDetails is the interface that show details of a storage device that OS can access to it.
+// All sizes are in Byte.
+type StorageBlockDetails interface {
+	Name() string // e.g. "sda", "nvme0n1", ...
+	Capacity() uint64
+	// Smallest unit the device can address. Any data transfer between host and drive will be in multiples of it.
+	LogicalBlockSize() uint
+	// Smallest unit the device can write without read-modify-write. It also known as PhysicalSectorSize.
+	PhysicalBlockSize() uint
+	Rotational() bool // true for HDDs and false for SSDs and other non-mechanical devices
+	Removable() bool
+	ReadOnly() bool
+}
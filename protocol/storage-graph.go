@@ -2,6 +2,28 @@
 
 package protocol
 
+// StorageGraph is the interface that show how a graph storage work.
+// Edges are directed from PrimaryNode to SecondaryNode and many relations with different labels can exist between two nodes.
+// Each relation has a history, so removing a relation just end it and it is still reachable by History() and NeighborsAt().
+// Neighbors order is stable between calls to let callers page through them.
+type StorageGraph interface {
+	// AddEdge start the relation from now. Adding a relation that is active now do nothing.
+	AddEdge(primary, secondary [16]byte, relation GraphRelationLabel) (err Error)
+	// RemoveEdge end the active relation from now.
+	RemoveEdge(primary, secondary [16]byte, relation GraphRelationLabel) (err Error)
+	// Relations return labels of all active relations from primary to secondary node.
+	Relations(primary, secondary [16]byte) (relations []GraphRelationLabel, err Error)
+
+	// GraphRelationLabel_Unset as relation means any relation label.
+	NeighborNumbers(node [16]byte, relation GraphRelationLabel, direction GraphDirection) (num uint64, err Error)
+	Neighbors(node [16]byte, relation GraphRelationLabel, direction GraphDirection, offset, limit uint64) (nodes [][16]byte, err Error)
+	// NeighborsAt is like Neighbors but return nodes that had the relation at the given time.
+	NeighborsAt(node [16]byte, relation GraphRelationLabel, direction GraphDirection, at Time, offset, limit uint64) (nodes [][16]byte, err Error)
+
+	// History return all periods of the relation between two nodes, oldest first.
+	History(primary, secondary [16]byte, relation GraphRelationLabel) (history []GraphRelation, err Error)
+}
+
 // Save in on device node as PrimaryNode() but with PrimaryKey as sha3.256(PrimaryNode, SecondaryNode) in related GraphMediaTypeID.
 // - One secondary key can exist to list all SecondaryNode for PrimaryNode. But in some cases it isn't practical e.g. all relation to a city.
 // - On some requirements may need more secondary indexes e.g. all "act" relation for an actor to get all movies or vice versa
@@ -17,10 +39,37 @@ type Graph interface {
 	Relation() GraphRelationLabel // Edge in graph data type
 }
 
+// GraphRelation is one period of a relation between two nodes.
+type GraphRelation interface {
+	Graph
+	Start() Time
+	End() Time // nil means the relation is still active
+}
+
+type GraphDirection uint8
+
+const (
+	GraphDirection_Outgoing GraphDirection = iota // node is the PrimaryNode
+	GraphDirection_Incoming                       // node is the SecondaryNode
+	GraphDirection_Both
+)
+
+// GraphRelationLabel is an extensible set of labels. Labels under GraphRelationLabel_AppDefined reserved for common labels
+// that declare here, and any app can declare its labels from GraphRelationLabel_AppDefined.
 type GraphRelationLabel uint32
 
 const (
 	GraphRelationLabel_Unset GraphRelationLabel = iota
 	GraphRelationLabel_Knowns
-	// friend, FriendCircleOne(best-friend), brother, LIVES_IN, NATIONAL_OF, ...
+	GraphRelationLabel_Friend
+	GraphRelationLabel_BestFriend // FriendCircleOne
+	GraphRelationLabel_Sibling
+	GraphRelationLabel_Parent
+	GraphRelationLabel_Spouse
+	GraphRelationLabel_LivesIn
+	GraphRelationLabel_NationalOf
+	GraphRelationLabel_WorksAt
+	GraphRelationLabel_Follows
+
+	GraphRelationLabel_AppDefined GraphRelationLabel = 1 << 16
 )
@@ -9,6 +9,13 @@ type StorageKeyValue interface {
 	KeyNumbers() (num uint64, err Error)
 	ListKeys(offset, limit uint64) (keys [][]byte, err Error)
 
+	// Scan call iterator with each key in [start, end) range and its value in byte order of keys.
+	// nil end means no upper bound. Scan stops when iterator return breaking.
+	// It iterates a snapshot of the range, so changes made during the scan (even by the iterator) are not visible to it.
+	Scan(start, end []byte, options StorageKeyValue_ScanOptions, iterator Iterate_KV[[]byte]) (err Error)
+	// ScanPrefix is like Scan over all keys that start with the prefix.
+	ScanPrefix(prefix []byte, options StorageKeyValue_ScanOptions, iterator Iterate_KV[[]byte]) (err Error)
+
 	Lock(key []byte) (value []byte, err Error)
 	Unlock(key []byte, value []byte) (err Error)
 
@@ -22,7 +29,39 @@ type StorageKeyValue interface {
 	Erase(key []byte) (err Error)
 
 	// Multiple changes can be made in one atomic batch
-	// Batch()
+	Batch() (batch StorageKeyValue_Batch, err Error)
+}
+
+// StorageKeyValue_Batch group changes on a StorageKeyValue to apply them all-or-nothing by Commit().
+// Changes are not visible to any reader until Commit() returns without error.
+type StorageKeyValue_Batch interface {
+	Set(key []byte, value []byte, options StorageKeyValue_SaveOptions) (err Error)
+	Delete(key []byte) (err Error)
+	Erase(key []byte) (err Error)
+
+	StorageBatch
+}
+
+// StorageKeyValue_Leases is the interface of a StorageKeyValue that lock keys by leases.
+// A key locked by a lease can't change by any method until the holder release it or the lease expire.
+type StorageKeyValue_Leases interface {
+	LockLease(key []byte, options StorageLease_Options) (value []byte, token StorageLeaseToken, err Error)
+	// RenewLease extend the lease by ttl from now. Zero ttl means the TTL that the lease locked by.
+	RenewLease(key []byte, token StorageLeaseToken, ttl Duration) (err Error)
+	// UnlockLease store the value if it is not nil and release the lease.
+	UnlockLease(key []byte, token StorageLeaseToken, value []byte) (err Error)
+}
+
+// StorageKeyValue_Expiration is the interface of a StorageKeyValue that can tell when its keys expire,
+// e.g. to dump keys with their TTL.
+type StorageKeyValue_Expiration interface {
+	// TTL return the remaining time to live of the key. Zero ttl means the key never expire.
+	TTL(key []byte) (ttl Duration, err Error)
+}
+
+type StorageKeyValue_ScanOptions struct {
+	// Reverse iterate keys in descending byte order.
+	Reverse bool
 }
 
 type StorageKeyValue_SaveOptions struct {
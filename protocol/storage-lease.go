@@ -0,0 +1,18 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package protocol
+
+// StorageLeaseToken identify the holder of a lease, so just the holder can renew or release it.
+type StorageLeaseToken [16]byte
+
+// StorageLease_Options indicate how to get a lease lock on a key or an object.
+// A lease expire if its holder doesn't renew or release it in its TTL, so a crashed holder can't block others forever.
+type StorageLease_Options struct {
+	// TTL is the lease duration. Zero means the storage default.
+	TTL Duration
+	// Wait is the max duration to wait for the current holder to release the lease.
+	// Zero means return the lock error without wait and negative means wait without limit.
+	Wait Duration
+	// Cancel stop waiting when it closed e.g. by context.Context.Done(). nil means no cancellation.
+	Cancel <-chan struct{}
+}
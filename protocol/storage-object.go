@@ -33,5 +33,26 @@ type StorageObjects interface {
 	Erase(mt MediaTypeID, id [16]byte) (err Error)
 
 	// Multiple changes can be made in one atomic batch
-	// Batch()
+	Batch() (batch StorageObjects_Batch, err Error)
+}
+
+// StorageObjects_Leases is the interface of a StorageObjects that lock objects by leases.
+type StorageObjects_Leases interface {
+	LockLease(mt MediaTypeID, id [16]byte, options StorageLease_Options) (token StorageLeaseToken, err Error)
+	// RenewLease extend the lease by ttl from now. Zero ttl means the TTL that the lease locked by.
+	RenewLease(mt MediaTypeID, id [16]byte, token StorageLeaseToken, ttl Duration) (err Error)
+	UnlockLease(mt MediaTypeID, id [16]byte, token StorageLeaseToken) (err Error)
+}
+
+// StorageObjects_Batch group changes on a StorageObjects to apply them all-or-nothing by Commit().
+// Changes are not visible to any reader until Commit() returns without error.
+type StorageObjects_Batch interface {
+	Save(mt MediaTypeID, id [16]byte, object []byte) (err Error)
+	Write(mt MediaTypeID, id [16]byte, offset uint64, data []byte) (err Error)
+	Append(mt MediaTypeID, id [16]byte, data []byte) (err Error)
+	Prepend(mt MediaTypeID, id [16]byte, data []byte) (err Error)
+	Delete(mt MediaTypeID, id [16]byte) (err Error)
+	Erase(mt MediaTypeID, id [16]byte) (err Error)
+
+	StorageBatch
 }
@@ -37,19 +37,107 @@ type StorageRecords interface {
 	// make invisible just by remove from primary index. next Get() can know that a version exist, but data gone and no access to data anymore.
 	DeleteVersion(mt MediaTypeID, id [16]byte, vo VersionOffset) (err Error)
 
+	// Multiple changes can be made in one atomic batch
+	Batch() (batch StorageRecords_Batch, err Error)
+
 	EventTarget
 }
 
+// StorageRecords_Batch group changes on a StorageRecords to apply them all-or-nothing by Commit().
+// Changes are not visible to any reader until Commit() returns without error.
+type StorageRecords_Batch interface {
+	Save(mt MediaTypeID, id [16]byte, record []byte, options StorageRecord_SaveOptions) (err Error)
+	Update(mt MediaTypeID, id [16]byte, record []byte, vo VersionOffset) (err Error)
+	Delete(mt MediaTypeID, id [16]byte) (err Error)
+	DeleteVersion(mt MediaTypeID, id [16]byte, vo VersionOffset) (err Error)
+
+	StorageBatch
+}
+
 type StorageRecord_SaveOptions struct {
 	// MaxVersion == StorageRecord_NoVersion means this record don't need versioning or just one version.
 	// MaxVersion > 0 indicate max version. e.g. 6 means just 6 version must store for the record.
 	// MaxVersion == StorageRecord_LastSourceVersion indicate no version limit but logically it has limit up to uint64.
 	MaxVersion VersionOffset
 
-	// By none, hour, day, week, ...
-	PrimaryIndexSplitting uint8
+	// PrimaryIndexSplitting split the primary index of new records by the period of their first save time.
+	// It has no effect on saving new versions of an existing record.
+	PrimaryIndexSplitting StorageRecord_IndexSplitting
 }
 
+// StorageRecord_IndexSplitting indicate the period of primary index partitions. All periods are in UTC and weeks start on Monday.
+type StorageRecord_IndexSplitting uint8
+
+const (
+	StorageRecord_IndexSplitting_None StorageRecord_IndexSplitting = iota
+	StorageRecord_IndexSplitting_Hour
+	StorageRecord_IndexSplitting_Day
+	StorageRecord_IndexSplitting_Week
+	StorageRecord_IndexSplitting_Month
+	StorageRecord_IndexSplitting_Year
+)
+
+// StorageRecords_Partitioned is the interface of a StorageRecords that keep records saved with PrimaryIndexSplitting
+// in partitions of the primary index, so time window queries just read the partitions that overlap the window.
+// Records saved without splitting are not in any partition. Time windows are [from, to).
+type StorageRecords_Partitioned interface {
+	RecordNumbersIn(mt MediaTypeID, from, to Time) (num uint64, err Error)
+	// ListRecordsIn return records in order of their first save time.
+	ListRecordsIn(mt MediaTypeID, from, to Time, offset, limit uint64) (ids [][16]byte, err Error)
+	// DropPartitions delete all records of partitions that end before given time e.g. to apply a retention policy.
+	DropPartitions(mt MediaTypeID, before Time) (num uint64, err Error)
+}
+
+// StorageRecords_Restore is the interface of a StorageRecords that can tell how a record saved and restore it the same way,
+// e.g. to dump records to a backup and restore them without change their retention or partitions.
+type StorageRecords_Restore interface {
+	// SaveOptions return the options of the last save of the record and its first save time.
+	SaveOptions(mt MediaTypeID, id [16]byte) (options StorageRecord_SaveOptions, created Time, err Error)
+	// Restore is like Save but a new record is as if it first saved at created time.
+	Restore(mt MediaTypeID, id [16]byte, record []byte, options StorageRecord_SaveOptions, created Time) (err Error)
+}
+
+// StorageRecords_Indexed is the interface of a StorageRecords that keep secondary indexes over fields of
+// the last version of records, so apps don't need their own index tables to find records by a field e.g. email or status.
+// Indexes change in the same transaction as the records on Save, Update, Delete, DeleteVersion, Unlock and batches.
+// A record that its last version is deleted or is too short to hold the field isn't in the index.
+type StorageRecords_Indexed interface {
+	// RegisterIndex index all existing records of the mediatype and then keep the index up to date.
+	RegisterIndex(mt MediaTypeID, index StorageRecord_Index) (err Error)
+	DropIndex(mt MediaTypeID, indexName string) (err Error)
+
+	// FindRecords return IDs of records that have the field value in the index, in byte order of IDs.
+	// value is the field as Syllab encode it on the stack e.g. by syllab.SetUInt64, or the content for StorageRecord_IndexType_String.
+	FindRecords(mt MediaTypeID, indexName string, value []byte, offset, limit uint64) (ids [][16]byte, err Error)
+	// FindRecord return the first record of FindRecords. It is useful for unique indexes.
+	FindRecord(mt MediaTypeID, indexName string, value []byte) (id [16]byte, err Error)
+}
+
+// StorageRecord_Index declare a secondary index over a field of Syllab encoded records.
+type StorageRecord_Index struct {
+	Name string
+	// StackIndex is the offset of the field in the Syllab stack of the record.
+	StackIndex uint32
+	Type       StorageRecord_IndexType
+	// Unique reject any change that make two records with the same field value.
+	Unique bool
+}
+
+// StorageRecord_IndexType indicate how to read an indexed field from the Syllab stack.
+// Signed integers and other fixed size types index by the type with the same size.
+type StorageRecord_IndexType uint8
+
+const (
+	StorageRecord_IndexType_Unset StorageRecord_IndexType = iota
+	StorageRecord_IndexType_UInt8
+	StorageRecord_IndexType_UInt16
+	StorageRecord_IndexType_UInt32
+	StorageRecord_IndexType_UInt64
+	StorageRecord_IndexType_Array16 // e.g. ID of other records
+	StorageRecord_IndexType_Array32
+	StorageRecord_IndexType_String // string or byte slice with its data in the Syllab heap
+)
+
 type NumberOfVersion uint64
 type VersionOffset uint64
 
@@ -0,0 +1,20 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+// batchOperation indicate the kind of a queued change in any storage batch.
+type batchOperation uint8
+
+const (
+	batchOperation_Unset batchOperation = iota
+	batchOperation_Set
+	batchOperation_Save
+	batchOperation_Update
+	batchOperation_Write
+	batchOperation_Append
+	batchOperation_Prepend
+	batchOperation_Extend
+	batchOperation_Delete
+	batchOperation_DeleteVersion
+	batchOperation_Erase
+)
@@ -0,0 +1,409 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"sync"
+
+	"libgo/binary"
+	"libgo/protocol"
+)
+
+// BlockEncrypted is a protocol.StorageBlock that encrypt data at rest on the underlying device by AES-256-GCM.
+// It is the block storage level encryption that objects, records and k/v storages ask for, so any of them can use it as device.
+//   - Each BlockSize bytes of data keep in one device block with a header of the key ID and a random nonce and the GCM tag.
+//   - Block index is the GCM additional data, so blocks can't swap on the device without detection.
+//   - Extend() and Erase() write erased blocks that are encryption of zero data, so a block with a zero or forged header
+//     on the device read as ErrCorrupted not as zero data. Use a device that BlockEncrypted make all its blocks.
+//   - Search() decrypt the blocks and search on the plain data.
+//   - Rotate() re-encrypt all blocks by a new key. GCM random nonces must not repeat, so rotate keys before about 2^32 writes.
+type BlockEncrypted struct {
+	// BlockSize is the data size of each block. Zero means blockEncrypted_DefaultBlockSize that fill 4KiB of the device
+	// with the header and the tag. It must not change after first write.
+	BlockSize int
+
+	sync   sync.Mutex
+	device protocol.StorageBlock
+	keyID  uint32 // ID of the key that encrypt new writes
+	keys   map[uint32]cipher.AEAD
+}
+
+const (
+	blockEncrypted_KeyIDSize        = 4
+	blockEncrypted_NonceSize        = 12
+	blockEncrypted_HeaderSize       = blockEncrypted_KeyIDSize + blockEncrypted_NonceSize
+	blockEncrypted_TagSize          = 16
+	blockEncrypted_Overhead         = blockEncrypted_HeaderSize + blockEncrypted_TagSize
+	blockEncrypted_DefaultBlockSize = 4096 - blockEncrypted_Overhead
+	blockEncrypted_KeySize          = 32
+)
+
+// Init use the key with given ID to encrypt new writes. keyID must not be zero.
+// Use AddKey() for keys of existing data that rotation of them isn't finished.
+//
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (be *BlockEncrypted) Init(device protocol.StorageBlock, keyID uint32, key []byte) (err protocol.Error) {
+	if be.BlockSize < 1 {
+		be.BlockSize = blockEncrypted_DefaultBlockSize
+	}
+	be.device = device
+	be.keys = make(map[uint32]cipher.AEAD)
+	err = be.addKey(keyID, key)
+	if err != nil {
+		return
+	}
+	be.keyID = keyID
+	return
+}
+
+// Deinit flush the device and forget all keys.
+func (be *BlockEncrypted) Deinit() (err protocol.Error) {
+	be.sync.Lock()
+	be.keys = nil
+	err = be.device.Flush()
+	be.sync.Unlock()
+	return
+}
+
+// AddKey add a key that just use to decrypt existing blocks.
+func (be *BlockEncrypted) AddKey(keyID uint32, key []byte) (err protocol.Error) {
+	be.sync.Lock()
+	err = be.addKey(keyID, key)
+	be.sync.Unlock()
+	return
+}
+
+// Rotate re-encrypt all blocks by the new key and then forget all other keys.
+// If it fails in the middle, blocks are readable by the old and the new keys, so add both of them and call it again.
+func (be *BlockEncrypted) Rotate(keyID uint32, key []byte) (err protocol.Error) {
+	be.sync.Lock()
+	defer be.sync.Unlock()
+	err = be.addKey(keyID, key)
+	if err != nil {
+		return
+	}
+	be.keyID = keyID
+
+	var slotSize = be.slotSize()
+	var slot = make([]byte, slotSize)
+	var plain = make([]byte, be.BlockSize)
+	var blocks = be.blocks()
+	for i := 0; i < blocks; i++ {
+		err = be.device.Read(i*slotSize, slot)
+		if err != nil {
+			return
+		}
+		var id = binary.LittleEndian(slot).Uint32()
+		if id == keyID {
+			continue
+		}
+		err = be.readBlock(i, plain)
+		if err != nil {
+			return
+		}
+		err = be.writeBlock(i, plain)
+		if err != nil {
+			return
+		}
+	}
+	err = be.device.Flush()
+	if err != nil {
+		return
+	}
+	for id := range be.keys {
+		if id != keyID {
+			delete(be.keys, id)
+		}
+	}
+	return
+}
+
+//libgo:impl libgo/protocol.StorageBlockVolatile
+func (be *BlockEncrypted) Cap() (c int) {
+	be.sync.Lock()
+	c = be.blocks() * be.BlockSize
+	be.sync.Unlock()
+	return
+}
+func (be *BlockEncrypted) Extend(cap int) (extended int, err protocol.Error) {
+	var blocks = (cap + be.BlockSize - 1) / be.BlockSize
+	be.sync.Lock()
+	err = be.extend(blocks)
+	extended = be.blocks() * be.BlockSize
+	be.sync.Unlock()
+	return
+}
+func (be *BlockEncrypted) Read(offset int, data []byte) (err protocol.Error) {
+	be.sync.Lock()
+	err = be.read(offset, data)
+	be.sync.Unlock()
+	return
+}
+func (be *BlockEncrypted) Write(offset int, data []byte) (err protocol.Error) {
+	if offset < 0 {
+		return &ErrOutOfRange
+	}
+	be.sync.Lock()
+	err = be.write(offset, data)
+	be.sync.Unlock()
+	return
+}
+func (be *BlockEncrypted) Erase(offset, limit int) (err protocol.Error) {
+	be.sync.Lock()
+	err = be.erase(offset, limit)
+	be.sync.Unlock()
+	return
+}
+func (be *BlockEncrypted) Copy(desOffset, srcOffset int, limit int) (err protocol.Error) {
+	be.sync.Lock()
+	err = be.copy(desOffset, srcOffset, limit)
+	be.sync.Unlock()
+	return
+}
+
+// Move copy data to destination and erase any part of source that not overwritten by the destination.
+func (be *BlockEncrypted) Move(desOffset, srcOffset int, limit int) (err protocol.Error) {
+	be.sync.Lock()
+	defer be.sync.Unlock()
+	err = be.copy(desOffset, srcOffset, limit)
+	if err != nil {
+		return
+	}
+	var srcEnd = srcOffset + limit
+	var desEnd = desOffset + limit
+	switch {
+	case desEnd <= srcOffset || desOffset >= srcEnd:
+		err = be.erase(srcOffset, limit)
+	case desOffset > srcOffset:
+		err = be.erase(srcOffset, desOffset-srcOffset)
+	default:
+		err = be.erase(desEnd, srcEnd-desEnd)
+	}
+	return
+}
+
+// Search return location of first match of data in the plain data from offset, or -1 if not found.
+func (be *BlockEncrypted) Search(data []byte, offset int) (loc int, err protocol.Error) {
+	be.sync.Lock()
+	defer be.sync.Unlock()
+	loc = -1
+	var blocks = be.blocks()
+	if offset < 0 || offset > blocks*be.BlockSize {
+		err = &ErrOutOfRange
+		return
+	}
+
+	// window keep len(data)-1 last bytes of previous blocks to find matches across block boundaries.
+	var window []byte
+	var windowStart = offset
+	var plain = make([]byte, be.BlockSize)
+	var first = offset / be.BlockSize
+	for i := first; i < blocks; i++ {
+		err = be.readBlock(i, plain)
+		if err != nil {
+			return
+		}
+		var start int
+		if i == first {
+			start = offset % be.BlockSize
+		}
+		window = append(window, plain[start:]...)
+		if idx := bytes.Index(window, data); idx >= 0 {
+			loc = windowStart + idx
+			return
+		}
+		if keep := len(data) - 1; len(window) > keep {
+			windowStart += len(window) - keep
+			window = append(window[:0], window[len(window)-keep:]...)
+		}
+	}
+	return
+}
+
+//libgo:impl libgo/protocol.StorageBlock
+func (be *BlockEncrypted) Flush() (err protocol.Error) { return be.device.Flush() }
+
+func (be *BlockEncrypted) addKey(keyID uint32, key []byte) (err protocol.Error) {
+	if keyID == 0 || len(key) != blockEncrypted_KeySize {
+		return &ErrBadKey
+	}
+	var block, goErr = aes.NewCipher(key)
+	if goErr != nil {
+		return &ErrBadKey
+	}
+	var aead cipher.AEAD
+	aead, goErr = cipher.NewGCM(block)
+	if goErr != nil {
+		return &ErrBadKey
+	}
+	be.keys[keyID] = aead
+	return
+}
+
+func (be *BlockEncrypted) slotSize() int { return be.BlockSize + blockEncrypted_Overhead }
+
+// blocks return number of blocks that the device can hold. Caller must hold the lock.
+func (be *BlockEncrypted) blocks() int { return be.device.Cap() / be.slotSize() }
+
+// extend extend the device to hold at least given number of blocks and write erased blocks to all new ones.
+// Caller must hold the lock.
+func (be *BlockEncrypted) extend(blocks int) (err protocol.Error) {
+	var old = be.blocks()
+	if blocks <= old {
+		return
+	}
+	if be.keys[be.keyID] == nil {
+		return &ErrBadKey
+	}
+	_, err = be.device.Extend(blocks * be.slotSize())
+	if err != nil {
+		return
+	}
+	var plain = make([]byte, be.BlockSize)
+	for i, end := old, be.blocks(); i < end; i++ {
+		err = be.writeBlock(i, plain)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Caller must hold the lock.
+func (be *BlockEncrypted) read(offset int, data []byte) (err protocol.Error) {
+	if offset < 0 || offset+len(data) > be.blocks()*be.BlockSize {
+		return &ErrOutOfRange
+	}
+	var plain = make([]byte, be.BlockSize)
+	for pos, end := offset, offset+len(data); pos < end; {
+		var i = pos / be.BlockSize
+		err = be.readBlock(i, plain)
+		if err != nil {
+			return
+		}
+		pos += copy(data[pos-offset:], plain[pos%be.BlockSize:])
+	}
+	return
+}
+
+// write encrypt whole blocks directly and read, change and write partial ones. Caller must hold the lock.
+func (be *BlockEncrypted) write(offset int, data []byte) (err protocol.Error) {
+	err = be.extend((offset + len(data) + be.BlockSize - 1) / be.BlockSize)
+	if err != nil {
+		return
+	}
+	var plain = make([]byte, be.BlockSize)
+	for pos, end := offset, offset+len(data); pos < end; {
+		var i, in = pos / be.BlockSize, pos % be.BlockSize
+		var src = data[pos-offset:]
+		if in == 0 && len(src) >= be.BlockSize {
+			err = be.writeBlock(i, src[:be.BlockSize])
+			pos += be.BlockSize
+		} else {
+			err = be.readBlock(i, plain)
+			if err == nil {
+				pos += copy(plain[in:], src)
+				err = be.writeBlock(i, plain)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// erase write erased blocks for whole blocks and zero data to partial ones. Caller must hold the lock.
+func (be *BlockEncrypted) erase(offset, limit int) (err protocol.Error) {
+	if offset < 0 || limit < 0 || offset+limit > be.blocks()*be.BlockSize {
+		return &ErrOutOfRange
+	}
+	var plain = make([]byte, be.BlockSize)
+	for pos, end := offset, offset+limit; pos < end; {
+		var i, in = pos / be.BlockSize, pos % be.BlockSize
+		if in == 0 && end-pos >= be.BlockSize {
+			zeroBytes(plain)
+			err = be.writeBlock(i, plain)
+			pos += be.BlockSize
+		} else {
+			err = be.readBlock(i, plain)
+			if err == nil {
+				var n = be.BlockSize - in
+				if n > end-pos {
+					n = end - pos
+				}
+				zeroBytes(plain[in : in+n])
+				pos += n
+				err = be.writeBlock(i, plain)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Caller must hold the lock.
+func (be *BlockEncrypted) copy(desOffset, srcOffset int, limit int) (err protocol.Error) {
+	if desOffset < 0 || limit < 0 {
+		return &ErrOutOfRange
+	}
+	var data = make([]byte, limit)
+	err = be.read(srcOffset, data)
+	if err != nil {
+		return
+	}
+	err = be.write(desOffset, data)
+	return
+}
+
+// readBlock decrypt the block i to plain that its len must be BlockSize. Caller must hold the lock.
+func (be *BlockEncrypted) readBlock(i int, plain []byte) (err protocol.Error) {
+	var slot = make([]byte, be.slotSize())
+	err = be.device.Read(i*len(slot), slot)
+	if err != nil {
+		return
+	}
+	var keyID = binary.LittleEndian(slot).Uint32()
+	if keyID == 0 {
+		// Not any block written by BlockEncrypted, even an erased one, has zero key ID.
+		return &ErrCorrupted
+	}
+	var aead = be.keys[keyID]
+	if aead == nil {
+		return &ErrBadKey
+	}
+	var nonce = slot[blockEncrypted_KeyIDSize:blockEncrypted_HeaderSize]
+	var _, goErr = aead.Open(plain[:0], nonce, slot[blockEncrypted_HeaderSize:], blockEncryptedAD(i))
+	if goErr != nil {
+		return &ErrCorrupted
+	}
+	return
+}
+
+// writeBlock encrypt plain by the current key and a new random nonce and write it as the block i. Caller must hold the lock.
+func (be *BlockEncrypted) writeBlock(i int, plain []byte) (err protocol.Error) {
+	var aead = be.keys[be.keyID]
+	if aead == nil {
+		return &ErrBadKey
+	}
+	var slot = make([]byte, blockEncrypted_HeaderSize, be.slotSize())
+	binary.LittleEndian(slot).PutUint32(be.keyID)
+	var nonce = slot[blockEncrypted_KeyIDSize:blockEncrypted_HeaderSize]
+	// crypto/rand never fail on supported OSs.
+	rand.Read(nonce)
+	slot = aead.Seal(slot, nonce, plain, blockEncryptedAD(i))
+	err = be.device.Write(i*len(slot), slot)
+	return
+}
+
+func blockEncryptedAD(i int) (ad []byte) {
+	ad = make([]byte, 8)
+	binary.LittleEndian(ad).PutUint64(uint64(i))
+	return
+}
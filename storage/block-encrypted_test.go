@@ -0,0 +1,130 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"bytes"
+	"testing"
+
+	"libgo/protocol"
+)
+
+var _ protocol.StorageBlock = &BlockEncrypted{}
+
+func TestBlockEncrypted(t *testing.T) {
+	var device BlockMemory
+	var be = BlockEncrypted{BlockSize: 32}
+	var key = bytes.Repeat([]byte{1}, 32)
+	if err := be.Init(&device, 1, key[:16]); err != &ErrBadKey {
+		t.Errorf("Init() with AES-128 key error = %v, want ErrBadKey", err)
+	}
+	be.Init(&device, 1, key)
+
+	var secret = []byte("top secret data that cross block boundaries")
+	if err := be.Write(20, secret); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if c := be.Cap(); c < 20+len(secret) || c%32 != 0 {
+		t.Errorf("Cap() = %v", c)
+	}
+	var got = make([]byte, len(secret))
+	if err := be.Read(20, got); err != nil || !bytes.Equal(got, secret) {
+		t.Fatalf("Read() = %q, %v", got, err)
+	}
+	if bytes.Contains(device.data, []byte("secret")) {
+		t.Errorf("device has plain data")
+	}
+	if loc, _ := be.Search([]byte("cross block"), 0); loc != 20+bytes.Index(secret, []byte("cross block")) {
+		t.Errorf("Search() = %v", loc)
+	}
+	if loc, _ := be.Search([]byte("nothing"), 0); loc != -1 {
+		t.Errorf("Search() of not exist data = %v, want -1", loc)
+	}
+
+	if err := be.Move(0, 20, 10); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	got = make([]byte, 30)
+	be.Read(0, got)
+	if string(got[:10]) != "top secret" || !bytes.Equal(got[10:], make([]byte, 20)) {
+		t.Errorf("Read() after Move() = %q", got)
+	}
+
+	// Swap two device blocks must detect.
+	var tampered BlockMemory
+	tampered.data = cloneBytes(device.data)
+	var slot = be.slotSize()
+	copy(tampered.data[slot:2*slot], device.data[:slot])
+	var te BlockEncrypted
+	te.BlockSize = 32
+	te.Init(&tampered, 1, key)
+	if err := te.Read(32, got[:1]); err != &ErrCorrupted {
+		t.Errorf("Read() of swapped block error = %v, want ErrCorrupted", err)
+	}
+}
+
+func TestBlockEncrypted_Rotate(t *testing.T) {
+	var device BlockMemory
+	var be = BlockEncrypted{BlockSize: 64}
+	var oldKey, newKey = bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	be.Init(&device, 1, oldKey)
+	var data = bytes.Repeat([]byte("0123456789"), 20)
+	be.Write(0, data)
+
+	if err := be.Rotate(2, newKey); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	var reopen = BlockEncrypted{BlockSize: 64}
+	reopen.Init(&device, 2, newKey)
+	var got = make([]byte, len(data))
+	if err := reopen.Read(0, got); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Read() by new key = %q, %v", got, err)
+	}
+
+	reopen.Init(&device, 1, oldKey)
+	if err := reopen.Read(0, got); err != &ErrBadKey {
+		t.Errorf("Read() by old key error = %v, want ErrBadKey", err)
+	}
+}
+
+func TestBlockEncrypted_Erased(t *testing.T) {
+	var device BlockMemory
+	var be = BlockEncrypted{BlockSize: 32}
+	var key = bytes.Repeat([]byte{1}, 32)
+	if err := be.Init(&device, 0, key); err != &ErrBadKey {
+		t.Errorf("Init() with zero key ID error = %v, want ErrBadKey", err)
+	}
+	if err := be.Write(0, []byte("data")); err != &ErrBadKey {
+		t.Errorf("Write() after failed Init() error = %v, want ErrBadKey", err)
+	}
+	be.Init(&device, 1, key)
+
+	if _, err := be.Extend(96); err != nil {
+		t.Fatalf("Extend() error = %v", err)
+	}
+	var slot = be.slotSize()
+	var got = make([]byte, 96)
+	if err := be.Read(0, got); err != nil || !bytes.Equal(got, make([]byte, 96)) {
+		t.Errorf("Read() of extended blocks = %q, %v", got, err)
+	}
+	be.Write(0, bytes.Repeat([]byte("x"), 96))
+	if err := be.Erase(32, 32); err != nil {
+		t.Fatalf("Erase() error = %v", err)
+	}
+	if err := be.Read(32, got[:32]); err != nil || !bytes.Equal(got[:32], make([]byte, 32)) {
+		t.Errorf("Read() of erased block = %q, %v", got[:32], err)
+	}
+	if bytes.Equal(device.data[slot:2*slot], make([]byte, slot)) {
+		t.Errorf("Erase() write zero header to the device")
+	}
+
+	// A zero header or an erased block of other index on the device must not read as zero data.
+	zeroBytes(device.data[2*slot : 3*slot])
+	if err := be.Read(64, got[:1]); err != &ErrCorrupted {
+		t.Errorf("Read() of zero block error = %v, want ErrCorrupted", err)
+	}
+	copy(device.data[2*slot:3*slot], device.data[slot:2*slot])
+	if err := be.Read(64, got[:1]); err != &ErrCorrupted {
+		t.Errorf("Read() of moved erased block error = %v, want ErrCorrupted", err)
+	}
+}
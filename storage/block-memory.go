@@ -0,0 +1,142 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"bytes"
+	"sync"
+
+	"libgo/protocol"
+)
+
+// BlockMemory is a volatile protocol.StorageBlock that keep all data in RAM.
+// It is useful as StorageBlockVolatile and to test any storage engine build on top of protocol.StorageBlock.
+type BlockMemory struct {
+	// BlockSize is the device block size that Extend() rounds to. Zero means blockMemory_DefaultBlockSize.
+	BlockSize int
+
+	sync sync.Mutex
+	data []byte
+}
+
+const blockMemory_DefaultBlockSize = 4096
+
+//libgo:impl libgo/protocol.StorageBlockVolatile
+func (bm *BlockMemory) Cap() (c int) {
+	bm.sync.Lock()
+	c = len(bm.data)
+	bm.sync.Unlock()
+	return
+}
+func (bm *BlockMemory) Extend(cap int) (extended int, err protocol.Error) {
+	bm.sync.Lock()
+	extended = bm.extend(cap)
+	bm.sync.Unlock()
+	return
+}
+func (bm *BlockMemory) Read(offset int, data []byte) (err protocol.Error) {
+	bm.sync.Lock()
+	if offset < 0 || offset+len(data) > len(bm.data) {
+		err = &ErrOutOfRange
+	} else {
+		copy(data, bm.data[offset:])
+	}
+	bm.sync.Unlock()
+	return
+}
+func (bm *BlockMemory) Write(offset int, data []byte) (err protocol.Error) {
+	if offset < 0 {
+		return &ErrOutOfRange
+	}
+	bm.sync.Lock()
+	if offset+len(data) > len(bm.data) {
+		bm.extend(offset + len(data))
+	}
+	copy(bm.data[offset:], data)
+	bm.sync.Unlock()
+	return
+}
+func (bm *BlockMemory) Erase(offset, limit int) (err protocol.Error) {
+	bm.sync.Lock()
+	if offset < 0 || limit < 0 || offset+limit > len(bm.data) {
+		err = &ErrOutOfRange
+	} else {
+		zeroBytes(bm.data[offset : offset+limit])
+	}
+	bm.sync.Unlock()
+	return
+}
+func (bm *BlockMemory) Copy(desOffset, srcOffset int, limit int) (err protocol.Error) {
+	bm.sync.Lock()
+	err = bm.copy(desOffset, srcOffset, limit)
+	bm.sync.Unlock()
+	return
+}
+
+// Move copy data to destination and write zero to any part of source that not overwritten by the destination.
+func (bm *BlockMemory) Move(desOffset, srcOffset int, limit int) (err protocol.Error) {
+	bm.sync.Lock()
+	err = bm.copy(desOffset, srcOffset, limit)
+	if err == nil {
+		var srcEnd = srcOffset + limit
+		var desEnd = desOffset + limit
+		switch {
+		case desEnd <= srcOffset || desOffset >= srcEnd:
+			zeroBytes(bm.data[srcOffset:srcEnd])
+		case desOffset > srcOffset:
+			zeroBytes(bm.data[srcOffset:desOffset])
+		default:
+			zeroBytes(bm.data[desEnd:srcEnd])
+		}
+	}
+	bm.sync.Unlock()
+	return
+}
+
+// Search return location of first match of data from offset, or -1 if not found.
+func (bm *BlockMemory) Search(data []byte, offset int) (loc int, err protocol.Error) {
+	bm.sync.Lock()
+	if offset < 0 || offset > len(bm.data) {
+		err = &ErrOutOfRange
+		loc = -1
+	} else {
+		loc = bytes.Index(bm.data[offset:], data)
+		if loc >= 0 {
+			loc += offset
+		}
+	}
+	bm.sync.Unlock()
+	return
+}
+
+//libgo:impl libgo/protocol.StorageBlock
+func (bm *BlockMemory) Flush() (err protocol.Error) { return }
+
+// Caller must hold the lock.
+func (bm *BlockMemory) extend(cap int) (extended int) {
+	var blockSize = bm.BlockSize
+	if blockSize < 1 {
+		blockSize = blockMemory_DefaultBlockSize
+	}
+	var ln = len(bm.data)
+	if cap <= ln {
+		return ln
+	}
+	extended = (cap + blockSize - 1) / blockSize * blockSize
+	var data = make([]byte, extended)
+	copy(data, bm.data)
+	bm.data = data
+	return
+}
+
+// Caller must hold the lock.
+func (bm *BlockMemory) copy(desOffset, srcOffset int, limit int) (err protocol.Error) {
+	if desOffset < 0 || srcOffset < 0 || limit < 0 || srcOffset+limit > len(bm.data) {
+		return &ErrOutOfRange
+	}
+	if desOffset+limit > len(bm.data) {
+		bm.extend(desOffset + limit)
+	}
+	copy(bm.data[desOffset:desOffset+limit], bm.data[srcOffset:srcOffset+limit])
+	return
+}
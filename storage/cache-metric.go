@@ -0,0 +1,45 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"sync/atomic"
+)
+
+// CacheMetric store the usage metric of a Cache.
+type CacheMetric struct {
+	hitCount      atomic.Int64
+	missCount     atomic.Int64
+	evictionCount atomic.Int64
+	entryCount    atomic.Int64
+	size          atomic.Int64
+}
+
+func (cm *CacheMetric) HitCount() int64      { return cm.hitCount.Load() }
+func (cm *CacheMetric) MissCount() int64     { return cm.missCount.Load() }
+func (cm *CacheMetric) EvictionCount() int64 { return cm.evictionCount.Load() }
+func (cm *CacheMetric) EntryCount() int64    { return cm.entryCount.Load() }
+func (cm *CacheMetric) Size() int64          { return cm.size.Load() }
+
+// HitRatio return the ratio of reads served by the cache in [0, 1].
+func (cm *CacheMetric) HitRatio() float64 {
+	var hit, miss = cm.hitCount.Load(), cm.missCount.Load()
+	if hit+miss == 0 {
+		return 0
+	}
+	return float64(hit) / float64(hit+miss)
+}
+
+func (cm *CacheMetric) hit()  { cm.hitCount.Add(1) }
+func (cm *CacheMetric) miss() { cm.missCount.Add(1) }
+func (cm *CacheMetric) added(size int) {
+	cm.entryCount.Add(1)
+	cm.size.Add(int64(size))
+}
+func (cm *CacheMetric) removed(size int, evicted bool) {
+	cm.entryCount.Add(-1)
+	cm.size.Add(-int64(size))
+	if evicted {
+		cm.evictionCount.Add(1)
+	}
+}
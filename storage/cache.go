@@ -0,0 +1,232 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+
+	"libgo/binary"
+	"libgo/protocol"
+	"libgo/time/monotonic"
+)
+
+// Cache is a volatile size bounded cache with LRU eviction policy to use by storage wrappers like KeyValueCache,
+// ObjectsCache, RecordsCache and FilesCache. Many wrappers can share one Cache to have one memory budget for all of them.
+//   - Entries are grouped (e.g. all cached versions of a record), so a change can drop the whole group at once.
+//   - Data read from a source storage fill the cache just if no change happen in between,
+//     so a slow read never replace a newer data in the cache.
+//   - It is safe to call its methods concurrently.
+type Cache struct {
+	// Budget is the max bytes of cached data including keys and entry overhead. Zero means cache_DefaultBudget.
+	Budget int
+	// MaxAge is the max duration an entry can serve after it cached, to bound staleness of data that change
+	// on the source storage by others. Zero means entries stay until evicted or changed through the wrappers.
+	MaxAge protocol.Duration
+
+	CacheMetric
+
+	sync    sync.Mutex
+	lru     list.List // front is the most recently used entry
+	groups  map[string]map[string]*list.Element
+	size    int
+	version uint64 // increase on any change to reject stale fills
+	spaces  uint32 // number of namespaces given to wrappers
+}
+
+// CacheMode indicate how a cache wrapper treat writes to its source storage.
+type CacheMode uint8
+
+const (
+	// CacheMode_ReadThrough fill the cache just by reads and drop changed data from the cache on writes.
+	CacheMode_ReadThrough CacheMode = iota
+	// CacheMode_WriteThrough write to the source storage and then cache the written data.
+	CacheMode_WriteThrough
+)
+
+type cacheEntry struct {
+	group  string
+	key    string
+	value  []byte
+	extra  uint64 // any fixed size data that a wrapper need to cache with the value
+	expire monotonic.Time
+	size   int
+}
+
+const (
+	cache_DefaultBudget = 64 << 20
+	// cacheEntry_Overhead is the approximate memory use of an entry other than its keys and value.
+	cacheEntry_Overhead = 128
+)
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (c *Cache) Init() (err protocol.Error) {
+	if c.Budget < 1 {
+		c.Budget = cache_DefaultBudget
+	}
+	c.lru.Init()
+	c.groups = make(map[string]map[string]*list.Element)
+	return
+}
+func (c *Cache) Deinit() (err protocol.Error) {
+	c.Purge()
+	return
+}
+
+// Purge remove all entries from the cache.
+func (c *Cache) Purge() {
+	c.sync.Lock()
+	c.version++
+	for e := c.lru.Front(); e != nil; e = c.lru.Front() {
+		c.remove(e, false)
+	}
+	c.sync.Unlock()
+}
+
+// namespace return a unique prefix for groups of a wrapper to not collide with groups of other wrappers.
+func (c *Cache) namespace() (ns string) {
+	c.sync.Lock()
+	c.spaces++
+	var b [4]byte
+	binary.LittleEndian(b[:]).PutUint32(c.spaces)
+	ns = string(b[:])
+	c.sync.Unlock()
+	return
+}
+
+// get return the cached value. Caller must not change the returned value.
+func (c *Cache) get(group, key string) (value []byte, extra uint64, ok bool) {
+	c.sync.Lock()
+	var e = c.groups[group][key]
+	if e != nil {
+		var entry = e.Value.(*cacheEntry)
+		if c.MaxAge != 0 && monotonic.Now().Pass(entry.expire) {
+			c.remove(e, false)
+		} else {
+			c.lru.MoveToFront(e)
+			value, extra, ok = entry.value, entry.extra, true
+		}
+	}
+	c.sync.Unlock()
+
+	if ok {
+		c.hit()
+	} else {
+		c.miss()
+	}
+	return
+}
+
+// ticket must call before read from the source storage and pass to fill().
+func (c *Cache) ticket() (t uint64) {
+	c.sync.Lock()
+	t = c.version
+	c.sync.Unlock()
+	return
+}
+
+// fill add the value read from source storage, if no change happen after the ticket get.
+// The cache own the value, so caller must not change it anymore.
+func (c *Cache) fill(ticket uint64, group, key string, value []byte, extra uint64) {
+	c.sync.Lock()
+	if c.version == ticket {
+		c.add(group, key, value, extra)
+	}
+	c.sync.Unlock()
+}
+
+// put add or replace the value that is written to the source storage.
+// The cache own the value, so caller must not change it anymore.
+func (c *Cache) put(group, key string, value []byte, extra uint64) {
+	c.sync.Lock()
+	c.version++
+	c.add(group, key, value, extra)
+	c.sync.Unlock()
+}
+
+// invalidate remove all entries of the group.
+func (c *Cache) invalidate(group string) {
+	c.sync.Lock()
+	c.version++
+	for _, e := range c.groups[group] {
+		c.remove(e, false)
+	}
+	c.sync.Unlock()
+}
+
+// invalidatePrefix remove all entries of groups that start with the prefix e.g. all files in a directory.
+func (c *Cache) invalidatePrefix(prefix string) {
+	c.sync.Lock()
+	c.version++
+	for group, g := range c.groups {
+		if strings.HasPrefix(group, prefix) {
+			for _, e := range g {
+				c.remove(e, false)
+			}
+		}
+	}
+	c.sync.Unlock()
+}
+
+// extra return the extra data of any live entry of the group, for wrappers that cache the same extra with
+// all entries of a group. It doesn't count as a hit or miss.
+func (c *Cache) extra(group string) (extra uint64, ok bool) {
+	c.sync.Lock()
+	for _, e := range c.groups[group] {
+		var entry = e.Value.(*cacheEntry)
+		if c.MaxAge == 0 || !monotonic.Now().Pass(entry.expire) {
+			extra, ok = entry.extra, true
+			break
+		}
+	}
+	c.sync.Unlock()
+	return
+}
+
+// add insert or replace an entry and evict least recently used entries to respect the budget. Caller must hold the lock.
+func (c *Cache) add(group, key string, value []byte, extra uint64) {
+	if e := c.groups[group][key]; e != nil {
+		c.remove(e, false)
+	}
+
+	var size = len(group) + len(key) + len(value) + cacheEntry_Overhead
+	if size > c.Budget {
+		return
+	}
+	for c.size+size > c.Budget {
+		c.remove(c.lru.Back(), true)
+	}
+
+	var entry = &cacheEntry{
+		group: group,
+		key:   key,
+		value: value,
+		extra: extra,
+		size:  size,
+	}
+	if c.MaxAge != 0 {
+		entry.expire = monotonic.Now()
+		entry.expire.Add(c.MaxAge)
+	}
+	var g = c.groups[group]
+	if g == nil {
+		g = make(map[string]*list.Element)
+		c.groups[group] = g
+	}
+	g[key] = c.lru.PushFront(entry)
+	c.size += size
+	c.added(size)
+}
+
+// remove the entry from the cache. Caller must hold the lock.
+func (c *Cache) remove(e *list.Element, evicted bool) {
+	var entry = c.lru.Remove(e).(*cacheEntry)
+	var g = c.groups[entry.group]
+	delete(g, entry.key)
+	if len(g) == 0 {
+		delete(c.groups, entry.group)
+	}
+	c.size -= entry.size
+	c.removed(entry.size, evicted)
+}
@@ -0,0 +1,202 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"testing"
+
+	"libgo/protocol"
+)
+
+var (
+	_ protocol.StorageKeyValue = &KeyValueCache{}
+	_ protocol.StorageObjects  = &ObjectsCache{}
+	_ protocol.StorageRecords  = &RecordsCache{}
+	_ protocol.StoragesCache   = &StoragesCache{}
+	_ protocol.FileDirectory   = &FilesCache{}
+	_ protocol.File            = &filesCacheFile{}
+)
+
+func TestCache_Eviction(t *testing.T) {
+	var c = Cache{Budget: 3 * (cacheEntry_Overhead + 2)}
+	c.Init()
+	c.put("a", "", []byte("a"), 0)
+	c.put("b", "", []byte("b"), 0)
+	c.put("c", "", []byte("c"), 0)
+	c.get("a", "")
+	c.put("d", "", []byte("d"), 0)
+
+	if _, _, ok := c.get("b", ""); ok {
+		t.Errorf("least recently used entry not evicted")
+	}
+	if _, _, ok := c.get("a", ""); !ok {
+		t.Errorf("recently used entry evicted")
+	}
+	if c.EvictionCount() != 1 || c.EntryCount() != 3 {
+		t.Errorf("EvictionCount() = %d, EntryCount() = %d, want 1 and 3", c.EvictionCount(), c.EntryCount())
+	}
+
+	var ticket = c.ticket()
+	c.invalidate("a")
+	c.fill(ticket, "a", "", []byte("stale"), 0)
+	if _, _, ok := c.get("a", ""); ok {
+		t.Errorf("fill() add data read before a change")
+	}
+}
+
+func TestKeyValueCache(t *testing.T) {
+	var source KeyValueMemory
+	source.Init()
+	var c Cache
+	c.Init()
+	var kc = KeyValueCache{Mode: CacheMode_ReadThrough}
+	kc.Init(&c, &source)
+
+	var options protocol.StorageKeyValue_SaveOptions
+	kc.Set([]byte("k"), []byte("v1"), options)
+	kc.Get([]byte("k"))
+	kc.Get([]byte("k"))
+	if c.HitCount() != 1 || c.MissCount() != 1 {
+		t.Errorf("HitCount() = %d, MissCount() = %d, want 1 and 1", c.HitCount(), c.MissCount())
+	}
+
+	kc.Set([]byte("k"), []byte("v2"), options)
+	if value, _ := kc.Get([]byte("k")); string(value) != "v2" {
+		t.Errorf("Get() = %q after Set(), want v2", value)
+	}
+
+	var batch, _ = kc.Batch()
+	batch.Delete([]byte("k"))
+	batch.Commit()
+	if _, err := kc.Get([]byte("k")); err != &ErrNotExist {
+		t.Errorf("Get() error = %v after batch Delete(), want ErrNotExist", err)
+	}
+}
+
+func TestRecordsCache_SourceEvent(t *testing.T) {
+	var source RecordsMemory
+	source.Init()
+	var c Cache
+	c.Init()
+	var rc RecordsCache
+	rc.Init(&c, &source)
+
+	const mt protocol.MediaTypeID = 1
+	var id = [16]byte{1}
+	var options = protocol.StorageRecord_SaveOptions{MaxVersion: 4}
+	source.Save(mt, id, []byte("v1"), options)
+	rc.Get(mt, id, protocol.StorageRecord_LastLocalVersion)
+
+	// Change directly on the source must drop the cached version by the record event.
+	source.Save(mt, id, []byte("v2"), options)
+	var record, numbers, _ = rc.Get(mt, id, protocol.StorageRecord_LastLocalVersion)
+	if string(record) != "v2" || numbers != 2 {
+		t.Errorf("Get() = %q, %d, want v2, 2", record, numbers)
+	}
+}
+
+func TestRecordsCache_WriteThrough(t *testing.T) {
+	var source RecordsMemory
+	source.Init()
+	var c Cache
+	c.Init()
+	var rc = RecordsCache{Mode: CacheMode_WriteThrough}
+	rc.Init(&c, &source)
+
+	const mt protocol.MediaTypeID = 1
+	var id = [16]byte{1}
+	var options = protocol.StorageRecord_SaveOptions{MaxVersion: 4}
+	rc.Save(mt, id, []byte("v1"), options)
+	// Number of versions of a record that is not in the cache is unknown, so first Get() must read the source.
+	rc.Get(mt, id, protocol.StorageRecord_LastLocalVersion)
+	if c.MissCount() != 1 {
+		t.Errorf("MissCount() = %d, want 1", c.MissCount())
+	}
+
+	rc.Save(mt, id, []byte("v2"), options)
+	var record, numbers, _ = rc.Get(mt, id, protocol.StorageRecord_LastLocalVersion)
+	if string(record) != "v2" || numbers != 2 || c.HitCount() != 1 {
+		t.Errorf("Get() after Save() = %q, %d, HitCount() = %d, want v2, 2, 1", record, numbers, c.HitCount())
+	}
+	var _, sourceNumbers, _ = source.Get(mt, id, protocol.StorageRecord_LastLocalVersion)
+	if numbers != sourceNumbers {
+		t.Errorf("Get() after Save() numbers = %d, source numbers = %d", numbers, sourceNumbers)
+	}
+
+	rc.Update(mt, id, []byte("v2-updated"), protocol.StorageRecord_LastLocalVersion)
+	record, numbers, _ = rc.Get(mt, id, protocol.StorageRecord_LastLocalVersion)
+	if string(record) != "v2-updated" || numbers != 2 || c.HitCount() != 2 {
+		t.Errorf("Get() after Update() = %q, %d, HitCount() = %d, want v2-updated, 2, 2", record, numbers, c.HitCount())
+	}
+
+	// Other versions must read from the source again, because the save may change them.
+	record, _, _ = rc.Get(mt, id, 0)
+	if string(record) != "v1" || c.MissCount() != 2 {
+		t.Errorf("Get() of first version = %q, MissCount() = %d, want v1, 2", record, c.MissCount())
+	}
+
+	var readThrough RecordsCache
+	readThrough.Init(&c, &source)
+	readThrough.Get(mt, id, protocol.StorageRecord_LastLocalVersion)
+	readThrough.Save(mt, id, []byte("v3"), options)
+	record, _, _ = readThrough.Get(mt, id, protocol.StorageRecord_LastLocalVersion)
+	if string(record) != "v3" || c.MissCount() != 4 {
+		t.Errorf("read-through Get() after Save() = %q, MissCount() = %d, want v3, 4", record, c.MissCount())
+	}
+}
+
+func TestFilesCache(t *testing.T) {
+	var source FileDirectoryMemory
+	source.Init()
+	var c Cache
+	c.Init()
+	var fc FilesCache
+	fc.Init(&c, &source)
+
+	var dir, _ = fc.Directory("pages")
+	var file, _ = dir.File("home.html")
+	file.Data().Unmarshal([]byte("<p>home</p>"))
+	file.Data().Marshal()
+	file.Data().Marshal()
+	if c.HitCount() != 1 || c.MissCount() != 1 {
+		t.Errorf("HitCount() = %d, MissCount() = %d, want 1 and 1", c.HitCount(), c.MissCount())
+	}
+
+	file.Data().Append([]byte("<p>more</p>"))
+	if data, _ := file.Data().Marshal(); string(data) != "<p>home</p><p>more</p>" {
+		t.Errorf("Marshal() after Append() = %q", data)
+	}
+
+	// Change a parent directory must drop cached files in it.
+	if err := fc.Rename("pages", "views"); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	var pages, _ = source.Directory("pages")
+	var newFile, _ = pages.File("home.html")
+	newFile.Data().Unmarshal([]byte("<p>new</p>"))
+	var renamed, _ = fc.FileByPath("pages/home.html")
+	if data, _ := renamed.Data().Marshal(); string(data) != "<p>new</p>" {
+		t.Errorf("Marshal() of new file with the old name = %q, want <p>new</p>", data)
+	}
+	var moved, err = fc.FileByPath("views/home.html")
+	if err != nil {
+		t.Fatalf("FileByPath() after Rename() error = %v", err)
+	}
+	if data, _ := moved.Data().Marshal(); string(data) != "<p>home</p><p>more</p>" {
+		t.Errorf("Marshal() after Rename() = %q", data)
+	}
+	var entries = c.EntryCount()
+	fc.Delete("views")
+	if c.EntryCount() != entries-1 {
+		t.Errorf("Delete() of directory don't drop its cached files, EntryCount() = %d", c.EntryCount())
+	}
+
+	var writeThrough = FilesCache{Mode: CacheMode_WriteThrough}
+	writeThrough.Init(&c, &source)
+	var wf, _ = writeThrough.File("app.js")
+	wf.Data().Unmarshal([]byte("run()"))
+	var hits = c.HitCount()
+	if data, _ := wf.Data().Marshal(); string(data) != "run()" || c.HitCount() != hits+1 {
+		t.Errorf("write-through Marshal() after Unmarshal() = %q, hits = %d", data, c.HitCount()-hits)
+	}
+}
@@ -0,0 +1,76 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	er "libgo/error"
+)
+
+// Errors
+var (
+	ErrNotExist     er.Error
+	ErrKeyLocked    er.Error
+	ErrKeyNotLocked er.Error
+
+	ErrBatchClosed er.Error
+	ErrKeyTooLong  er.Error
+	ErrOutOfRange  er.Error
+	ErrCorrupted   er.Error
+	ErrTimeEpoch   er.Error
+
+	ErrRecordLocked    er.Error
+	ErrRecordNotLocked er.Error
+	ErrVersionNotExist er.Error
+	ErrVersionDeleted  er.Error
+	ErrVersionNotLast  er.Error
+	ErrIndexUnique     er.Error
+
+	ErrObjectNotLocked er.Error
+	ErrNoSpace         er.Error
+
+	ErrExist       er.Error
+	ErrInvalidPath er.Error
+	ErrReadOnly    er.Error
+
+	ErrBadKey er.Error
+
+	ErrStream        er.Error
+	ErrFrameTooLarge er.Error
+
+	ErrLeaseOwner    er.Error
+	ErrLeaseCanceled er.Error
+)
+
+func init() {
+	ErrNotExist.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=not-exist")
+	ErrKeyLocked.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=key-locked")
+	ErrKeyNotLocked.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=key-not-locked")
+
+	ErrBatchClosed.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=batch-closed")
+	ErrKeyTooLong.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=key-too-long")
+	ErrOutOfRange.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=out-of-range")
+	ErrCorrupted.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=corrupted")
+	ErrTimeEpoch.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=time-epoch")
+
+	ErrRecordLocked.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=record-locked")
+	ErrRecordNotLocked.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=record-not-locked")
+	ErrVersionNotExist.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=version-not-exist")
+	ErrVersionDeleted.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=version-deleted")
+	ErrVersionNotLast.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=version-not-last")
+	ErrIndexUnique.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=index-unique")
+
+	ErrObjectNotLocked.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=object-not-locked")
+	ErrNoSpace.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=no-space")
+
+	ErrExist.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=exist")
+	ErrInvalidPath.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=invalid-path")
+	ErrReadOnly.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=read-only")
+
+	ErrBadKey.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=bad-key")
+
+	ErrStream.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=stream")
+	ErrFrameTooLarge.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=frame-too-large")
+
+	ErrLeaseOwner.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=lease-owner")
+	ErrLeaseCanceled.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=lease-canceled")
+}
@@ -0,0 +1,36 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/time/monotonic"
+)
+
+// expireHeap is a min-heap of keys ordered by their expire time that implement container/heap.Interface.
+// It can hold stale items (key deleted or TTL changed after push), so caller must check item expire with the owner record.
+type expireHeap []expireItem
+
+type expireItem struct {
+	key    string
+	expire monotonic.Time
+}
+
+func (eh expireHeap) Len() int           { return len(eh) }
+func (eh expireHeap) Less(i, j int) bool { return eh[i].expire < eh[j].expire }
+func (eh expireHeap) Swap(i, j int)      { eh[i], eh[j] = eh[j], eh[i] }
+func (eh *expireHeap) Push(x any)        { *eh = append(*eh, x.(expireItem)) }
+func (eh *expireHeap) Pop() any {
+	var old = *eh
+	var ln = len(old)
+	var item = old[ln-1]
+	*eh = old[:ln-1]
+	return item
+}
+
+// Peek return the item with nearest expire time without remove it.
+func (eh expireHeap) Peek() (item expireItem, ok bool) {
+	if len(eh) == 0 {
+		return
+	}
+	return eh[0], true
+}
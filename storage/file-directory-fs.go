@@ -0,0 +1,337 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"io/fs"
+	"sort"
+	"strings"
+
+	"libgo/mediatype"
+	"libgo/protocol"
+	"libgo/time/unix"
+)
+
+// FileDirectoryFS expose a fs.FS as a read-only protocol.FileDirectory e.g. to use an embed.FS or os.DirFS()
+// where libgo want a FileDirectory. Use FileDirectoryMemory.InitFS() if it needs to change.
+//   - Directory() and File() don't make anything and return ErrNotExist for desire name not exist.
+//   - Methods that change the tree return ErrReadOnly, and FileData methods without error result do nothing.
+//   - Created() and Accessed() are same as Modified() unless fs.FileInfo.Sys() is a protocol.FileMetadata.
+type FileDirectoryFS struct {
+	fsys   fs.FS
+	path   string // fs path, "." for the root directory
+	info   fs.FileInfo
+	parent *FileDirectoryFS
+}
+
+// FileFS is a read-only protocol.File and protocol.FileData of a FileDirectoryFS.
+type FileFS struct {
+	metadata fileMetadata
+	fsys     fs.FS
+	path     string
+	parent   *FileDirectoryFS
+}
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (dir *FileDirectoryFS) Init(fsys fs.FS) (err protocol.Error) {
+	var info, goErr = fs.Stat(fsys, ".")
+	if goErr != nil {
+		return fsError(goErr)
+	}
+	dir.fsys = fsys
+	dir.path = "."
+	dir.info = info
+	return
+}
+func (dir *FileDirectoryFS) Deinit() (err protocol.Error) { return }
+
+// Metadata read the directory entries to return DirNum() and FileNum().
+//
+//libgo:impl libgo/protocol.FileDirectory
+func (dir *FileDirectoryFS) Metadata() protocol.FileDirectoryMetadata {
+	var md fileDirectoryMetadata
+	md.initFileInfo(dir.uriPath(), dir.info)
+	var entries, _ = fs.ReadDir(dir.fsys, dir.path)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			md.dirNum++
+		} else {
+			md.fileNum++
+		}
+	}
+	return &md
+}
+func (dir *FileDirectoryFS) ParentDirectory() protocol.FileDirectory {
+	if dir.parent == nil {
+		return nil
+	}
+	return dir.parent
+}
+
+// Directories return sub directories in order by name.
+func (dir *FileDirectoryFS) Directories(offset, limit uint64) (dirs []protocol.FileDirectory) {
+	var entries = dir.entries(true)
+	var start, end = pageRange(uint64(len(entries)), offset, limit)
+	dirs = make([]protocol.FileDirectory, 0, end-start)
+	for _, entry := range entries[start:end] {
+		var d, err = dir.directory(entry)
+		if err == nil {
+			dirs = append(dirs, d)
+		}
+	}
+	return
+}
+
+// Directory return the sub directory by its name.
+func (dir *FileDirectoryFS) Directory(name string) (d protocol.FileDirectory, err protocol.Error) {
+	if !validFileName(name) {
+		err = &ErrInvalidPath
+		return
+	}
+	var info, goErr = fs.Stat(dir.fsys, dir.join(name))
+	if goErr != nil {
+		err = fsError(goErr)
+		return
+	}
+	if !info.IsDir() {
+		err = &ErrExist
+		return
+	}
+	d = &FileDirectoryFS{fsys: dir.fsys, path: dir.join(name), info: info, parent: dir}
+	return
+}
+
+// Files return files in order by name.
+func (dir *FileDirectoryFS) Files(offset, limit uint64) (files []protocol.File) {
+	var entries = dir.entries(false)
+	var start, end = pageRange(uint64(len(entries)), offset, limit)
+	files = make([]protocol.File, 0, end-start)
+	for _, entry := range entries[start:end] {
+		var f, err = dir.file(entry)
+		if err == nil {
+			files = append(files, f)
+		}
+	}
+	return
+}
+
+// File return the file by its full name with extension.
+func (dir *FileDirectoryFS) File(name string) (file protocol.File, err protocol.Error) {
+	if !validFileName(name) {
+		err = &ErrInvalidPath
+		return
+	}
+	return dir.FileByPath(name)
+}
+
+// FileByPath return the file by its path relative to the directory.
+func (dir *FileDirectoryFS) FileByPath(uriPath string) (file protocol.File, err protocol.Error) {
+	var parts = splitURIPath(uriPath)
+	if len(parts) == 0 {
+		err = &ErrInvalidPath
+		return
+	}
+	var parent = dir
+	for _, part := range parts[:len(parts)-1] {
+		var d protocol.FileDirectory
+		d, err = parent.Directory(part)
+		if err != nil {
+			return
+		}
+		parent = d.(*FileDirectoryFS)
+	}
+	var name = parts[len(parts)-1]
+	if !validFileName(name) {
+		err = &ErrInvalidPath
+		return
+	}
+	var info, goErr = fs.Stat(dir.fsys, parent.join(name))
+	if goErr != nil {
+		err = fsError(goErr)
+		return
+	}
+	if info.IsDir() {
+		err = &ErrExist
+		return
+	}
+	file = parent.newFile(name, info)
+	return
+}
+
+// FindFiles return files that their names contain partName in order by name.
+func (dir *FileDirectoryFS) FindFiles(partName string, num uint) (files []protocol.File) {
+	for _, entry := range dir.entries(false) {
+		if uint(len(files)) == num {
+			break
+		}
+		if strings.Contains(entry.Name(), partName) {
+			var f, err = dir.file(entry)
+			if err == nil {
+				files = append(files, f)
+			}
+		}
+	}
+	return
+}
+
+// FindFile return the first file in order by name that its name contain partName.
+func (dir *FileDirectoryFS) FindFile(partName string) (file protocol.File) {
+	var files = dir.FindFiles(partName, 1)
+	if len(files) > 0 {
+		file = files[0]
+	}
+	return
+}
+
+func (dir *FileDirectoryFS) Rename(oldURIPath, newURIPath string) (err protocol.Error) {
+	return &ErrReadOnly
+}
+func (dir *FileDirectoryFS) Copy(uriPath, newURIPath string) (err protocol.Error) {
+	return &ErrReadOnly
+}
+func (dir *FileDirectoryFS) Move(uriPath, newURIPath string) (err protocol.Error) {
+	return &ErrReadOnly
+}
+func (dir *FileDirectoryFS) Delete(uriPath string) (err protocol.Error) { return &ErrReadOnly }
+func (dir *FileDirectoryFS) PermanentlyDelete(uriPath string) (err protocol.Error) {
+	return &ErrReadOnly
+}
+func (dir *FileDirectoryFS) Erase(uriPath string) (err protocol.Error) { return &ErrReadOnly }
+
+// entries return sub directories or files of dir in order by name.
+func (dir *FileDirectoryFS) entries(isDir bool) (entries []fs.DirEntry) {
+	var all, _ = fs.ReadDir(dir.fsys, dir.path)
+	for _, entry := range all {
+		if entry.IsDir() == isDir {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return
+}
+
+// lookupDirectory return the sub directory by its name or nil if it doesn't exist.
+func (dir *FileDirectoryFS) lookupDirectory(name string) protocol.FileDirectory {
+	var d, err = dir.Directory(name)
+	if err != nil {
+		return nil
+	}
+	return d
+}
+
+func (dir *FileDirectoryFS) directory(entry fs.DirEntry) (d *FileDirectoryFS, err protocol.Error) {
+	var info, goErr = entry.Info()
+	if goErr != nil {
+		return nil, fsError(goErr)
+	}
+	d = &FileDirectoryFS{fsys: dir.fsys, path: dir.join(entry.Name()), info: info, parent: dir}
+	return
+}
+
+func (dir *FileDirectoryFS) file(entry fs.DirEntry) (f *FileFS, err protocol.Error) {
+	var info, goErr = entry.Info()
+	if goErr != nil {
+		return nil, fsError(goErr)
+	}
+	f = dir.newFile(entry.Name(), info)
+	return
+}
+
+func (dir *FileDirectoryFS) newFile(name string, info fs.FileInfo) (f *FileFS) {
+	f = &FileFS{fsys: dir.fsys, path: dir.join(name), parent: dir}
+	f.metadata.initFileInfo(dir.uriPath()+name, info)
+	return
+}
+
+// join return the fs path of the name in dir.
+func (dir *FileDirectoryFS) join(name string) string {
+	if dir.path == "." {
+		return name
+	}
+	return dir.path + "/" + name
+}
+
+func (dir *FileDirectoryFS) uriPath() string {
+	if dir.path == "." {
+		return "/"
+	}
+	return "/" + dir.path + "/"
+}
+
+//libgo:impl libgo/protocol.File
+func (f *FileFS) Metadata() protocol.FileMetadata         { return &f.metadata }
+func (f *FileFS) Data() protocol.FileData                 { return f }
+func (f *FileFS) ParentDirectory() protocol.FileDirectory { return f.parent }
+func (f *FileFS) Rename(newName string)                   {}
+
+//libgo:impl libgo/protocol.FileData
+func (f *FileFS) Save() (err protocol.Error)     { return }
+func (f *FileFS) Prepend(data []byte)            {}
+func (f *FileFS) Append(data []byte)             {}
+func (f *FileFS) Replace(old, new []byte, n int) {}
+
+//libgo:impl libgo/protocol.Codec
+func (f *FileFS) MediaType() protocol.MediaType {
+	return mediatype.ByFileExtension(f.metadata.uri.Extension())
+}
+func (f *FileFS) CompressType() protocol.CompressType { return nil }
+
+//libgo:impl libgo/protocol.Decoder
+func (f *FileFS) Decode(source protocol.Codec) (n int, err protocol.Error) { return 0, &ErrReadOnly }
+
+//libgo:impl libgo/protocol.Encoder
+func (f *FileFS) Encode(destination protocol.Codec) (n int, err protocol.Error) {
+	n, err = destination.Decode(f)
+	return
+}
+func (f *FileFS) Len() (ln int) { return int(f.metadata.size) }
+
+//libgo:impl libgo/protocol.Unmarshaler
+func (f *FileFS) Unmarshal(data []byte) (n int, err protocol.Error) { return 0, &ErrReadOnly }
+func (f *FileFS) UnmarshalFrom(data []byte) (remaining []byte, err protocol.Error) {
+	return data, &ErrReadOnly
+}
+
+// Marshal read the file data from the fs.FS on each call.
+//
+//libgo:impl libgo/protocol.Marshaler
+func (f *FileFS) Marshal() (data []byte, err protocol.Error) {
+	var goErr error
+	data, goErr = fs.ReadFile(f.fsys, f.path)
+	if goErr != nil {
+		err = fsError(goErr)
+	}
+	return
+}
+func (f *FileFS) MarshalTo(data []byte) (added []byte, err protocol.Error) {
+	var fd []byte
+	fd, err = f.Marshal()
+	added = append(data, fd...)
+	return
+}
+
+// initFileInfo fill md by the fs.FileInfo.
+func (md *fileMetadata) initFileInfo(path string, info fs.FileInfo) {
+	md.setPath(path)
+	if !info.IsDir() {
+		md.size = uint64(info.Size())
+	}
+	if sys, ok := info.Sys().(protocol.FileMetadata); ok {
+		md.created = unixTime(sys.Created())
+		md.accessed = unixTime(sys.Accessed())
+		md.modified = unixTime(sys.Modified())
+		return
+	}
+	var modTime = info.ModTime()
+	if !modTime.IsZero() {
+		md.modified.ChangeTo(unix.SecElapsed(modTime.Unix()), int32(modTime.Nanosecond()))
+	}
+	md.created, md.accessed = md.modified, md.modified
+}
+
+func unixTime(t protocol.Time) (ut unix.Time) {
+	if t != nil {
+		ut.ChangeTo(unix.SecElapsed(t.SecondElapsed()), t.NanoSecondElapsed())
+	}
+	return
+}
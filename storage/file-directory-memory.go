@@ -0,0 +1,657 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"libgo/protocol"
+	"libgo/time/unix"
+)
+
+// FileDirectoryMemory is a volatile protocol.FileDirectory that keep all its files in RAM.
+// It is useful to test any FileDirectory consumer without a disk and to serve assets embedded in the app binary.
+//   - InitFS() load a fs.FS e.g. an embed.FS, so single-binary apps can ship their GUI assets inside the executable.
+//   - Delete() move files and directories to RecycleBin(), Restore() move them back to their old place.
+//   - Erase() write zero to the file data before drop it.
+//   - All directories of a tree share one lock, so it is safe to call methods of any of them concurrently.
+type FileDirectoryMemory struct {
+	metadata    fileDirectoryMetadata
+	tree        *fileTree
+	parent      *FileDirectoryMemory // nil for the root directory and the recycle bin
+	directories map[string]*FileDirectoryMemory
+	files       map[string]*FileMemory
+}
+
+// fileTree is the shared state of all directories of a tree.
+type fileTree struct {
+	sync    sync.Mutex
+	root    *FileDirectoryMemory
+	bin     FileDirectoryMemory
+	deleted map[string]string // name in the recycle bin to its uri path before delete
+}
+
+// fileDirectoryMetadata implement protocol.FileDirectoryMetadata.
+type fileDirectoryMetadata struct {
+	fileMetadata
+	dirNum  uint
+	fileNum uint
+}
+
+//libgo:impl libgo/protocol.FileDirectoryMetadata
+func (md *fileDirectoryMetadata) DirNum() uint  { return md.dirNum }
+func (md *fileDirectoryMetadata) FileNum() uint { return md.fileNum }
+
+// Init make an empty tree that dir is its root directory.
+//
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (dir *FileDirectoryMemory) Init() (err protocol.Error) {
+	var tree = &fileTree{
+		root:    dir,
+		deleted: make(map[string]string),
+	}
+	var now = unix.Now()
+	dir.init(tree, nil, "/", now)
+	tree.bin.init(tree, nil, "/", now)
+	return
+}
+
+// InitFS make the tree and copy all directories and files of fsys to it.
+// Modification time of the fsys entries use for all timestamps if it exists, e.g. embed.FS has none.
+func (dir *FileDirectoryMemory) InitFS(fsys fs.FS) (err protocol.Error) {
+	err = dir.Init()
+	if err != nil {
+		return
+	}
+	err = dir.load(fsys, ".")
+	return
+}
+
+func (dir *FileDirectoryMemory) Deinit() (err protocol.Error) {
+	dir.tree.sync.Lock()
+	dir.directories = make(map[string]*FileDirectoryMemory)
+	dir.files = make(map[string]*FileMemory)
+	dir.changed(unix.Now())
+	dir.tree.sync.Unlock()
+	return
+}
+
+//libgo:impl libgo/protocol.FileDirectory
+func (dir *FileDirectoryMemory) Metadata() protocol.FileDirectoryMetadata { return &dir.metadata }
+func (dir *FileDirectoryMemory) ParentDirectory() protocol.FileDirectory {
+	dir.tree.sync.Lock()
+	var parent = dir.parent
+	dir.tree.sync.Unlock()
+	if parent == nil {
+		return nil
+	}
+	return parent
+}
+
+// Directories return sub directories in order by name.
+func (dir *FileDirectoryMemory) Directories(offset, limit uint64) (dirs []protocol.FileDirectory) {
+	dir.tree.sync.Lock()
+	var names = make([]string, 0, len(dir.directories))
+	for name := range dir.directories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var start, end = pageRange(uint64(len(names)), offset, limit)
+	dirs = make([]protocol.FileDirectory, 0, end-start)
+	for _, name := range names[start:end] {
+		dirs = append(dirs, dir.directories[name])
+	}
+	dir.tree.sync.Unlock()
+	return
+}
+
+// Directory return the directory by its name or make new one if desire name not exist.
+func (dir *FileDirectoryMemory) Directory(name string) (dr protocol.FileDirectory, err protocol.Error) {
+	if !validFileName(name) {
+		err = &ErrInvalidPath
+		return
+	}
+	dir.tree.sync.Lock()
+	defer dir.tree.sync.Unlock()
+	var d, exist = dir.directories[name]
+	if !exist {
+		if _, exist = dir.files[name]; exist {
+			err = &ErrExist
+			return
+		}
+		d = dir.makeDirectory(name, unix.Now())
+	}
+	dr = d
+	return
+}
+
+// Files return files in order by name.
+func (dir *FileDirectoryMemory) Files(offset, limit uint64) (files []protocol.File) {
+	dir.tree.sync.Lock()
+	var names = dir.fileNames()
+	var start, end = pageRange(uint64(len(names)), offset, limit)
+	files = make([]protocol.File, 0, end-start)
+	for _, name := range names[start:end] {
+		files = append(files, dir.files[name])
+	}
+	dir.tree.sync.Unlock()
+	return
+}
+
+// File return the file by its full name with extension or make new empty one if desire name not exist.
+func (dir *FileDirectoryMemory) File(name string) (file protocol.File, err protocol.Error) {
+	if !validFileName(name) {
+		err = &ErrInvalidPath
+		return
+	}
+	dir.tree.sync.Lock()
+	defer dir.tree.sync.Unlock()
+	var f, exist = dir.files[name]
+	if !exist {
+		if _, exist = dir.directories[name]; exist {
+			err = &ErrExist
+			return
+		}
+		f = dir.makeFile(name, unix.Now())
+	}
+	file = f
+	return
+}
+
+// FileByPath return the file by its path relative to the directory.
+func (dir *FileDirectoryMemory) FileByPath(uriPath string) (file protocol.File, err protocol.Error) {
+	dir.tree.sync.Lock()
+	defer dir.tree.sync.Unlock()
+	var parent, name, e = dir.resolve(uriPath)
+	if e != nil {
+		err = e
+		return
+	}
+	var f, exist = parent.files[name]
+	if !exist {
+		err = &ErrNotExist
+		return
+	}
+	file = f
+	return
+}
+
+// FindFiles return files that their names contain partName in order by name.
+func (dir *FileDirectoryMemory) FindFiles(partName string, num uint) (files []protocol.File) {
+	dir.tree.sync.Lock()
+	for _, name := range dir.fileNames() {
+		if uint(len(files)) == num {
+			break
+		}
+		if strings.Contains(name, partName) {
+			files = append(files, dir.files[name])
+		}
+	}
+	dir.tree.sync.Unlock()
+	return
+}
+
+// FindFile return the first file in order by name that its name contain partName.
+func (dir *FileDirectoryMemory) FindFile(partName string) (file protocol.File) {
+	var files = dir.FindFiles(partName, 1)
+	if len(files) > 0 {
+		file = files[0]
+	}
+	return
+}
+
+// Rename change the name of a file or directory. newURIPath must be in the same directory as oldURIPath.
+func (dir *FileDirectoryMemory) Rename(oldURIPath, newURIPath string) (err protocol.Error) {
+	dir.tree.sync.Lock()
+	defer dir.tree.sync.Unlock()
+	var parent, name, e = dir.resolve(oldURIPath)
+	if e != nil {
+		return e
+	}
+	var newParent *FileDirectoryMemory
+	var newName string
+	newParent, newName, err = dir.resolve(newURIPath)
+	if err != nil {
+		return
+	}
+	if parent != newParent {
+		return &ErrInvalidPath
+	}
+	if !parent.exist(name) {
+		return &ErrNotExist
+	}
+	if name == newName {
+		return
+	}
+	if parent.exist(newName) {
+		return &ErrExist
+	}
+	parent.move(name, parent, newName)
+	return
+}
+
+// Copy copy a file or a directory recursively. If newURIPath end with "/" it is the destination directory,
+// otherwise it is the new path include the name.
+func (dir *FileDirectoryMemory) Copy(uriPath, newURIPath string) (err protocol.Error) {
+	dir.tree.sync.Lock()
+	defer dir.tree.sync.Unlock()
+	var src, name, e = dir.resolve(uriPath)
+	if e != nil {
+		return e
+	}
+	var des *FileDirectoryMemory
+	var desName string
+	des, desName, err = dir.destination(newURIPath, name)
+	if err != nil {
+		return
+	}
+	if !src.exist(name) {
+		return &ErrNotExist
+	}
+	if des.exist(desName) {
+		return &ErrExist
+	}
+
+	var now = unix.Now()
+	if d, ok := src.directories[name]; ok {
+		if des.inside(d) {
+			return &ErrInvalidPath
+		}
+		des.directories[desName] = d.clone(des, des.childPath(desName, true), now)
+	} else {
+		des.files[desName] = src.files[name].clone(des, des.childPath(desName, false), now)
+	}
+	des.changed(now)
+	return
+}
+
+// Move move a file or a directory to other place. If newURIPath end with "/" it is the destination directory,
+// otherwise it is the new path include the name.
+func (dir *FileDirectoryMemory) Move(uriPath, newURIPath string) (err protocol.Error) {
+	dir.tree.sync.Lock()
+	defer dir.tree.sync.Unlock()
+	var src, name, e = dir.resolve(uriPath)
+	if e != nil {
+		return e
+	}
+	var des *FileDirectoryMemory
+	var desName string
+	des, desName, err = dir.destination(newURIPath, name)
+	if err != nil {
+		return
+	}
+	if !src.exist(name) {
+		return &ErrNotExist
+	}
+	if src == des && name == desName {
+		return
+	}
+	if des.exist(desName) {
+		return &ErrExist
+	}
+	if d, ok := src.directories[name]; ok && des.inside(d) {
+		return &ErrInvalidPath
+	}
+	src.move(name, des, desName)
+	return
+}
+
+// Delete make the file or directory invisible by move it to the recycle bin.
+// Same names get a number suffix in the bin e.g. "index.html.2". Delete in the recycle bin is permanent.
+func (dir *FileDirectoryMemory) Delete(uriPath string) (err protocol.Error) {
+	dir.tree.sync.Lock()
+	defer dir.tree.sync.Unlock()
+	var parent, name, e = dir.resolve(uriPath)
+	if e != nil {
+		return e
+	}
+	if !parent.exist(name) {
+		return &ErrNotExist
+	}
+
+	var bin = &dir.tree.bin
+	if parent.root() == bin {
+		parent.remove(name)
+		return
+	}
+	var binName = name
+	for i := 2; bin.exist(binName); i++ {
+		binName = name + "." + strconv.Itoa(i)
+	}
+	var isDir = parent.directories[name] != nil
+	var path = parent.childPath(name, isDir)
+	parent.move(name, bin, binName)
+	dir.tree.deleted[binName] = path
+	return
+}
+
+// PermanentlyDelete make the file or directory invisible by remove it from the tree.
+// Its data remain in RAM until no one has any reference to it.
+func (dir *FileDirectoryMemory) PermanentlyDelete(uriPath string) (err protocol.Error) {
+	dir.tree.sync.Lock()
+	defer dir.tree.sync.Unlock()
+	var parent, name, e = dir.resolve(uriPath)
+	if e != nil {
+		return e
+	}
+	if !parent.exist(name) {
+		return &ErrNotExist
+	}
+	parent.remove(name)
+	return
+}
+
+// Erase write zero data to all files of the uri path and then remove them from the tree.
+func (dir *FileDirectoryMemory) Erase(uriPath string) (err protocol.Error) {
+	dir.tree.sync.Lock()
+	defer dir.tree.sync.Unlock()
+	var parent, name, e = dir.resolve(uriPath)
+	if e != nil {
+		return e
+	}
+	if d, ok := parent.directories[name]; ok {
+		d.erase()
+	} else if f, ok := parent.files[name]; ok {
+		f.erase()
+	} else {
+		return &ErrNotExist
+	}
+	parent.remove(name)
+	return
+}
+
+// RecycleBin return the directory that deleted files and directories of the tree move to.
+// Its entries can restore by Restore() with their names in it.
+func (dir *FileDirectoryMemory) RecycleBin() protocol.FileDirectory { return &dir.tree.bin }
+
+// Restore move back a deleted file or directory from the recycle bin to its path before delete.
+// Parent directory of the old path must exist and the name must not use by other one.
+func (dir *FileDirectoryMemory) Restore(binName string) (err protocol.Error) {
+	dir.tree.sync.Lock()
+	defer dir.tree.sync.Unlock()
+	var path, ok = dir.tree.deleted[binName]
+	if !ok {
+		return &ErrNotExist
+	}
+	var parent, name, e = dir.tree.root.resolve(path)
+	if e != nil {
+		return e
+	}
+	if parent.exist(name) {
+		return &ErrExist
+	}
+	dir.tree.bin.move(binName, parent, name)
+	return
+}
+
+func (dir *FileDirectoryMemory) init(tree *fileTree, parent *FileDirectoryMemory, path string, now unix.Time) {
+	dir.metadata.init(path, now)
+	dir.metadata.dirNum, dir.metadata.fileNum = 0, 0
+	dir.tree = tree
+	dir.parent = parent
+	dir.directories = make(map[string]*FileDirectoryMemory)
+	dir.files = make(map[string]*FileMemory)
+}
+
+// load copy the fsPath directory of fsys to dir recursively.
+func (dir *FileDirectoryMemory) load(fsys fs.FS, fsPath string) (err protocol.Error) {
+	var entries, goErr = fs.ReadDir(fsys, fsPath)
+	if goErr != nil {
+		return fsError(goErr)
+	}
+	for _, entry := range entries {
+		var entryPath = entry.Name()
+		if fsPath != "." {
+			entryPath = fsPath + "/" + entryPath
+		}
+		var info fs.FileInfo
+		info, goErr = entry.Info()
+		if goErr != nil {
+			return fsError(goErr)
+		}
+		var now = unix.Now()
+		if modTime := info.ModTime(); !modTime.IsZero() {
+			now.ChangeTo(unix.SecElapsed(modTime.Unix()), int32(modTime.Nanosecond()))
+		}
+
+		if entry.IsDir() {
+			err = dir.makeDirectory(entry.Name(), now).load(fsys, entryPath)
+			if err != nil {
+				return
+			}
+			continue
+		}
+		var data []byte
+		data, goErr = fs.ReadFile(fsys, entryPath)
+		if goErr != nil {
+			return fsError(goErr)
+		}
+		var f = dir.makeFile(entry.Name(), now)
+		f.data = data
+		f.metadata.size = uint64(len(data))
+	}
+	return
+}
+
+// makeDirectory add new empty directory. Caller must hold the tree lock and check the name not exist.
+func (dir *FileDirectoryMemory) makeDirectory(name string, now unix.Time) (d *FileDirectoryMemory) {
+	d = &FileDirectoryMemory{}
+	d.init(dir.tree, dir, dir.childPath(name, true), now)
+	dir.directories[name] = d
+	dir.changed(now)
+	return
+}
+
+// makeFile add new empty file. Caller must hold the tree lock and check the name not exist.
+func (dir *FileDirectoryMemory) makeFile(name string, now unix.Time) (f *FileMemory) {
+	f = &FileMemory{}
+	f.init(dir.tree, dir, dir.childPath(name, false), now)
+	dir.files[name] = f
+	dir.changed(now)
+	return
+}
+
+// move detach the name from dir and attach it to des with desName.
+// Caller must hold the tree lock and check name exist in dir and desName not exist in des.
+func (dir *FileDirectoryMemory) move(name string, des *FileDirectoryMemory, desName string) {
+	if d, ok := dir.directories[name]; ok {
+		delete(dir.directories, name)
+		des.directories[desName] = d
+		d.relocate(des, des.childPath(desName, true))
+	} else {
+		var f = dir.files[name]
+		delete(dir.files, name)
+		des.files[desName] = f
+		f.parent = des
+		f.metadata.setPath(des.childPath(desName, false))
+	}
+	dir.forget(name)
+
+	var now = unix.Now()
+	dir.changed(now)
+	des.changed(now)
+}
+
+// remove drop the name from dir. Caller must hold the tree lock.
+func (dir *FileDirectoryMemory) remove(name string) {
+	delete(dir.directories, name)
+	delete(dir.files, name)
+	dir.forget(name)
+	dir.changed(unix.Now())
+}
+
+// forget drop the restore record of the name if dir is the recycle bin.
+func (dir *FileDirectoryMemory) forget(name string) {
+	if dir == &dir.tree.bin {
+		delete(dir.tree.deleted, name)
+	}
+}
+
+// relocate set new parent and path of dir and update paths of all its sub directories and files.
+func (dir *FileDirectoryMemory) relocate(parent *FileDirectoryMemory, path string) {
+	dir.parent = parent
+	dir.metadata.setPath(path)
+	for name, d := range dir.directories {
+		d.relocate(dir, path+name+"/")
+	}
+	for name, f := range dir.files {
+		f.metadata.setPath(path + name)
+	}
+}
+
+// clone return a deep copy of dir with new timestamps.
+func (dir *FileDirectoryMemory) clone(parent *FileDirectoryMemory, path string, now unix.Time) (c *FileDirectoryMemory) {
+	c = &FileDirectoryMemory{}
+	c.init(dir.tree, parent, path, now)
+	for name, d := range dir.directories {
+		c.directories[name] = d.clone(c, path+name+"/", now)
+	}
+	for name, f := range dir.files {
+		c.files[name] = f.clone(c, path+name, now)
+	}
+	c.changed(now)
+	return
+}
+
+// erase write zero data to all files of dir recursively.
+func (dir *FileDirectoryMemory) erase() {
+	for _, d := range dir.directories {
+		d.erase()
+	}
+	for _, f := range dir.files {
+		f.erase()
+	}
+}
+
+// changed update the metadata after add or remove any entry.
+func (dir *FileDirectoryMemory) changed(now unix.Time) {
+	dir.metadata.dirNum = uint(len(dir.directories))
+	dir.metadata.fileNum = uint(len(dir.files))
+	dir.metadata.modified = now
+	dir.metadata.accessed = now
+}
+
+// lookupDirectory return the sub directory by its name or nil if it doesn't exist.
+func (dir *FileDirectoryMemory) lookupDirectory(name string) protocol.FileDirectory {
+	dir.tree.sync.Lock()
+	defer dir.tree.sync.Unlock()
+	if d, exist := dir.directories[name]; exist {
+		return d
+	}
+	return nil
+}
+
+func (dir *FileDirectoryMemory) exist(name string) (exist bool) {
+	_, exist = dir.directories[name]
+	if !exist {
+		_, exist = dir.files[name]
+	}
+	return
+}
+
+func (dir *FileDirectoryMemory) fileNames() (names []string) {
+	names = make([]string, 0, len(dir.files))
+	for name := range dir.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+func (dir *FileDirectoryMemory) childPath(name string, isDir bool) (path string) {
+	path = dir.metadata.uri.Path() + name
+	if isDir {
+		path += "/"
+	}
+	return
+}
+
+func (dir *FileDirectoryMemory) root() (root *FileDirectoryMemory) {
+	root = dir
+	for root.parent != nil {
+		root = root.parent
+	}
+	return
+}
+
+// inside report whether dir is d or one of its sub directories.
+func (dir *FileDirectoryMemory) inside(d *FileDirectoryMemory) bool {
+	for p := dir; p != nil; p = p.parent {
+		if p == d {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve return the parent directory and the name of the last part of the uri path that is relative to dir.
+// Caller must hold the tree lock.
+func (dir *FileDirectoryMemory) resolve(uriPath string) (parent *FileDirectoryMemory, name string, err protocol.Error) {
+	var parts = splitURIPath(uriPath)
+	if len(parts) == 0 {
+		err = &ErrInvalidPath
+		return
+	}
+	name = parts[len(parts)-1]
+	if !validFileName(name) {
+		err = &ErrInvalidPath
+		return
+	}
+	parent, err = dir.walk(parts[:len(parts)-1])
+	return
+}
+
+// destination resolve the target of Copy() and Move(). A uri path end with "/" is the destination directory
+// and the name remain the same.
+func (dir *FileDirectoryMemory) destination(uriPath, name string) (des *FileDirectoryMemory, desName string, err protocol.Error) {
+	if strings.HasSuffix(uriPath, "/") {
+		des, err = dir.walk(splitURIPath(uriPath))
+		desName = name
+		return
+	}
+	des, desName, err = dir.resolve(uriPath)
+	return
+}
+
+// walk return the existing sub directory by its path parts.
+func (dir *FileDirectoryMemory) walk(parts []string) (des *FileDirectoryMemory, err protocol.Error) {
+	des = dir
+	for _, part := range parts {
+		if !validFileName(part) {
+			err = &ErrInvalidPath
+			return
+		}
+		var ok bool
+		des, ok = des.directories[part]
+		if !ok {
+			err = &ErrNotExist
+			return
+		}
+	}
+	return
+}
+
+func splitURIPath(uriPath string) (parts []string) {
+	uriPath = strings.Trim(uriPath, "/")
+	if uriPath == "" {
+		return
+	}
+	return strings.Split(uriPath, "/")
+}
+
+func validFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsRune(name, '/')
+}
+
+// fsError convert fs.FS errors to storage errors. fs.FS is read-only, so any other failure means its data is not valid.
+func fsError(goErr error) protocol.Error {
+	if errors.Is(goErr, fs.ErrNotExist) {
+		return &ErrNotExist
+	}
+	return &ErrCorrupted
+}
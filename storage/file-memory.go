@@ -0,0 +1,180 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"bytes"
+	"strings"
+
+	"libgo/file"
+	"libgo/mediatype"
+	"libgo/protocol"
+	"libgo/time/unix"
+)
+
+// FileMemory is a volatile protocol.File and protocol.FileData that keep its data in RAM.
+// It always belongs to a FileDirectoryMemory and use the lock of its directory tree.
+type FileMemory struct {
+	metadata fileMetadata
+	tree     *fileTree
+	parent   *FileDirectoryMemory
+	data     []byte
+}
+
+// fileMetadata implement protocol.FileMetadata for in-memory files and directories.
+type fileMetadata struct {
+	uri      file.URI
+	size     uint64
+	created  unix.Time
+	accessed unix.Time
+	modified unix.Time
+}
+
+func (md *fileMetadata) init(path string, now unix.Time) {
+	md.setPath(path)
+	md.created, md.accessed, md.modified = now, now, now
+}
+
+// setPath set the uri path that is from the root directory of the tree, and end with "/" for directories.
+// In-memory files have no domain.
+func (md *fileMetadata) setPath(path string) {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	md.uri.Set("file", "", path, "", "")
+}
+
+//libgo:impl libgo/protocol.FileMetadata
+func (md *fileMetadata) URI() protocol.FileURI   { return &md.uri }
+func (md *fileMetadata) Size() uint64            { return md.size }
+func (md *fileMetadata) Created() protocol.Time  { return &md.created }
+func (md *fileMetadata) Accessed() protocol.Time { return &md.accessed }
+func (md *fileMetadata) Modified() protocol.Time { return &md.modified }
+
+//libgo:impl libgo/protocol.File
+func (f *FileMemory) Metadata() protocol.FileMetadata { return &f.metadata }
+func (f *FileMemory) Data() protocol.FileData         { return f }
+func (f *FileMemory) ParentDirectory() protocol.FileDirectory {
+	f.tree.sync.Lock()
+	var parent = f.parent
+	f.tree.sync.Unlock()
+	return parent
+}
+
+// Rename change the file name in its directory. It does nothing if a file or directory with the new name exist.
+func (f *FileMemory) Rename(newName string) {
+	f.tree.sync.Lock()
+	var parent, name = f.parent, f.metadata.uri.Name()
+	f.tree.sync.Unlock()
+	parent.Rename(name, newName)
+}
+
+//libgo:impl libgo/protocol.FileData
+func (f *FileMemory) Save() (err protocol.Error) { return }
+func (f *FileMemory) Prepend(data []byte) {
+	f.tree.sync.Lock()
+	var nd = make([]byte, len(data)+len(f.data))
+	copy(nd, data)
+	copy(nd[len(data):], f.data)
+	f.setData(nd)
+	f.tree.sync.Unlock()
+}
+func (f *FileMemory) Append(data []byte) {
+	f.tree.sync.Lock()
+	f.setData(append(f.data, data...))
+	f.tree.sync.Unlock()
+}
+func (f *FileMemory) Replace(old, new []byte, n int) {
+	f.tree.sync.Lock()
+	f.setData(bytes.Replace(f.data, old, new, n))
+	f.tree.sync.Unlock()
+}
+
+//libgo:impl libgo/protocol.Codec
+func (f *FileMemory) MediaType() protocol.MediaType {
+	return mediatype.ByFileExtension(f.metadata.uri.Extension())
+}
+func (f *FileMemory) CompressType() protocol.CompressType { return nil }
+
+//libgo:impl libgo/protocol.Decoder
+func (f *FileMemory) Decode(source protocol.Codec) (n int, err protocol.Error) {
+	var data []byte
+	data, err = source.Marshal()
+	if err != nil {
+		return
+	}
+	return f.Unmarshal(data)
+}
+
+//libgo:impl libgo/protocol.Encoder
+func (f *FileMemory) Encode(destination protocol.Codec) (n int, err protocol.Error) {
+	n, err = destination.Decode(f)
+	return
+}
+func (f *FileMemory) Len() (ln int) {
+	f.tree.sync.Lock()
+	ln = len(f.data)
+	f.tree.sync.Unlock()
+	return
+}
+
+//libgo:impl libgo/protocol.Unmarshaler
+func (f *FileMemory) Unmarshal(data []byte) (n int, err protocol.Error) {
+	f.tree.sync.Lock()
+	f.setData(cloneBytes(data))
+	f.tree.sync.Unlock()
+	n = len(data)
+	return
+}
+func (f *FileMemory) UnmarshalFrom(data []byte) (remaining []byte, err protocol.Error) {
+	_, err = f.Unmarshal(data)
+	return
+}
+
+// Marshal return a copy of the file data.
+//
+//libgo:impl libgo/protocol.Marshaler
+func (f *FileMemory) Marshal() (data []byte, err protocol.Error) {
+	f.tree.sync.Lock()
+	data = make([]byte, len(f.data))
+	copy(data, f.data)
+	f.metadata.accessed = unix.Now()
+	f.tree.sync.Unlock()
+	return
+}
+func (f *FileMemory) MarshalTo(data []byte) (added []byte, err protocol.Error) {
+	f.tree.sync.Lock()
+	added = append(data, f.data...)
+	f.metadata.accessed = unix.Now()
+	f.tree.sync.Unlock()
+	return
+}
+
+func (f *FileMemory) init(tree *fileTree, parent *FileDirectoryMemory, path string, now unix.Time) {
+	f.metadata.init(path, now)
+	f.tree = tree
+	f.parent = parent
+}
+
+// clone return a copy of f with new timestamps.
+func (f *FileMemory) clone(parent *FileDirectoryMemory, path string, now unix.Time) (c *FileMemory) {
+	c = &FileMemory{data: cloneBytes(f.data)}
+	c.init(f.tree, parent, path, now)
+	c.metadata.size = f.metadata.size
+	return
+}
+
+// setData replace the file data and update the metadata. Caller must hold the tree lock.
+// Old data that isn't in the backing array of the new one write zero, so Erase() never leaves any copy of the file in RAM.
+func (f *FileMemory) setData(data []byte) {
+	if cap(f.data) > 0 && (cap(data) == 0 || &f.data[:cap(f.data)][cap(f.data)-1] != &data[:cap(data)][cap(data)-1]) {
+		f.erase()
+	}
+	f.data = data
+	f.metadata.size = uint64(len(data))
+	f.metadata.modified = unix.Now()
+	f.metadata.accessed = f.metadata.modified
+}
+
+// erase write zero data to the whole backing array of the file data. Caller must hold the tree lock.
+func (f *FileMemory) erase() { zeroBytes(f.data[:cap(f.data)]) }
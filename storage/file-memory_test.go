@@ -0,0 +1,203 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"bytes"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"libgo/protocol"
+)
+
+var (
+	_ protocol.FileDirectory = &FileDirectoryMemory{}
+	_ protocol.File          = &FileMemory{}
+	_ protocol.FileData      = &FileMemory{}
+)
+
+func TestFileDirectoryMemory(t *testing.T) {
+	var root FileDirectoryMemory
+	root.Init()
+	defer root.Deinit()
+
+	var d, err = root.Directory("www")
+	if err != nil {
+		t.Fatalf("Directory() error = %v", err)
+	}
+	var f protocol.File
+	f, err = d.File("index.html")
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	f.Data().Append([]byte("<html>"))
+	f.Data().Append([]byte("</html>"))
+	if f.Metadata().Size() != 13 {
+		t.Errorf("Size() = %v, want 13", f.Metadata().Size())
+	}
+	if f.Metadata().URI().Path() != "/www/index.html" || f.Metadata().URI().Extension() != "html" {
+		t.Errorf("URI() = %v, %v", f.Metadata().URI().Path(), f.Metadata().URI().Extension())
+	}
+	var md = f.Metadata()
+	if md.Modified().SecondElapsed() < md.Created().SecondElapsed() {
+		t.Errorf("Modified() is before Created()")
+	}
+	if root.Metadata().DirNum() != 1 || d.Metadata().FileNum() != 1 {
+		t.Errorf("DirNum() = %v, FileNum() = %v, want 1, 1", root.Metadata().DirNum(), d.Metadata().FileNum())
+	}
+	if _, err = root.File("www"); err != &ErrExist {
+		t.Errorf("File() with a directory name error = %v, want ErrExist", err)
+	}
+	if _, err = root.FileByPath("www/../www/index.html"); err != &ErrInvalidPath {
+		t.Errorf("FileByPath() with .. error = %v, want ErrInvalidPath", err)
+	}
+
+	if err = root.Copy("www", "backup"); err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+	f.Data().Replace([]byte("html"), []byte("body"), -1)
+	var copied protocol.File
+	copied, err = root.FileByPath("backup/index.html")
+	if err != nil {
+		t.Fatalf("FileByPath() of the copy error = %v", err)
+	}
+	if data, _ := copied.Data().Marshal(); string(data) != "<html></html>" {
+		t.Errorf("copy data = %q, want it unchanged", data)
+	}
+	if err = root.Copy("www", "/"); err != &ErrExist {
+		t.Errorf("Copy() to the same path error = %v, want ErrExist", err)
+	}
+	if err = root.Move("backup", "www/"); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	if copied.Metadata().URI().Path() != "/www/backup/index.html" {
+		t.Errorf("Path() after Move() = %v", copied.Metadata().URI().Path())
+	}
+	if err = root.Move("www", "www/backup/"); err != &ErrInvalidPath {
+		t.Errorf("Move() into its sub directory error = %v, want ErrInvalidPath", err)
+	}
+	if err = root.Rename("www/backup", "www/old"); err != nil {
+		t.Errorf("Rename() error = %v", err)
+	}
+	if copied.ParentDirectory().Metadata().URI().Path() != "/www/old/" {
+		t.Errorf("ParentDirectory() after Rename() = %v", copied.ParentDirectory().Metadata().URI().Path())
+	}
+}
+
+func TestFileDirectoryMemory_recycleBin(t *testing.T) {
+	var root FileDirectoryMemory
+	root.Init()
+	defer root.Deinit()
+
+	for i := 0; i < 2; i++ {
+		var f, _ = root.File("a.txt")
+		f.Data().Unmarshal([]byte("secret"))
+		if err := root.Delete("a.txt"); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+	}
+	if root.Metadata().FileNum() != 0 {
+		t.Errorf("FileNum() after Delete() = %v, want 0", root.Metadata().FileNum())
+	}
+	var bin = root.RecycleBin()
+	var names []string
+	for _, f := range bin.Files(0, 10) {
+		names = append(names, f.Metadata().URI().Name())
+	}
+	if len(names) != 2 || names[0] != "a.txt" || names[1] != "a.txt.2" {
+		t.Fatalf("RecycleBin().Files() = %v, want [a.txt a.txt.2]", names)
+	}
+
+	if err := root.Restore("a.txt.2"); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if err := root.Restore("a.txt"); err != &ErrExist {
+		t.Errorf("Restore() to a used name error = %v, want ErrExist", err)
+	}
+	var f, err = root.FileByPath("a.txt")
+	if err != nil {
+		t.Fatalf("FileByPath() after Restore() error = %v", err)
+	}
+	if f.Metadata().URI().Path() != "/a.txt" {
+		t.Errorf("Path() after Restore() = %v", f.Metadata().URI().Path())
+	}
+
+	var data = f.(*FileMemory).data
+	if err = root.Erase("a.txt"); err != nil {
+		t.Errorf("Erase() error = %v", err)
+	}
+	if !bytes.Equal(data, make([]byte, len(data))) {
+		t.Errorf("Erase() don't write zero data, got %q", data)
+	}
+	if err = bin.Delete("a.txt"); err != nil || bin.Metadata().FileNum() != 0 {
+		t.Errorf("Delete() in recycle bin error = %v, FileNum() = %v", err, bin.Metadata().FileNum())
+	}
+	if err = root.Restore("a.txt"); err != &ErrNotExist {
+		t.Errorf("Restore() after permanent delete error = %v, want ErrNotExist", err)
+	}
+}
+
+func TestFileDirectoryMemory_InitFS(t *testing.T) {
+	var modTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var fsys = fstest.MapFS{
+		"index.html":    {Data: []byte("<html></html>"), ModTime: modTime},
+		"css/main.css":  {Data: []byte("body{}")},
+		"js/app/app.js": {Data: []byte("main()")},
+	}
+	var root FileDirectoryMemory
+	var err = root.InitFS(fsys)
+	if err != nil {
+		t.Fatalf("InitFS() error = %v", err)
+	}
+	defer root.Deinit()
+
+	if root.Metadata().DirNum() != 2 || root.Metadata().FileNum() != 1 {
+		t.Errorf("DirNum() = %v, FileNum() = %v, want 2, 1", root.Metadata().DirNum(), root.Metadata().FileNum())
+	}
+	var f protocol.File
+	f, err = root.FileByPath("js/app/app.js")
+	if err != nil {
+		t.Fatalf("FileByPath() error = %v", err)
+	}
+	if data, _ := f.Data().Marshal(); string(data) != "main()" {
+		t.Errorf("Marshal() = %q, want main()", data)
+	}
+	f = root.FindFile("index")
+	if f == nil {
+		t.Fatal("FindFile() = nil")
+	}
+	if f.Metadata().Modified().SecondElapsed() != modTime.Unix() {
+		t.Errorf("Modified() = %v, want %v", f.Metadata().Modified().SecondElapsed(), modTime.Unix())
+	}
+}
+
+func TestFileMemory_EraseOldData(t *testing.T) {
+	var root FileDirectoryMemory
+	root.Init()
+	var file, _ = root.File("secret.txt")
+	var fm = file.(*FileMemory)
+
+	// Keep whole backing arrays of all versions of the data to check them after Erase().
+	var arrays [][]byte
+	var keep = func() { arrays = append(arrays, fm.data[:cap(fm.data)]) }
+	file.Data().Unmarshal([]byte("secret"))
+	keep()
+	for i := 0; i < 4; i++ {
+		file.Data().Append([]byte("-more-secret"))
+		keep()
+	}
+	file.Data().Replace([]byte("secret"), []byte("SECRET"), -1)
+	keep()
+	file.Data().Prepend([]byte("head-"))
+	keep()
+
+	if err := root.Erase("secret.txt"); err != nil {
+		t.Fatalf("Erase() error = %v", err)
+	}
+	for i, array := range arrays {
+		if !bytes.Equal(array, make([]byte, len(array))) {
+			t.Errorf("Erase() don't write zero data to backing array %d, got %q", i, array)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"strings"
+
+	"libgo/protocol"
+)
+
+// FilesCache wrap a protocol.FileDirectory to serve repeated reads of file data from a Cache.
+// Whole data of a file cache by Marshal() and any change on the file or its directories through the wrappers
+// drop it from the cache. File directories don't dispatch change events, so use Cache.MaxAge to bound staleness
+// of files that change on the source by others.
+// In CacheMode_WriteThrough, Unmarshal() and Decode() cache the new data of the file.
+type FilesCache struct {
+	Mode CacheMode
+
+	filesCacheDirectory
+	cache *Cache
+	ns    string
+}
+
+// filesCacheDirectory implement protocol.FileDirectory by wrap a directory of the source tree.
+type filesCacheDirectory struct {
+	fc     *FilesCache
+	source protocol.FileDirectory
+}
+
+// filesCacheFile implement protocol.File and protocol.FileData by wrap a file of the source tree.
+type filesCacheFile struct {
+	fc     *FilesCache
+	source protocol.File
+}
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (fc *FilesCache) Init(cache *Cache, source protocol.FileDirectory) (err protocol.Error) {
+	fc.cache = cache
+	fc.ns = cache.namespace()
+	fc.filesCacheDirectory = filesCacheDirectory{fc: fc, source: source}
+	return
+}
+func (fc *FilesCache) Deinit() (err protocol.Error) { return }
+
+// Source return the wrapped directory.
+func (fc *FilesCache) Source() protocol.FileDirectory { return fc.source }
+
+func (fc *FilesCache) directory(source protocol.FileDirectory) protocol.FileDirectory {
+	if source == nil {
+		return nil
+	}
+	return &filesCacheDirectory{fc: fc, source: source}
+}
+func (fc *FilesCache) file(source protocol.File) protocol.File {
+	if source == nil {
+		return nil
+	}
+	return &filesCacheFile{fc: fc, source: source}
+}
+
+//libgo:impl libgo/protocol.FileDirectory
+func (dir *filesCacheDirectory) Metadata() protocol.FileDirectoryMetadata { return dir.source.Metadata() }
+func (dir *filesCacheDirectory) ParentDirectory() protocol.FileDirectory {
+	return dir.fc.directory(dir.source.ParentDirectory())
+}
+func (dir *filesCacheDirectory) Directories(offset, limit uint64) (dirs []protocol.FileDirectory) {
+	dirs = dir.source.Directories(offset, limit)
+	for i, d := range dirs {
+		dirs[i] = dir.fc.directory(d)
+	}
+	return
+}
+func (dir *filesCacheDirectory) Directory(name string) (dr protocol.FileDirectory, err protocol.Error) {
+	dr, err = dir.source.Directory(name)
+	if err == nil {
+		dr = dir.fc.directory(dr)
+	}
+	return
+}
+func (dir *filesCacheDirectory) Files(offset, limit uint64) (files []protocol.File) {
+	files = dir.source.Files(offset, limit)
+	for i, f := range files {
+		files[i] = dir.fc.file(f)
+	}
+	return
+}
+func (dir *filesCacheDirectory) File(name string) (file protocol.File, err protocol.Error) {
+	file, err = dir.source.File(name)
+	if err == nil {
+		file = dir.fc.file(file)
+	}
+	return
+}
+func (dir *filesCacheDirectory) FileByPath(uriPath string) (file protocol.File, err protocol.Error) {
+	file, err = dir.source.FileByPath(uriPath)
+	if err == nil {
+		file = dir.fc.file(file)
+	}
+	return
+}
+func (dir *filesCacheDirectory) FindFiles(partName string, num uint) (files []protocol.File) {
+	files = dir.source.FindFiles(partName, num)
+	for i, f := range files {
+		files[i] = dir.fc.file(f)
+	}
+	return
+}
+func (dir *filesCacheDirectory) FindFile(partName string) (file protocol.File) {
+	return dir.fc.file(dir.source.FindFile(partName))
+}
+func (dir *filesCacheDirectory) Rename(oldURIPath, newURIPath string) (err protocol.Error) {
+	err = dir.source.Rename(oldURIPath, newURIPath)
+	dir.changed(oldURIPath, newURIPath)
+	return
+}
+func (dir *filesCacheDirectory) Copy(uriPath, newURIPath string) (err protocol.Error) {
+	err = dir.source.Copy(uriPath, newURIPath)
+	dir.changed(newURIPath)
+	return
+}
+func (dir *filesCacheDirectory) Move(uriPath, newURIPath string) (err protocol.Error) {
+	err = dir.source.Move(uriPath, newURIPath)
+	dir.changed(uriPath, newURIPath)
+	return
+}
+func (dir *filesCacheDirectory) Delete(uriPath string) (err protocol.Error) {
+	err = dir.source.Delete(uriPath)
+	dir.changed(uriPath)
+	return
+}
+func (dir *filesCacheDirectory) PermanentlyDelete(uriPath string) (err protocol.Error) {
+	err = dir.source.PermanentlyDelete(uriPath)
+	dir.changed(uriPath)
+	return
+}
+func (dir *filesCacheDirectory) Erase(uriPath string) (err protocol.Error) {
+	err = dir.source.Erase(uriPath)
+	dir.changed(uriPath)
+	return
+}
+
+// lookupDirectory return the sub directory by its name or nil if it doesn't exist.
+func (dir *filesCacheDirectory) lookupDirectory(name string) protocol.FileDirectory {
+	return dir.fc.directory(fsLookupDirectory(dir.source, name))
+}
+
+// changed drop cached data of the files or all files in the directories of the uri paths that are relative to dir.
+// A uri path that end with "/" is a destination directory of Copy() and Move(), so drop all files in it.
+func (dir *filesCacheDirectory) changed(uriPaths ...string) {
+	var dirPath = dir.source.Metadata().URI().Path()
+	if !strings.HasSuffix(dirPath, "/") {
+		dirPath += "/"
+	}
+	for _, uriPath := range uriPaths {
+		var path = dir.fc.ns + dirPath + strings.Trim(uriPath, "/")
+		dir.fc.cache.invalidate(path)
+		dir.fc.cache.invalidatePrefix(path + "/")
+	}
+}
+
+//libgo:impl libgo/protocol.File
+func (f *filesCacheFile) Metadata() protocol.FileMetadata { return f.source.Metadata() }
+func (f *filesCacheFile) Data() protocol.FileData         { return f }
+func (f *filesCacheFile) ParentDirectory() protocol.FileDirectory {
+	return f.fc.directory(f.source.ParentDirectory())
+}
+func (f *filesCacheFile) Rename(newName string) {
+	var group = f.group()
+	f.source.Rename(newName)
+	f.fc.cache.invalidate(group)
+}
+
+//libgo:impl libgo/protocol.FileData
+func (f *filesCacheFile) Save() (err protocol.Error) { return f.source.Data().Save() }
+func (f *filesCacheFile) Prepend(data []byte) {
+	f.source.Data().Prepend(data)
+	f.fc.cache.invalidate(f.group())
+}
+func (f *filesCacheFile) Append(data []byte) {
+	f.source.Data().Append(data)
+	f.fc.cache.invalidate(f.group())
+}
+func (f *filesCacheFile) Replace(old, new []byte, n int) {
+	f.source.Data().Replace(old, new, n)
+	f.fc.cache.invalidate(f.group())
+}
+
+//libgo:impl libgo/protocol.Codec
+func (f *filesCacheFile) MediaType() protocol.MediaType       { return f.source.Data().MediaType() }
+func (f *filesCacheFile) CompressType() protocol.CompressType { return f.source.Data().CompressType() }
+
+//libgo:impl libgo/protocol.Decoder
+func (f *filesCacheFile) Decode(source protocol.Codec) (n int, err protocol.Error) {
+	var data []byte
+	data, err = source.Marshal()
+	if err != nil {
+		return
+	}
+	return f.Unmarshal(data)
+}
+
+//libgo:impl libgo/protocol.Encoder
+func (f *filesCacheFile) Encode(destination protocol.Codec) (n int, err protocol.Error) {
+	n, err = destination.Decode(f)
+	return
+}
+func (f *filesCacheFile) Len() (ln int) {
+	var data, _, ok = f.fc.cache.get(f.group(), "")
+	if ok {
+		return len(data)
+	}
+	return f.source.Data().Len()
+}
+
+//libgo:impl libgo/protocol.Unmarshaler
+func (f *filesCacheFile) Unmarshal(data []byte) (n int, err protocol.Error) {
+	var group = f.group()
+	n, err = f.source.Data().Unmarshal(data)
+	if err == nil && f.fc.Mode == CacheMode_WriteThrough {
+		f.fc.cache.put(group, "", cloneBytes(data), 0)
+	} else {
+		f.fc.cache.invalidate(group)
+	}
+	return
+}
+func (f *filesCacheFile) UnmarshalFrom(data []byte) (remaining []byte, err protocol.Error) {
+	_, err = f.Unmarshal(data)
+	return
+}
+
+// Marshal return a copy of the file data.
+//
+//libgo:impl libgo/protocol.Marshaler
+func (f *filesCacheFile) Marshal() (data []byte, err protocol.Error) {
+	var group = f.group()
+	var cached, _, ok = f.fc.cache.get(group, "")
+	if ok {
+		data = cloneBytes(cached)
+		return
+	}
+
+	var ticket = f.fc.cache.ticket()
+	data, err = f.source.Data().Marshal()
+	if err == nil {
+		f.fc.cache.fill(ticket, group, "", cloneBytes(data), 0)
+	}
+	return
+}
+func (f *filesCacheFile) MarshalTo(data []byte) (added []byte, err protocol.Error) {
+	var fileData []byte
+	fileData, err = f.Marshal()
+	if err == nil {
+		added = append(data, fileData...)
+	}
+	return
+}
+
+func (f *filesCacheFile) group() string { return f.fc.ns + f.source.Metadata().URI().Path() }
@@ -0,0 +1,236 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"libgo/protocol"
+)
+
+// FS expose a protocol.FileDirectory as fs.FS, so it can use by standard library packages
+// e.g. http.FileServer(http.FS(&fsys)), template.ParseFS() or fs.WalkDir().
+//   - Opened files are io.ReadSeeker and io.ReaderAt on a copy of the file data at open time.
+//   - fs.FileInfo.Sys() return the protocol.FileMetadata, so its Created() and Accessed() are reachable too.
+//   - It never makes any directory or file in the source even though FileDirectory.Directory() can.
+type FS struct {
+	dir protocol.FileDirectory
+}
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (fsys *FS) Init(dir protocol.FileDirectory) (err protocol.Error) {
+	fsys.dir = dir
+	return
+}
+func (fsys *FS) Deinit() (err protocol.Error) { return }
+
+// Open implement fs.FS
+func (fsys *FS) Open(name string) (file fs.File, err error) {
+	var dir, f, e = fsys.lookup("open", name)
+	if e != nil {
+		return nil, e
+	}
+	if dir != nil {
+		return &fsDirectory{info: fsDirectoryInfo(name, dir), dir: dir}, nil
+	}
+	var data []byte
+	data, err = f.Data().Marshal()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	var of = &fsFile{info: fsFileInfo(name, f)}
+	of.Reader.Reset(data)
+	return of, nil
+}
+
+// ReadDir implement fs.ReadDirFS
+func (fsys *FS) ReadDir(name string) (entries []fs.DirEntry, err error) {
+	var dir, _, e = fsys.lookup("readdir", name)
+	if e != nil {
+		return nil, e
+	}
+	if dir == nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return fsReadDir(dir), nil
+}
+
+// Stat implement fs.StatFS
+func (fsys *FS) Stat(name string) (info fs.FileInfo, err error) {
+	var dir, f, e = fsys.lookup("stat", name)
+	if e != nil {
+		return nil, e
+	}
+	if dir != nil {
+		return fsDirectoryInfo(name, dir), nil
+	}
+	return fsFileInfo(name, f), nil
+}
+
+// ReadFile implement fs.ReadFileFS
+func (fsys *FS) ReadFile(name string) (data []byte, err error) {
+	var _, f, e = fsys.lookup("readfile", name)
+	if e != nil {
+		return nil, e
+	}
+	if f == nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	data, err = f.Data().Marshal()
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return
+}
+
+// lookup return the directory or the file of the fs path name.
+func (fsys *FS) lookup(op, name string) (dir protocol.FileDirectory, file protocol.File, err error) {
+	if !fs.ValidPath(name) {
+		err = &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+		return
+	}
+	dir = fsys.dir
+	if name == "." {
+		return
+	}
+	var parts = strings.Split(name, "/")
+	for _, part := range parts[:len(parts)-1] {
+		dir = fsLookupDirectory(dir, part)
+		if dir == nil {
+			err = &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+			return
+		}
+	}
+	var last = parts[len(parts)-1]
+	if d := fsLookupDirectory(dir, last); d != nil {
+		dir = d
+		return
+	}
+	var e protocol.Error
+	file, e = dir.FileByPath(last)
+	if e != nil || file == nil {
+		dir, file = nil, nil
+		err = &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		return
+	}
+	dir = nil
+	return
+}
+
+// fsDirectoryLookup is implemented by directories that can find a sub directory by its name without make it.
+type fsDirectoryLookup interface {
+	lookupDirectory(name string) protocol.FileDirectory
+}
+
+// fsLookupDirectory return the sub directory by its name or nil if it doesn't exist.
+// It can't use FileDirectory.Directory() that make the directory if it doesn't exist,
+// so other directories than this package ones are scanned by Directories().
+func fsLookupDirectory(dir protocol.FileDirectory, name string) protocol.FileDirectory {
+	if l, ok := dir.(fsDirectoryLookup); ok {
+		return l.lookupDirectory(name)
+	}
+	for _, d := range dir.Directories(0, ^uint64(0)) {
+		if d.Metadata().URI().Name() == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// fsReadDir return all entries of the directory in order by name.
+func fsReadDir(dir protocol.FileDirectory) (entries []fs.DirEntry) {
+	var dirs = dir.Directories(0, ^uint64(0))
+	var files = dir.Files(0, ^uint64(0))
+	entries = make([]fs.DirEntry, 0, len(dirs)+len(files))
+	for _, d := range dirs {
+		entries = append(entries, fs.FileInfoToDirEntry(fsDirectoryInfo(d.Metadata().URI().Name(), d)))
+	}
+	for _, f := range files {
+		entries = append(entries, fs.FileInfoToDirEntry(fsFileInfo(f.Metadata().URI().Name(), f)))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return
+}
+
+// fsFile implement fs.File, io.Seeker and io.ReaderAt for a file of FS.
+type fsFile struct {
+	info *fsInfo
+	bytes.Reader
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *fsFile) Close() error               { return nil }
+
+// fsDirectory implement fs.ReadDirFile for a directory of FS.
+type fsDirectory struct {
+	info    *fsInfo
+	dir     protocol.FileDirectory
+	entries []fs.DirEntry // nil until first ReadDir() call
+	offset  int
+}
+
+func (d *fsDirectory) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *fsDirectory) Close() error               { return nil }
+func (d *fsDirectory) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir implement fs.ReadDirFile
+func (d *fsDirectory) ReadDir(n int) (entries []fs.DirEntry, err error) {
+	if d.entries == nil {
+		d.entries = fsReadDir(d.dir)
+	}
+	entries = d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return
+	}
+	if len(entries) == 0 {
+		return nil, io.EOF
+	}
+	if n < len(entries) {
+		entries = entries[:n]
+	}
+	d.offset += len(entries)
+	return
+}
+
+// fsInfo implement fs.FileInfo by a protocol.FileMetadata.
+type fsInfo struct {
+	name     string
+	metadata protocol.FileMetadata
+	dir      bool
+}
+
+func fsDirectoryInfo(name string, dir protocol.FileDirectory) *fsInfo {
+	return &fsInfo{name: fsBase(name), metadata: dir.Metadata(), dir: true}
+}
+func fsFileInfo(name string, file protocol.File) *fsInfo {
+	return &fsInfo{name: fsBase(name), metadata: file.Metadata()}
+}
+
+func (fi *fsInfo) Name() string { return fi.name }
+func (fi *fsInfo) Size() int64  { return int64(fi.metadata.Size()) }
+func (fi *fsInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+func (fi *fsInfo) ModTime() time.Time { return fsTime(fi.metadata.Modified()) }
+func (fi *fsInfo) IsDir() bool        { return fi.dir }
+func (fi *fsInfo) Sys() any           { return fi.metadata }
+
+func fsBase(name string) string { return name[strings.LastIndexByte(name, '/')+1:] }
+
+func fsTime(t protocol.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return time.Unix(t.SecondElapsed(), int64(t.NanoSecondElapsed()))
+}
@@ -0,0 +1,134 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"libgo/protocol"
+)
+
+var (
+	_ fs.ReadDirFS           = &FS{}
+	_ fs.StatFS              = &FS{}
+	_ fs.ReadFileFS          = &FS{}
+	_ protocol.FileDirectory = &FileDirectoryFS{}
+	_ protocol.File          = &FileFS{}
+)
+
+func TestFS(t *testing.T) {
+	var root FileDirectoryMemory
+	root.Init()
+	defer root.Deinit()
+	var f, _ = root.File("index.html")
+	f.Data().Unmarshal([]byte("<html></html>"))
+	var d, _ = root.Directory("css")
+	f, _ = d.File("main.css")
+	f.Data().Unmarshal([]byte("body{}"))
+	root.Directory("empty")
+
+	var fsys FS
+	fsys.Init(&root)
+	var err = fstest.TestFS(&fsys, "index.html", "css/main.css", "empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Metadata().DirNum() != 2 {
+		t.Errorf("FS make a directory in the source, DirNum() = %v, want 2", root.Metadata().DirNum())
+	}
+
+	var info fs.FileInfo
+	info, err = fsys.Stat("css/main.css")
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	var md = f.Metadata()
+	if info.Size() != 6 || info.ModTime().Unix() != md.Modified().SecondElapsed() {
+		t.Errorf("Stat() = %v, %v", info.Size(), info.ModTime())
+	}
+	if info.Sys().(protocol.FileMetadata).Created() != md.Created() {
+		t.Errorf("Sys() isn't the file metadata")
+	}
+	if _, err = fsys.Open("css/none.css"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open() not exist file error = %v, want fs.ErrNotExist", err)
+	}
+	if _, err = fsys.Open("none/main.css"); !errors.Is(err, fs.ErrNotExist) || root.Metadata().DirNum() != 2 {
+		t.Errorf("Open() in not exist directory error = %v, DirNum() = %v", err, root.Metadata().DirNum())
+	}
+}
+
+func TestFileDirectoryFS(t *testing.T) {
+	var modTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var mapFS = fstest.MapFS{
+		"index.html":    {Data: []byte("<html></html>"), ModTime: modTime},
+		"css/main.css":  {Data: []byte("body{}")},
+		"js/app/app.js": {Data: []byte("main()")},
+	}
+	var root FileDirectoryFS
+	var err = root.Init(mapFS)
+	if err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	if root.Metadata().DirNum() != 2 || root.Metadata().FileNum() != 1 {
+		t.Errorf("DirNum() = %v, FileNum() = %v, want 2, 1", root.Metadata().DirNum(), root.Metadata().FileNum())
+	}
+	var f protocol.File
+	f, err = root.FileByPath("js/app/app.js")
+	if err != nil {
+		t.Fatalf("FileByPath() error = %v", err)
+	}
+	if f.Metadata().URI().Path() != "/js/app/app.js" || f.Metadata().Size() != 6 {
+		t.Errorf("Metadata() = %v, %v", f.Metadata().URI().Path(), f.Metadata().Size())
+	}
+	if data, _ := f.Data().Marshal(); string(data) != "main()" {
+		t.Errorf("Marshal() = %q, want main()", data)
+	}
+	if f.ParentDirectory().Metadata().URI().Path() != "/js/app/" {
+		t.Errorf("ParentDirectory() = %v", f.ParentDirectory().Metadata().URI().Path())
+	}
+
+	f, err = root.File("index.html")
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	if f.Metadata().Modified().SecondElapsed() != modTime.Unix() || f.Metadata().Created().SecondElapsed() != modTime.Unix() {
+		t.Errorf("Modified() = %v, want %v", f.Metadata().Modified().SecondElapsed(), modTime.Unix())
+	}
+	if _, err = root.File("none.html"); err != &ErrNotExist {
+		t.Errorf("File() not exist error = %v, want ErrNotExist", err)
+	}
+	if _, err = f.Data().Unmarshal(nil); err != &ErrReadOnly {
+		t.Errorf("Unmarshal() error = %v, want ErrReadOnly", err)
+	}
+	if err = root.Delete("index.html"); err != &ErrReadOnly {
+		t.Errorf("Delete() error = %v, want ErrReadOnly", err)
+	}
+}
+
+func TestFS_roundTrip(t *testing.T) {
+	var mem FileDirectoryMemory
+	mem.Init()
+	defer mem.Deinit()
+	var f, _ = mem.File("a.txt")
+	f.Data().Unmarshal([]byte("a"))
+
+	var fsys FS
+	fsys.Init(&mem)
+	var dir FileDirectoryFS
+	dir.Init(&fsys)
+
+	var got, err = dir.File("a.txt")
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	var md, gmd = f.Metadata(), got.Metadata()
+	if gmd.Created().SecondElapsed() != md.Created().SecondElapsed() || gmd.Created().NanoSecondElapsed() != md.Created().NanoSecondElapsed() ||
+		gmd.Accessed().NanoSecondElapsed() != md.Accessed().NanoSecondElapsed() {
+		t.Errorf("Created() and Accessed() don't map through fs.FileInfo.Sys()")
+	}
+}
@@ -0,0 +1,154 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/binary"
+	"libgo/protocol"
+	"libgo/time/unix"
+)
+
+// graphEdge hold all relations from primary node to secondary node and store as one record.
+type graphEdge struct {
+	primary   [16]byte
+	secondary [16]byte
+	relations []graphRelation // in order of start time
+}
+
+// graphRelation is one period of a relation. Times are unix nano and zero end means the relation is active.
+type graphRelation struct {
+	label protocol.GraphRelationLabel
+	start int64
+	end   int64
+}
+
+const (
+	graphEdge_HeaderLen = 16 + 16
+	graphRelation_Len   = 4 + 8 + 8
+)
+
+func graphEdgeID(primary, secondary [16]byte) (id [16]byte) {
+	var buf [graphEdge_HeaderLen]byte
+	copy(buf[:], primary[:])
+	copy(buf[16:], secondary[:])
+	id = ObjectID(buf[:])
+	return
+}
+
+func (e *graphEdge) clone() (c *graphEdge) {
+	c = &graphEdge{
+		primary:   e.primary,
+		secondary: e.secondary,
+		relations: append([]graphRelation(nil), e.relations...),
+	}
+	return
+}
+
+// active return index of the active relation with the label or -1 if not exist.
+func (e *graphEdge) active(label protocol.GraphRelationLabel) int {
+	for i := len(e.relations) - 1; i >= 0; i-- {
+		var r = &e.relations[i]
+		if r.label == label && r.end == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// activeAt report any relation with the label (or any label if GraphRelationLabel_Unset) was active at the time,
+// or is active now if now is true.
+func (e *graphEdge) activeAt(label protocol.GraphRelationLabel, at int64, now bool) bool {
+	for i := range e.relations {
+		var r = &e.relations[i]
+		if label != protocol.GraphRelationLabel_Unset && r.label != label {
+			continue
+		}
+		if now {
+			if r.end == 0 {
+				return true
+			}
+		} else if r.start <= at && (r.end == 0 || at < r.end) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *graphEdge) encode() (data []byte) {
+	data = make([]byte, graphEdge_HeaderLen+len(e.relations)*graphRelation_Len)
+	copy(data, e.primary[:])
+	copy(data[16:], e.secondary[:])
+	var buf = data[graphEdge_HeaderLen:]
+	for _, r := range e.relations {
+		binary.LittleEndian(buf).PutUint32(uint32(r.label))
+		binary.LittleEndian(buf[4:]).PutUint64(uint64(r.start))
+		binary.LittleEndian(buf[12:]).PutUint64(uint64(r.end))
+		buf = buf[graphRelation_Len:]
+	}
+	return
+}
+
+func (e *graphEdge) decode(data []byte) (err protocol.Error) {
+	if len(data) < graphEdge_HeaderLen || (len(data)-graphEdge_HeaderLen)%graphRelation_Len != 0 {
+		return &ErrCorrupted
+	}
+	copy(e.primary[:], data)
+	copy(e.secondary[:], data[16:])
+	var buf = data[graphEdge_HeaderLen:]
+	e.relations = make([]graphRelation, len(buf)/graphRelation_Len)
+	for i := range e.relations {
+		e.relations[i] = graphRelation{
+			label: protocol.GraphRelationLabel(binary.LittleEndian(buf).Uint32()),
+			start: int64(binary.LittleEndian(buf[4:]).Uint64()),
+			end:   int64(binary.LittleEndian(buf[12:]).Uint64()),
+		}
+		buf = buf[graphRelation_Len:]
+	}
+	return
+}
+
+// GraphRelation implement protocol.GraphRelation.
+type GraphRelation struct {
+	primary   [16]byte
+	secondary [16]byte
+	relation  protocol.GraphRelationLabel
+	start     unix.Time
+	end       unix.Time
+	active    bool
+}
+
+//libgo:impl libgo/protocol.Graph
+func (gr *GraphRelation) PrimaryNode() [16]byte                 { return gr.primary }
+func (gr *GraphRelation) SecondaryNode() [16]byte               { return gr.secondary }
+func (gr *GraphRelation) Relation() protocol.GraphRelationLabel { return gr.relation }
+
+//libgo:impl libgo/protocol.GraphRelation
+func (gr *GraphRelation) Start() protocol.Time { return &gr.start }
+func (gr *GraphRelation) End() protocol.Time {
+	if gr.active {
+		return nil
+	}
+	return &gr.end
+}
+
+func newGraphRelation(e *graphEdge, r *graphRelation) (gr *GraphRelation) {
+	gr = &GraphRelation{
+		primary:   e.primary,
+		secondary: e.secondary,
+		relation:  r.label,
+		active:    r.end == 0,
+	}
+	gr.start.ChangeTo(unix.SecElapsed(r.start/1e9), int32(r.start%1e9))
+	gr.end.ChangeTo(unix.SecElapsed(r.end/1e9), int32(r.end%1e9))
+	return
+}
+
+// unixNano return t as nanoseconds elapsed from unix epoch. t must be a unix time.
+func unixNano(t protocol.Time) (nano int64, err protocol.Error) {
+	if t.Epoch() != protocol.TimeEpoch_Unix {
+		err = &ErrTimeEpoch
+		return
+	}
+	nano = t.SecondElapsed()*1e9 + int64(t.NanoSecondElapsed())
+	return
+}
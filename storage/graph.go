@@ -0,0 +1,221 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"libgo/protocol"
+	"libgo/time/unix"
+)
+
+// Graph implement protocol.StorageGraph on top of any protocol.StorageRecords.
+//   - Each edge store as a record with sha3(PrimaryNode, SecondaryNode) as ID, and hold all relations between them
+//     with their history, so any relation change is just one record save.
+//   - Adjacency of nodes in both directions keep in memory and rebuild from records in Init().
+//   - It is safe to call its methods concurrently.
+type Graph struct {
+	records protocol.StorageRecords
+	mt      protocol.MediaTypeID
+
+	sync  sync.RWMutex
+	edges map[[16]byte]*graphEdge   // by edge ID
+	nodes map[[16]byte][]*graphEdge // edges of a node in any direction
+}
+
+// Init load all edges stored in records with mt mediatype. Zero mt means GraphEdge_MediaType.
+//
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (g *Graph) Init(records protocol.StorageRecords, mt protocol.MediaTypeID) (err protocol.Error) {
+	if mt == 0 {
+		mt = GraphEdge_MediaType.ID()
+	}
+	g.records = records
+	g.mt = mt
+	g.edges = make(map[[16]byte]*graphEdge)
+	g.nodes = make(map[[16]byte][]*graphEdge)
+
+	var ids [][16]byte
+	ids, err = records.ListRecords(mt, 0, ^uint64(0))
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		var data []byte
+		data, _, err = records.Get(mt, id, protocol.StorageRecord_LastLocalVersion)
+		if err != nil {
+			return
+		}
+		var e = &graphEdge{}
+		err = e.decode(data)
+		if err != nil {
+			return
+		}
+		g.put(id, e)
+	}
+	return
+}
+func (g *Graph) Deinit() (err protocol.Error) {
+	g.sync.Lock()
+	g.edges = nil
+	g.nodes = nil
+	g.sync.Unlock()
+	return
+}
+
+//libgo:impl libgo/protocol.StorageGraph
+func (g *Graph) AddEdge(primary, secondary [16]byte, relation protocol.GraphRelationLabel) (err protocol.Error) {
+	g.sync.Lock()
+	defer g.sync.Unlock()
+
+	var id = graphEdgeID(primary, secondary)
+	var e = g.edges[id]
+	if e == nil {
+		e = &graphEdge{primary: primary, secondary: secondary}
+	} else if e.active(relation) != -1 {
+		return
+	} else {
+		e = e.clone()
+	}
+	e.relations = append(e.relations, graphRelation{label: relation, start: int64(unix.Now().NanoElapsed())})
+	err = g.save(id, e)
+	return
+}
+func (g *Graph) RemoveEdge(primary, secondary [16]byte, relation protocol.GraphRelationLabel) (err protocol.Error) {
+	g.sync.Lock()
+	defer g.sync.Unlock()
+
+	var id = graphEdgeID(primary, secondary)
+	var e = g.edges[id]
+	if e == nil {
+		return &ErrNotExist
+	}
+	var i = e.active(relation)
+	if i == -1 {
+		return &ErrNotExist
+	}
+	e = e.clone()
+	e.relations[i].end = int64(unix.Now().NanoElapsed())
+	err = g.save(id, e)
+	return
+}
+func (g *Graph) Relations(primary, secondary [16]byte) (relations []protocol.GraphRelationLabel, err protocol.Error) {
+	g.sync.RLock()
+	var e = g.edges[graphEdgeID(primary, secondary)]
+	if e != nil {
+		for _, r := range e.relations {
+			if r.end == 0 {
+				relations = append(relations, r.label)
+			}
+		}
+	}
+	g.sync.RUnlock()
+	return
+}
+func (g *Graph) NeighborNumbers(node [16]byte, relation protocol.GraphRelationLabel, direction protocol.GraphDirection) (num uint64, err protocol.Error) {
+	g.sync.RLock()
+	num = uint64(len(g.neighbors(node, relation, direction, 0, true)))
+	g.sync.RUnlock()
+	return
+}
+func (g *Graph) Neighbors(node [16]byte, relation protocol.GraphRelationLabel, direction protocol.GraphDirection, offset, limit uint64) (nodes [][16]byte, err protocol.Error) {
+	g.sync.RLock()
+	nodes = g.neighbors(node, relation, direction, 0, true)
+	g.sync.RUnlock()
+	var start, end = pageRange(uint64(len(nodes)), offset, limit)
+	nodes = nodes[start:end]
+	return
+}
+func (g *Graph) NeighborsAt(node [16]byte, relation protocol.GraphRelationLabel, direction protocol.GraphDirection, at protocol.Time, offset, limit uint64) (nodes [][16]byte, err protocol.Error) {
+	var atNano int64
+	atNano, err = unixNano(at)
+	if err != nil {
+		return
+	}
+	g.sync.RLock()
+	nodes = g.neighbors(node, relation, direction, atNano, false)
+	g.sync.RUnlock()
+	var start, end = pageRange(uint64(len(nodes)), offset, limit)
+	nodes = nodes[start:end]
+	return
+}
+func (g *Graph) History(primary, secondary [16]byte, relation protocol.GraphRelationLabel) (history []protocol.GraphRelation, err protocol.Error) {
+	g.sync.RLock()
+	defer g.sync.RUnlock()
+
+	var e = g.edges[graphEdgeID(primary, secondary)]
+	if e == nil {
+		err = &ErrNotExist
+		return
+	}
+	for i := range e.relations {
+		var r = &e.relations[i]
+		if r.label == relation {
+			history = append(history, newGraphRelation(e, r))
+		}
+	}
+	return
+}
+
+// neighbors return sorted unique nodes that has the relation with node at the given time, or now if now is true.
+// Caller must hold the lock.
+func (g *Graph) neighbors(node [16]byte, relation protocol.GraphRelationLabel, direction protocol.GraphDirection, at int64, now bool) (nodes [][16]byte) {
+	for _, e := range g.nodes[node] {
+		if !e.activeAt(relation, at, now) {
+			continue
+		}
+		if e.primary == node && direction != protocol.GraphDirection_Incoming {
+			nodes = append(nodes, e.secondary)
+		}
+		if e.secondary == node && direction != protocol.GraphDirection_Outgoing {
+			nodes = append(nodes, e.primary)
+		}
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return bytes.Compare(nodes[i][:], nodes[j][:]) < 0 })
+	// Remove duplicates e.g. when both A->B and B->A edges exist.
+	var unique = nodes[:0]
+	for i, n := range nodes {
+		if i == 0 || n != nodes[i-1] {
+			unique = append(unique, n)
+		}
+	}
+	return unique
+}
+
+// save store the edge record and then replace it in memory. Caller must hold the lock.
+func (g *Graph) save(id [16]byte, e *graphEdge) (err protocol.Error) {
+	err = g.records.Save(g.mt, id, e.encode(), protocol.StorageRecord_SaveOptions{MaxVersion: protocol.StorageRecord_NoVersion})
+	if err != nil {
+		return
+	}
+	g.put(id, e)
+	return
+}
+
+// put add or replace the edge in memory. Caller must hold the lock.
+func (g *Graph) put(id [16]byte, e *graphEdge) {
+	var old = g.edges[id]
+	g.edges[id] = e
+	if old == nil {
+		g.nodes[e.primary] = append(g.nodes[e.primary], e)
+		if e.secondary != e.primary {
+			g.nodes[e.secondary] = append(g.nodes[e.secondary], e)
+		}
+		return
+	}
+	g.replace(e.primary, old, e)
+	g.replace(e.secondary, old, e)
+}
+
+func (g *Graph) replace(node [16]byte, old, e *graphEdge) {
+	var edges = g.nodes[node]
+	for i := range edges {
+		if edges[i] == old {
+			edges[i] = e
+			return
+		}
+	}
+}
@@ -0,0 +1,75 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"testing"
+
+	"libgo/protocol"
+	"libgo/time/monotonic"
+	"libgo/time/unix"
+)
+
+var _ protocol.StorageGraph = &Graph{}
+
+func TestGraph(t *testing.T) {
+	var records RecordsMemory
+	records.Init()
+	var g Graph
+	g.Init(&records, 0)
+
+	var alice, bob, carol, tehran = [16]byte{1}, [16]byte{2}, [16]byte{3}, [16]byte{4}
+	g.AddEdge(alice, bob, protocol.GraphRelationLabel_Knowns)
+	g.AddEdge(carol, alice, protocol.GraphRelationLabel_Knowns)
+	g.AddEdge(alice, tehran, protocol.GraphRelationLabel_LivesIn)
+	g.AddEdge(bob, tehran, protocol.GraphRelationLabel_LivesIn)
+
+	var nodes, _ = g.Neighbors(alice, protocol.GraphRelationLabel_Knowns, protocol.GraphDirection_Both, 0, 10)
+	if len(nodes) != 2 || nodes[0] != bob || nodes[1] != carol {
+		t.Errorf("Neighbors() = %x, want [bob carol]", nodes)
+	}
+	nodes, _ = g.Neighbors(tehran, protocol.GraphRelationLabel_LivesIn, protocol.GraphDirection_Incoming, 0, 10)
+	if len(nodes) != 2 {
+		t.Errorf("Neighbors() incoming = %x, want [alice bob]", nodes)
+	}
+	if num, _ := g.NeighborNumbers(alice, protocol.GraphRelationLabel_Unset, protocol.GraphDirection_Outgoing); num != 2 {
+		t.Errorf("NeighborNumbers() = %d, want 2", num)
+	}
+
+	var before = unix.Now()
+	if err := g.RemoveEdge(alice, bob, protocol.GraphRelationLabel_Knowns); err != nil {
+		t.Fatalf("RemoveEdge() error = %v", err)
+	}
+	nodes, _ = g.Neighbors(alice, protocol.GraphRelationLabel_Knowns, protocol.GraphDirection_Outgoing, 0, 10)
+	if len(nodes) != 0 {
+		t.Errorf("Neighbors() = %x after RemoveEdge(), want none", nodes)
+	}
+	nodes, _ = g.NeighborsAt(alice, protocol.GraphRelationLabel_Knowns, protocol.GraphDirection_Outgoing, &before, 0, 10)
+	if len(nodes) != 1 || nodes[0] != bob {
+		t.Errorf("NeighborsAt() = %x, want [bob]", nodes)
+	}
+	var epoch unix.Time
+	nodes, _ = g.NeighborsAt(alice, protocol.GraphRelationLabel_Knowns, protocol.GraphDirection_Outgoing, &epoch, 0, 10)
+	if len(nodes) != 0 {
+		t.Errorf("NeighborsAt() the unix epoch = %x, want none", nodes)
+	}
+	var mono = monotonic.Now()
+	if _, err := g.NeighborsAt(alice, protocol.GraphRelationLabel_Knowns, protocol.GraphDirection_Outgoing, &mono, 0, 10); err != &ErrTimeEpoch {
+		t.Errorf("NeighborsAt() monotonic time error = %v, want ErrTimeEpoch", err)
+	}
+
+	g.AddEdge(alice, bob, protocol.GraphRelationLabel_Knowns)
+	var history, _ = g.History(alice, bob, protocol.GraphRelationLabel_Knowns)
+	if len(history) != 2 || history[0].End() == nil || history[1].End() != nil {
+		t.Errorf("History() = %v, want one ended and one active period", history)
+	}
+
+	var recovered Graph
+	if err := recovered.Init(&records, 0); err != nil {
+		t.Fatalf("recover Init() error = %v", err)
+	}
+	var relations, _ = recovered.Relations(alice, bob)
+	if len(relations) != 1 || relations[0] != protocol.GraphRelationLabel_Knowns {
+		t.Errorf("recovered Relations() = %v, want [Knowns]", relations)
+	}
+}
@@ -0,0 +1,103 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/protocol"
+)
+
+// kvBatch queue changes of any protocol.StorageKeyValue_Batch implementation.
+// Implementations embed it and just implement Commit().
+type kvBatch struct {
+	ops    []kvBatchOperation
+	closed bool
+}
+
+type kvBatchOperation struct {
+	kind    batchOperation
+	key     string
+	value   []byte
+	options protocol.StorageKeyValue_SaveOptions
+}
+
+//libgo:impl libgo/protocol.StorageKeyValue_Batch
+func (b *kvBatch) Set(key []byte, value []byte, options protocol.StorageKeyValue_SaveOptions) (err protocol.Error) {
+	err = b.add(kvBatchOperation{batchOperation_Set, string(key), cloneBytes(value), options})
+	return
+}
+func (b *kvBatch) Delete(key []byte) (err protocol.Error) {
+	err = b.add(kvBatchOperation{kind: batchOperation_Delete, key: string(key)})
+	return
+}
+func (b *kvBatch) Erase(key []byte) (err protocol.Error) {
+	err = b.add(kvBatchOperation{kind: batchOperation_Erase, key: string(key)})
+	return
+}
+
+//libgo:impl libgo/protocol.StorageBatch
+func (b *kvBatch) Discard() {
+	b.closed = true
+	b.ops = nil
+}
+
+func (b *kvBatch) add(op kvBatchOperation) (err protocol.Error) {
+	if b.closed {
+		return &ErrBatchClosed
+	}
+	b.ops = append(b.ops, op)
+	return
+}
+
+// replay queue all operations on the given batch.
+func (b *kvBatch) replay(to protocol.StorageKeyValue_Batch) (err protocol.Error) {
+	for _, op := range b.ops {
+		switch op.kind {
+		case batchOperation_Set:
+			err = to.Set([]byte(op.key), op.value, op.options)
+		case batchOperation_Delete:
+			err = to.Delete([]byte(op.key))
+		case batchOperation_Erase:
+			err = to.Erase([]byte(op.key))
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// close mark the batch as committed and return error if it closed before.
+func (b *kvBatch) close() (err protocol.Error) {
+	if b.closed {
+		return &ErrBatchClosed
+	}
+	b.closed = true
+	return
+}
+
+// check simulate all operations on current store state without change it.
+// state must report the key exist and is locked in the store, and caller must hold the store lock.
+func (b *kvBatch) check(state func(k string) (live, locked bool)) (err protocol.Error) {
+	// exist track keys that changed by earlier operations in the batch.
+	var exist = make(map[string]bool, len(b.ops))
+	for _, op := range b.ops {
+		var live, locked = state(op.key)
+		if live && locked {
+			return &ErrKeyLocked
+		}
+		if e, ok := exist[op.key]; ok {
+			live = e
+		}
+
+		switch op.kind {
+		case batchOperation_Set:
+			exist[op.key] = true
+		case batchOperation_Delete, batchOperation_Erase:
+			if !live {
+				return &ErrNotExist
+			}
+			exist[op.key] = false
+		}
+	}
+	return
+}
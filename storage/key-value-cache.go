@@ -0,0 +1,150 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/protocol"
+)
+
+// KeyValueCache wrap a protocol.StorageKeyValue to serve repeated reads from a Cache.
+// Values that set with TTL never cache by writes, use Cache.MaxAge to bound staleness of values that cache by reads.
+type KeyValueCache struct {
+	Mode CacheMode
+
+	cache  *Cache
+	source protocol.StorageKeyValue
+	ns     string
+}
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (kc *KeyValueCache) Init(cache *Cache, source protocol.StorageKeyValue) (err protocol.Error) {
+	kc.cache = cache
+	kc.source = source
+	kc.ns = cache.namespace()
+	return
+}
+func (kc *KeyValueCache) Deinit() (err protocol.Error) { return }
+
+// Source return the wrapped storage.
+func (kc *KeyValueCache) Source() protocol.StorageKeyValue { return kc.source }
+
+//libgo:impl libgo/protocol.StorageKeyValue
+func (kc *KeyValueCache) KeyNumbers() (num uint64, err protocol.Error) {
+	return kc.source.KeyNumbers()
+}
+func (kc *KeyValueCache) ListKeys(offset, limit uint64) (keys [][]byte, err protocol.Error) {
+	return kc.source.ListKeys(offset, limit)
+}
+
+// Scan always read from the source, so scanned values never fill the cache.
+func (kc *KeyValueCache) Scan(start, end []byte, options protocol.StorageKeyValue_ScanOptions, iterator protocol.Iterate_KV[[]byte]) (err protocol.Error) {
+	return kc.source.Scan(start, end, options, iterator)
+}
+func (kc *KeyValueCache) ScanPrefix(prefix []byte, options protocol.StorageKeyValue_ScanOptions, iterator protocol.Iterate_KV[[]byte]) (err protocol.Error) {
+	return kc.source.ScanPrefix(prefix, options, iterator)
+}
+func (kc *KeyValueCache) Lock(key []byte) (value []byte, err protocol.Error) {
+	return kc.source.Lock(key)
+}
+func (kc *KeyValueCache) Unlock(key []byte, value []byte) (err protocol.Error) {
+	err = kc.source.Unlock(key, value)
+	kc.cache.invalidate(kc.group(key))
+	return
+}
+func (kc *KeyValueCache) Length(key []byte) (ln int, err protocol.Error) {
+	var value, _, ok = kc.cache.get(kc.group(key), "")
+	if ok {
+		ln = len(value)
+		return
+	}
+	return kc.source.Length(key)
+}
+func (kc *KeyValueCache) Get(key []byte) (value []byte, err protocol.Error) {
+	var group = kc.group(key)
+	var cached, _, ok = kc.cache.get(group, "")
+	if ok {
+		value = cloneBytes(cached)
+		return
+	}
+
+	var ticket = kc.cache.ticket()
+	value, err = kc.source.Get(key)
+	if err == nil {
+		kc.cache.fill(ticket, group, "", cloneBytes(value), 0)
+	}
+	return
+}
+func (kc *KeyValueCache) Set(key []byte, value []byte, options protocol.StorageKeyValue_SaveOptions) (err protocol.Error) {
+	err = kc.source.Set(key, value, options)
+	if err == nil && kc.Mode == CacheMode_WriteThrough && options.TTL == 0 {
+		kc.cache.put(kc.group(key), "", cloneBytes(value), 0)
+	} else {
+		kc.cache.invalidate(kc.group(key))
+	}
+	return
+}
+func (kc *KeyValueCache) Delete(key []byte) (err protocol.Error) {
+	err = kc.source.Delete(key)
+	kc.cache.invalidate(kc.group(key))
+	return
+}
+func (kc *KeyValueCache) Erase(key []byte) (err protocol.Error) {
+	err = kc.source.Erase(key)
+	kc.cache.invalidate(kc.group(key))
+	return
+}
+func (kc *KeyValueCache) Batch() (batch protocol.StorageKeyValue_Batch, err protocol.Error) {
+	var sb protocol.StorageKeyValue_Batch
+	sb, err = kc.source.Batch()
+	if err != nil {
+		return
+	}
+	batch = &keyValueCacheBatch{kc: kc, batch: sb}
+	return
+}
+
+func (kc *KeyValueCache) group(key []byte) string { return kc.ns + string(key) }
+
+// keyValueCacheBatch forward changes to the source batch and drop changed keys from the cache after Commit().
+type keyValueCacheBatch struct {
+	kc     *KeyValueCache
+	batch  protocol.StorageKeyValue_Batch
+	groups []string
+}
+
+//libgo:impl libgo/protocol.StorageKeyValue_Batch
+func (b *keyValueCacheBatch) Set(key []byte, value []byte, options protocol.StorageKeyValue_SaveOptions) (err protocol.Error) {
+	err = b.batch.Set(key, value, options)
+	b.changed(key, err)
+	return
+}
+func (b *keyValueCacheBatch) Delete(key []byte) (err protocol.Error) {
+	err = b.batch.Delete(key)
+	b.changed(key, err)
+	return
+}
+func (b *keyValueCacheBatch) Erase(key []byte) (err protocol.Error) {
+	err = b.batch.Erase(key)
+	b.changed(key, err)
+	return
+}
+
+//libgo:impl libgo/protocol.StorageBatch
+func (b *keyValueCacheBatch) Commit() (err protocol.Error) {
+	err = b.batch.Commit()
+	for _, group := range b.groups {
+		b.kc.cache.invalidate(group)
+	}
+	b.groups = nil
+	return
+}
+func (b *keyValueCacheBatch) Discard() {
+	b.batch.Discard()
+	b.groups = nil
+}
+
+func (b *keyValueCacheBatch) changed(key []byte, err protocol.Error) {
+	if err == nil {
+		b.groups = append(b.groups, b.kc.group(key))
+	}
+}
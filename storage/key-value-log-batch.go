@@ -0,0 +1,91 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/protocol"
+	"libgo/time/monotonic"
+	"libgo/time/unix"
+)
+
+// keyValueLogBatch implement protocol.StorageKeyValue_Batch for KeyValueLog.
+// All changes append to the log as batched records and one commit record in one write,
+// so replay apply all of them or none of them.
+type keyValueLogBatch struct {
+	kv *KeyValueLog
+	kvBatch
+}
+
+//libgo:impl libgo/protocol.StorageBatch
+func (b *keyValueLogBatch) Commit() (err protocol.Error) {
+	err = b.close()
+	if err != nil {
+		return
+	}
+	for _, op := range b.ops {
+		if len(op.key) > logRecordMaxKeyLen {
+			return &ErrKeyTooLong
+		}
+	}
+
+	var kv = b.kv
+	var now = int64(unix.Now().NanoElapsed())
+	kv.sync.Lock()
+	defer kv.sync.Unlock()
+
+	err = b.check(func(k string) (live, locked bool) {
+		var entry = kv.entries[k]
+		live = entry != nil && !entry.expired(now)
+		return live, live && kv.leases.locked(k, monotonic.Now())
+	})
+	if err != nil {
+		return
+	}
+
+	var records = make([]logRecord, len(b.ops))
+	var buf []byte
+	for i, op := range b.ops {
+		var r = &records[i]
+		r.generation = kv.header.generation
+		r.key = []byte(op.key)
+		if op.kind == batchOperation_Set {
+			r.kind = logRecordKind_Set | logRecordKind_Batched
+			r.value = op.value
+			if op.options.TTL > 0 {
+				r.expire = now + int64(op.options.TTL)
+			}
+		} else {
+			r.kind = logRecordKind_Delete | logRecordKind_Batched
+		}
+		buf = r.encode(buf)
+	}
+	var commit = logRecord{generation: kv.header.generation, kind: logRecordKind_Commit}
+	buf = commit.encode(buf)
+
+	var offset int
+	offset, err = kv.append(buf)
+	if err != nil {
+		return
+	}
+	kv.garbage += commit.len()
+
+	for i, op := range b.ops {
+		var r = &records[i]
+		r.kind &^= logRecordKind_Batched
+		switch op.kind {
+		case batchOperation_Set:
+			kv.index(r, offset+logRecordHeaderLen+len(r.key))
+		case batchOperation_Delete, batchOperation_Erase:
+			kv.garbage += r.len()
+			err = kv.remove(op.key, op.kind == batchOperation_Erase)
+			if err != nil {
+				// Batch is durable in the log, so just the erase of old value failed.
+				return
+			}
+		}
+		offset += r.len()
+	}
+	b.ops = nil
+	err = kv.afterWrite()
+	return
+}
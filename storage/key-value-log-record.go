@@ -0,0 +1,159 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"hash/crc32"
+
+	"libgo/binary"
+	"libgo/protocol"
+)
+
+/*
+Each record in the log has below layout, all numbers in little-endian:
+| checksum(4) | value checksum(4) | generation(4) | kind(1) | key length(2) | value length(4) | expire(8) | key | value |
+
+  - checksum covers generation to the end of the key, so a torn write or stale data of other generation stop the log replay.
+  - value checksum covers just the value, so Erase() can write zero to the value location without break the log.
+    A record with bad value checksum skips in replay, because it is torn at the end of the log or its value erased.
+*/
+const (
+	logRecordHeaderLen = 27
+	logRecordMaxKeyLen = 1<<16 - 1
+)
+
+type logRecordKind uint8
+
+const (
+	logRecordKind_Unset logRecordKind = iota
+	logRecordKind_Set
+	logRecordKind_Delete
+	// logRecordKind_Commit close a batch and make all batched records before it visible.
+	logRecordKind_Commit
+
+	// logRecordKind_Batched flag records that must not apply until a logRecordKind_Commit record.
+	logRecordKind_Batched logRecordKind = 0x80
+)
+
+type logRecord struct {
+	generation uint32
+	kind       logRecordKind
+	expire     int64 // unix nano, 0 means no TTL
+	key        []byte
+	value      []byte
+}
+
+func (r *logRecord) len() int { return logRecordHeaderLen + len(r.key) + len(r.value) }
+
+// encode append encoded record to buf and return it.
+func (r *logRecord) encode(buf []byte) []byte {
+	var start = len(buf)
+	var ln = r.len()
+	buf = append(buf, make([]byte, ln)...)
+	var rec = buf[start:]
+
+	binary.LittleEndian(rec[8:]).PutUint32(r.generation)
+	rec[12] = byte(r.kind)
+	binary.LittleEndian(rec[13:]).PutUint16(uint16(len(r.key)))
+	binary.LittleEndian(rec[15:]).PutUint32(uint32(len(r.value)))
+	binary.LittleEndian(rec[19:]).PutUint64(uint64(r.expire))
+	copy(rec[logRecordHeaderLen:], r.key)
+	copy(rec[logRecordHeaderLen+len(r.key):], r.value)
+
+	binary.LittleEndian(rec[0:]).PutUint32(crc32.ChecksumIEEE(rec[8 : logRecordHeaderLen+len(r.key)]))
+	binary.LittleEndian(rec[4:]).PutUint32(crc32.ChecksumIEEE(r.value))
+	return buf
+}
+
+// logRecordReader read records one by one from a protocol.StorageBlock.
+type logRecordReader struct {
+	block      protocol.StorageBlock
+	generation uint32
+	offset     int
+	header     [logRecordHeaderLen]byte
+}
+
+// next read the record at reader offset and move the offset to the next record.
+// - ok is false if no valid record exist at the offset, that means end of the log.
+// - valueOK is false if the value is torn or erased.
+func (rr *logRecordReader) next() (r logRecord, valueOffset int, ok, valueOK bool) {
+	var cap = rr.block.Cap()
+	if rr.offset+logRecordHeaderLen > cap {
+		return
+	}
+	var err = rr.block.Read(rr.offset, rr.header[:])
+	if err != nil {
+		return
+	}
+	var hdr = rr.header[:]
+	var keyLen = int(binary.LittleEndian(hdr[13:]).Uint16())
+	var valueLen = int(binary.LittleEndian(hdr[15:]).Uint32())
+	var recordLen = logRecordHeaderLen + keyLen + valueLen
+	if rr.offset+recordLen > cap || recordLen < logRecordHeaderLen {
+		return
+	}
+
+	r.generation = binary.LittleEndian(hdr[8:]).Uint32()
+	if r.generation != rr.generation {
+		return
+	}
+	r.kind = logRecordKind(hdr[12])
+	r.expire = int64(binary.LittleEndian(hdr[19:]).Uint64())
+	r.key = make([]byte, keyLen)
+	err = rr.block.Read(rr.offset+logRecordHeaderLen, r.key)
+	if err != nil {
+		return
+	}
+	var checksum = crc32.Update(crc32.ChecksumIEEE(hdr[8:]), crc32.IEEETable, r.key)
+	if checksum != binary.LittleEndian(hdr[0:]).Uint32() {
+		return
+	}
+
+	ok = true
+	valueOffset = rr.offset + logRecordHeaderLen + keyLen
+	r.value = make([]byte, valueLen)
+	err = rr.block.Read(valueOffset, r.value)
+	valueOK = err == nil && crc32.ChecksumIEEE(r.value) == binary.LittleEndian(hdr[4:]).Uint32()
+	rr.offset += recordLen
+	return
+}
+
+/*
+Each header slot has below layout, all numbers in little-endian:
+| magic(4) | checksum(4) | sequence(8) | generation(4) | start(8) |
+
+Two slots exist at start of the block and update in turn, so a torn header write never lose the last valid one.
+*/
+const (
+	logHeaderLen     = 28
+	logHeaderSlotLen = 64
+	logDataStart     = 4096
+)
+
+var logHeaderMagic = [4]byte{'L', 'G', 'K', 'V'}
+
+type logHeader struct {
+	sequence   uint64
+	generation uint32
+	start      int
+}
+
+func (h *logHeader) encode() (buf []byte) {
+	buf = make([]byte, logHeaderLen)
+	copy(buf, logHeaderMagic[:])
+	binary.LittleEndian(buf[8:]).PutUint64(h.sequence)
+	binary.LittleEndian(buf[16:]).PutUint32(h.generation)
+	binary.LittleEndian(buf[20:]).PutUint64(uint64(h.start))
+	binary.LittleEndian(buf[4:]).PutUint32(crc32.ChecksumIEEE(buf[8:]))
+	return
+}
+
+func (h *logHeader) decode(buf []byte) (ok bool) {
+	if [4]byte(buf[:4]) != logHeaderMagic || crc32.ChecksumIEEE(buf[8:logHeaderLen]) != binary.LittleEndian(buf[4:]).Uint32() {
+		return false
+	}
+	h.sequence = binary.LittleEndian(buf[8:]).Uint64()
+	h.generation = binary.LittleEndian(buf[16:]).Uint32()
+	h.start = int(binary.LittleEndian(buf[20:]).Uint64())
+	return true
+}
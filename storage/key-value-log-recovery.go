@@ -0,0 +1,212 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/protocol"
+	"libgo/time/monotonic"
+	"libgo/time/unix"
+)
+
+// readHeader load the last valid header slot. found is false if the block is not formatted yet.
+// Caller must hold the lock or call it before any other method.
+func (kv *KeyValueLog) readHeader() (found bool, err protocol.Error) {
+	if kv.block.Cap() < logDataStart {
+		return
+	}
+	var buf [2 * logHeaderSlotLen]byte
+	err = kv.block.Read(0, buf[:])
+	if err != nil {
+		return
+	}
+
+	var empty = true
+	for slot := 0; slot < 2; slot++ {
+		var slotBuf = buf[slot*logHeaderSlotLen : (slot+1)*logHeaderSlotLen]
+		var h logHeader
+		if h.decode(slotBuf) {
+			if !found || h.sequence > kv.header.sequence {
+				kv.header = h
+			}
+			found = true
+		}
+		for _, b := range slotBuf {
+			if b != 0 {
+				empty = false
+				break
+			}
+		}
+	}
+	if !found && !empty {
+		err = &ErrCorrupted
+	}
+	return
+}
+
+// writeHeader write the header in the slot that not hold the last valid header and flush the block.
+// Caller must hold the lock.
+func (kv *KeyValueLog) writeHeader(h logHeader) (err protocol.Error) {
+	h.sequence = kv.header.sequence + 1
+	var slot = int(h.sequence % 2)
+	err = kv.block.Write(slot*logHeaderSlotLen, h.encode())
+	if err != nil {
+		return
+	}
+	err = kv.block.Flush()
+	if err != nil {
+		return
+	}
+	kv.header = h
+	return
+}
+
+// replay rebuild the index by read the log from the header start to the first invalid record.
+// Batched records apply just if their commit record exist, so a torn batch drop completely.
+// Caller must hold the lock or call it before any other method.
+func (kv *KeyValueLog) replay() (err protocol.Error) {
+	var now = int64(unix.Now().NanoElapsed())
+	var rr = logRecordReader{
+		block:      kv.block,
+		generation: kv.header.generation,
+		offset:     kv.header.start,
+	}
+	var batched []logReplayItem
+	kv.tail = rr.offset
+loop:
+	for {
+		var recordOffset = rr.offset
+		var r, valueOffset, ok, valueOK = rr.next()
+		if !ok {
+			break loop
+		}
+
+		var item = logReplayItem{r, valueOffset, valueOK}
+		switch {
+		case r.kind == logRecordKind_Commit:
+			for _, bi := range batched {
+				kv.replayItem(bi, now)
+			}
+			kv.garbage += r.len()
+			batched = batched[:0]
+		case r.kind&logRecordKind_Batched != 0:
+			item.r.kind &^= logRecordKind_Batched
+			batched = append(batched, item)
+			continue
+		default:
+			if len(batched) > 0 {
+				// Uncommitted batch follow by a normal record must not happen, so log is not trusted anymore from the batch start.
+				break loop
+			}
+			kv.replayItem(item, now)
+		}
+		kv.tail = recordOffset + r.len()
+	}
+	// Records after the tail (e.g. a torn batch) will overwrite by next append.
+	return
+}
+
+type logReplayItem struct {
+	r           logRecord
+	valueOffset int
+	valueOK     bool
+}
+
+func (kv *KeyValueLog) replayItem(item logReplayItem, now int64) {
+	var k = string(item.r.key)
+	switch item.r.kind {
+	case logRecordKind_Set:
+		if !item.valueOK {
+			// Value torn at the end of the log or erased, so the record is just garbage.
+			// Don't drop the committed value before it, Erase() write a delete record before it write zero data.
+			kv.garbage += item.r.len()
+			return
+		}
+		if item.r.expire != 0 && now > item.r.expire {
+			// Expired overwrite, so the key expired too.
+			kv.garbage += item.r.len()
+			if kv.entries[k] != nil {
+				kv.drop(k)
+			}
+			return
+		}
+		kv.index(&item.r, item.valueOffset)
+	case logRecordKind_Delete:
+		kv.garbage += item.r.len()
+		if kv.entries[k] != nil {
+			kv.drop(k)
+		}
+	}
+}
+
+// compact write all live records as a new generation, switch the header to it and erase the old generation.
+// New generation write at start of the data area if old generation leaves enough space there, otherwise after the tail,
+// so the block size stays around two times of live data.
+// Caller must hold the lock.
+func (kv *KeyValueLog) compact() (err protocol.Error) {
+	err = kv.keepScans("", true)
+	if err != nil {
+		return
+	}
+	var now = int64(unix.Now().NanoElapsed())
+	var newHeader = logHeader{generation: kv.header.generation + 1}
+	var newStart = kv.tail
+	if kv.header.start-logDataStart >= kv.live {
+		newStart = logDataStart
+	}
+	newHeader.start = newStart
+
+	var offset = newStart
+	var buf []byte
+	var newValueOffsets = make(map[string]int, len(kv.entries))
+	var live int
+	for _, k := range kv.keys {
+		var entry = kv.entries[k]
+		if entry.expired(now) && !kv.leases.locked(k, monotonic.Now()) {
+			continue
+		}
+		var r = logRecord{generation: newHeader.generation, kind: logRecordKind_Set, expire: entry.expire, key: []byte(k)}
+		r.value, err = kv.read(entry)
+		if err != nil {
+			return
+		}
+		buf = r.encode(buf[:0])
+		err = kv.block.Write(offset, buf)
+		if err != nil {
+			return
+		}
+		newValueOffsets[k] = offset + logRecordHeaderLen + len(r.key)
+		offset += len(buf)
+		live += len(buf)
+	}
+	err = kv.block.Flush()
+	if err != nil {
+		return
+	}
+
+	var oldStart, oldTail = kv.header.start, kv.tail
+	err = kv.writeHeader(newHeader)
+	if err != nil {
+		return
+	}
+
+	for _, k := range append([]string(nil), kv.keys...) {
+		var valueOffset, ok = newValueOffsets[k]
+		if !ok {
+			kv.drop(k)
+			continue
+		}
+		kv.entries[k].valueOffset = valueOffset
+	}
+	kv.tail = offset
+	kv.live = live
+	kv.garbage = 0
+	kv.versions = make(map[string][]logValue)
+
+	// Old generation can't replay anymore, but erase it to remove any deleted or overwritten data from the device.
+	err = kv.block.Erase(oldStart, oldTail-oldStart)
+	if err != nil {
+		return
+	}
+	err = kv.block.Flush()
+	return
+}
@@ -0,0 +1,87 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/protocol"
+)
+
+// logScan is a snapshot of the keys in the range of an active KeyValueLog.Scan() and the value location of them.
+// Values read lazily from the block when the iterator reach them, so scan a broad range or break it early
+// don't load the whole range in RAM. The log never rewrite a value location in place, except compact() and Erase(),
+// so they read the values that are not iterated yet before rewrite their locations, to keep the snapshot.
+type logScan struct {
+	items []logScanItem
+}
+
+type logScanItem struct {
+	key   string
+	value logValue
+	data  []byte // value that read before its location rewrite
+	done  bool   // data is read or the item is iterated
+}
+
+// iterate call iterator with all items in the requested order until it return breaking.
+// It holds the store lock just to read each value, so iterator can call any method of the store.
+func (ls *logScan) iterate(kv *KeyValueLog, options protocol.StorageKeyValue_ScanOptions, iterator protocol.Iterate_KV[[]byte]) (err protocol.Error) {
+	var i, last, step = 0, len(ls.items), 1
+	if options.Reverse {
+		i, last, step = len(ls.items)-1, -1, -1
+	}
+	for ; i != last; i += step {
+		var value []byte
+		kv.sync.Lock()
+		value, err = ls.take(kv, i)
+		kv.sync.Unlock()
+		if err != nil {
+			return
+		}
+		if iterator.Iterate([]byte(ls.items[i].key), value) {
+			return
+		}
+	}
+	return
+}
+
+// take return the value of the item and mark it as iterated. Caller must hold the store lock.
+func (ls *logScan) take(kv *KeyValueLog, i int) (value []byte, err protocol.Error) {
+	var item = &ls.items[i]
+	if item.done {
+		value = item.data
+		item.data = nil
+		return
+	}
+	item.done = true
+	value = make([]byte, item.value.len)
+	err = kv.block.Read(item.value.offset, value)
+	return
+}
+
+// keep read the value of the items that are not iterated yet, of the key or all keys,
+// before their locations rewrite. Caller must hold the store lock.
+func (ls *logScan) keep(kv *KeyValueLog, k string, all bool) (err protocol.Error) {
+	for i := range ls.items {
+		var item = &ls.items[i]
+		if item.done || (!all && item.key != k) {
+			continue
+		}
+		item.data = make([]byte, item.value.len)
+		err = kv.block.Read(item.value.offset, item.data)
+		if err != nil {
+			return
+		}
+		item.done = true
+	}
+	return
+}
+
+// keepScans call keep() on all active scans. Caller must hold the store lock.
+func (kv *KeyValueLog) keepScans(k string, all bool) (err protocol.Error) {
+	for ls := range kv.scans {
+		err = ls.keep(kv, k, all)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
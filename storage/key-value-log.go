@@ -0,0 +1,492 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"sort"
+	"sync"
+
+	"libgo/protocol"
+	"libgo/time/monotonic"
+	"libgo/time/unix"
+)
+
+// KeyValueLog is a persistent log-structured implementation of protocol.StorageKeyValue on top of any protocol.StorageBlock.
+// - The log is the write-ahead log and the data file at the same time (like bitcask), so each change is just one append to the block.
+// - Index of all live keys keep in RAM and rebuild by replay the log in Init(), that recover the store after any crash.
+// - Compact() rewrite live records in a new generation and switch to it atomically by the header slots, then erase old generation.
+// - Expired keys remove lazily on read and never rewrite on compaction, so TTL don't need any timer here.
+// - Locks are leases that keep just in RAM and expire if their holders don't renew or release them, see leases.
+// - It is safe to call its methods concurrently.
+// https://riak.com/assets/bitcask-intro.pdf
+type KeyValueLog struct {
+	// SyncWrites force Flush() the block after each change, otherwise caller must call Flush() to make changes durable.
+	SyncWrites bool
+	// CompactRatio trigger Compact() automatically when garbage bytes reach CompactRatio times of live bytes.
+	// Zero means never, so caller must call Compact() manually.
+	CompactRatio uint
+
+	block protocol.StorageBlock
+
+	sync    sync.Mutex
+	header  logHeader
+	tail    int // end of the log, next record will write here
+	live    int // bytes of live records
+	garbage int // bytes of overwritten or deleted records
+	keys    []string
+	entries map[string]*logEntry
+	// versions keep the value location of overwritten and deleted set records of each key in the current generation,
+	// so Erase() write zero data to them without scan the log. It costs some bytes of RAM for each garbage record,
+	// and compaction clear it.
+	versions map[string][]logValue
+	scans    map[*logScan]struct{} // active scans that read values lazily
+	leases   leases
+}
+
+type logEntry struct {
+	size        int // record length in the log
+	valueOffset int
+	valueLen    int
+	expire      int64 // unix nano, 0 means no TTL
+}
+
+func (e *logEntry) expired(now int64) bool { return e.expire != 0 && now > e.expire }
+
+// logValue is the location of a value on the block.
+type logValue struct {
+	offset int
+	len    int
+}
+
+// Init open the store on given block and recover it by replay the log, or format the block if it is empty.
+//
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (kv *KeyValueLog) Init(block protocol.StorageBlock) (err protocol.Error) {
+	kv.block = block
+	kv.entries = make(map[string]*logEntry)
+	kv.versions = make(map[string][]logValue)
+	kv.scans = make(map[*logScan]struct{})
+	err = kv.leases.init(&kv.sync, &ErrKeyLocked, &ErrKeyNotLocked)
+	if err != nil {
+		return
+	}
+
+	var found bool
+	found, err = kv.readHeader()
+	if err != nil {
+		return
+	}
+	if !found {
+		kv.header = logHeader{generation: 1, start: logDataStart}
+		err = kv.writeHeader(kv.header)
+		if err != nil {
+			return
+		}
+		kv.tail = logDataStart
+		return
+	}
+	err = kv.replay()
+	return
+}
+func (kv *KeyValueLog) Deinit() (err protocol.Error) {
+	kv.sync.Lock()
+	err = kv.block.Flush()
+	var leasesErr = kv.leases.deinit()
+	if err == nil {
+		err = leasesErr
+	}
+	kv.keys = nil
+	kv.entries = nil
+	kv.versions = nil
+	kv.scans = nil
+	kv.sync.Unlock()
+	return
+}
+
+// Flush force the block to write any changes to the device.
+func (kv *KeyValueLog) Flush() (err protocol.Error) { return kv.block.Flush() }
+
+//libgo:impl libgo/protocol.StorageKeyValue
+func (kv *KeyValueLog) KeyNumbers() (num uint64, err protocol.Error) {
+	kv.sync.Lock()
+	num = uint64(len(kv.keys))
+	kv.sync.Unlock()
+	return
+}
+func (kv *KeyValueLog) ListKeys(offset, limit uint64) (keys [][]byte, err protocol.Error) {
+	kv.sync.Lock()
+	var ln = uint64(len(kv.keys))
+	if offset >= ln {
+		kv.sync.Unlock()
+		return
+	}
+	var end = offset + limit
+	if end > ln || end < offset {
+		end = ln
+	}
+	keys = make([][]byte, 0, end-offset)
+	for _, k := range kv.keys[offset:end] {
+		keys = append(keys, []byte(k))
+	}
+	kv.sync.Unlock()
+	return
+}
+
+// Scan iterate a snapshot of the range that take under the store lock and read each value lazily from the block,
+// so iterator can call any method of the store and break the scan early without read the rest of the range, see logScan.
+func (kv *KeyValueLog) Scan(start, end []byte, options protocol.StorageKeyValue_ScanOptions, iterator protocol.Iterate_KV[[]byte]) (err protocol.Error) {
+	var now = int64(unix.Now().NanoElapsed())
+	kv.sync.Lock()
+	var from, to = scanRange(kv.keys, start, end)
+	var scan = &logScan{items: make([]logScanItem, 0, to-from)}
+	for _, k := range kv.keys[from:to] {
+		var entry = kv.entries[k]
+		if entry.expired(now) {
+			continue
+		}
+		scan.items = append(scan.items, logScanItem{key: k, value: logValue{entry.valueOffset, entry.valueLen}})
+	}
+	kv.scans[scan] = struct{}{}
+	kv.sync.Unlock()
+
+	err = scan.iterate(kv, options, iterator)
+
+	kv.sync.Lock()
+	delete(kv.scans, scan)
+	kv.sync.Unlock()
+	return
+}
+func (kv *KeyValueLog) ScanPrefix(prefix []byte, options protocol.StorageKeyValue_ScanOptions, iterator protocol.Iterate_KV[[]byte]) (err protocol.Error) {
+	return kv.Scan(prefix, prefixEnd(prefix), options, iterator)
+}
+
+// Lock return the value of the key and prevent any other changes on it until Unlock() called.
+// The lock is a lease that expire after leases_DefaultTTL, so call Unlock() before it or use LockLease() instead.
+func (kv *KeyValueLog) Lock(key []byte) (value []byte, err protocol.Error) {
+	value, _, err = kv.lock(key, protocol.StorageLease_Options{}, true)
+	return
+}
+
+// Unlock store the value if it is not nil and release the lock get by Lock().
+// It return ErrLeaseOwner if the key is locked by LockLease().
+func (kv *KeyValueLog) Unlock(key []byte, value []byte) (err protocol.Error) {
+	err = kv.unlock(key, protocol.StorageLeaseToken{}, true, value)
+	return
+}
+
+// LockLease is like Lock() but can wait for the current holder as options says and return a random token
+// that just its holder can renew or release the lease by it.
+//
+//libgo:impl libgo/protocol.StorageKeyValue_Leases
+func (kv *KeyValueLog) LockLease(key []byte, options protocol.StorageLease_Options) (value []byte, token protocol.StorageLeaseToken, err protocol.Error) {
+	value, token, err = kv.lock(key, options, false)
+	return
+}
+func (kv *KeyValueLog) RenewLease(key []byte, token protocol.StorageLeaseToken, ttl protocol.Duration) (err protocol.Error) {
+	kv.sync.Lock()
+	_, err = kv.entry(key)
+	if err == nil {
+		err = kv.leases.renew(string(key), token, ttl)
+	}
+	kv.sync.Unlock()
+	return
+}
+func (kv *KeyValueLog) UnlockLease(key []byte, token protocol.StorageLeaseToken, value []byte) (err protocol.Error) {
+	err = kv.unlock(key, token, false, value)
+	return
+}
+
+// unlock store the value if it is not nil and release the lease of the token, or the lease of Lock() if plain is true.
+func (kv *KeyValueLog) unlock(key []byte, token protocol.StorageLeaseToken, plain bool, value []byte) (err protocol.Error) {
+	var k = string(key)
+	kv.sync.Lock()
+	if plain {
+		token = kv.leases.plainToken(k)
+	}
+	var entry = kv.entries[k]
+	if entry == nil {
+		err = &ErrNotExist
+	} else {
+		_, err = kv.leases.holder(k, token, monotonic.Now())
+	}
+	if err == nil && value != nil {
+		// Keep the TTL of the key as it was before the lock.
+		err = kv.set(k, value, entry.expire)
+		if err == nil {
+			err = kv.afterWrite()
+		}
+	}
+	if err == nil {
+		err = kv.leases.release(k, token)
+	}
+	kv.sync.Unlock()
+	return
+}
+
+func (kv *KeyValueLog) Length(key []byte) (ln int, err protocol.Error) {
+	kv.sync.Lock()
+	var entry *logEntry
+	entry, err = kv.entry(key)
+	if err == nil {
+		ln = entry.valueLen
+	}
+	kv.sync.Unlock()
+	return
+}
+func (kv *KeyValueLog) Get(key []byte) (value []byte, err protocol.Error) {
+	kv.sync.Lock()
+	var entry *logEntry
+	entry, err = kv.entry(key)
+	if err == nil {
+		value, err = kv.read(entry)
+	}
+	kv.sync.Unlock()
+	return
+}
+
+// TTL return the remaining time to live of the key. A key that expired while it is locked has 1ns TTL.
+//
+//libgo:impl libgo/protocol.StorageKeyValue_Expiration
+func (kv *KeyValueLog) TTL(key []byte) (ttl protocol.Duration, err protocol.Error) {
+	kv.sync.Lock()
+	var entry *logEntry
+	entry, err = kv.entry(key)
+	if err == nil && entry.expire != 0 {
+		ttl = protocol.Duration(entry.expire - int64(unix.Now().NanoElapsed()))
+		if ttl < 1 {
+			ttl = 1
+		}
+	}
+	kv.sync.Unlock()
+	return
+}
+
+// Set append a new record for the key. options.TTL > 0 make the key expire after given duration.
+func (kv *KeyValueLog) Set(key []byte, value []byte, options protocol.StorageKeyValue_SaveOptions) (err protocol.Error) {
+	if len(key) > logRecordMaxKeyLen {
+		return &ErrKeyTooLong
+	}
+	kv.sync.Lock()
+	var entry, _ = kv.entry(key)
+	if entry != nil && kv.leases.locked(string(key), monotonic.Now()) {
+		err = &ErrKeyLocked
+	} else {
+		var expire int64
+		if options.TTL > 0 {
+			expire = int64(unix.Now().NanoElapsed()) + int64(options.TTL)
+		}
+		err = kv.set(string(key), value, expire)
+		if err == nil {
+			err = kv.afterWrite()
+		}
+	}
+	kv.sync.Unlock()
+	return
+}
+
+// Delete append a tombstone record for the key. Old value remain on the block until next compaction.
+func (kv *KeyValueLog) Delete(key []byte) (err protocol.Error) {
+	err = kv.delete(key, false)
+	return
+}
+
+// Erase append a tombstone record for the key and write zero data to the value location of all its versions on the block.
+func (kv *KeyValueLog) Erase(key []byte) (err protocol.Error) {
+	err = kv.delete(key, true)
+	return
+}
+
+// Batch return a new batch that apply its changes on the store all-or-nothing even on crash.
+func (kv *KeyValueLog) Batch() (batch protocol.StorageKeyValue_Batch, err protocol.Error) {
+	batch = &keyValueLogBatch{kv: kv}
+	return
+}
+
+// Compact rewrite all live records as a new generation and erase the old one.
+// It blocks all other methods until done.
+func (kv *KeyValueLog) Compact() (err protocol.Error) {
+	kv.sync.Lock()
+	err = kv.compact()
+	kv.sync.Unlock()
+	return
+}
+
+// lock get a lease on the live key and return its value.
+func (kv *KeyValueLog) lock(key []byte, options protocol.StorageLease_Options, plain bool) (value []byte, token protocol.StorageLeaseToken, err protocol.Error) {
+	kv.sync.Lock()
+	_, err = kv.entry(key)
+	if err == nil {
+		token, err = kv.leases.acquire(string(key), options, plain)
+	}
+	// The key can be deleted by the holder that acquire() waited for.
+	if err == nil {
+		var entry *logEntry
+		entry, err = kv.entry(key)
+		if err == nil {
+			value, err = kv.read(entry)
+		}
+		if err != nil {
+			kv.leases.release(string(key), token)
+		}
+	}
+	kv.sync.Unlock()
+	return
+}
+
+func (kv *KeyValueLog) delete(key []byte, erase bool) (err protocol.Error) {
+	kv.sync.Lock()
+	_, err = kv.entry(key)
+	if err == nil {
+		if kv.leases.locked(string(key), monotonic.Now()) {
+			err = &ErrKeyLocked
+		} else {
+			var r = logRecord{generation: kv.header.generation, kind: logRecordKind_Delete, key: key}
+			_, err = kv.append(r.encode(nil))
+			if err == nil {
+				kv.garbage += r.len()
+				err = kv.remove(string(key), erase)
+			}
+			if err == nil {
+				err = kv.afterWrite()
+			}
+		}
+	}
+	kv.sync.Unlock()
+	return
+}
+
+// entry return the live entry of the key. Caller must hold the lock.
+func (kv *KeyValueLog) entry(key []byte) (entry *logEntry, err protocol.Error) {
+	entry = kv.entries[string(key)]
+	if entry != nil && !kv.leases.locked(string(key), monotonic.Now()) && entry.expired(int64(unix.Now().NanoElapsed())) {
+		kv.drop(string(key))
+		entry = nil
+	}
+	if entry == nil {
+		err = &ErrNotExist
+	}
+	return
+}
+
+// read return the value of the entry from the block. Caller must hold the lock.
+func (kv *KeyValueLog) read(entry *logEntry) (value []byte, err protocol.Error) {
+	value = make([]byte, entry.valueLen)
+	err = kv.block.Read(entry.valueOffset, value)
+	return
+}
+
+// set append a set record and index it. expire is in unix nano and 0 means no TTL.
+// Caller must hold the lock.
+func (kv *KeyValueLog) set(k string, value []byte, expire int64) (err protocol.Error) {
+	var r = logRecord{generation: kv.header.generation, kind: logRecordKind_Set, expire: expire, key: []byte(k), value: value}
+	var offset int
+	offset, err = kv.append(r.encode(nil))
+	if err != nil {
+		return
+	}
+	kv.index(&r, offset+logRecordHeaderLen+len(r.key))
+	return
+}
+
+// append write the encoded records at the end of the log. Caller must hold the lock.
+func (kv *KeyValueLog) append(records []byte) (offset int, err protocol.Error) {
+	offset = kv.tail
+	err = kv.block.Write(offset, records)
+	if err != nil {
+		return
+	}
+	kv.tail += len(records)
+	if kv.SyncWrites {
+		err = kv.block.Flush()
+	}
+	return
+}
+
+// index add or replace the key in the index by given set record. Caller must hold the lock.
+func (kv *KeyValueLog) index(r *logRecord, valueOffset int) {
+	var k = string(r.key)
+	var entry = kv.entries[k]
+	if entry == nil {
+		entry = &logEntry{}
+		kv.entries[k] = entry
+		kv.insertKey(k)
+	} else {
+		kv.live -= entry.size
+		kv.garbage += entry.size
+		kv.addVersion(k, entry)
+	}
+	entry.size = r.len()
+	entry.valueOffset = valueOffset
+	entry.valueLen = len(r.value)
+	entry.expire = r.expire
+	kv.live += entry.size
+}
+
+// remove delete the key from the index and write zero data to the value location of all its versions if erase is true.
+// Caller must hold the lock.
+func (kv *KeyValueLog) remove(k string, erase bool) (err protocol.Error) {
+	kv.drop(k)
+	if erase {
+		err = kv.eraseVersions(k)
+		if err == nil && kv.SyncWrites {
+			err = kv.block.Flush()
+		}
+	}
+	return
+}
+
+// eraseVersions write zero data to the value of every overwritten and deleted set record of the key
+// in the current generation, so they don't remain on the block until next compaction.
+// It costs just the number of the versions. Older generations erase by compact() itself. Caller must hold the lock.
+func (kv *KeyValueLog) eraseVersions(k string) (err protocol.Error) {
+	err = kv.keepScans(k, false)
+	if err != nil {
+		return
+	}
+	for _, v := range kv.versions[k] {
+		err = kv.block.Erase(v.offset, v.len)
+		if err != nil {
+			return
+		}
+	}
+	delete(kv.versions, k)
+	return
+}
+
+// addVersion keep the value location of the entry that is overwriting or deleting. Caller must hold the lock.
+func (kv *KeyValueLog) addVersion(k string, entry *logEntry) {
+	if entry.valueLen == 0 {
+		return
+	}
+	kv.versions[k] = append(kv.versions[k], logValue{entry.valueOffset, entry.valueLen})
+}
+
+// drop delete the key from the index. Caller must hold the lock.
+func (kv *KeyValueLog) drop(k string) {
+	var entry = kv.entries[k]
+	kv.live -= entry.size
+	kv.garbage += entry.size
+	kv.addVersion(k, entry)
+	delete(kv.entries, k)
+	var i = sort.SearchStrings(kv.keys, k)
+	if i < len(kv.keys) && kv.keys[i] == k {
+		kv.keys = append(kv.keys[:i], kv.keys[i+1:]...)
+	}
+}
+
+// Caller must hold the lock.
+func (kv *KeyValueLog) insertKey(k string) {
+	var i = sort.SearchStrings(kv.keys, k)
+	kv.keys = append(kv.keys, "")
+	copy(kv.keys[i+1:], kv.keys[i:])
+	kv.keys[i] = k
+}
+
+// afterWrite compact the log if garbage reach the CompactRatio. Caller must hold the lock.
+func (kv *KeyValueLog) afterWrite() (err protocol.Error) {
+	if kv.CompactRatio == 0 || kv.garbage < logDataStart || kv.garbage < int(kv.CompactRatio)*kv.live {
+		return
+	}
+	err = kv.compact()
+	return
+}
@@ -0,0 +1,218 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"libgo/protocol"
+)
+
+var _ protocol.StorageKeyValue = &KeyValueLog{}
+var _ protocol.StorageKeyValue_Expiration = &KeyValueLog{}
+
+func TestKeyValueLog_Recovery(t *testing.T) {
+	var block BlockMemory
+	var kv KeyValueLog
+	if err := kv.Init(&block); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	var options protocol.StorageKeyValue_SaveOptions
+	kv.Set([]byte("a"), []byte("value-a"), options)
+	kv.Set([]byte("b"), []byte("value-b"), options)
+	kv.Set([]byte("a"), []byte("value-a2"), options)
+	var secrets = []string{"secret-value-c1", "secret-value-c2", "secret-value-c3"}
+	for _, secret := range secrets {
+		kv.Set([]byte("c"), []byte(secret), options)
+	}
+	kv.Delete([]byte("b"))
+	if err := kv.Erase([]byte("c")); err != nil {
+		t.Fatalf("Erase() error = %v", err)
+	}
+	for _, secret := range secrets {
+		if loc, _ := block.Search([]byte(secret), 0); loc != -1 {
+			t.Errorf("Erase() don't write zero data to value location of %q", secret)
+		}
+	}
+	if loc, _ := block.Search([]byte("value-a2"), 0); loc == -1 {
+		t.Errorf("Erase() write zero data to value location of other keys")
+	}
+
+	var batch, _ = kv.Batch()
+	batch.Set([]byte("d"), []byte("value-d"), options)
+	batch.Delete([]byte("a"))
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	var recovered KeyValueLog
+	if err := recovered.Init(&block); err != nil {
+		t.Fatalf("recover Init() error = %v", err)
+	}
+	var keys, _ = recovered.ListKeys(0, 10)
+	if len(keys) != 1 || string(keys[0]) != "d" {
+		t.Fatalf("recovered keys = %q, want [d]", keys)
+	}
+	var value, _ = recovered.Get([]byte("d"))
+	if string(value) != "value-d" {
+		t.Errorf("recovered Get() = %q, want value-d", value)
+	}
+}
+
+func TestKeyValueLog_TornBatch(t *testing.T) {
+	var block BlockMemory
+	var kv KeyValueLog
+	kv.Init(&block)
+	var options protocol.StorageKeyValue_SaveOptions
+	kv.Set([]byte("a"), []byte("value-a"), options)
+	var tail = kv.tail
+
+	var batch, _ = kv.Batch()
+	batch.Set([]byte("b"), []byte("value-b"), options)
+	batch.Delete([]byte("a"))
+	batch.Commit()
+	// Simulate crash before the commit record reach the device.
+	block.Erase(kv.tail-logRecordHeaderLen, logRecordHeaderLen)
+
+	var recovered KeyValueLog
+	recovered.Init(&block)
+	var keys, _ = recovered.ListKeys(0, 10)
+	if len(keys) != 1 || string(keys[0]) != "a" {
+		t.Fatalf("recovered keys = %q, want [a]", keys)
+	}
+	if recovered.tail != tail {
+		t.Errorf("recovered tail = %v, want %v", recovered.tail, tail)
+	}
+}
+
+func TestKeyValueLog_TornOverwrite(t *testing.T) {
+	var block BlockMemory
+	var kv KeyValueLog
+	kv.Init(&block)
+	var options protocol.StorageKeyValue_SaveOptions
+	kv.Set([]byte("a"), []byte("value-a"), options)
+	kv.Set([]byte("a"), []byte("value-a2"), options)
+	// Simulate crash before the end of the overwrite value reach the device.
+	block.Erase(kv.tail-2, 2)
+
+	var recovered KeyValueLog
+	recovered.Init(&block)
+	var value, err = recovered.Get([]byte("a"))
+	if err != nil || string(value) != "value-a" {
+		t.Errorf("recovered Get() = %q, %v, want value-a", value, err)
+	}
+}
+
+func TestKeyValueLog_EraseVersions(t *testing.T) {
+	var block BlockMemory
+	var kv KeyValueLog
+	kv.Init(&block)
+	var options protocol.StorageKeyValue_SaveOptions
+	kv.Set([]byte("a"), []byte("secret-value-a1"), options)
+	kv.Delete([]byte("a"))
+	kv.Set([]byte("a"), []byte("secret-value-a2"), options)
+	kv.Lock([]byte("a"))
+	kv.Unlock([]byte("a"), []byte("secret-value-a3"))
+	if err := kv.Erase([]byte("a")); err != nil {
+		t.Fatalf("Erase() error = %v", err)
+	}
+	for _, secret := range []string{"secret-value-a1", "secret-value-a2", "secret-value-a3"} {
+		if loc, _ := block.Search([]byte(secret), 0); loc != -1 {
+			t.Errorf("Erase() don't write zero data to value location of %q", secret)
+		}
+	}
+	if len(kv.versions) != 0 {
+		t.Errorf("Erase() keep %v versions", len(kv.versions))
+	}
+}
+
+func TestKeyValueLog_Compact(t *testing.T) {
+	var block BlockMemory
+	var kv KeyValueLog
+	kv.Init(&block)
+	var options protocol.StorageKeyValue_SaveOptions
+	for i := 0; i < 100; i++ {
+		kv.Set([]byte("key"), []byte{byte(i)}, options)
+		kv.Set([]byte("deleted-key"), []byte("deleted-value"), options)
+		kv.Delete([]byte("deleted-key"))
+	}
+	kv.Set([]byte("live"), []byte("live-value"), options)
+
+	for round := 0; round < 3; round++ {
+		if err := kv.Compact(); err != nil {
+			t.Fatalf("Compact() error = %v", err)
+		}
+		if loc, _ := block.Search([]byte("deleted-value"), 0); loc != -1 {
+			t.Errorf("Compact() don't erase old generation")
+		}
+
+		var recovered KeyValueLog
+		recovered.Init(&block)
+		var value, _ = recovered.Get([]byte("key"))
+		if !bytes.Equal(value, []byte{99}) {
+			t.Errorf("round %d: recovered Get(key) = %v, want [99]", round, value)
+		}
+		value, _ = recovered.Get([]byte("live"))
+		if string(value) != "live-value" {
+			t.Errorf("round %d: recovered Get(live) = %q, want live-value", round, value)
+		}
+		kv.Set([]byte("live"), []byte("live-value"), options)
+	}
+}
+
+// testCountBlock count reads from the block.
+type testCountBlock struct {
+	BlockMemory
+	reads int
+}
+
+func (cb *testCountBlock) Read(offset int, data []byte) (err protocol.Error) {
+	cb.reads++
+	return cb.BlockMemory.Read(offset, data)
+}
+
+// testIterator is a protocol.Iterate_KV by a function.
+type testIterator func(key, value []byte) (breaking bool)
+
+func (ti testIterator) Iterate(key, value []byte) (breaking bool) { return ti(key, value) }
+
+func TestKeyValueLog_Scan(t *testing.T) {
+	var block testCountBlock
+	var kv KeyValueLog
+	kv.Init(&block)
+	var options protocol.StorageKeyValue_SaveOptions
+	for i := 0; i < 100; i++ {
+		kv.Set([]byte{'k', byte(i)}, []byte{'v', byte(i)}, options)
+	}
+
+	var reads = block.reads
+	var ts = testScan{limit: 1}
+	kv.Scan(nil, nil, protocol.StorageKeyValue_ScanOptions{}, &ts)
+	if got := block.reads - reads; got != 1 {
+		t.Errorf("Scan() break after first key read %v values, want 1", got)
+	}
+
+	// Erase and compaction during the scan must not change values of the snapshot.
+	var got []string
+	var iterator = testIterator(func(key, value []byte) (breaking bool) {
+		got = append(got, string(value))
+		if key[1] == 0 {
+			kv.Erase([]byte{'k', 1})
+			kv.Set([]byte{'k', 2}, []byte("changed"), options)
+			kv.Compact()
+		}
+		return len(got) == 3
+	})
+	if err := kv.Scan(nil, nil, protocol.StorageKeyValue_ScanOptions{}, iterator); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	var want = []string{"v\x00", "v\x01", "v\x02"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Scan() = %q, want %q", got, want)
+	}
+	if len(kv.scans) != 0 {
+		t.Errorf("Scan() keep %v active scans", len(kv.scans))
+	}
+}
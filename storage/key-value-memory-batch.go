@@ -0,0 +1,47 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/protocol"
+	"libgo/time/monotonic"
+)
+
+// keyValueMemoryBatch implement protocol.StorageKeyValue_Batch for KeyValueMemory.
+// It is not safe to call its methods concurrently, but Commit() is atomic against other store methods.
+type keyValueMemoryBatch struct {
+	kv *KeyValueMemory
+	kvBatch
+}
+
+//libgo:impl libgo/protocol.StorageBatch
+func (b *keyValueMemoryBatch) Commit() (err protocol.Error) {
+	err = b.close()
+	if err != nil {
+		return
+	}
+
+	var kv = b.kv
+	var now = monotonic.Now()
+	kv.sync.Lock()
+	err = b.check(func(k string) (live, locked bool) {
+		var entry = kv.entries[k]
+		live = entry != nil && !entry.expired(now)
+		return live, live && kv.leases.locked(k, now)
+	})
+	if err == nil {
+		for _, op := range b.ops {
+			switch op.kind {
+			case batchOperation_Set:
+				kv.set(op.key, op.value, op.options, now)
+			case batchOperation_Delete:
+				kv.remove(op.key, false)
+			case batchOperation_Erase:
+				kv.remove(op.key, true)
+			}
+		}
+	}
+	kv.sync.Unlock()
+	b.ops = nil
+	return
+}
@@ -0,0 +1,382 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+
+	"libgo/protocol"
+	"libgo/time/monotonic"
+	"libgo/timer"
+)
+
+// KeyValueMemory is the in-memory reference implementation of protocol.StorageKeyValue.
+// - It is safe to call its methods concurrently.
+// - Expired keys evict by one timer for the whole store, not one timer per key.
+// - Get() and other read methods return copy of the value, so caller can't change stored data without Set().
+// - Locks are leases that expire if their holders don't renew or release them, see leases.
+type KeyValueMemory struct {
+	sync    sync.Mutex
+	keys    []string // sorted to serve ListKeys() in stable order
+	entries map[string]*kvEntry
+	leases  leases
+
+	expires     expireHeap
+	expireTimer timer.Async
+	nextExpire  monotonic.Time // 0 means expireTimer is not waiting
+}
+
+type kvEntry struct {
+	value  []byte
+	expire monotonic.Time // 0 means no TTL
+}
+
+func (e *kvEntry) expired(now monotonic.Time) bool { return e.expire != 0 && now.Pass(e.expire) }
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (kv *KeyValueMemory) Init() (err protocol.Error) {
+	kv.entries = make(map[string]*kvEntry)
+	err = kv.expireTimer.Init(kv)
+	if err != nil {
+		return
+	}
+	err = kv.leases.init(&kv.sync, &ErrKeyLocked, &ErrKeyNotLocked)
+	return
+}
+func (kv *KeyValueMemory) Deinit() (err protocol.Error) {
+	kv.sync.Lock()
+	if kv.nextExpire != 0 {
+		err = kv.expireTimer.Stop()
+		kv.nextExpire = 0
+	}
+	var leasesErr = kv.leases.deinit()
+	if err == nil {
+		err = leasesErr
+	}
+	kv.keys = nil
+	kv.entries = nil
+	kv.expires = nil
+	kv.sync.Unlock()
+	return
+}
+
+//libgo:impl libgo/protocol.StorageKeyValue
+func (kv *KeyValueMemory) KeyNumbers() (num uint64, err protocol.Error) {
+	kv.sync.Lock()
+	num = uint64(len(kv.keys))
+	kv.sync.Unlock()
+	return
+}
+func (kv *KeyValueMemory) ListKeys(offset, limit uint64) (keys [][]byte, err protocol.Error) {
+	kv.sync.Lock()
+	var ln = uint64(len(kv.keys))
+	if offset >= ln {
+		kv.sync.Unlock()
+		return
+	}
+	var end = offset + limit
+	if end > ln || end < offset {
+		end = ln
+	}
+	keys = make([][]byte, 0, end-offset)
+	for _, k := range kv.keys[offset:end] {
+		keys = append(keys, []byte(k))
+	}
+	kv.sync.Unlock()
+	return
+}
+
+// Scan iterate a snapshot of the range that copied under the store lock, so iterator can call any method of the store.
+func (kv *KeyValueMemory) Scan(start, end []byte, options protocol.StorageKeyValue_ScanOptions, iterator protocol.Iterate_KV[[]byte]) (err protocol.Error) {
+	var now = monotonic.Now()
+	kv.sync.Lock()
+	var from, to = scanRange(kv.keys, start, end)
+	var snapshot = make(kvSnapshot, 0, to-from)
+	for _, k := range kv.keys[from:to] {
+		var entry = kv.entries[k]
+		if entry.expired(now) {
+			continue
+		}
+		snapshot = append(snapshot, kvPair{[]byte(k), cloneBytes(entry.value)})
+	}
+	kv.sync.Unlock()
+
+	snapshot.iterate(options, iterator)
+	return
+}
+func (kv *KeyValueMemory) ScanPrefix(prefix []byte, options protocol.StorageKeyValue_ScanOptions, iterator protocol.Iterate_KV[[]byte]) (err protocol.Error) {
+	return kv.Scan(prefix, prefixEnd(prefix), options, iterator)
+}
+
+// Lock return the value of the key and prevent any other changes on it until Unlock() called.
+// It doesn't block the caller if the key locked before and return ErrKeyLocked.
+// The lock is a lease that expire after leases_DefaultTTL, so call Unlock() before it or use LockLease() instead.
+func (kv *KeyValueMemory) Lock(key []byte) (value []byte, err protocol.Error) {
+	value, _, err = kv.lock(key, protocol.StorageLease_Options{}, true)
+	return
+}
+
+// Unlock store the value if it is not nil and release the lock get by Lock().
+// It return ErrLeaseOwner if the key is locked by LockLease().
+func (kv *KeyValueMemory) Unlock(key []byte, value []byte) (err protocol.Error) {
+	err = kv.unlock(key, protocol.StorageLeaseToken{}, true, value)
+	return
+}
+
+// LockLease is like Lock() but can wait for the current holder as options says and return a random token
+// that just its holder can renew or release the lease by it.
+//
+//libgo:impl libgo/protocol.StorageKeyValue_Leases
+func (kv *KeyValueMemory) LockLease(key []byte, options protocol.StorageLease_Options) (value []byte, token protocol.StorageLeaseToken, err protocol.Error) {
+	value, token, err = kv.lock(key, options, false)
+	return
+}
+func (kv *KeyValueMemory) RenewLease(key []byte, token protocol.StorageLeaseToken, ttl protocol.Duration) (err protocol.Error) {
+	kv.sync.Lock()
+	_, err = kv.entry(key, monotonic.Now())
+	if err == nil {
+		err = kv.leases.renew(string(key), token, ttl)
+	}
+	kv.sync.Unlock()
+	return
+}
+func (kv *KeyValueMemory) UnlockLease(key []byte, token protocol.StorageLeaseToken, value []byte) (err protocol.Error) {
+	err = kv.unlock(key, token, false, value)
+	return
+}
+
+// unlock store the value if it is not nil and release the lease of the token, or the lease of Lock() if plain is true.
+func (kv *KeyValueMemory) unlock(key []byte, token protocol.StorageLeaseToken, plain bool, value []byte) (err protocol.Error) {
+	var k = string(key)
+	kv.sync.Lock()
+	if plain {
+		token = kv.leases.plainToken(k)
+	}
+	var entry = kv.entries[k]
+	if entry == nil {
+		err = &ErrNotExist
+	} else {
+		err = kv.leases.release(k, token)
+	}
+	if err == nil {
+		if value != nil {
+			entry.value = cloneBytes(value)
+		}
+		// The timer skip locked keys, so evict it here if it expired while locked.
+		if entry.expired(monotonic.Now()) {
+			kv.remove(k, true)
+		}
+	}
+	kv.sync.Unlock()
+	return
+}
+
+func (kv *KeyValueMemory) Length(key []byte) (ln int, err protocol.Error) {
+	kv.sync.Lock()
+	var entry *kvEntry
+	entry, err = kv.entry(key, monotonic.Now())
+	if err == nil {
+		ln = len(entry.value)
+	}
+	kv.sync.Unlock()
+	return
+}
+func (kv *KeyValueMemory) Get(key []byte) (value []byte, err protocol.Error) {
+	kv.sync.Lock()
+	var entry *kvEntry
+	entry, err = kv.entry(key, monotonic.Now())
+	if err == nil {
+		value = cloneBytes(entry.value)
+	}
+	kv.sync.Unlock()
+	return
+}
+
+// TTL return the remaining time to live of the key. A key that expired while it is locked has 1ns TTL.
+//
+//libgo:impl libgo/protocol.StorageKeyValue_Expiration
+func (kv *KeyValueMemory) TTL(key []byte) (ttl protocol.Duration, err protocol.Error) {
+	var now = monotonic.Now()
+	kv.sync.Lock()
+	var entry *kvEntry
+	entry, err = kv.entry(key, now)
+	if err == nil && entry.expire != 0 {
+		ttl = entry.expire.Until(now)
+		if ttl < 1 {
+			ttl = 1
+		}
+	}
+	kv.sync.Unlock()
+	return
+}
+
+// Set store a copy of the value. options.TTL > 0 make the key expire after given duration,
+// otherwise any TTL set before on the key will be removed.
+func (kv *KeyValueMemory) Set(key []byte, value []byte, options protocol.StorageKeyValue_SaveOptions) (err protocol.Error) {
+	var now = monotonic.Now()
+	kv.sync.Lock()
+	var entry = kv.entries[string(key)]
+	if entry != nil && kv.leases.locked(string(key), now) && !entry.expired(now) {
+		err = &ErrKeyLocked
+	} else {
+		kv.set(string(key), value, options, now)
+	}
+	kv.sync.Unlock()
+	return
+}
+
+func (kv *KeyValueMemory) Delete(key []byte) (err protocol.Error) {
+	err = kv.delete(key, false)
+	return
+}
+func (kv *KeyValueMemory) Erase(key []byte) (err protocol.Error) {
+	err = kv.delete(key, true)
+	return
+}
+
+// Batch return a new batch that apply its changes on the store all-or-nothing.
+func (kv *KeyValueMemory) Batch() (batch protocol.StorageKeyValue_Batch, err protocol.Error) {
+	batch = &keyValueMemoryBatch{kv: kv}
+	return
+}
+
+// TimerHandler evict all expired keys and schedule the timer for the next one.
+// It is non-blocking as protocol.TimerListener needs, it just holds the store lock briefly.
+//
+//libgo:impl libgo/protocol.TimerListener
+func (kv *KeyValueMemory) TimerHandler() {
+	var now = monotonic.Now()
+	kv.sync.Lock()
+	kv.nextExpire = 0
+	for {
+		var item, ok = kv.expires.Peek()
+		if !ok || item.expire.Pass(now) {
+			break
+		}
+		heap.Pop(&kv.expires)
+		var entry = kv.entries[item.key]
+		// The key can be deleted or set again with other TTL after item pushed.
+		if entry != nil && entry.expire == item.expire && !kv.leases.locked(item.key, now) {
+			kv.remove(item.key, true)
+		}
+	}
+	kv.scheduleExpire(now)
+	kv.sync.Unlock()
+}
+
+// lock get a lease on the live key and return a copy of its value.
+func (kv *KeyValueMemory) lock(key []byte, options protocol.StorageLease_Options, plain bool) (value []byte, token protocol.StorageLeaseToken, err protocol.Error) {
+	kv.sync.Lock()
+	_, err = kv.entry(key, monotonic.Now())
+	if err == nil {
+		token, err = kv.leases.acquire(string(key), options, plain)
+	}
+	// The key can be deleted by the holder that acquire() waited for.
+	if err == nil {
+		var entry *kvEntry
+		entry, err = kv.entry(key, monotonic.Now())
+		if err != nil {
+			kv.leases.release(string(key), token)
+		} else {
+			value = cloneBytes(entry.value)
+		}
+	}
+	kv.sync.Unlock()
+	return
+}
+
+func (kv *KeyValueMemory) delete(key []byte, erase bool) (err protocol.Error) {
+	kv.sync.Lock()
+	var now = monotonic.Now()
+	_, err = kv.entry(key, now)
+	if err == nil {
+		if kv.leases.locked(string(key), now) {
+			err = &ErrKeyLocked
+		} else {
+			kv.remove(string(key), erase)
+		}
+	}
+	kv.sync.Unlock()
+	return
+}
+
+// set store a copy of the value and replace any TTL set before on the key.
+// Caller must hold the lock and check the key is not locked.
+func (kv *KeyValueMemory) set(k string, value []byte, options protocol.StorageKeyValue_SaveOptions, now monotonic.Time) {
+	var entry = kv.entries[k]
+	if entry != nil && entry.expired(now) {
+		kv.remove(k, true)
+		entry = nil
+	}
+	if entry == nil {
+		entry = &kvEntry{}
+		kv.entries[k] = entry
+		kv.insertKey(k)
+	}
+	entry.value = cloneBytes(value)
+	entry.expire = 0
+	if options.TTL > 0 {
+		entry.expire = now
+		entry.expire.Add(options.TTL)
+		heap.Push(&kv.expires, expireItem{key: k, expire: entry.expire})
+		kv.scheduleExpire(now)
+	}
+}
+
+// entry return the live entry of the key. Expired entry removed lazily here if the timer not evict it yet.
+// Caller must hold the lock.
+func (kv *KeyValueMemory) entry(key []byte, now monotonic.Time) (entry *kvEntry, err protocol.Error) {
+	entry = kv.entries[string(key)]
+	if entry != nil && entry.expired(now) && !kv.leases.locked(string(key), now) {
+		kv.remove(string(key), true)
+		entry = nil
+	}
+	if entry == nil {
+		err = &ErrNotExist
+	}
+	return
+}
+
+// remove delete the key from the index and write zero to value location if erase is true.
+// Caller must hold the lock.
+func (kv *KeyValueMemory) remove(k string, erase bool) {
+	var entry = kv.entries[k]
+	if erase {
+		zeroBytes(entry.value)
+	}
+	delete(kv.entries, k)
+	var i = sort.SearchStrings(kv.keys, k)
+	if i < len(kv.keys) && kv.keys[i] == k {
+		kv.keys = append(kv.keys[:i], kv.keys[i+1:]...)
+	}
+}
+
+// Caller must hold the lock.
+func (kv *KeyValueMemory) insertKey(k string) {
+	var i = sort.SearchStrings(kv.keys, k)
+	kv.keys = append(kv.keys, "")
+	copy(kv.keys[i+1:], kv.keys[i:])
+	kv.keys[i] = k
+}
+
+// scheduleExpire reset the timer if the nearest expire time is sooner than the timer is waiting for.
+// Caller must hold the lock.
+func (kv *KeyValueMemory) scheduleExpire(now monotonic.Time) {
+	var item, ok = kv.expires.Peek()
+	if !ok {
+		return
+	}
+	if kv.nextExpire != 0 && !kv.nextExpire.Pass(item.expire) {
+		return
+	}
+	var d = item.expire.Until(now)
+	if d < 1 {
+		d = 1
+	}
+	var err = kv.expireTimer.Reset(d)
+	if err == nil {
+		kv.nextExpire = item.expire
+	}
+}
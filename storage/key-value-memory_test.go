@@ -0,0 +1,285 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"libgo/protocol"
+	"libgo/time/monotonic"
+)
+
+var _ protocol.StorageKeyValue = &KeyValueMemory{}
+var _ protocol.StorageKeyValue_Leases = &KeyValueMemory{}
+var _ protocol.StorageKeyValue_Expiration = &KeyValueMemory{}
+
+func TestKeyValueMemory(t *testing.T) {
+	var kv KeyValueMemory
+	kv.Init()
+	defer kv.Deinit()
+
+	var keys = []string{"c", "a", "b"}
+	for _, k := range keys {
+		var err = kv.Set([]byte(k), []byte("value-"+k), protocol.StorageKeyValue_SaveOptions{})
+		if err != nil {
+			t.Fatalf("Set(%s) error = %v", k, err)
+		}
+	}
+
+	var num, _ = kv.KeyNumbers()
+	if num != 3 {
+		t.Errorf("KeyNumbers() = %v, want 3", num)
+	}
+	var list, _ = kv.ListKeys(1, 5)
+	if len(list) != 2 || string(list[0]) != "b" || string(list[1]) != "c" {
+		t.Errorf("ListKeys(1, 5) = %q, want [b c]", list)
+	}
+
+	var value, err = kv.Lock([]byte("a"))
+	if err != nil || string(value) != "value-a" {
+		t.Fatalf("Lock() = %q, %v", value, err)
+	}
+	if err = kv.Set([]byte("a"), []byte("new"), protocol.StorageKeyValue_SaveOptions{}); err != &ErrKeyLocked {
+		t.Errorf("Set() on locked key error = %v, want ErrKeyLocked", err)
+	}
+	if err = kv.Unlock([]byte("a"), []byte("unlocked")); err != nil {
+		t.Errorf("Unlock() error = %v", err)
+	}
+	value, _ = kv.Get([]byte("a"))
+	if string(value) != "unlocked" {
+		t.Errorf("Get() after Unlock() = %q, want unlocked", value)
+	}
+
+	var stored = kv.entries["b"].value
+	if err = kv.Erase([]byte("b")); err != nil {
+		t.Errorf("Erase() error = %v", err)
+	}
+	if !bytes.Equal(stored, make([]byte, len(stored))) {
+		t.Errorf("Erase() don't write zero data to value location, got %q", stored)
+	}
+	if _, err = kv.Get([]byte("b")); err != &ErrNotExist {
+		t.Errorf("Get() after Erase() error = %v, want ErrNotExist", err)
+	}
+
+	if err = kv.Delete([]byte("c")); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	num, _ = kv.KeyNumbers()
+	if num != 1 {
+		t.Errorf("KeyNumbers() after delete = %v, want 1", num)
+	}
+}
+
+func TestKeyValueMemory_Leases(t *testing.T) {
+	var kv KeyValueMemory
+	kv.Init()
+	defer kv.Deinit()
+	var key = []byte("k")
+	kv.Set(key, []byte("v"), protocol.StorageKeyValue_SaveOptions{})
+
+	var value, token, err = kv.LockLease(key, protocol.StorageLease_Options{TTL: 50 * monotonic.Millisecond})
+	if err != nil || string(value) != "v" {
+		t.Fatalf("LockLease() = %q, %v", value, err)
+	}
+	if err = kv.Unlock(key, nil); err != &ErrLeaseOwner {
+		t.Errorf("Unlock() of a lease error = %v, want ErrLeaseOwner", err)
+	}
+	if _, _, err = kv.LockLease(key, protocol.StorageLease_Options{Wait: 5 * monotonic.Millisecond}); err != &ErrKeyLocked {
+		t.Errorf("LockLease() wait timeout error = %v, want ErrKeyLocked", err)
+	}
+	var cancel = make(chan struct{})
+	close(cancel)
+	if _, _, err = kv.LockLease(key, protocol.StorageLease_Options{Wait: -1, Cancel: cancel}); err != &ErrLeaseCanceled {
+		t.Errorf("LockLease() canceled error = %v, want ErrLeaseCanceled", err)
+	}
+	if err = kv.RenewLease(key, token, 0); err != nil {
+		t.Errorf("RenewLease() error = %v", err)
+	}
+
+	// Waiter must get the lease after the holder crashed and its lease expired.
+	var start = time.Now()
+	var token2 protocol.StorageLeaseToken
+	_, token2, err = kv.LockLease(key, protocol.StorageLease_Options{Wait: -1})
+	if err != nil || token2 == token {
+		t.Fatalf("LockLease() after expire = %x, %v", token2, err)
+	}
+	if time.Since(start) < 40*time.Millisecond {
+		t.Errorf("LockLease() get the lease before the renewed lease expired")
+	}
+	if err = kv.RenewLease(key, token, 0); err != &ErrLeaseOwner {
+		t.Errorf("RenewLease() of expired lease error = %v, want ErrLeaseOwner", err)
+	}
+	if err = kv.UnlockLease(key, token2, []byte("v2")); err != nil {
+		t.Errorf("UnlockLease() error = %v", err)
+	}
+	if value, _ = kv.Get(key); string(value) != "v2" {
+		t.Errorf("Get() after UnlockLease() = %q, want v2", value)
+	}
+	if err = kv.RenewLease(key, token2, 0); err != &ErrKeyNotLocked {
+		t.Errorf("RenewLease() of released lease error = %v, want ErrKeyNotLocked", err)
+	}
+	if err = kv.Set(key, []byte("v3"), protocol.StorageKeyValue_SaveOptions{}); err != nil {
+		t.Errorf("Set() after UnlockLease() error = %v", err)
+	}
+}
+
+// Locks of Lock() are leases that expire, so a crashed holder never block the key forever,
+// and just Unlock() release them, that can't release a lease of LockLease().
+func TestKeyValueMemory_Lock(t *testing.T) {
+	var kv KeyValueMemory
+	kv.Init()
+	defer kv.Deinit()
+	var key = []byte("k")
+	kv.Set(key, []byte("v"), protocol.StorageKeyValue_SaveOptions{})
+
+	if _, err := kv.Lock(key); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	var later = monotonic.Now()
+	later.Add(2 * leases_DefaultTTL)
+	kv.sync.Lock()
+	var locked = kv.leases.locked(string(key), later)
+	var token = kv.leases.plainToken(string(key))
+	kv.sync.Unlock()
+	if locked {
+		t.Errorf("Lock() don't expire after leases_DefaultTTL")
+	}
+	if _, err := kv.Lock(key); err != &ErrKeyLocked {
+		t.Errorf("second Lock() error = %v, want ErrKeyLocked", err)
+	}
+	var zero protocol.StorageLeaseToken
+	if err := kv.RenewLease(key, zero, 0); err != &ErrLeaseOwner {
+		t.Errorf("RenewLease() of Lock() by zero token error = %v, want ErrLeaseOwner", err)
+	}
+	if err := kv.UnlockLease(key, zero, []byte("zero")); err != &ErrLeaseOwner {
+		t.Errorf("UnlockLease() of Lock() by zero token error = %v, want ErrLeaseOwner", err)
+	}
+
+	// Holder crashed and its lock expired.
+	kv.RenewLease(key, token, 10*monotonic.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if _, err := kv.Lock(key); err != nil {
+		t.Fatalf("Lock() after expire error = %v", err)
+	}
+	if err := kv.Unlock(key, []byte("v1")); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if err := kv.Unlock(key, nil); err != &ErrKeyNotLocked {
+		t.Errorf("second Unlock() error = %v, want ErrKeyNotLocked", err)
+	}
+
+	var _, leaseToken, err = kv.LockLease(key, protocol.StorageLease_Options{})
+	if err != nil {
+		t.Fatalf("LockLease() after Unlock() error = %v", err)
+	}
+	if err = kv.Unlock(key, []byte("stale")); err != &ErrLeaseOwner {
+		t.Errorf("stale Unlock() error = %v, want ErrLeaseOwner", err)
+	}
+	if err = kv.UnlockLease(key, leaseToken, nil); err != nil {
+		t.Errorf("UnlockLease() error = %v", err)
+	}
+	if value, _ := kv.Get(key); string(value) != "v1" {
+		t.Errorf("Get() = %q, want v1", value)
+	}
+}
+
+func TestKeyValueMemory_Batch(t *testing.T) {
+	var kv KeyValueMemory
+	kv.Init()
+	defer kv.Deinit()
+
+	kv.Set([]byte("order"), []byte("1"), protocol.StorageKeyValue_SaveOptions{})
+
+	var batch, _ = kv.Batch()
+	batch.Set([]byte("inventory"), []byte("9"), protocol.StorageKeyValue_SaveOptions{})
+	batch.Delete([]byte("not-exist"))
+	if err := batch.Commit(); err != &ErrNotExist {
+		t.Fatalf("Commit() error = %v, want ErrNotExist", err)
+	}
+	if _, err := kv.Get([]byte("inventory")); err != &ErrNotExist {
+		t.Errorf("failed Commit() apply some changes")
+	}
+
+	batch, _ = kv.Batch()
+	batch.Set([]byte("inventory"), []byte("9"), protocol.StorageKeyValue_SaveOptions{})
+	batch.Delete([]byte("order"))
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	batch.Discard()
+	if err := batch.Set([]byte("a"), nil, protocol.StorageKeyValue_SaveOptions{}); err != &ErrBatchClosed {
+		t.Errorf("Set() after Commit() error = %v, want ErrBatchClosed", err)
+	}
+	var num, _ = kv.KeyNumbers()
+	if num != 1 {
+		t.Errorf("KeyNumbers() = %v, want 1", num)
+	}
+}
+
+// testScan collect keys of a scan and break after limit keys if limit > 0.
+type testScan struct {
+	limit int
+	keys  []string
+	kv    *KeyValueMemory
+}
+
+func (ts *testScan) Iterate(key, value []byte) (breaking bool) {
+	ts.keys = append(ts.keys, string(key)+"="+string(value))
+	if ts.kv != nil {
+		// Changes during the scan must not be visible to it.
+		ts.kv.Set([]byte("user/2/z"), []byte("9"), protocol.StorageKeyValue_SaveOptions{})
+	}
+	return ts.limit > 0 && len(ts.keys) == ts.limit
+}
+
+func TestKeyValueMemory_Scan(t *testing.T) {
+	var kv KeyValueMemory
+	kv.Init()
+	defer kv.Deinit()
+
+	for _, k := range []string{"user/2/b", "user/1/a", "user/2/a", "user/3/a"} {
+		kv.Set([]byte(k), []byte(k[5:6]), protocol.StorageKeyValue_SaveOptions{})
+	}
+
+	var tests = []struct {
+		name    string
+		scan    func(ts *testScan) protocol.Error
+		limit   int
+		reverse bool
+		want    string
+	}{
+		{"prefix", func(ts *testScan) protocol.Error {
+			return kv.ScanPrefix([]byte("user/2/"), protocol.StorageKeyValue_ScanOptions{}, ts)
+		}, 0, false, "user/2/a=2 user/2/b=2"},
+		{"range", func(ts *testScan) protocol.Error {
+			return kv.Scan([]byte("user/1/b"), []byte("user/3/a"), protocol.StorageKeyValue_ScanOptions{}, ts)
+		}, 0, false, "user/2/a=2 user/2/b=2"},
+		{"reverse break", func(ts *testScan) protocol.Error {
+			return kv.Scan(nil, nil, protocol.StorageKeyValue_ScanOptions{Reverse: true}, ts)
+		}, 2, true, "user/3/a=3 user/2/b=2"},
+	}
+	for _, tt := range tests {
+		var ts = testScan{limit: tt.limit, kv: &kv}
+		var err = tt.scan(&ts)
+		if err != nil {
+			t.Fatalf("%s: scan error = %v", tt.name, err)
+		}
+		var got = ""
+		for i, k := range ts.keys {
+			if i > 0 {
+				got += " "
+			}
+			got += k
+		}
+		if got != tt.want {
+			t.Errorf("%s: scan = %q, want %q", tt.name, got, tt.want)
+		}
+		kv.Delete([]byte("user/2/z"))
+	}
+
+	if end := prefixEnd([]byte{'a', 0xFF}); !bytes.Equal(end, []byte{'b'}) {
+		t.Errorf("prefixEnd() = %v, want %v", end, []byte{'b'})
+	}
+}
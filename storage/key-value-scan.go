@@ -0,0 +1,72 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"sort"
+
+	"libgo/protocol"
+)
+
+// kvPair is a key and its value in a snapshot of a key-value scan.
+type kvPair struct {
+	key   []byte
+	value []byte
+}
+
+// kvSnapshot is the range of keys and their values copied from a store, to iterate without hold the store lock.
+type kvSnapshot []kvPair
+
+// iterate call iterator with all pairs in the requested order until it return breaking.
+func (ks kvSnapshot) iterate(options protocol.StorageKeyValue_ScanOptions, iterator protocol.Iterate_KV[[]byte]) {
+	if options.Reverse {
+		for i := len(ks) - 1; i >= 0; i-- {
+			if iterator.Iterate(ks[i].key, ks[i].value) {
+				return
+			}
+		}
+		return
+	}
+	for i := range ks {
+		if iterator.Iterate(ks[i].key, ks[i].value) {
+			return
+		}
+	}
+}
+
+// scanRange return the index range of sorted keys that are in [start, end). nil end means no upper bound.
+func scanRange(keys []string, start, end []byte) (from, to int) {
+	from = sort.SearchStrings(keys, string(start))
+	to = len(keys)
+	if end != nil {
+		to = sort.SearchStrings(keys, string(end))
+	}
+	if to < from {
+		to = from
+	}
+	return
+}
+
+// prefixEnd return the smallest key that is greater than all keys start with the prefix.
+// It returns nil if no such key exist e.g. prefix is empty or just has 0xFF bytes.
+func prefixEnd(prefix []byte) (end []byte) {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xFF {
+			end = cloneBytes(prefix[:i+1])
+			end[i]++
+			return
+		}
+	}
+	return
+}
+
+// kvCollector is a protocol.Iterate_KV that collect all pairs of a scan.
+type kvCollector struct {
+	snapshot kvSnapshot
+}
+
+//libgo:impl libgo/protocol.Iterate_KV
+func (kc *kvCollector) Iterate(key, value []byte) (breaking bool) {
+	kc.snapshot = append(kc.snapshot, kvPair{key, value})
+	return
+}
@@ -0,0 +1,277 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"container/heap"
+	"crypto/rand"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"libgo/log"
+	"libgo/protocol"
+	"libgo/time/monotonic"
+	"libgo/timer"
+)
+
+// leases track lease locks of a storage by string keys.
+//   - Callers must hold the storage lock that given to init(). acquire() release it while it waits.
+//   - Expired leases release by one timer for all leases, that wakes their waiters too.
+//   - All leases have a random token and expire if their holders don't renew or release them, so a crashed holder
+//     never block a key forever. Plain leases are for holders without any token e.g. Lock() of storages, so leases
+//     keep their token to release them by the key. Plain holders can't be told apart, so a holder must release
+//     its plain lease before it expires, otherwise it may release the plain lease of the next holder.
+//   - In protocol.AppMode_Dev it keeps the stack of holders and log it with the waiter stack when a waiter
+//     waits more than leases_DeadlockWarning, to diagnose deadlocks.
+type leases struct {
+	sync         *sync.Mutex
+	lockedErr    protocol.Error // return when the key locked by other holder
+	notLockedErr protocol.Error // return when the key has no live lease
+	held         map[string]*lease
+	plain        map[string]protocol.StorageLeaseToken // token of plain leases
+	expires      expireHeap
+	timer        timer.Async
+	nextExpire   monotonic.Time // 0 means timer is not waiting
+}
+
+type lease struct {
+	token    protocol.StorageLeaseToken
+	ttl      protocol.Duration
+	expire   monotonic.Time
+	released chan struct{} // closed when the lease release or expire
+	since    monotonic.Time
+	stack    []byte // stack of the holder just in protocol.AppMode_Dev
+}
+
+const (
+	leases_DefaultTTL       = 30 * monotonic.Second
+	leases_DeadlockWarning  = 10 * monotonic.Second
+	leases_DevStackMaxBytes = 4096
+)
+
+func (ls *leases) init(mutex *sync.Mutex, lockedErr, notLockedErr protocol.Error) (err protocol.Error) {
+	ls.sync = mutex
+	ls.lockedErr = lockedErr
+	ls.notLockedErr = notLockedErr
+	ls.held = make(map[string]*lease)
+	ls.plain = make(map[string]protocol.StorageLeaseToken)
+	err = ls.timer.Init(ls)
+	return
+}
+
+// deinit release all leases and wake their waiters.
+func (ls *leases) deinit() (err protocol.Error) {
+	if ls.nextExpire != 0 {
+		err = ls.timer.Stop()
+		ls.nextExpire = 0
+	}
+	for k := range ls.held {
+		ls.remove(k)
+	}
+	ls.expires = nil
+	return
+}
+
+// locked report whether the key has a live lease.
+func (ls *leases) locked(k string, now monotonic.Time) bool {
+	var l = ls.held[k]
+	return l != nil && !l.expired(now)
+}
+
+// acquire get a lease on the key or wait for it as options says. It return lockedErr if the key is locked and
+// the caller doesn't want to wait or the wait time passed.
+// plain keep the token of the lease, so plainToken() return it to release the lease by the key.
+func (ls *leases) acquire(k string, options protocol.StorageLease_Options, plain bool) (token protocol.StorageLeaseToken, err protocol.Error) {
+	var waitTimer, warnTimer timer.Sync
+	// nil channels block forever in select.
+	var wait, warn <-chan struct{}
+	defer func() {
+		if wait != nil {
+			waitTimer.Stop()
+		}
+		if warn != nil {
+			warnTimer.Stop()
+		}
+	}()
+
+	for {
+		var now = monotonic.Now()
+		var l = ls.held[k]
+		if l == nil || l.expired(now) {
+			if l != nil {
+				ls.remove(k)
+			}
+			rand.Read(token[:])
+			ls.add(k, token, options.TTL, now)
+			if plain {
+				ls.plain[k] = token
+			}
+			return
+		}
+
+		if options.Wait == 0 {
+			err = ls.lockedErr
+			return
+		}
+		if options.Wait > 0 && wait == nil {
+			waitTimer.Init()
+			err = waitTimer.Start(options.Wait)
+			if err != nil {
+				return
+			}
+			wait = waitTimer.Signal()
+		}
+		if protocol.AppMode_Dev && warn == nil {
+			warnTimer.Init()
+			err = warnTimer.Start(leases_DeadlockWarning)
+			if err != nil {
+				return
+			}
+			warn = warnTimer.Signal()
+		}
+
+		ls.sync.Unlock()
+		select {
+		case <-l.released:
+		case <-options.Cancel:
+			err = &ErrLeaseCanceled
+		case <-wait:
+			err = ls.lockedErr
+		case <-warn:
+			ls.sync.Lock()
+			ls.warn(k, l)
+			ls.sync.Unlock()
+		}
+		ls.sync.Lock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// renew extend the live lease of the key by ttl from now. Zero or negative ttl means the ttl of the lease.
+func (ls *leases) renew(k string, token protocol.StorageLeaseToken, ttl protocol.Duration) (err protocol.Error) {
+	var now = monotonic.Now()
+	var l *lease
+	l, err = ls.holder(k, token, now)
+	if err != nil {
+		return
+	}
+	if ttl > 0 {
+		l.ttl = ttl
+	}
+	l.expire = now
+	l.expire.Add(l.ttl)
+	heap.Push(&ls.expires, expireItem{key: k, expire: l.expire})
+	ls.scheduleExpire(now)
+	return
+}
+
+// release remove the live lease of the key and wake its waiters.
+func (ls *leases) release(k string, token protocol.StorageLeaseToken) (err protocol.Error) {
+	_, err = ls.holder(k, token, monotonic.Now())
+	if err != nil {
+		return
+	}
+	ls.remove(k)
+	return
+}
+
+// plainToken return the token of the plain lease of the key, or the zero token that is no lease token.
+func (ls *leases) plainToken(k string) (token protocol.StorageLeaseToken) { return ls.plain[k] }
+
+// holder return the live lease of the key if the token is its holder token.
+func (ls *leases) holder(k string, token protocol.StorageLeaseToken, now monotonic.Time) (l *lease, err protocol.Error) {
+	l = ls.held[k]
+	if l == nil || l.expired(now) {
+		return nil, ls.notLockedErr
+	}
+	if l.token != token {
+		return nil, &ErrLeaseOwner
+	}
+	return
+}
+
+// TimerHandler release all expired leases and schedule the timer for the next one.
+//
+//libgo:impl libgo/protocol.TimerListener
+func (ls *leases) TimerHandler() {
+	var now = monotonic.Now()
+	ls.sync.Lock()
+	ls.nextExpire = 0
+	for {
+		var item, ok = ls.expires.Peek()
+		if !ok || item.expire.Pass(now) {
+			break
+		}
+		heap.Pop(&ls.expires)
+		var l = ls.held[item.key]
+		// The lease can be released, renewed or locked again after item pushed.
+		if l != nil && l.expire == item.expire {
+			ls.remove(item.key)
+		}
+	}
+	ls.scheduleExpire(now)
+	ls.sync.Unlock()
+}
+
+func (ls *leases) add(k string, token protocol.StorageLeaseToken, ttl protocol.Duration, now monotonic.Time) {
+	var l = &lease{
+		token:    token,
+		ttl:      ttl,
+		released: make(chan struct{}),
+		since:    now,
+	}
+	if ttl <= 0 {
+		l.ttl = leases_DefaultTTL
+	}
+	l.expire = now
+	l.expire.Add(l.ttl)
+	heap.Push(&ls.expires, expireItem{key: k, expire: l.expire})
+	ls.scheduleExpire(now)
+	if protocol.AppMode_Dev {
+		l.stack = make([]byte, leases_DevStackMaxBytes)
+		l.stack = l.stack[:runtime.Stack(l.stack, false)]
+	}
+	ls.held[k] = l
+}
+
+func (ls *leases) remove(k string) {
+	var l = ls.held[k]
+	delete(ls.held, k)
+	delete(ls.plain, k)
+	close(l.released)
+}
+
+// warn log the holder and the waiter of the lease that may be in a deadlock.
+func (ls *leases) warn(k string, l *lease) {
+	if ls.held[k] != l {
+		return
+	}
+	var waiter = make([]byte, leases_DevStackMaxBytes)
+	waiter = waiter[:runtime.Stack(waiter, false)]
+	log.Debug(&Lease_MediaType, "Possible deadlock on lease of "+strconv.Quote(k)+" that held for "+
+		strconv.FormatInt(int64(l.since.SinceNow()/monotonic.Second), 10)+" seconds\nHolder: "+string(l.stack)+"\nWaiter: "+string(waiter))
+}
+
+// scheduleExpire reset the timer if the nearest expire time is sooner than the timer is waiting for.
+func (ls *leases) scheduleExpire(now monotonic.Time) {
+	var item, ok = ls.expires.Peek()
+	if !ok {
+		return
+	}
+	if ls.nextExpire != 0 && !ls.nextExpire.Pass(item.expire) {
+		return
+	}
+	var d = item.expire.Until(now)
+	if d < 1 {
+		d = 1
+	}
+	var err = ls.timer.Reset(d)
+	if err == nil {
+		ls.nextExpire = item.expire
+	}
+}
+
+func (l *lease) expired(now monotonic.Time) bool { return now.Pass(l.expire) }
@@ -0,0 +1,262 @@
+//go:build lang_eng
+
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/detail"
+	"libgo/protocol"
+)
+
+const domainEnglish = "Storage"
+
+func init() {
+	ErrNotExist.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Not Exist").
+		SetOverview("Requested key, object or record not exist in the storage").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrKeyLocked.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Key Locked").
+		SetOverview("Requested key locked by other process and can't change until it unlocked").
+		SetUserNote("").
+		SetDevNote("Try again later or use Lock() to wait for your turn").
+		SetTAGS([]string{}),
+	)
+	ErrKeyNotLocked.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Key Not Locked").
+		SetOverview("Unlock() called on a key that not locked before").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+
+	ErrBatchClosed.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Batch Closed").
+		SetOverview("Batch committed or discarded before and can't accept any more changes").
+		SetUserNote("").
+		SetDevNote("Get a new batch by Batch() method of the storage").
+		SetTAGS([]string{}),
+	)
+	ErrKeyTooLong.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Key Too Long").
+		SetOverview("Given key is longer than the storage engine can store").
+		SetUserNote("").
+		SetDevNote("Use a hash of long keys as the key").
+		SetTAGS([]string{}),
+	)
+	ErrOutOfRange.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Out Of Range").
+		SetOverview("Requested offset or limit is out of the storage capacity").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrCorrupted.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Corrupted").
+		SetOverview("Storage data on the device is not valid and can't recover automatically").
+		SetUserNote("Restore the data from a backup").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrTimeEpoch.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Time Epoch").
+		SetOverview("Given time isn't elapsed from the epoch that the storage use").
+		SetUserNote("").
+		SetDevNote("Give a unix time e.g. by libgo/time/unix package").
+		SetTAGS([]string{}),
+	)
+
+	ErrRecordLocked.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Record Locked").
+		SetOverview("Requested record locked by other process and can't change until it unlocked").
+		SetUserNote("").
+		SetDevNote("Use Lock() and Unlock() to change a record in strict consistency manner").
+		SetTAGS([]string{}),
+	)
+	ErrRecordNotLocked.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Record Not Locked").
+		SetOverview("Unlock() called on a record that not locked before").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrVersionNotExist.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Version Not Exist").
+		SetOverview("Requested version of the record never saved or dropped by the record MaxVersion retention").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrVersionDeleted.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Version Deleted").
+		SetOverview("Requested version of the record exist but its data deleted by DeleteVersion()").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrVersionNotLast.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Version Not Last").
+		SetOverview("Changes on the local tier sync to the distributed tier just by the last version of the record").
+		SetUserNote("").
+		SetDevNote("Update the last version by StorageRecord_LastLocalVersion or write to the distributed tier").
+		SetTAGS([]string{}),
+	)
+	ErrIndexUnique.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Index Unique").
+		SetOverview("The change make two records with the same value in a unique index").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+
+	ErrObjectNotLocked.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Object Not Locked").
+		SetOverview("Requested object to unlock is not locked by Lock()").
+		SetUserNote("").
+		SetDevNote("Call Unlock() just once after each Lock()").
+		SetTAGS([]string{}),
+	)
+	ErrNoSpace.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("No Space").
+		SetOverview("Storage device can't extend to hold the requested data").
+		SetUserNote("Free some space on the storage device and try again").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+
+	ErrExist.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Exist").
+		SetOverview("A file or directory with requested name exist already").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrInvalidPath.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Invalid Path").
+		SetOverview("Requested path is empty, has empty, \".\" or \"..\" parts, or point out of the directory").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrReadOnly.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Read Only").
+		SetOverview("Requested storage can't change").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+
+	ErrBadKey.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Bad Key").
+		SetOverview("Encryption key isn't a valid AES-256 key or the key of the stored data isn't given").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+
+	ErrStream.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Stream").
+		SetOverview("Read from or write to the snapshot stream failed or the stream ended before its last entry").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrFrameTooLarge.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Frame Too Large").
+		SetOverview("Encoded entry of the snapshot is more than 1GiB and can't fit in a frame").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+
+	ErrLeaseOwner.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Lease Owner").
+		SetOverview("Given token isn't the token of the lease holder").
+		SetUserNote("").
+		SetDevNote("Use the token that returned by LockLease() and renew the lease before its TTL pass").
+		SetTAGS([]string{}),
+	)
+	ErrLeaseCanceled.SetDetail(detail.New(protocol.LanguageEnglish, domainEnglish).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("Lease Canceled").
+		SetOverview("Waiting for the lease canceled by the caller before the lease released").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+}
@@ -0,0 +1,262 @@
+//go:build lang_per
+
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/detail"
+	"libgo/protocol"
+)
+
+const domainPersian = "ذخیره سازی"
+
+func init() {
+	ErrNotExist.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("وجود ندارد").
+		SetOverview("کلید، شی یا رکورد درخواست شده در ذخیره ساز وجود ندارد").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrKeyLocked.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("کلید قفل است").
+		SetOverview("کلید درخواست شده توسط فرایند دیگری قفل شده است و تا باز شدن قفل قابل تغییر نیست").
+		SetUserNote("").
+		SetDevNote("بعدا دوباره تلاش کنید یا با Lock() منتظر نوبت خود بمانید").
+		SetTAGS([]string{}),
+	)
+	ErrKeyNotLocked.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("کلید قفل نیست").
+		SetOverview("Unlock() برای کلیدی فراخوانی شده که قبلا قفل نشده است").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+
+	ErrBatchClosed.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("دسته بسته شده").
+		SetOverview("دسته قبلا ثبت یا رها شده است و تغییر جدیدی نمی پذیرد").
+		SetUserNote("").
+		SetDevNote("با متد Batch() ذخیره ساز یک دسته جدید بگیرید").
+		SetTAGS([]string{}),
+	)
+	ErrKeyTooLong.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("کلید بیش از حد طولانی").
+		SetOverview("کلید داده شده طولانی تر از حدی است که موتور ذخیره ساز می تواند ذخیره کند").
+		SetUserNote("").
+		SetDevNote("از هش کلیدهای طولانی به عنوان کلید استفاده کنید").
+		SetTAGS([]string{}),
+	)
+	ErrOutOfRange.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("خارج از محدوده").
+		SetOverview("آفست یا محدودیت درخواست شده خارج از ظرفیت ذخیره ساز است").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrCorrupted.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("خراب شده").
+		SetOverview("داده ذخیره ساز روی دستگاه معتبر نیست و به صورت خودکار قابل بازیابی نیست").
+		SetUserNote("داده را از یک نسخه پشتیبان بازیابی کنید").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrTimeEpoch.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("مبدا زمان").
+		SetOverview("زمان داده شده از مبدایی که ذخیره ساز استفاده می کند سپری نشده است").
+		SetUserNote("").
+		SetDevNote("یک زمان یونیکس بدهید برای مثال با بسته libgo/time/unix").
+		SetTAGS([]string{}),
+	)
+
+	ErrRecordLocked.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("رکورد قفل است").
+		SetOverview("رکورد درخواست شده توسط فرایند دیگری قفل شده است و تا باز شدن قفل قابل تغییر نیست").
+		SetUserNote("").
+		SetDevNote("برای تغییر رکورد با سازگاری سخت از Lock() و Unlock() استفاده کنید").
+		SetTAGS([]string{}),
+	)
+	ErrRecordNotLocked.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("رکورد قفل نیست").
+		SetOverview("Unlock() برای رکوردی فراخوانی شده که قبلا قفل نشده است").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrVersionNotExist.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("نسخه وجود ندارد").
+		SetOverview("نسخه درخواست شده رکورد هرگز ذخیره نشده یا با نگهداری MaxVersion رکورد حذف شده است").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrVersionDeleted.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("نسخه حذف شده").
+		SetOverview("نسخه درخواست شده رکورد وجود دارد ولی داده آن با DeleteVersion() حذف شده است").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrVersionNotLast.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("نسخه آخر نیست").
+		SetOverview("تغییرات لایه محلی فقط با آخرین نسخه رکورد با لایه توزیع شده همگام می شوند").
+		SetUserNote("").
+		SetDevNote("آخرین نسخه را با StorageRecord_LastLocalVersion به روز کنید یا در لایه توزیع شده بنویسید").
+		SetTAGS([]string{}),
+	)
+	ErrIndexUnique.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("شاخص یکتا").
+		SetOverview("این تغییر دو رکورد با مقدار یکسان در یک شاخص یکتا ایجاد می کند").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+
+	ErrObjectNotLocked.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("شی قفل نیست").
+		SetOverview("شی درخواست شده برای باز کردن قفل با Lock() قفل نشده است").
+		SetUserNote("").
+		SetDevNote("Unlock() را فقط یک بار بعد از هر Lock() فراخوانی کنید").
+		SetTAGS([]string{}),
+	)
+	ErrNoSpace.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("فضا وجود ندارد").
+		SetOverview("دستگاه ذخیره ساز برای نگهداری داده درخواست شده قابل گسترش نیست").
+		SetUserNote("مقداری فضا روی دستگاه ذخیره ساز آزاد کنید و دوباره تلاش کنید").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+
+	ErrExist.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("وجود دارد").
+		SetOverview("فایل یا پوشه ای با نام درخواست شده از قبل وجود دارد").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrInvalidPath.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("مسیر نامعتبر").
+		SetOverview("مسیر درخواست شده خالی است، بخش خالی، \".\" یا \"..\" دارد یا به بیرون پوشه اشاره می کند").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrReadOnly.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("فقط خواندنی").
+		SetOverview("ذخیره ساز درخواست شده قابل تغییر نیست").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+
+	ErrBadKey.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("کلید نامعتبر").
+		SetOverview("کلید رمزنگاری یک کلید معتبر AES-256 نیست یا کلید داده ذخیره شده داده نشده است").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+
+	ErrStream.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("جریان").
+		SetOverview("خواندن از جریان اسنپ شات یا نوشتن در آن ناموفق بود یا جریان پیش از آخرین ورودی خود تمام شد").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+	ErrFrameTooLarge.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("قاب بیش از حد بزرگ").
+		SetOverview("ورودی کدگذاری شده اسنپ شات بیش از ۱ گیگابایت است و در یک قاب جا نمی شود").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+
+	ErrLeaseOwner.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("مالک اجاره").
+		SetOverview("توکن داده شده توکن دارنده اجاره نیست").
+		SetUserNote("").
+		SetDevNote("از توکنی که LockLease() برگردانده استفاده کنید و اجاره را پیش از گذشت TTL آن تمدید کنید").
+		SetTAGS([]string{}),
+	)
+	ErrLeaseCanceled.SetDetail(detail.New(protocol.LanguagePersian, domainPersian).
+		SetName("").
+		SetAbbreviation("").
+		SetAliases([]string{}).
+		SetSummary("اجاره لغو شد").
+		SetOverview("انتظار برای اجاره پیش از آزاد شدن آن توسط فراخوان لغو شد").
+		SetUserNote("").
+		SetDevNote("").
+		SetTAGS([]string{}),
+	)
+}
@@ -0,0 +1,84 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/binary"
+	"libgo/protocol"
+)
+
+// object is the primary index entry of an object in Objects.
+// Object data is the concatenation of its chunks on the block and just first length bytes of them are valid.
+type object struct {
+	length uint64
+	chunks []uint32
+}
+
+type objectKey struct {
+	mt protocol.MediaTypeID
+	id [16]byte
+}
+
+const (
+	objectKey_Len          = 8 + 16
+	objectIndex_HeaderLen  = 8
+	objectIndex_ChunkIDLen = 4
+)
+
+func (o *object) clone() (c *object) {
+	c = &object{
+		length: o.length,
+		chunks: append([]uint32(nil), o.chunks...),
+	}
+	return
+}
+
+// encode return the key of the object in the index storage. mt comes first to group objects by their mediatype.
+func (k objectKey) encode() (key []byte) {
+	key = make([]byte, objectKey_Len)
+	binary.LittleEndian(key).PutUint64(uint64(k.mt))
+	copy(key[8:], k.id[:])
+	return
+}
+
+func (k *objectKey) decode(key []byte) (err protocol.Error) {
+	if len(key) != objectKey_Len {
+		return &ErrCorrupted
+	}
+	k.mt = protocol.MediaTypeID(binary.LittleEndian(key).Uint64())
+	copy(k.id[:], key[8:])
+	return
+}
+
+// encode return the index value of the object as length(8) and then chunk numbers(4) one after another.
+func (o *object) encode() (value []byte) {
+	value = make([]byte, objectIndex_HeaderLen+len(o.chunks)*objectIndex_ChunkIDLen)
+	binary.LittleEndian(value).PutUint64(o.length)
+	var buf = value[objectIndex_HeaderLen:]
+	for i, c := range o.chunks {
+		binary.LittleEndian(buf[i*objectIndex_ChunkIDLen:]).PutUint32(c)
+	}
+	return
+}
+
+func (o *object) decode(value []byte, chunkSize int) (err protocol.Error) {
+	if len(value) < objectIndex_HeaderLen || (len(value)-objectIndex_HeaderLen)%objectIndex_ChunkIDLen != 0 {
+		return &ErrCorrupted
+	}
+	o.length = binary.LittleEndian(value).Uint64()
+	var buf = value[objectIndex_HeaderLen:]
+	var num = len(buf) / objectIndex_ChunkIDLen
+	if uint64(num) != chunksFor(o.length, chunkSize) {
+		return &ErrCorrupted
+	}
+	o.chunks = make([]uint32, num)
+	for i := range o.chunks {
+		o.chunks[i] = binary.LittleEndian(buf[i*objectIndex_ChunkIDLen:]).Uint32()
+	}
+	return
+}
+
+// chunksFor return number of chunks need to hold ln bytes.
+func chunksFor(ln uint64, chunkSize int) uint64 {
+	return (ln + uint64(chunkSize) - 1) / uint64(chunkSize)
+}
@@ -0,0 +1,134 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/protocol"
+)
+
+// objectsBatch implement protocol.StorageObjects_Batch for Objects.
+// Commit() apply all operations in one transaction, so the index change in one atomic batch just if all operations succeed.
+type objectsBatch struct {
+	obs    *Objects
+	ops    []objectsBatchOperation
+	closed bool
+}
+
+type objectsBatchOperation struct {
+	kind   batchOperation
+	mt     protocol.MediaTypeID
+	id     [16]byte
+	offset uint64 // length in Extend
+	data   []byte
+}
+
+//libgo:impl libgo/protocol.StorageObjects_Batch
+func (b *objectsBatch) Save(mt protocol.MediaTypeID, id [16]byte, object []byte) (err protocol.Error) {
+	err = b.add(objectsBatchOperation{kind: batchOperation_Save, mt: mt, id: id, data: cloneBytes(object)})
+	return
+}
+func (b *objectsBatch) Write(mt protocol.MediaTypeID, id [16]byte, offset uint64, data []byte) (err protocol.Error) {
+	err = b.add(objectsBatchOperation{kind: batchOperation_Write, mt: mt, id: id, offset: offset, data: cloneBytes(data)})
+	return
+}
+func (b *objectsBatch) Append(mt protocol.MediaTypeID, id [16]byte, data []byte) (err protocol.Error) {
+	err = b.add(objectsBatchOperation{kind: batchOperation_Append, mt: mt, id: id, data: cloneBytes(data)})
+	return
+}
+func (b *objectsBatch) Prepend(mt protocol.MediaTypeID, id [16]byte, data []byte) (err protocol.Error) {
+	err = b.add(objectsBatchOperation{kind: batchOperation_Prepend, mt: mt, id: id, data: cloneBytes(data)})
+	return
+}
+func (b *objectsBatch) Delete(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	err = b.add(objectsBatchOperation{kind: batchOperation_Delete, mt: mt, id: id})
+	return
+}
+func (b *objectsBatch) Erase(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	err = b.add(objectsBatchOperation{kind: batchOperation_Erase, mt: mt, id: id})
+	return
+}
+
+//libgo:impl libgo/protocol.StorageBatch
+func (b *objectsBatch) Commit() (err protocol.Error) {
+	if b.closed {
+		return &ErrBatchClosed
+	}
+	b.closed = true
+
+	var obs = b.obs
+	obs.sync.Lock()
+	var tx = obs.begin()
+	for i := range b.ops {
+		err = b.ops[i].apply(&tx)
+		if err != nil {
+			tx.rollback()
+			obs.sync.Unlock()
+			return
+		}
+	}
+	err = tx.commit()
+	obs.sync.Unlock()
+	b.ops = nil
+	return
+}
+func (b *objectsBatch) Discard() {
+	b.closed = true
+	b.ops = nil
+}
+
+func (b *objectsBatch) add(op objectsBatchOperation) (err protocol.Error) {
+	if b.closed {
+		return &ErrBatchClosed
+	}
+	b.ops = append(b.ops, op)
+	return
+}
+
+// replay queue all operations on the given batch.
+func (b *objectsBatch) replay(to protocol.StorageObjects_Batch) (err protocol.Error) {
+	for _, op := range b.ops {
+		switch op.kind {
+		case batchOperation_Save:
+			err = to.Save(op.mt, op.id, op.data)
+		case batchOperation_Write:
+			err = to.Write(op.mt, op.id, op.offset, op.data)
+		case batchOperation_Append:
+			err = to.Append(op.mt, op.id, op.data)
+		case batchOperation_Prepend:
+			err = to.Prepend(op.mt, op.id, op.data)
+		case batchOperation_Delete:
+			err = to.Delete(op.mt, op.id)
+		case batchOperation_Erase:
+			err = to.Erase(op.mt, op.id)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (op *objectsBatchOperation) apply(tx *objectsTx) (err protocol.Error) {
+	var k = objectKey{op.mt, op.id}
+	switch op.kind {
+	case batchOperation_Save:
+		err = tx.save(k, op.data)
+	case batchOperation_Write:
+		err = tx.write(k, op.offset, op.data)
+	case batchOperation_Append:
+		var o = tx.object(k)
+		if o == nil {
+			return &ErrNotExist
+		}
+		err = tx.write(k, o.length, op.data)
+	case batchOperation_Prepend:
+		err = tx.prepend(k, op.data)
+	case batchOperation_Extend:
+		err = tx.extend(k, op.offset)
+	case batchOperation_Delete:
+		err = tx.delete(k, false)
+	case batchOperation_Erase:
+		err = tx.delete(k, true)
+	}
+	return
+}
@@ -0,0 +1,202 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/protocol"
+)
+
+// ObjectsCache wrap a protocol.StorageObjects to serve repeated reads from a Cache.
+// Whole objects cache by Get() and Save(), and Read() serve from a cached object without call the source.
+// Partial changes (Write, Append, ...) always drop the object from the cache.
+type ObjectsCache struct {
+	Mode CacheMode
+	// MaxObjectSize is the max object length to cache. Zero means any object that fit in the cache budget.
+	MaxObjectSize int
+
+	cache  *Cache
+	source protocol.StorageObjects
+	ns     string
+}
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (oc *ObjectsCache) Init(cache *Cache, source protocol.StorageObjects) (err protocol.Error) {
+	oc.cache = cache
+	oc.source = source
+	oc.ns = cache.namespace()
+	return
+}
+func (oc *ObjectsCache) Deinit() (err protocol.Error) { return }
+
+// Source return the wrapped storage.
+func (oc *ObjectsCache) Source() protocol.StorageObjects { return oc.source }
+
+//libgo:impl libgo/protocol.StorageObjects
+func (oc *ObjectsCache) MediatypeNumbers() (num uint64, err protocol.Error) {
+	return oc.source.MediatypeNumbers()
+}
+func (oc *ObjectsCache) ListMediatypeIDs(offset, limit uint64) (ids []uint64, err protocol.Error) {
+	return oc.source.ListMediatypeIDs(offset, limit)
+}
+func (oc *ObjectsCache) ObjectNumbers(mt protocol.MediaTypeID) (num uint64, err protocol.Error) {
+	return oc.source.ObjectNumbers(mt)
+}
+func (oc *ObjectsCache) ListObjects(mt protocol.MediaTypeID, offset, limit uint64) (ids [][16]byte, err protocol.Error) {
+	return oc.source.ListObjects(mt, offset, limit)
+}
+func (oc *ObjectsCache) Lock(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	return oc.source.Lock(mt, id)
+}
+func (oc *ObjectsCache) Unlock(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	return oc.source.Unlock(mt, id)
+}
+func (oc *ObjectsCache) Length(mt protocol.MediaTypeID, id [16]byte) (ln int, err protocol.Error) {
+	var object, _, ok = oc.cache.get(oc.group(mt, id), "")
+	if ok {
+		ln = len(object)
+		return
+	}
+	return oc.source.Length(mt, id)
+}
+func (oc *ObjectsCache) Get(mt protocol.MediaTypeID, id [16]byte) (object []byte, err protocol.Error) {
+	var group = oc.group(mt, id)
+	var cached, _, ok = oc.cache.get(group, "")
+	if ok {
+		object = cloneBytes(cached)
+		return
+	}
+
+	var ticket = oc.cache.ticket()
+	object, err = oc.source.Get(mt, id)
+	if err == nil && oc.cacheable(object) {
+		oc.cache.fill(ticket, group, "", cloneBytes(object), 0)
+	}
+	return
+}
+func (oc *ObjectsCache) Read(mt protocol.MediaTypeID, id [16]byte, offset, limit uint64) (data []byte, err protocol.Error) {
+	var cached, _, ok = oc.cache.get(oc.group(mt, id), "")
+	if !ok {
+		return oc.source.Read(mt, id, offset, limit)
+	}
+	if offset > uint64(len(cached)) {
+		err = &ErrOutOfRange
+		return
+	}
+	var start, end = pageRange(uint64(len(cached)), offset, limit)
+	data = cloneBytes(cached[start:end])
+	return
+}
+func (oc *ObjectsCache) Save(mt protocol.MediaTypeID, id [16]byte, object []byte) (err protocol.Error) {
+	err = oc.source.Save(mt, id, object)
+	if err == nil && oc.Mode == CacheMode_WriteThrough && oc.cacheable(object) {
+		oc.cache.put(oc.group(mt, id), "", cloneBytes(object), 0)
+	} else {
+		oc.cache.invalidate(oc.group(mt, id))
+	}
+	return
+}
+func (oc *ObjectsCache) Write(mt protocol.MediaTypeID, id [16]byte, offset uint64, data []byte) (err protocol.Error) {
+	err = oc.source.Write(mt, id, offset, data)
+	oc.cache.invalidate(oc.group(mt, id))
+	return
+}
+func (oc *ObjectsCache) Append(mt protocol.MediaTypeID, id [16]byte, data []byte) (err protocol.Error) {
+	err = oc.source.Append(mt, id, data)
+	oc.cache.invalidate(oc.group(mt, id))
+	return
+}
+func (oc *ObjectsCache) Prepend(mt protocol.MediaTypeID, id [16]byte, data []byte) (err protocol.Error) {
+	err = oc.source.Prepend(mt, id, data)
+	oc.cache.invalidate(oc.group(mt, id))
+	return
+}
+func (oc *ObjectsCache) Extend(mt protocol.MediaTypeID, id [16]byte, length uint64) (err protocol.Error) {
+	err = oc.source.Extend(mt, id, length)
+	oc.cache.invalidate(oc.group(mt, id))
+	return
+}
+func (oc *ObjectsCache) Delete(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	err = oc.source.Delete(mt, id)
+	oc.cache.invalidate(oc.group(mt, id))
+	return
+}
+func (oc *ObjectsCache) Erase(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	err = oc.source.Erase(mt, id)
+	oc.cache.invalidate(oc.group(mt, id))
+	return
+}
+func (oc *ObjectsCache) Batch() (batch protocol.StorageObjects_Batch, err protocol.Error) {
+	var sb protocol.StorageObjects_Batch
+	sb, err = oc.source.Batch()
+	if err != nil {
+		return
+	}
+	batch = &objectsCacheBatch{oc: oc, batch: sb}
+	return
+}
+
+func (oc *ObjectsCache) group(mt protocol.MediaTypeID, id [16]byte) string {
+	return oc.ns + string(objectKey{mt, id}.encode())
+}
+func (oc *ObjectsCache) cacheable(object []byte) bool {
+	return oc.MaxObjectSize == 0 || len(object) <= oc.MaxObjectSize
+}
+
+// objectsCacheBatch forward changes to the source batch and drop changed objects from the cache after Commit().
+type objectsCacheBatch struct {
+	oc     *ObjectsCache
+	batch  protocol.StorageObjects_Batch
+	groups []string
+}
+
+//libgo:impl libgo/protocol.StorageObjects_Batch
+func (b *objectsCacheBatch) Save(mt protocol.MediaTypeID, id [16]byte, object []byte) (err protocol.Error) {
+	err = b.batch.Save(mt, id, object)
+	b.changed(mt, id, err)
+	return
+}
+func (b *objectsCacheBatch) Write(mt protocol.MediaTypeID, id [16]byte, offset uint64, data []byte) (err protocol.Error) {
+	err = b.batch.Write(mt, id, offset, data)
+	b.changed(mt, id, err)
+	return
+}
+func (b *objectsCacheBatch) Append(mt protocol.MediaTypeID, id [16]byte, data []byte) (err protocol.Error) {
+	err = b.batch.Append(mt, id, data)
+	b.changed(mt, id, err)
+	return
+}
+func (b *objectsCacheBatch) Prepend(mt protocol.MediaTypeID, id [16]byte, data []byte) (err protocol.Error) {
+	err = b.batch.Prepend(mt, id, data)
+	b.changed(mt, id, err)
+	return
+}
+func (b *objectsCacheBatch) Delete(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	err = b.batch.Delete(mt, id)
+	b.changed(mt, id, err)
+	return
+}
+func (b *objectsCacheBatch) Erase(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	err = b.batch.Erase(mt, id)
+	b.changed(mt, id, err)
+	return
+}
+
+//libgo:impl libgo/protocol.StorageBatch
+func (b *objectsCacheBatch) Commit() (err protocol.Error) {
+	err = b.batch.Commit()
+	for _, group := range b.groups {
+		b.oc.cache.invalidate(group)
+	}
+	b.groups = nil
+	return
+}
+func (b *objectsCacheBatch) Discard() {
+	b.batch.Discard()
+	b.groups = nil
+}
+
+func (b *objectsCacheBatch) changed(mt protocol.MediaTypeID, id [16]byte, err protocol.Error) {
+	if err == nil {
+		b.groups = append(b.groups, b.oc.group(mt, id))
+	}
+}
@@ -0,0 +1,293 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/protocol"
+)
+
+// objectsTx apply changes of one or more operations on Objects in copy-on-write manner.
+// Data of stored objects never change in place before commit() except the bytes after the object end
+// that no reader can see, so rollback() just need to free chunks allocated in the transaction.
+// Chunks that a change replaces write zero on commit, so no older version of an object remains on the block.
+// Caller must hold Objects lock from begin() until commit() or rollback().
+type objectsTx struct {
+	obs     *Objects
+	changed map[objectKey]*object // nil value means object deleted in the transaction
+	order   []objectKey
+	fresh   map[uint32]struct{} // chunks allocated in the transaction
+	release []uint32            // chunks of deleted objects that must free after commit
+	erase   []uint32            // chunks of replaced or erased objects that must zero and free after commit
+}
+
+func (obs *Objects) begin() (tx objectsTx) {
+	tx = objectsTx{
+		obs:     obs,
+		changed: make(map[objectKey]*object),
+		fresh:   make(map[uint32]struct{}),
+	}
+	return
+}
+
+// object return the object as the transaction see it. It can change the returned object in place.
+func (tx *objectsTx) object(k objectKey) (o *object) {
+	var ok bool
+	o, ok = tx.changed[k]
+	if !ok {
+		o = tx.obs.object(k)
+		if o != nil {
+			o = o.clone()
+		}
+		tx.changed[k] = o
+		tx.order = append(tx.order, k)
+	}
+	return
+}
+
+func (tx *objectsTx) save(k objectKey, data []byte) (err protocol.Error) {
+	var o = tx.object(k)
+	if o != nil {
+		tx.drop(o.chunks, true)
+	}
+	o = &object{}
+	tx.changed[k] = o
+	err = tx.grow(o, uint64(len(data)))
+	if err != nil {
+		return
+	}
+	err = tx.obs.writeChunks(o.chunks, 0, data)
+	return
+}
+
+func (tx *objectsTx) write(k objectKey, offset uint64, data []byte) (err protocol.Error) {
+	var o = tx.object(k)
+	if o == nil {
+		return &ErrNotExist
+	}
+	if offset > o.length {
+		return &ErrOutOfRange
+	}
+
+	var end = offset + uint64(len(data))
+	// Chunks before the object end must copy before write on them, bytes after it are invisible.
+	if offset < o.length {
+		var chunkSize = uint64(tx.obs.ChunkSize)
+		var last = o.length
+		if end < last {
+			last = end
+		}
+		for c := offset / chunkSize; c*chunkSize < last; c++ {
+			err = tx.own(o, int(c))
+			if err != nil {
+				return
+			}
+		}
+	}
+	err = tx.grow(o, end)
+	if err != nil {
+		return
+	}
+	err = tx.obs.writeChunks(o.chunks, offset, data)
+	return
+}
+
+func (tx *objectsTx) prepend(k objectKey, data []byte) (err protocol.Error) {
+	var o = tx.object(k)
+	if o == nil {
+		return &ErrNotExist
+	}
+
+	var no = &object{}
+	err = tx.grow(no, uint64(len(data))+o.length)
+	if err != nil {
+		return
+	}
+	err = tx.obs.writeChunks(no.chunks, 0, data)
+	if err != nil {
+		return
+	}
+	err = tx.copy(no, uint64(len(data)), o, 0, o.length)
+	if err != nil {
+		return
+	}
+	tx.drop(o.chunks, true)
+	tx.changed[k] = no
+	return
+}
+
+func (tx *objectsTx) extend(k objectKey, length uint64) (err protocol.Error) {
+	var o = tx.object(k)
+	if o == nil {
+		return &ErrNotExist
+	}
+	err = tx.grow(o, length)
+	return
+}
+
+func (tx *objectsTx) delete(k objectKey, erase bool) (err protocol.Error) {
+	var o = tx.object(k)
+	if o == nil {
+		return &ErrNotExist
+	}
+	tx.drop(o.chunks, erase)
+	tx.changed[k] = nil
+	return
+}
+
+// grow make the object length bytes by zero data after its current end. It never shrink the object.
+func (tx *objectsTx) grow(o *object, length uint64) (err protocol.Error) {
+	if length <= o.length {
+		return
+	}
+
+	var obs = tx.obs
+	// Bytes after the object end in its last chunk may hold garbage of a failed change.
+	var in = o.length % uint64(obs.ChunkSize)
+	if in != 0 {
+		var last = o.chunks[len(o.chunks)-1]
+		err = obs.block.Erase(obs.chunkOffset(last)+int(in), obs.ChunkSize-int(in))
+		if err != nil {
+			return
+		}
+	}
+
+	var need = chunksFor(length, obs.ChunkSize)
+	for uint64(len(o.chunks)) < need {
+		var c uint32
+		c, err = obs.alloc()
+		if err != nil {
+			return
+		}
+		tx.fresh[c] = struct{}{}
+		o.chunks = append(o.chunks, c)
+	}
+	o.length = length
+	return
+}
+
+// own replace i-th chunk of the object by a copy of it if the chunk isn't allocated in the transaction.
+func (tx *objectsTx) own(o *object, i int) (err protocol.Error) {
+	var old = o.chunks[i]
+	var _, fresh = tx.fresh[old]
+	if fresh {
+		return
+	}
+
+	var obs = tx.obs
+	var c uint32
+	c, err = obs.alloc()
+	if err != nil {
+		return
+	}
+	tx.fresh[c] = struct{}{}
+	err = obs.block.Copy(obs.chunkOffset(c), obs.chunkOffset(old), obs.ChunkSize)
+	if err != nil {
+		return
+	}
+	o.chunks[i] = c
+	tx.erase = append(tx.erase, old)
+	return
+}
+
+// copy copy limit bytes of src object from srcOffset to des object from desOffset on the block.
+func (tx *objectsTx) copy(des *object, desOffset uint64, src *object, srcOffset uint64, limit uint64) (err protocol.Error) {
+	var obs = tx.obs
+	var chunkSize = uint64(obs.ChunkSize)
+	for limit > 0 {
+		var dc, din = desOffset / chunkSize, desOffset % chunkSize
+		var sc, sin = srcOffset / chunkSize, srcOffset % chunkSize
+		var n = chunkSize - din
+		if chunkSize-sin < n {
+			n = chunkSize - sin
+		}
+		if limit < n {
+			n = limit
+		}
+		err = obs.block.Copy(obs.chunkOffset(des.chunks[dc])+int(din), obs.chunkOffset(src.chunks[sc])+int(sin), int(n))
+		if err != nil {
+			return
+		}
+		desOffset += n
+		srcOffset += n
+		limit -= n
+	}
+	return
+}
+
+// drop mark chunks as unused. Chunks of stored objects free just after commit.
+func (tx *objectsTx) drop(chunks []uint32, erase bool) {
+	for _, c := range chunks {
+		var _, fresh = tx.fresh[c]
+		switch {
+		case fresh:
+			// Never visible to any reader, so it can reuse in this transaction and erase on reuse.
+			delete(tx.fresh, c)
+			tx.obs.free = append(tx.obs.free, c)
+		case erase:
+			tx.erase = append(tx.erase, c)
+		default:
+			tx.release = append(tx.release, c)
+		}
+	}
+}
+
+// commit flush new data to the block, then commit the index changes in one atomic batch,
+// and finally make changes visible to readers and free unused chunks.
+func (tx *objectsTx) commit() (err protocol.Error) {
+	var obs = tx.obs
+	err = obs.block.Flush()
+	if err != nil {
+		tx.rollback()
+		return
+	}
+
+	var batch protocol.StorageKeyValue_Batch
+	batch, err = obs.index.Batch()
+	if err != nil {
+		tx.rollback()
+		return
+	}
+	for _, k := range tx.order {
+		var o = tx.changed[k]
+		switch {
+		case o != nil:
+			err = batch.Set(k.encode(), o.encode(), protocol.StorageKeyValue_SaveOptions{})
+		case obs.object(k) != nil:
+			err = batch.Delete(k.encode())
+		}
+		if err != nil {
+			batch.Discard()
+			tx.rollback()
+			return
+		}
+	}
+	err = batch.Commit()
+	if err != nil {
+		tx.rollback()
+		return
+	}
+
+	for _, k := range tx.order {
+		obs.put(k, tx.changed[k])
+	}
+	obs.free = append(obs.free, tx.release...)
+	for _, c := range tx.erase {
+		// Chunks are free even if erase failed and will erase on reuse.
+		obs.free = append(obs.free, c)
+		if err == nil {
+			err = obs.block.Erase(obs.chunkOffset(c), obs.ChunkSize)
+		}
+	}
+	if len(tx.erase) > 0 && err == nil {
+		err = obs.block.Flush()
+	}
+	return
+}
+
+// rollback free chunks allocated in the transaction. Stored objects are untouched.
+func (tx *objectsTx) rollback() {
+	for c := range tx.fresh {
+		tx.obs.free = append(tx.obs.free, c)
+	}
+	tx.fresh = nil
+}
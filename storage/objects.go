@@ -0,0 +1,412 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/sha3"
+
+	"libgo/protocol"
+)
+
+// Objects is a persistent protocol.StorageObjects that store objects data in fixed size chunks on a protocol.StorageBlock
+// and keep the primary index (object length and its chunk numbers) in a protocol.StorageKeyValue.
+//   - Read() and Write() just touch the chunks that cover the requested range, so objects never load entirely.
+//   - Any change write data to new chunks (copy-on-write) and then commit the index, so readers and
+//     a crash never see a half written change.
+//   - Delete() just remove the object from the index and leave its data on the block until the chunks reused,
+//     but Erase() write zero data to the object chunks too. Chunks that Save(), Write() or Prepend() replace write zero
+//     on commit, so Erase() leave no older version of the object on the block.
+//   - Lock() and Unlock() are advisory: Lock() wait until no one else hold the object lock.
+//     Locks are leases that expire if their holders don't renew or release them, see leases.
+//   - It is safe to call its methods concurrently.
+type Objects struct {
+	// ChunkSize is the allocation unit of objects data on the block. Zero means objects_DefaultChunkSize.
+	// It must not change after any object stored on the block.
+	ChunkSize int
+
+	block protocol.StorageBlock
+	index protocol.StorageKeyValue
+
+	sync       sync.Mutex
+	leases     leases
+	mediatypes map[protocol.MediaTypeID]*objectsMediatype
+	mtIDs      []uint64 // sorted to serve ListMediatypeIDs() in stable order
+	chunks     uint32   // number of chunks allocated on the block
+	free       []uint32 // chunks not used by any object, reused before allocate new chunks
+}
+
+type objectsMediatype struct {
+	ids     [][16]byte // sorted to serve ListObjects() in stable order
+	objects map[[16]byte]*object
+}
+
+const objects_DefaultChunkSize = 64 << 10
+
+// ObjectID return the suggested ID of an object by its data as protocol.StorageObjects suggest.
+// It is the first 128bit of sha3-256 hash of the data.
+func ObjectID(data []byte) (id [16]byte) {
+	var hash = sha3.Sum256(data)
+	copy(id[:], hash[:])
+	return
+}
+
+// Init read the primary index from index storage and prepare objects stored on the block.
+// block and index must be the same storages used before to store the objects, or both must be empty.
+//
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (obs *Objects) Init(block protocol.StorageBlock, index protocol.StorageKeyValue) (err protocol.Error) {
+	if obs.ChunkSize < 1 {
+		obs.ChunkSize = objects_DefaultChunkSize
+	}
+	obs.block = block
+	obs.index = index
+	err = obs.leases.init(&obs.sync, &ErrKeyLocked, &ErrObjectNotLocked)
+	if err != nil {
+		return
+	}
+	obs.mediatypes = make(map[protocol.MediaTypeID]*objectsMediatype)
+	obs.chunks = uint32(block.Cap() / obs.ChunkSize)
+
+	var used = make([]bool, obs.chunks)
+	var keys [][]byte
+	keys, err = index.ListKeys(0, ^uint64(0))
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		var k objectKey
+		err = k.decode(key)
+		if err != nil {
+			return
+		}
+		var value []byte
+		value, err = index.Get(key)
+		if err != nil {
+			return
+		}
+		var o object
+		err = o.decode(value, obs.ChunkSize)
+		if err != nil {
+			return
+		}
+		for _, c := range o.chunks {
+			if c >= obs.chunks || used[c] {
+				return &ErrCorrupted
+			}
+			used[c] = true
+		}
+		obs.put(k, &o)
+	}
+
+	// Push in reverse order to reuse lower chunks first.
+	for c := len(used) - 1; c >= 0; c-- {
+		if !used[c] {
+			obs.free = append(obs.free, uint32(c))
+		}
+	}
+	return
+}
+func (obs *Objects) Deinit() (err protocol.Error) {
+	obs.sync.Lock()
+	err = obs.block.Flush()
+	var leasesErr = obs.leases.deinit()
+	if err == nil {
+		err = leasesErr
+	}
+	obs.mediatypes = nil
+	obs.mtIDs = nil
+	obs.free = nil
+	obs.sync.Unlock()
+	return
+}
+
+//libgo:impl libgo/protocol.StorageObjects
+func (obs *Objects) MediatypeNumbers() (num uint64, err protocol.Error) {
+	obs.sync.Lock()
+	num = uint64(len(obs.mtIDs))
+	obs.sync.Unlock()
+	return
+}
+func (obs *Objects) ListMediatypeIDs(offset, limit uint64) (ids []uint64, err protocol.Error) {
+	obs.sync.Lock()
+	var start, end = pageRange(uint64(len(obs.mtIDs)), offset, limit)
+	ids = append([]uint64(nil), obs.mtIDs[start:end]...)
+	obs.sync.Unlock()
+	return
+}
+func (obs *Objects) ObjectNumbers(mt protocol.MediaTypeID) (num uint64, err protocol.Error) {
+	obs.sync.Lock()
+	var om = obs.mediatypes[mt]
+	if om != nil {
+		num = uint64(len(om.ids))
+	}
+	obs.sync.Unlock()
+	return
+}
+func (obs *Objects) ListObjects(mt protocol.MediaTypeID, offset, limit uint64) (ids [][16]byte, err protocol.Error) {
+	obs.sync.Lock()
+	var om = obs.mediatypes[mt]
+	if om != nil {
+		var start, end = pageRange(uint64(len(om.ids)), offset, limit)
+		ids = append([][16]byte(nil), om.ids[start:end]...)
+	}
+	obs.sync.Unlock()
+	return
+}
+
+// Lock wait until no one else hold the lock of the object and then hold it until Unlock() called.
+// The object doesn't need to exist, so it can also use to serialize the object creation.
+// The lock is a lease that expire after leases_DefaultTTL, so call Unlock() before it or use LockLease() instead.
+func (obs *Objects) Lock(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	obs.sync.Lock()
+	_, err = obs.leases.acquire(string(objectKey{mt, id}.encode()), protocol.StorageLease_Options{Wait: -1}, true)
+	obs.sync.Unlock()
+	return
+}
+
+// Unlock release the lock get by Lock(). It return ErrLeaseOwner if the object is locked by LockLease().
+func (obs *Objects) Unlock(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	var k = string(objectKey{mt, id}.encode())
+	obs.sync.Lock()
+	err = obs.leases.release(k, obs.leases.plainToken(k))
+	obs.sync.Unlock()
+	return
+}
+
+// LockLease is like Lock() but wait for the current holder as options says and return a random token
+// that just its holder can renew or release the lease by it. It return ErrKeyLocked if the wait time passed.
+//
+//libgo:impl libgo/protocol.StorageObjects_Leases
+func (obs *Objects) LockLease(mt protocol.MediaTypeID, id [16]byte, options protocol.StorageLease_Options) (token protocol.StorageLeaseToken, err protocol.Error) {
+	obs.sync.Lock()
+	token, err = obs.leases.acquire(string(objectKey{mt, id}.encode()), options, false)
+	obs.sync.Unlock()
+	return
+}
+func (obs *Objects) RenewLease(mt protocol.MediaTypeID, id [16]byte, token protocol.StorageLeaseToken, ttl protocol.Duration) (err protocol.Error) {
+	obs.sync.Lock()
+	err = obs.leases.renew(string(objectKey{mt, id}.encode()), token, ttl)
+	obs.sync.Unlock()
+	return
+}
+func (obs *Objects) UnlockLease(mt protocol.MediaTypeID, id [16]byte, token protocol.StorageLeaseToken) (err protocol.Error) {
+	obs.sync.Lock()
+	err = obs.leases.release(string(objectKey{mt, id}.encode()), token)
+	obs.sync.Unlock()
+	return
+}
+
+func (obs *Objects) Length(mt protocol.MediaTypeID, id [16]byte) (ln int, err protocol.Error) {
+	obs.sync.Lock()
+	var o = obs.object(objectKey{mt, id})
+	if o == nil {
+		err = &ErrNotExist
+	} else {
+		ln = int(o.length)
+	}
+	obs.sync.Unlock()
+	return
+}
+func (obs *Objects) Get(mt protocol.MediaTypeID, id [16]byte) (object []byte, err protocol.Error) {
+	object, err = obs.Read(mt, id, 0, ^uint64(0))
+	return
+}
+
+// Read return limit bytes of the object from offset, or less if the object ends sooner.
+func (obs *Objects) Read(mt protocol.MediaTypeID, id [16]byte, offset, limit uint64) (data []byte, err protocol.Error) {
+	obs.sync.Lock()
+	defer obs.sync.Unlock()
+
+	var o = obs.object(objectKey{mt, id})
+	if o == nil {
+		err = &ErrNotExist
+		return
+	}
+	if offset > o.length {
+		err = &ErrOutOfRange
+		return
+	}
+	var start, end = pageRange(o.length, offset, limit)
+	data = make([]byte, end-start)
+	err = obs.readChunks(o.chunks, start, data)
+	return
+}
+func (obs *Objects) Save(mt protocol.MediaTypeID, id [16]byte, object []byte) (err protocol.Error) {
+	err = obs.apply(objectsBatchOperation{kind: batchOperation_Save, mt: mt, id: id, data: object})
+	return
+}
+
+// Write overwrite the object from offset by data and grow the object if data pass the object end.
+// offset can't be after the object end, use Extend() to make room first.
+func (obs *Objects) Write(mt protocol.MediaTypeID, id [16]byte, offset uint64, data []byte) (err protocol.Error) {
+	err = obs.apply(objectsBatchOperation{kind: batchOperation_Write, mt: mt, id: id, offset: offset, data: data})
+	return
+}
+func (obs *Objects) Append(mt protocol.MediaTypeID, id [16]byte, data []byte) (err protocol.Error) {
+	err = obs.apply(objectsBatchOperation{kind: batchOperation_Append, mt: mt, id: id, data: data})
+	return
+}
+func (obs *Objects) Prepend(mt protocol.MediaTypeID, id [16]byte, data []byte) (err protocol.Error) {
+	err = obs.apply(objectsBatchOperation{kind: batchOperation_Prepend, mt: mt, id: id, data: data})
+	return
+}
+
+// Extend grow the object to length by zero data. It never shrink the object.
+func (obs *Objects) Extend(mt protocol.MediaTypeID, id [16]byte, length uint64) (err protocol.Error) {
+	err = obs.apply(objectsBatchOperation{kind: batchOperation_Extend, mt: mt, id: id, offset: length})
+	return
+}
+func (obs *Objects) Delete(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	err = obs.apply(objectsBatchOperation{kind: batchOperation_Delete, mt: mt, id: id})
+	return
+}
+func (obs *Objects) Erase(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	err = obs.apply(objectsBatchOperation{kind: batchOperation_Erase, mt: mt, id: id})
+	return
+}
+func (obs *Objects) Batch() (batch protocol.StorageObjects_Batch, err protocol.Error) {
+	batch = &objectsBatch{obs: obs}
+	return
+}
+
+// SaveHashed save the object with ObjectID() of its data as the ID.
+// It doesn't write anything if the same object saved before.
+func (obs *Objects) SaveHashed(mt protocol.MediaTypeID, object []byte) (id [16]byte, err protocol.Error) {
+	id = ObjectID(object)
+	obs.sync.Lock()
+	var exist = obs.object(objectKey{mt, id}) != nil
+	obs.sync.Unlock()
+	if !exist {
+		err = obs.Save(mt, id, object)
+	}
+	return
+}
+
+// apply do one change directly on the store.
+func (obs *Objects) apply(op objectsBatchOperation) (err protocol.Error) {
+	obs.sync.Lock()
+	var tx = obs.begin()
+	err = op.apply(&tx)
+	if err == nil {
+		err = tx.commit()
+	} else {
+		tx.rollback()
+	}
+	obs.sync.Unlock()
+	return
+}
+
+// object return the object index entry. Caller must hold the lock.
+func (obs *Objects) object(k objectKey) (o *object) {
+	var om = obs.mediatypes[k.mt]
+	if om != nil {
+		o = om.objects[k.id]
+	}
+	return
+}
+
+// put add, replace or remove (if o is nil) the object in the index. Caller must hold the lock.
+func (obs *Objects) put(k objectKey, o *object) {
+	var om = obs.mediatypes[k.mt]
+	if om == nil {
+		if o == nil {
+			return
+		}
+		om = &objectsMediatype{objects: make(map[[16]byte]*object)}
+		obs.mediatypes[k.mt] = om
+		var i = sort.Search(len(obs.mtIDs), func(i int) bool { return obs.mtIDs[i] >= uint64(k.mt) })
+		obs.mtIDs = append(obs.mtIDs, 0)
+		copy(obs.mtIDs[i+1:], obs.mtIDs[i:])
+		obs.mtIDs[i] = uint64(k.mt)
+	}
+
+	var _, exist = om.objects[k.id]
+	var i = sort.Search(len(om.ids), func(i int) bool { return bytes.Compare(om.ids[i][:], k.id[:]) >= 0 })
+	switch {
+	case o == nil && exist:
+		delete(om.objects, k.id)
+		om.ids = append(om.ids[:i], om.ids[i+1:]...)
+	case o != nil && !exist:
+		om.objects[k.id] = o
+		om.ids = append(om.ids, [16]byte{})
+		copy(om.ids[i+1:], om.ids[i:])
+		om.ids[i] = k.id
+	case o != nil:
+		om.objects[k.id] = o
+	}
+}
+
+// alloc return a zeroed chunk. Caller must hold the lock.
+func (obs *Objects) alloc() (c uint32, err protocol.Error) {
+	var ln = len(obs.free)
+	if ln > 0 {
+		c = obs.free[ln-1]
+		// Reused chunk may hold data of a deleted object.
+		err = obs.block.Erase(obs.chunkOffset(c), obs.ChunkSize)
+		if err != nil {
+			return
+		}
+		obs.free = obs.free[:ln-1]
+		return
+	}
+
+	c = obs.chunks
+	var end = obs.chunkOffset(c) + obs.ChunkSize
+	if obs.block.Cap() < end {
+		var extended int
+		extended, err = obs.block.Extend(end)
+		if err != nil {
+			return
+		}
+		if extended < end {
+			err = &ErrNoSpace
+			return
+		}
+	}
+	obs.chunks++
+	return
+}
+
+func (obs *Objects) chunkOffset(c uint32) int { return int(c) * obs.ChunkSize }
+
+// readChunks read data from offset of the object stored on chunks.
+func (obs *Objects) readChunks(chunks []uint32, offset uint64, data []byte) (err protocol.Error) {
+	var chunkSize = uint64(obs.ChunkSize)
+	for len(data) > 0 {
+		var c, in = offset / chunkSize, offset % chunkSize
+		var n = chunkSize - in
+		if n > uint64(len(data)) {
+			n = uint64(len(data))
+		}
+		err = obs.block.Read(obs.chunkOffset(chunks[c])+int(in), data[:n])
+		if err != nil {
+			return
+		}
+		data = data[n:]
+		offset += n
+	}
+	return
+}
+
+// writeChunks write data from offset of the object stored on chunks.
+func (obs *Objects) writeChunks(chunks []uint32, offset uint64, data []byte) (err protocol.Error) {
+	var chunkSize = uint64(obs.ChunkSize)
+	for len(data) > 0 {
+		var c, in = offset / chunkSize, offset % chunkSize
+		var n = chunkSize - in
+		if n > uint64(len(data)) {
+			n = uint64(len(data))
+		}
+		err = obs.block.Write(obs.chunkOffset(chunks[c])+int(in), data[:n])
+		if err != nil {
+			return
+		}
+		data = data[n:]
+		offset += n
+	}
+	return
+}
@@ -0,0 +1,182 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"bytes"
+	"testing"
+
+	"libgo/protocol"
+	"libgo/time/monotonic"
+)
+
+var _ protocol.StorageObjects = &Objects{}
+var _ protocol.StorageObjects_Leases = &Objects{}
+
+func TestObjects_ReadWrite(t *testing.T) {
+	var block BlockMemory
+	var index KeyValueMemory
+	index.Init()
+	var obs = Objects{ChunkSize: 8}
+	if err := obs.Init(&block, &index); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	const mt protocol.MediaTypeID = 7
+	var data = []byte("hello content addressed world")
+	var id, err = obs.SaveHashed(mt, data)
+	if err != nil {
+		t.Fatalf("SaveHashed() error = %v", err)
+	}
+	if id != ObjectID(data) {
+		t.Errorf("SaveHashed() id = %x, want %x", id, ObjectID(data))
+	}
+
+	var part, _ = obs.Read(mt, id, 6, 7)
+	if string(part) != "content" {
+		t.Errorf("Read() = %q, want content", part)
+	}
+	obs.Write(mt, id, 6, []byte("CONTENT"))
+	obs.Append(mt, id, []byte("!"))
+	obs.Prepend(mt, id, []byte(">> "))
+	var object, _ = obs.Get(mt, id)
+	if string(object) != ">> hello CONTENT addressed world!" {
+		t.Errorf("Get() = %q after Write, Append and Prepend", object)
+	}
+
+	obs.Extend(mt, id, uint64(len(object)+10))
+	object, _ = obs.Get(mt, id)
+	if len(object) != 43 || !bytes.Equal(object[33:], make([]byte, 10)) {
+		t.Errorf("Extend() = %q, want 10 zero bytes at the end", object)
+	}
+	if err = obs.Write(mt, id, 100, []byte("x")); err != &ErrOutOfRange {
+		t.Errorf("Write() after end error = %v, want ErrOutOfRange", err)
+	}
+
+	var ids, _ = obs.ListObjects(mt, 0, 10)
+	if len(ids) != 1 || ids[0] != id {
+		t.Errorf("ListObjects() = %x, want [%x]", ids, id)
+	}
+
+	var recovered = Objects{ChunkSize: 8}
+	if err = recovered.Init(&block, &index); err != nil {
+		t.Fatalf("recover Init() error = %v", err)
+	}
+	var again, _ = recovered.Get(mt, id)
+	if !bytes.Equal(again, object) {
+		t.Errorf("recovered Get() = %q, want %q", again, object)
+	}
+}
+
+func TestObjects_DeleteErase(t *testing.T) {
+	var block BlockMemory
+	var index KeyValueMemory
+	index.Init()
+	var obs = Objects{ChunkSize: 16}
+	obs.Init(&block, &index)
+
+	const mt protocol.MediaTypeID = 1
+	var deleted, erased = [16]byte{1}, [16]byte{2}
+	obs.Save(mt, deleted, []byte("deleted-data"))
+	obs.Save(mt, erased, []byte("erased-secret"))
+	obs.Write(mt, erased, 0, []byte("changed"))
+	obs.Prepend(mt, erased, []byte("prepended-"))
+
+	obs.Delete(mt, deleted)
+	obs.Erase(mt, erased)
+	if num, _ := obs.ObjectNumbers(mt); num != 0 {
+		t.Errorf("ObjectNumbers() = %d, want 0", num)
+	}
+	if loc, _ := block.Search([]byte("deleted-data"), 0); loc == -1 {
+		t.Errorf("Delete() must just remove the object from index")
+	}
+	if loc, _ := block.Search([]byte("erased-secret"), 0); loc != -1 {
+		t.Errorf("Erase() don't write zero data to object location")
+	}
+	if loc, _ := block.Search([]byte("changed"), 0); loc != -1 {
+		t.Errorf("Erase() don't write zero data to object location of the older versions")
+	}
+	if _, err := obs.Get(mt, deleted); err != &ErrNotExist {
+		t.Errorf("Get() deleted object error = %v, want ErrNotExist", err)
+	}
+}
+
+func TestObjects_Batch(t *testing.T) {
+	var block BlockMemory
+	var index KeyValueMemory
+	index.Init()
+	var obs = Objects{ChunkSize: 4}
+	obs.Init(&block, &index)
+
+	const mt protocol.MediaTypeID = 1
+	var a, b = [16]byte{1}, [16]byte{2}
+	obs.Save(mt, a, []byte("aaaaaaaa"))
+
+	var batch, _ = obs.Batch()
+	batch.Write(mt, a, 2, []byte("XX"))
+	batch.Save(mt, b, []byte("bbbb"))
+	batch.Append(mt, [16]byte{3}, []byte("not exist"))
+	if err := batch.Commit(); err != &ErrNotExist {
+		t.Fatalf("Commit() error = %v, want ErrNotExist", err)
+	}
+	var object, _ = obs.Get(mt, a)
+	if string(object) != "aaaaaaaa" {
+		t.Errorf("failed batch change object to %q", object)
+	}
+	if _, err := obs.Get(mt, b); err != &ErrNotExist {
+		t.Errorf("failed batch save an object")
+	}
+
+	batch, _ = obs.Batch()
+	batch.Write(mt, a, 2, []byte("XX"))
+	batch.Save(mt, b, []byte("bbbb"))
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	object, _ = obs.Get(mt, a)
+	if string(object) != "aaXXaaaa" {
+		t.Errorf("Get() = %q, want aaXXaaaa", object)
+	}
+	// Chunks of the first failed batch and the overwritten chunk must reuse.
+	if len(obs.free)+3 != int(obs.chunks) {
+		t.Errorf("%d chunks allocated and %d free, want just 3 chunks in use", obs.chunks, len(obs.free))
+	}
+}
+
+func TestObjects_Leases(t *testing.T) {
+	var block BlockMemory
+	var index KeyValueMemory
+	index.Init()
+	var obs Objects
+	obs.Init(&block, &index)
+	defer obs.Deinit()
+
+	const mt protocol.MediaTypeID = 7
+	var id = [16]byte{1}
+	if err := obs.Lock(mt, id); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	var _, err = obs.LockLease(mt, id, protocol.StorageLease_Options{Wait: 5 * monotonic.Millisecond})
+	if err != &ErrKeyLocked {
+		t.Errorf("LockLease() wait timeout error = %v, want ErrKeyLocked", err)
+	}
+
+	var locked = make(chan protocol.StorageLeaseToken)
+	go func() {
+		var token, _ = obs.LockLease(mt, id, protocol.StorageLease_Options{Wait: -1})
+		locked <- token
+	}()
+	if err = obs.Unlock(mt, id); err != nil {
+		t.Errorf("Unlock() error = %v", err)
+	}
+	var token = <-locked
+	if err = obs.UnlockLease(mt, id, protocol.StorageLeaseToken{}); err != &ErrLeaseOwner {
+		t.Errorf("UnlockLease() by other token error = %v, want ErrLeaseOwner", err)
+	}
+	if err = obs.UnlockLease(mt, id, token); err != nil {
+		t.Errorf("UnlockLease() error = %v", err)
+	}
+	if err = obs.Unlock(mt, id); err != &ErrObjectNotLocked {
+		t.Errorf("Unlock() not locked object error = %v, want ErrObjectNotLocked", err)
+	}
+}
@@ -0,0 +1,48 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/event"
+	"libgo/protocol"
+	"libgo/time/unix"
+)
+
+// RecordOperation indicate which change on a record cause a RecordEvent.
+type RecordOperation uint8
+
+const (
+	RecordOperation_Unset RecordOperation = iota
+	RecordOperation_Save
+	RecordOperation_Update
+	RecordOperation_Delete
+	RecordOperation_DeleteVersion
+)
+
+// RecordEvent dispatch by record storages on any change on a record.
+// Listeners must add by RecordEvent_MediaType.ID() as the domain and check RecordMediaTypeID() for the records they need.
+type RecordEvent struct {
+	event.Event
+
+	operation         RecordOperation
+	recordMediaTypeID protocol.MediaTypeID
+	recordID          [16]byte
+	version           protocol.VersionOffset
+}
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (e *RecordEvent) Init(op RecordOperation, mt protocol.MediaTypeID, id [16]byte, vo protocol.VersionOffset) {
+	e.operation = op
+	e.recordMediaTypeID = mt
+	e.recordID = id
+	e.version = vo
+	// TODO::: set NodeID???
+	e.Event.Init(&RecordEvent_MediaType, [16]byte{}, unix.Now())
+}
+
+func (e *RecordEvent) Operation() RecordOperation              { return e.operation }
+func (e *RecordEvent) RecordMediaTypeID() protocol.MediaTypeID { return e.recordMediaTypeID }
+func (e *RecordEvent) RecordID() [16]byte                      { return e.recordID }
+
+// Version return the absolute version offset that changed. It is meaningless for RecordOperation_Delete.
+func (e *RecordEvent) Version() protocol.VersionOffset { return e.version }
@@ -0,0 +1,135 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/protocol"
+)
+
+// record hold all retained versions of a record.
+// Version offsets are absolute from the first version ever saved, so they don't change when old versions drop by retention.
+// - protocol.StorageRecord_NoVersion address the oldest retained version, as it is "first version in Get logic".
+// - protocol.StorageRecord_Last*Version address the last version. All of them are same in a local storage.
+type record struct {
+	maxVersion protocol.VersionOffset
+	first      protocol.VersionOffset // absolute offset of versions[0]
+	versions   []recordVersion
+	locked     bool
+	created    int64 // unix nano of the first save
+	splitting  protocol.StorageRecord_IndexSplitting
+}
+
+type recordVersion struct {
+	data    []byte
+	deleted bool
+}
+
+// last return absolute offset of the last version.
+func (r *record) last() protocol.VersionOffset {
+	return r.first + protocol.VersionOffset(len(r.versions)) - 1
+}
+
+func (r *record) numbers() protocol.NumberOfVersion { return protocol.NumberOfVersion(r.last() + 1) }
+
+// resolve return absolute offset and index in versions of given offset.
+func (r *record) resolve(vo protocol.VersionOffset) (abs protocol.VersionOffset, i int, err protocol.Error) {
+	switch {
+	case vo >= protocol.StorageRecord_LastLocalVersion:
+		abs = r.last()
+	case vo == protocol.StorageRecord_NoVersion:
+		abs = r.first
+	default:
+		abs = vo
+	}
+	if abs < r.first || abs > r.last() {
+		err = &ErrVersionNotExist
+		return
+	}
+	i = int(abs - r.first)
+	return
+}
+
+// version return data of given version offset.
+func (r *record) version(vo protocol.VersionOffset) (data []byte, abs protocol.VersionOffset, err protocol.Error) {
+	var i int
+	abs, i, err = r.resolve(vo)
+	if err != nil {
+		return
+	}
+	if r.versions[i].deleted {
+		err = &ErrVersionDeleted
+		return
+	}
+	data = r.versions[i].data
+	return
+}
+
+// save add data as a new version and drop oldest versions that exceed maxVersion.
+// NoVersion means just one version, so it replaces the only version.
+func (r *record) save(data []byte, maxVersion protocol.VersionOffset) (abs protocol.VersionOffset) {
+	r.maxVersion = maxVersion
+	if maxVersion == protocol.StorageRecord_NoVersion {
+		r.first = 0
+		r.versions = append(r.versions[:0], recordVersion{data: data})
+		return 0
+	}
+
+	r.versions = append(r.versions, recordVersion{data: data})
+	if maxVersion < protocol.StorageRecord_LastLocalVersion {
+		for protocol.VersionOffset(len(r.versions)) > maxVersion {
+			r.versions[0] = recordVersion{}
+			r.versions = r.versions[1:]
+			r.first++
+		}
+	}
+	return r.last()
+}
+
+func (r *record) update(data []byte, vo protocol.VersionOffset) (abs protocol.VersionOffset, err protocol.Error) {
+	_, abs, err = r.version(vo)
+	if err != nil {
+		return
+	}
+	r.versions[abs-r.first].data = data
+	return
+}
+
+func (r *record) deleteVersion(vo protocol.VersionOffset) (abs protocol.VersionOffset, err protocol.Error) {
+	var i int
+	abs, i, err = r.resolve(vo)
+	if err != nil {
+		return
+	}
+	r.versions[i] = recordVersion{deleted: true}
+	return
+}
+
+// count return number of available versions in [offset, offset+limit). Zero limit means to the last version.
+func (r *record) count(offset, limit uint64) (numbers protocol.NumberOfVersion) {
+	var end = uint64(r.last()) + 1
+	if limit != 0 && offset+limit < end && offset+limit > offset {
+		end = offset + limit
+	}
+	if offset < uint64(r.first) {
+		offset = uint64(r.first)
+	}
+	for abs := offset; abs < end; abs++ {
+		if !r.versions[abs-uint64(r.first)].deleted {
+			numbers++
+		}
+	}
+	return
+}
+
+// clone return a copy that can change without change r. Version data share due to they never change in place.
+func (r *record) clone() (c *record) {
+	c = &record{
+		maxVersion: r.maxVersion,
+		first:      r.first,
+		versions:   append([]recordVersion(nil), r.versions...),
+		locked:     r.locked,
+		created:    r.created,
+		splitting:  r.splitting,
+	}
+	return
+}
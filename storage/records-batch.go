@@ -0,0 +1,130 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/protocol"
+	"libgo/time/unix"
+)
+
+// recordsBatch queue changes of any protocol.StorageRecords_Batch implementation.
+// Implementations embed it and just implement Commit().
+type recordsBatch struct {
+	ops    []recordsBatchOperation
+	closed bool
+}
+
+type recordsBatchOperation struct {
+	kind    batchOperation
+	mt      protocol.MediaTypeID
+	id      [16]byte
+	data    []byte
+	vo      protocol.VersionOffset
+	options protocol.StorageRecord_SaveOptions
+	created int64 // unix nano of the first save if the operation save a new record
+}
+
+//libgo:impl libgo/protocol.StorageRecords_Batch
+func (b *recordsBatch) Save(mt protocol.MediaTypeID, id [16]byte, rec []byte, options protocol.StorageRecord_SaveOptions) (err protocol.Error) {
+	err = b.add(recordsBatchOperation{kind: batchOperation_Save, mt: mt, id: id, data: cloneBytes(rec), options: options,
+		created: int64(unix.Now().NanoElapsed())})
+	return
+}
+func (b *recordsBatch) Update(mt protocol.MediaTypeID, id [16]byte, rec []byte, vo protocol.VersionOffset) (err protocol.Error) {
+	err = b.add(recordsBatchOperation{kind: batchOperation_Update, mt: mt, id: id, data: cloneBytes(rec), vo: vo})
+	return
+}
+func (b *recordsBatch) Delete(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	err = b.add(recordsBatchOperation{kind: batchOperation_Delete, mt: mt, id: id})
+	return
+}
+func (b *recordsBatch) DeleteVersion(mt protocol.MediaTypeID, id [16]byte, vo protocol.VersionOffset) (err protocol.Error) {
+	err = b.add(recordsBatchOperation{kind: batchOperation_DeleteVersion, mt: mt, id: id, vo: vo})
+	return
+}
+
+//libgo:impl libgo/protocol.StorageBatch
+func (b *recordsBatch) Discard() {
+	b.closed = true
+	b.ops = nil
+}
+
+func (b *recordsBatch) add(op recordsBatchOperation) (err protocol.Error) {
+	if b.closed {
+		return &ErrBatchClosed
+	}
+	b.ops = append(b.ops, op)
+	return
+}
+
+// close mark the batch as committed and return error if it closed before.
+func (b *recordsBatch) close() (err protocol.Error) {
+	if b.closed {
+		return &ErrBatchClosed
+	}
+	b.closed = true
+	return
+}
+
+// replay queue all operations on the given batch.
+func (b *recordsBatch) replay(to protocol.StorageRecords_Batch) (err protocol.Error) {
+	for _, op := range b.ops {
+		switch op.kind {
+		case batchOperation_Save:
+			err = to.Save(op.mt, op.id, op.data, op.options)
+		case batchOperation_Update:
+			err = to.Update(op.mt, op.id, op.data, op.vo)
+		case batchOperation_Delete:
+			err = to.Delete(op.mt, op.id)
+		case batchOperation_DeleteVersion:
+			err = to.DeleteVersion(op.mt, op.id, op.vo)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// apply do the operation on r and return the record must store instead of r, nil means remove the record.
+// It never change r if return any error.
+func (op *recordsBatchOperation) apply(r *record) (nr *record, e *RecordEvent, err protocol.Error) {
+	if op.kind == batchOperation_Save && r == nil {
+		r = &record{
+			created:   op.created,
+			splitting: op.options.PrimaryIndexSplitting,
+		}
+	}
+	if r == nil {
+		err = &ErrNotExist
+		return
+	}
+	if r.locked {
+		err = &ErrRecordLocked
+		return
+	}
+
+	var abs protocol.VersionOffset
+	switch op.kind {
+	case batchOperation_Save:
+		abs = r.save(op.data, op.options.MaxVersion)
+		e = newRecordEvent(RecordOperation_Save, op.mt, op.id, abs)
+	case batchOperation_Update:
+		abs, err = r.update(op.data, op.vo)
+		if err != nil {
+			return
+		}
+		e = newRecordEvent(RecordOperation_Update, op.mt, op.id, abs)
+	case batchOperation_Delete:
+		e = newRecordEvent(RecordOperation_Delete, op.mt, op.id, 0)
+		return nil, e, nil
+	case batchOperation_DeleteVersion:
+		abs, err = r.deleteVersion(op.vo)
+		if err != nil {
+			return
+		}
+		e = newRecordEvent(RecordOperation_DeleteVersion, op.mt, op.id, abs)
+	}
+	nr = r
+	return
+}
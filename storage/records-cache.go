@@ -0,0 +1,210 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/binary"
+	"libgo/protocol"
+)
+
+// RecordsCache wrap a protocol.StorageRecords to serve repeated reads from a Cache.
+// Each requested version of a record cache by Get() and any change on the record drop all its cached versions,
+// even changes made by others if the source dispatch RecordEvent for them.
+// In CacheMode_WriteThrough, Save() and Update() cache the written version if the number of versions of the record
+// is known from its other cached versions, otherwise the next Get() fill the cache as in CacheMode_ReadThrough.
+type RecordsCache struct {
+	Mode CacheMode
+
+	cache  *Cache
+	source protocol.StorageRecords
+	ns     string
+}
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (rc *RecordsCache) Init(cache *Cache, source protocol.StorageRecords) (err protocol.Error) {
+	rc.cache = cache
+	rc.source = source
+	rc.ns = cache.namespace()
+	err = source.AddEventListener(RecordEvent_MediaType.ID(), rc, protocol.AddEventListenerOptions{})
+	return
+}
+func (rc *RecordsCache) Deinit() (err protocol.Error) {
+	err = rc.source.RemoveEventListener(RecordEvent_MediaType.ID(), rc, protocol.EventListenerOptions{})
+	return
+}
+
+// Source return the wrapped storage.
+func (rc *RecordsCache) Source() protocol.StorageRecords { return rc.source }
+
+//libgo:impl libgo/protocol.StorageRecords
+func (rc *RecordsCache) MediatypeNumbers() (num uint64, err protocol.Error) {
+	return rc.source.MediatypeNumbers()
+}
+func (rc *RecordsCache) ListMediatypeIDs(offset, limit uint64) (ids []uint64, err protocol.Error) {
+	return rc.source.ListMediatypeIDs(offset, limit)
+}
+func (rc *RecordsCache) RecordNumbers(mt protocol.MediaTypeID) (num uint64, err protocol.Error) {
+	return rc.source.RecordNumbers(mt)
+}
+func (rc *RecordsCache) ListRecords(mt protocol.MediaTypeID, offset, limit uint64) (ids [][16]byte, err protocol.Error) {
+	return rc.source.ListRecords(mt, offset, limit)
+}
+func (rc *RecordsCache) Lock(mt protocol.MediaTypeID, id [16]byte) (lastVersion []byte, vo protocol.VersionOffset, err protocol.Error) {
+	return rc.source.Lock(mt, id)
+}
+func (rc *RecordsCache) Unlock(mt protocol.MediaTypeID, id [16]byte, newVersion []byte) (err protocol.Error) {
+	err = rc.source.Unlock(mt, id, newVersion)
+	rc.cache.invalidate(rc.group(mt, id))
+	return
+}
+func (rc *RecordsCache) Count(mt protocol.MediaTypeID, id [16]byte, offset, limit uint64) (numbers protocol.NumberOfVersion, err protocol.Error) {
+	return rc.source.Count(mt, id, offset, limit)
+}
+func (rc *RecordsCache) Length(mt protocol.MediaTypeID, id [16]byte, vo protocol.VersionOffset) (ln int, err protocol.Error) {
+	var record, _, ok = rc.cache.get(rc.group(mt, id), versionKey(vo))
+	if ok {
+		ln = len(record)
+		return
+	}
+	return rc.source.Length(mt, id, vo)
+}
+func (rc *RecordsCache) Get(mt protocol.MediaTypeID, id [16]byte, vo protocol.VersionOffset) (record []byte, numbers protocol.NumberOfVersion, err protocol.Error) {
+	var group, key = rc.group(mt, id), versionKey(vo)
+	var cached, extra, ok = rc.cache.get(group, key)
+	if ok {
+		record, numbers = cloneBytes(cached), protocol.NumberOfVersion(extra)
+		return
+	}
+
+	var ticket = rc.cache.ticket()
+	record, numbers, err = rc.source.Get(mt, id, vo)
+	if err == nil {
+		rc.cache.fill(ticket, group, key, cloneBytes(record), uint64(numbers))
+	}
+	return
+}
+func (rc *RecordsCache) Save(mt protocol.MediaTypeID, id [16]byte, record []byte, options protocol.StorageRecord_SaveOptions) (err protocol.Error) {
+	var group = rc.group(mt, id)
+	var numbers, known = rc.cache.extra(group)
+	err = rc.source.Save(mt, id, record, options)
+	// Other cached versions may be the new last or dropped by retention, so drop all of them anyway.
+	rc.cache.invalidate(group)
+	if err == nil && rc.Mode == CacheMode_WriteThrough && known {
+		if options.MaxVersion == protocol.StorageRecord_NoVersion {
+			// The new version replace the only version.
+			numbers = 1
+		} else {
+			numbers++
+		}
+		rc.cache.put(group, versionKey(protocol.StorageRecord_LastLocalVersion), cloneBytes(record), numbers)
+	}
+	return
+}
+func (rc *RecordsCache) Update(mt protocol.MediaTypeID, id [16]byte, record []byte, vo protocol.VersionOffset) (err protocol.Error) {
+	var group = rc.group(mt, id)
+	var numbers, known = rc.cache.extra(group)
+	err = rc.source.Update(mt, id, record, vo)
+	// The version may cache by other offsets too e.g. by its absolute offset and as the last version.
+	rc.cache.invalidate(group)
+	if err == nil && rc.Mode == CacheMode_WriteThrough && known {
+		rc.cache.put(group, versionKey(vo), cloneBytes(record), numbers)
+	}
+	return
+}
+func (rc *RecordsCache) Delete(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	err = rc.source.Delete(mt, id)
+	rc.cache.invalidate(rc.group(mt, id))
+	return
+}
+func (rc *RecordsCache) DeleteVersion(mt protocol.MediaTypeID, id [16]byte, vo protocol.VersionOffset) (err protocol.Error) {
+	err = rc.source.DeleteVersion(mt, id, vo)
+	rc.cache.invalidate(rc.group(mt, id))
+	return
+}
+func (rc *RecordsCache) Batch() (batch protocol.StorageRecords_Batch, err protocol.Error) {
+	var sb protocol.StorageRecords_Batch
+	sb, err = rc.source.Batch()
+	if err != nil {
+		return
+	}
+	batch = &recordsCacheBatch{rc: rc, batch: sb}
+	return
+}
+
+//libgo:impl libgo/protocol.EventTarget
+func (rc *RecordsCache) AddEventListener(domain protocol.MediaTypeID, callback protocol.EventListener, options protocol.AddEventListenerOptions) (err protocol.Error) {
+	return rc.source.AddEventListener(domain, callback, options)
+}
+func (rc *RecordsCache) RemoveEventListener(domain protocol.MediaTypeID, callback protocol.EventListener, options protocol.EventListenerOptions) (err protocol.Error) {
+	return rc.source.RemoveEventListener(domain, callback, options)
+}
+func (rc *RecordsCache) DispatchEvent(event protocol.Event) (err protocol.Error) {
+	return rc.source.DispatchEvent(event)
+}
+
+//libgo:impl libgo/protocol.EventListener
+func (rc *RecordsCache) EventHandler(event protocol.Event) {
+	var re, ok = event.(*RecordEvent)
+	if ok {
+		rc.cache.invalidate(rc.group(re.RecordMediaTypeID(), re.RecordID()))
+	}
+}
+
+func (rc *RecordsCache) group(mt protocol.MediaTypeID, id [16]byte) string {
+	return rc.ns + string(objectKey{mt, id}.encode())
+}
+
+func versionKey(vo protocol.VersionOffset) string {
+	var key [8]byte
+	binary.LittleEndian(key[:]).PutUint64(uint64(vo))
+	return string(key[:])
+}
+
+// recordsCacheBatch forward changes to the source batch and drop changed records from the cache after Commit().
+type recordsCacheBatch struct {
+	rc     *RecordsCache
+	batch  protocol.StorageRecords_Batch
+	groups []string
+}
+
+//libgo:impl libgo/protocol.StorageRecords_Batch
+func (b *recordsCacheBatch) Save(mt protocol.MediaTypeID, id [16]byte, record []byte, options protocol.StorageRecord_SaveOptions) (err protocol.Error) {
+	err = b.batch.Save(mt, id, record, options)
+	b.changed(mt, id, err)
+	return
+}
+func (b *recordsCacheBatch) Update(mt protocol.MediaTypeID, id [16]byte, record []byte, vo protocol.VersionOffset) (err protocol.Error) {
+	err = b.batch.Update(mt, id, record, vo)
+	b.changed(mt, id, err)
+	return
+}
+func (b *recordsCacheBatch) Delete(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	err = b.batch.Delete(mt, id)
+	b.changed(mt, id, err)
+	return
+}
+func (b *recordsCacheBatch) DeleteVersion(mt protocol.MediaTypeID, id [16]byte, vo protocol.VersionOffset) (err protocol.Error) {
+	err = b.batch.DeleteVersion(mt, id, vo)
+	b.changed(mt, id, err)
+	return
+}
+
+//libgo:impl libgo/protocol.StorageBatch
+func (b *recordsCacheBatch) Commit() (err protocol.Error) {
+	err = b.batch.Commit()
+	for _, group := range b.groups {
+		b.rc.cache.invalidate(group)
+	}
+	b.groups = nil
+	return
+}
+func (b *recordsCacheBatch) Discard() {
+	b.batch.Discard()
+	b.groups = nil
+}
+
+func (b *recordsCacheBatch) changed(mt protocol.MediaTypeID, id [16]byte, err protocol.Error) {
+	if err == nil {
+		b.groups = append(b.groups, b.rc.group(mt, id))
+	}
+}
@@ -0,0 +1,70 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/protocol"
+)
+
+// recordsMemoryBatch implement protocol.StorageRecords_Batch for RecordsMemory.
+// Commit() apply operations on copies of the records and replace them in the store just if all operations succeed.
+type recordsMemoryBatch struct {
+	rs *RecordsMemory
+	recordsBatch
+}
+
+type recordKey struct {
+	mt protocol.MediaTypeID
+	id [16]byte
+}
+
+//libgo:impl libgo/protocol.StorageBatch
+func (b *recordsMemoryBatch) Commit() (err protocol.Error) {
+	err = b.close()
+	if err != nil {
+		return
+	}
+
+	var rs = b.rs
+	var events = make([]*RecordEvent, 0, len(b.ops))
+	// changed hold copy of changed records, nil value means record deleted in the batch.
+	var changed = make(map[recordKey]*record, len(b.ops))
+	var order = make([]recordKey, 0, len(b.ops))
+	rs.sync.Lock()
+	for i := range b.ops {
+		var op = &b.ops[i]
+		var key = recordKey{op.mt, op.id}
+		var r, ok = changed[key]
+		if !ok {
+			r = rs.record(op.mt, op.id)
+			if r != nil {
+				r = r.clone()
+			}
+			order = append(order, key)
+		}
+
+		var e *RecordEvent
+		r, e, err = op.apply(r)
+		if err != nil {
+			rs.sync.Unlock()
+			return
+		}
+		changed[key] = r
+		events = append(events, e)
+	}
+	err = rs.checkIndexes(changed)
+	if err != nil {
+		rs.sync.Unlock()
+		return
+	}
+	for _, key := range order {
+		rs.put(key.mt, key.id, changed[key])
+	}
+	rs.sync.Unlock()
+
+	for _, e := range events {
+		rs.dispatch(e)
+	}
+	b.ops = nil
+	return
+}
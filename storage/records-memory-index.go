@@ -0,0 +1,219 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"bytes"
+	"sort"
+
+	"libgo/binary"
+	"libgo/protocol"
+)
+
+// recordsIndex is a secondary index of RecordsMemory.
+type recordsIndex struct {
+	protocol.StorageRecord_Index
+	values map[string][][16]byte // ids sorted to serve FindRecords() in stable order
+	byID   map[[16]byte]string   // value of each indexed record to remove it on change
+}
+
+// value return the indexed field of the last version of the record. ok is false if the record isn't in the index.
+func (ri *recordsIndex) value(r *record) (value string, ok bool) {
+	if r == nil {
+		return
+	}
+	var data, _, err = r.version(protocol.StorageRecord_LastLocalVersion)
+	if err != nil {
+		return
+	}
+
+	var si = uint64(ri.StackIndex)
+	var ln = uint64(len(data))
+	var size uint64
+	switch ri.Type {
+	case protocol.StorageRecord_IndexType_UInt8:
+		size = 1
+	case protocol.StorageRecord_IndexType_UInt16:
+		size = 2
+	case protocol.StorageRecord_IndexType_UInt32:
+		size = 4
+	case protocol.StorageRecord_IndexType_UInt64:
+		size = 8
+	case protocol.StorageRecord_IndexType_Array16:
+		size = 16
+	case protocol.StorageRecord_IndexType_Array32:
+		size = 32
+	case protocol.StorageRecord_IndexType_String:
+		if si+8 > ln {
+			return
+		}
+		var add = uint64(binary.LittleEndian(data[si:]).Uint32())
+		var fieldLen = uint64(binary.LittleEndian(data[si+4:]).Uint32())
+		if add+fieldLen > ln {
+			return
+		}
+		return string(data[add : add+fieldLen]), true
+	}
+	if size == 0 || si+size > ln {
+		return
+	}
+	return string(data[si : si+size]), true
+}
+
+// put add, replace or remove (if r is nil) the record in the index.
+func (ri *recordsIndex) put(id [16]byte, r *record) {
+	var value, ok = ri.value(r)
+	var old, exist = ri.byID[id]
+	if exist && ok && old == value {
+		return
+	}
+	if exist {
+		var ids = ri.values[old]
+		var i = searchIDs(ids, id)
+		ids = append(ids[:i], ids[i+1:]...)
+		if len(ids) == 0 {
+			delete(ri.values, old)
+		} else {
+			ri.values[old] = ids
+		}
+		delete(ri.byID, id)
+	}
+	if ok {
+		var ids = ri.values[value]
+		var i = searchIDs(ids, id)
+		ids = append(ids, [16]byte{})
+		copy(ids[i+1:], ids[i:])
+		ids[i] = id
+		ri.values[value] = ids
+		ri.byID[id] = value
+	}
+}
+
+//libgo:impl libgo/protocol.StorageRecords_Indexed
+func (rs *RecordsMemory) RegisterIndex(mt protocol.MediaTypeID, index protocol.StorageRecord_Index) (err protocol.Error) {
+	if index.Type == protocol.StorageRecord_IndexType_Unset || index.Type > protocol.StorageRecord_IndexType_String {
+		return &ErrOutOfRange
+	}
+	var ri = &recordsIndex{
+		StorageRecord_Index: index,
+		values:              make(map[string][][16]byte),
+		byID:                make(map[[16]byte]string),
+	}
+
+	rs.sync.Lock()
+	defer rs.sync.Unlock()
+	var indexes = rs.indexes[mt]
+	if indexes[index.Name] != nil {
+		return &ErrExist
+	}
+	var rm = rs.mediatypes[mt]
+	if rm != nil {
+		for id, r := range rm.records {
+			ri.put(id, r)
+		}
+	}
+	if index.Unique {
+		for _, ids := range ri.values {
+			if len(ids) > 1 {
+				return &ErrIndexUnique
+			}
+		}
+	}
+	if indexes == nil {
+		indexes = make(map[string]*recordsIndex)
+		rs.indexes[mt] = indexes
+	}
+	indexes[index.Name] = ri
+	return
+}
+func (rs *RecordsMemory) DropIndex(mt protocol.MediaTypeID, indexName string) (err protocol.Error) {
+	rs.sync.Lock()
+	var indexes = rs.indexes[mt]
+	if indexes[indexName] == nil {
+		err = &ErrNotExist
+	} else {
+		delete(indexes, indexName)
+		if len(indexes) == 0 {
+			delete(rs.indexes, mt)
+		}
+	}
+	rs.sync.Unlock()
+	return
+}
+func (rs *RecordsMemory) FindRecords(mt protocol.MediaTypeID, indexName string, value []byte, offset, limit uint64) (ids [][16]byte, err protocol.Error) {
+	rs.sync.Lock()
+	var ri = rs.indexes[mt][indexName]
+	if ri == nil {
+		err = &ErrNotExist
+	} else {
+		var found = ri.values[string(value)]
+		var start, end = pageRange(uint64(len(found)), offset, limit)
+		ids = append([][16]byte(nil), found[start:end]...)
+	}
+	rs.sync.Unlock()
+	return
+}
+func (rs *RecordsMemory) FindRecord(mt protocol.MediaTypeID, indexName string, value []byte) (id [16]byte, err protocol.Error) {
+	var ids [][16]byte
+	ids, err = rs.FindRecords(mt, indexName, value, 0, 1)
+	if err == nil && len(ids) == 0 {
+		err = &ErrNotExist
+	}
+	if err != nil {
+		return
+	}
+	id = ids[0]
+	return
+}
+
+// checkIndexes return ErrIndexUnique if the changes make two records with the same value in a unique index.
+// nil record in changes means the record delete. Caller must hold the lock.
+func (rs *RecordsMemory) checkIndexes(changes map[recordKey]*record) (err protocol.Error) {
+	if len(rs.indexes) == 0 {
+		return
+	}
+	var claimed = make(map[*recordsIndex]map[string][16]byte)
+	for key, r := range changes {
+		for _, ri := range rs.indexes[key.mt] {
+			if !ri.Unique {
+				continue
+			}
+			var value, ok = ri.value(r)
+			if !ok {
+				continue
+			}
+
+			var values = claimed[ri]
+			if values == nil {
+				values = make(map[string][16]byte)
+				claimed[ri] = values
+			}
+			if other, exist := values[value]; exist && other != key.id {
+				return &ErrIndexUnique
+			}
+			values[value] = key.id
+
+			// Records that change in the same changes check by their new value.
+			for _, other := range ri.values[value] {
+				if _, change := changes[recordKey{key.mt, other}]; other != key.id && !change {
+					return &ErrIndexUnique
+				}
+			}
+		}
+	}
+	return
+}
+
+// index add, replace or remove (if r is nil) the record in all indexes of the mediatype. Caller must hold the lock.
+func (rs *RecordsMemory) index(mt protocol.MediaTypeID, id [16]byte, r *record) {
+	for _, ri := range rs.indexes[mt] {
+		ri.put(id, r)
+	}
+}
+
+// indexed report whether the mediatype has any index. Caller must hold the lock.
+func (rs *RecordsMemory) indexed(mt protocol.MediaTypeID) bool { return len(rs.indexes[mt]) > 0 }
+
+func searchIDs(ids [][16]byte, id [16]byte) int {
+	return sort.Search(len(ids), func(i int) bool { return bytes.Compare(ids[i][:], id[:]) >= 0 })
+}
@@ -0,0 +1,234 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"time"
+
+	"libgo/protocol"
+)
+
+// recordsPartitionKey address a partition of the primary index. Records saved by different splitting
+// periods never share a partition, even if their periods start at the same time.
+type recordsPartitionKey struct {
+	splitting protocol.StorageRecord_IndexSplitting
+	start     int64 // unix nano
+}
+
+func (k recordsPartitionKey) less(o recordsPartitionKey) bool {
+	return k.start < o.start || (k.start == o.start && k.splitting < o.splitting)
+}
+
+// recordsPartition_MaxPeriod is the longest period of any splitting (a leap year), so a partition that end after
+// a time must start after that time minus it.
+const recordsPartition_MaxPeriod = int64(366 * 24 * time.Hour)
+
+type recordsPartition struct {
+	end     int64 // unix nano, exclusive
+	entries []recordsPartitionEntry
+}
+
+// recordsPartitionEntry sorted by created and then id in a partition.
+type recordsPartitionEntry struct {
+	created int64
+	id      [16]byte
+}
+
+func (e recordsPartitionEntry) less(o recordsPartitionEntry) bool {
+	return e.created < o.created || (e.created == o.created && bytes.Compare(e.id[:], o.id[:]) < 0)
+}
+
+// search return index of the first entry that isn't less than given entry.
+func (p *recordsPartition) search(e recordsPartitionEntry) int {
+	return sort.Search(len(p.entries), func(i int) bool { return !p.entries[i].less(e) })
+}
+
+// window return entries that created in [from, to).
+func (p *recordsPartition) window(from, to int64) []recordsPartitionEntry {
+	var start = sort.Search(len(p.entries), func(i int) bool { return p.entries[i].created >= from })
+	var end = sort.Search(len(p.entries), func(i int) bool { return p.entries[i].created >= to })
+	return p.entries[start:end]
+}
+
+// partition add the new record to its partition if it saved with splitting.
+func (rm *recordsMediatype) partition(id [16]byte, r *record) {
+	if r.splitting == protocol.StorageRecord_IndexSplitting_None {
+		return
+	}
+	var start, end = recordsPartitionRange(r.splitting, r.created)
+	var key = recordsPartitionKey{splitting: r.splitting, start: start}
+	var p = rm.partitions[key]
+	if p == nil {
+		p = &recordsPartition{end: end}
+		rm.partitions[key] = p
+		var i = rm.searchPartKey(key)
+		rm.partKeys = append(rm.partKeys, recordsPartitionKey{})
+		copy(rm.partKeys[i+1:], rm.partKeys[i:])
+		rm.partKeys[i] = key
+	}
+	var e = recordsPartitionEntry{created: r.created, id: id}
+	var i = p.search(e)
+	p.entries = append(p.entries, recordsPartitionEntry{})
+	copy(p.entries[i+1:], p.entries[i:])
+	p.entries[i] = e
+}
+
+// unpartition remove the deleted record from its partition and drop the partition if it becomes empty.
+func (rm *recordsMediatype) unpartition(id [16]byte, r *record) {
+	if r.splitting == protocol.StorageRecord_IndexSplitting_None {
+		return
+	}
+	var start, _ = recordsPartitionRange(r.splitting, r.created)
+	var key = recordsPartitionKey{splitting: r.splitting, start: start}
+	var p = rm.partitions[key]
+	if p == nil {
+		return
+	}
+	var e = recordsPartitionEntry{created: r.created, id: id}
+	var i = p.search(e)
+	if i < len(p.entries) && p.entries[i] == e {
+		p.entries = append(p.entries[:i], p.entries[i+1:]...)
+	}
+	if len(p.entries) == 0 {
+		delete(rm.partitions, key)
+		var i = rm.searchPartKey(key)
+		rm.partKeys = append(rm.partKeys[:i], rm.partKeys[i+1:]...)
+	}
+}
+
+// searchPartKey return index of the first partition key that isn't less than given key.
+func (rm *recordsMediatype) searchPartKey(key recordsPartitionKey) int {
+	return sort.Search(len(rm.partKeys), func(i int) bool { return !rm.partKeys[i].less(key) })
+}
+
+// partitionsIn call fn for each partition that overlap [from, to) in order by their start. Caller must hold the lock.
+func (rm *recordsMediatype) partitionsIn(from, to int64, fn func(p *recordsPartition)) {
+	var min = from - recordsPartition_MaxPeriod
+	if min > from {
+		min = math.MinInt64
+	}
+	var i = rm.searchPartKey(recordsPartitionKey{start: min})
+	for ; i < len(rm.partKeys) && rm.partKeys[i].start < to; i++ {
+		var p = rm.partitions[rm.partKeys[i]]
+		if p.end > from {
+			fn(p)
+		}
+	}
+}
+
+//libgo:impl libgo/protocol.StorageRecords_Partitioned
+func (rs *RecordsMemory) RecordNumbersIn(mt protocol.MediaTypeID, from, to protocol.Time) (num uint64, err protocol.Error) {
+	var fromNano, toNano int64
+	fromNano, err = unixNano(from)
+	if err == nil {
+		toNano, err = unixNano(to)
+	}
+	if err != nil {
+		return
+	}
+	rs.sync.Lock()
+	var rm = rs.mediatypes[mt]
+	if rm != nil {
+		rm.partitionsIn(fromNano, toNano, func(p *recordsPartition) {
+			num += uint64(len(p.window(fromNano, toNano)))
+		})
+	}
+	rs.sync.Unlock()
+	return
+}
+func (rs *RecordsMemory) ListRecordsIn(mt protocol.MediaTypeID, from, to protocol.Time, offset, limit uint64) (ids [][16]byte, err protocol.Error) {
+	var fromNano, toNano int64
+	fromNano, err = unixNano(from)
+	if err == nil {
+		toNano, err = unixNano(to)
+	}
+	if err != nil {
+		return
+	}
+	var entries []recordsPartitionEntry
+	rs.sync.Lock()
+	var rm = rs.mediatypes[mt]
+	if rm != nil {
+		rm.partitionsIn(fromNano, toNano, func(p *recordsPartition) {
+			entries = append(entries, p.window(fromNano, toNano)...)
+		})
+	}
+	rs.sync.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].less(entries[j]) })
+	var start, end = pageRange(uint64(len(entries)), offset, limit)
+	if start < end {
+		ids = make([][16]byte, 0, end-start)
+		for _, e := range entries[start:end] {
+			ids = append(ids, e.id)
+		}
+	}
+	return
+}
+
+// DropPartitions delete records of whole partitions, so a partition that is still open at before time keep all its records.
+// Locked records stay in their partition. A RecordOperation_Delete event dispatch for each deleted record.
+func (rs *RecordsMemory) DropPartitions(mt protocol.MediaTypeID, before protocol.Time) (num uint64, err protocol.Error) {
+	var beforeNano int64
+	beforeNano, err = unixNano(before)
+	if err != nil {
+		return
+	}
+	var events []*RecordEvent
+	rs.sync.Lock()
+	var rm = rs.mediatypes[mt]
+	if rm != nil {
+		for _, key := range rm.partKeys {
+			if key.start >= beforeNano {
+				break
+			}
+			var p = rm.partitions[key]
+			if p.end > beforeNano {
+				continue
+			}
+			for _, e := range p.entries {
+				if !rm.records[e.id].locked {
+					events = append(events, newRecordEvent(RecordOperation_Delete, mt, e.id, 0))
+				}
+			}
+		}
+		for _, e := range events {
+			rs.put(mt, e.RecordID(), nil)
+		}
+	}
+	rs.sync.Unlock()
+
+	num = uint64(len(events))
+	for _, e := range events {
+		rs.dispatch(e)
+	}
+	return
+}
+
+// recordsPartitionRange return the start and end of the period that contain given unix nano time.
+func recordsPartitionRange(splitting protocol.StorageRecord_IndexSplitting, nano int64) (start, end int64) {
+	var t = time.Unix(0, nano).UTC()
+	var s, e time.Time
+	switch splitting {
+	case protocol.StorageRecord_IndexSplitting_Hour:
+		s = t.Truncate(time.Hour)
+		e = s.Add(time.Hour)
+	case protocol.StorageRecord_IndexSplitting_Day:
+		s = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		e = s.AddDate(0, 0, 1)
+	case protocol.StorageRecord_IndexSplitting_Week:
+		var monday = (int(t.Weekday()) + 6) % 7
+		s = time.Date(t.Year(), t.Month(), t.Day()-monday, 0, 0, 0, 0, time.UTC)
+		e = s.AddDate(0, 0, 7)
+	case protocol.StorageRecord_IndexSplitting_Month:
+		s = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		e = s.AddDate(0, 1, 0)
+	default:
+		s = time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+		e = s.AddDate(1, 0, 0)
+	}
+	return s.UnixNano(), e.UnixNano()
+}
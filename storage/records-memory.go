@@ -0,0 +1,314 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"libgo/event"
+	"libgo/protocol"
+	"libgo/time/unix"
+)
+
+// RecordsMemory is the in-memory reference implementation of protocol.StorageRecords.
+//   - It keeps at most MaxVersion versions per record as the last Save() asks, and drop oldest versions.
+//   - Lock() and Unlock() are the optimistic concurrency handshake: Lock() give the last version and
+//     block any other change on the record until Unlock() save the new version.
+//   - Each change dispatch a RecordEvent after the change is visible to readers.
+//   - It is safe to call its methods concurrently.
+type RecordsMemory struct {
+	sync       sync.Mutex
+	mediatypes map[protocol.MediaTypeID]*recordsMediatype
+	mtIDs      []uint64 // sorted to serve ListMediatypeIDs() in stable order
+	indexes    map[protocol.MediaTypeID]map[string]*recordsIndex
+
+	event.EventTarget
+}
+
+type recordsMediatype struct {
+	ids        [][16]byte // sorted to serve ListRecords() in stable order
+	records    map[[16]byte]*record
+	partitions map[recordsPartitionKey]*recordsPartition
+	partKeys   []recordsPartitionKey // sorted by start to seek partitions of a time range
+}
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (rs *RecordsMemory) Init() (err protocol.Error) {
+	rs.mediatypes = make(map[protocol.MediaTypeID]*recordsMediatype)
+	rs.indexes = make(map[protocol.MediaTypeID]map[string]*recordsIndex)
+	err = rs.EventTarget.Init()
+	return
+}
+func (rs *RecordsMemory) Deinit() (err protocol.Error) {
+	rs.sync.Lock()
+	rs.mediatypes = nil
+	rs.mtIDs = nil
+	rs.indexes = nil
+	rs.sync.Unlock()
+	return
+}
+
+//libgo:impl libgo/protocol.StorageRecords
+func (rs *RecordsMemory) MediatypeNumbers() (num uint64, err protocol.Error) {
+	rs.sync.Lock()
+	num = uint64(len(rs.mtIDs))
+	rs.sync.Unlock()
+	return
+}
+func (rs *RecordsMemory) ListMediatypeIDs(offset, limit uint64) (ids []uint64, err protocol.Error) {
+	rs.sync.Lock()
+	var start, end = pageRange(uint64(len(rs.mtIDs)), offset, limit)
+	ids = append([]uint64(nil), rs.mtIDs[start:end]...)
+	rs.sync.Unlock()
+	return
+}
+func (rs *RecordsMemory) RecordNumbers(mt protocol.MediaTypeID) (num uint64, err protocol.Error) {
+	rs.sync.Lock()
+	var rm = rs.mediatypes[mt]
+	if rm != nil {
+		num = uint64(len(rm.ids))
+	}
+	rs.sync.Unlock()
+	return
+}
+func (rs *RecordsMemory) ListRecords(mt protocol.MediaTypeID, offset, limit uint64) (ids [][16]byte, err protocol.Error) {
+	rs.sync.Lock()
+	var rm = rs.mediatypes[mt]
+	if rm != nil {
+		var start, end = pageRange(uint64(len(rm.ids)), offset, limit)
+		ids = append([][16]byte(nil), rm.ids[start:end]...)
+	}
+	rs.sync.Unlock()
+	return
+}
+
+// Lock return the last version of the record and prevent any other changes on it until Unlock() called.
+// It doesn't block the caller if the record locked before and return ErrRecordLocked.
+func (rs *RecordsMemory) Lock(mt protocol.MediaTypeID, id [16]byte) (lastVersion []byte, vo protocol.VersionOffset, err protocol.Error) {
+	rs.sync.Lock()
+	defer rs.sync.Unlock()
+
+	var r = rs.record(mt, id)
+	if r == nil {
+		err = &ErrNotExist
+		return
+	}
+	if r.locked {
+		err = &ErrRecordLocked
+		return
+	}
+	lastVersion, vo, err = r.version(protocol.StorageRecord_LastLocalVersion)
+	if err != nil && err != &ErrVersionDeleted {
+		return
+	}
+	err = nil
+	lastVersion = cloneBytes(lastVersion)
+	r.locked = true
+	return
+}
+
+// Unlock save newVersion as a new version of the record if it is not nil and release the lock get by Lock().
+func (rs *RecordsMemory) Unlock(mt protocol.MediaTypeID, id [16]byte, newVersion []byte) (err protocol.Error) {
+	var e *RecordEvent
+	rs.sync.Lock()
+	var r = rs.record(mt, id)
+	switch {
+	case r == nil:
+		err = &ErrNotExist
+	case !r.locked:
+		err = &ErrRecordNotLocked
+	default:
+		if newVersion == nil {
+			r.locked = false
+			break
+		}
+		var nr = r.clone()
+		nr.locked = false
+		var abs = nr.save(cloneBytes(newVersion), nr.maxVersion)
+		err = rs.checkIndexes(map[recordKey]*record{{mt, id}: nr})
+		if err != nil {
+			// Keep the lock, so the caller can unlock by other version.
+			break
+		}
+		rs.put(mt, id, nr)
+		e = newRecordEvent(RecordOperation_Save, mt, id, abs)
+	}
+	rs.sync.Unlock()
+	rs.dispatch(e)
+	return
+}
+
+func (rs *RecordsMemory) Count(mt protocol.MediaTypeID, id [16]byte, offset, limit uint64) (numbers protocol.NumberOfVersion, err protocol.Error) {
+	rs.sync.Lock()
+	var r = rs.record(mt, id)
+	if r == nil {
+		err = &ErrNotExist
+	} else {
+		numbers = r.count(offset, limit)
+	}
+	rs.sync.Unlock()
+	return
+}
+func (rs *RecordsMemory) Length(mt protocol.MediaTypeID, id [16]byte, vo protocol.VersionOffset) (ln int, err protocol.Error) {
+	rs.sync.Lock()
+	var r = rs.record(mt, id)
+	if r == nil {
+		err = &ErrNotExist
+	} else {
+		var data []byte
+		data, _, err = r.version(vo)
+		ln = len(data)
+	}
+	rs.sync.Unlock()
+	return
+}
+
+// Get return a copy of the record in given version and numbers of all versions saved for the record till now.
+func (rs *RecordsMemory) Get(mt protocol.MediaTypeID, id [16]byte, vo protocol.VersionOffset) (rec []byte, numbers protocol.NumberOfVersion, err protocol.Error) {
+	rs.sync.Lock()
+	var r = rs.record(mt, id)
+	if r == nil {
+		err = &ErrNotExist
+	} else {
+		numbers = r.numbers()
+		rec, _, err = r.version(vo)
+		rec = cloneBytes(rec)
+	}
+	rs.sync.Unlock()
+	return
+}
+
+func (rs *RecordsMemory) Save(mt protocol.MediaTypeID, id [16]byte, rec []byte, options protocol.StorageRecord_SaveOptions) (err protocol.Error) {
+	err = rs.apply(recordsBatchOperation{kind: batchOperation_Save, mt: mt, id: id, data: cloneBytes(rec), options: options,
+		created: int64(unix.Now().NanoElapsed())})
+	return
+}
+func (rs *RecordsMemory) Update(mt protocol.MediaTypeID, id [16]byte, rec []byte, vo protocol.VersionOffset) (err protocol.Error) {
+	err = rs.apply(recordsBatchOperation{kind: batchOperation_Update, mt: mt, id: id, data: cloneBytes(rec), vo: vo})
+	return
+}
+func (rs *RecordsMemory) Delete(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	err = rs.apply(recordsBatchOperation{kind: batchOperation_Delete, mt: mt, id: id})
+	return
+}
+func (rs *RecordsMemory) DeleteVersion(mt protocol.MediaTypeID, id [16]byte, vo protocol.VersionOffset) (err protocol.Error) {
+	err = rs.apply(recordsBatchOperation{kind: batchOperation_DeleteVersion, mt: mt, id: id, vo: vo})
+	return
+}
+
+// Batch return a new batch that apply its changes on the store all-or-nothing.
+func (rs *RecordsMemory) Batch() (batch protocol.StorageRecords_Batch, err protocol.Error) {
+	batch = &recordsMemoryBatch{rs: rs}
+	return
+}
+
+// SaveOptions return MaxVersion of the last save and PrimaryIndexSplitting and time of the first save of the record.
+//
+//libgo:impl libgo/protocol.StorageRecords_Restore
+func (rs *RecordsMemory) SaveOptions(mt protocol.MediaTypeID, id [16]byte) (options protocol.StorageRecord_SaveOptions, created protocol.Time, err protocol.Error) {
+	rs.sync.Lock()
+	var r = rs.record(mt, id)
+	if r == nil {
+		err = &ErrNotExist
+	} else {
+		options = protocol.StorageRecord_SaveOptions{MaxVersion: r.maxVersion, PrimaryIndexSplitting: r.splitting}
+		var t unix.Time
+		t.ChangeTo(unix.SecElapsed(r.created/1e9), int32(r.created%1e9))
+		created = &t
+	}
+	rs.sync.Unlock()
+	return
+}
+
+// Restore is like Save() but a new record is as if it first saved at created time, so it goes to the partition of that time.
+// created must be a unix time.
+func (rs *RecordsMemory) Restore(mt protocol.MediaTypeID, id [16]byte, rec []byte, options protocol.StorageRecord_SaveOptions, created protocol.Time) (err protocol.Error) {
+	var nano int64
+	nano, err = unixNano(created)
+	if err != nil {
+		return
+	}
+	err = rs.apply(recordsBatchOperation{kind: batchOperation_Save, mt: mt, id: id, data: cloneBytes(rec), options: options, created: nano})
+	return
+}
+
+// apply do one change directly on the store.
+func (rs *RecordsMemory) apply(op recordsBatchOperation) (err protocol.Error) {
+	var e *RecordEvent
+	rs.sync.Lock()
+	var r = rs.record(op.mt, op.id)
+	if r != nil && rs.indexed(op.mt) {
+		// Apply on a copy to keep the record unchanged if the change violates a unique index.
+		r = r.clone()
+	}
+	r, e, err = op.apply(r)
+	if err == nil && rs.indexed(op.mt) {
+		err = rs.checkIndexes(map[recordKey]*record{{op.mt, op.id}: r})
+	}
+	if err == nil {
+		rs.put(op.mt, op.id, r)
+	}
+	rs.sync.Unlock()
+	rs.dispatch(e)
+	return
+}
+
+func (rs *RecordsMemory) dispatch(e *RecordEvent) {
+	if e != nil {
+		rs.EventTarget.DispatchEvent(e)
+	}
+}
+
+// record return the record or nil if not exist. Caller must hold the lock.
+func (rs *RecordsMemory) record(mt protocol.MediaTypeID, id [16]byte) (r *record) {
+	var rm = rs.mediatypes[mt]
+	if rm != nil {
+		r = rm.records[id]
+	}
+	return
+}
+
+// put add, replace or remove (if r is nil) the record in the primary and secondary indexes. Caller must hold the lock.
+func (rs *RecordsMemory) put(mt protocol.MediaTypeID, id [16]byte, r *record) {
+	var rm = rs.mediatypes[mt]
+	if rm == nil {
+		if r == nil {
+			return
+		}
+		rm = &recordsMediatype{
+			records:    make(map[[16]byte]*record),
+			partitions: make(map[recordsPartitionKey]*recordsPartition),
+		}
+		rs.mediatypes[mt] = rm
+		var i = sort.Search(len(rs.mtIDs), func(i int) bool { return rs.mtIDs[i] >= uint64(mt) })
+		rs.mtIDs = append(rs.mtIDs, 0)
+		copy(rs.mtIDs[i+1:], rs.mtIDs[i:])
+		rs.mtIDs[i] = uint64(mt)
+	}
+
+	var old, exist = rm.records[id]
+	var i = sort.Search(len(rm.ids), func(i int) bool { return bytes.Compare(rm.ids[i][:], id[:]) >= 0 })
+	switch {
+	case r == nil && exist:
+		delete(rm.records, id)
+		rm.ids = append(rm.ids[:i], rm.ids[i+1:]...)
+		rm.unpartition(id, old)
+	case r != nil && !exist:
+		rm.records[id] = r
+		rm.ids = append(rm.ids, [16]byte{})
+		copy(rm.ids[i+1:], rm.ids[i:])
+		rm.ids[i] = id
+		rm.partition(id, r)
+	case r != nil:
+		rm.records[id] = r
+	}
+	rs.index(mt, id, r)
+}
+
+func newRecordEvent(op RecordOperation, mt protocol.MediaTypeID, id [16]byte, vo protocol.VersionOffset) (e *RecordEvent) {
+	e = &RecordEvent{}
+	e.Init(op, mt, id, vo)
+	return
+}
@@ -0,0 +1,285 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"libgo/protocol"
+	"libgo/syllab"
+	"libgo/time/unix"
+)
+
+var (
+	_ protocol.StorageRecords             = &RecordsMemory{}
+	_ protocol.StorageRecords_Partitioned = &RecordsMemory{}
+	_ protocol.StorageRecords_Indexed     = &RecordsMemory{}
+)
+
+type recordEventCounter struct{ events []*RecordEvent }
+
+func (rec *recordEventCounter) EventHandler(e protocol.Event) {
+	rec.events = append(rec.events, e.(*RecordEvent))
+}
+
+func TestRecordsMemory_Versions(t *testing.T) {
+	var rs RecordsMemory
+	rs.Init()
+	var listener recordEventCounter
+	rs.AddEventListener(RecordEvent_MediaType.ID(), &listener, protocol.AddEventListenerOptions{})
+
+	const mt protocol.MediaTypeID = 7
+	var id = [16]byte{1}
+	var options = protocol.StorageRecord_SaveOptions{MaxVersion: 3}
+	for i := 0; i < 5; i++ {
+		rs.Save(mt, id, []byte{byte(i)}, options)
+	}
+
+	var rec, numbers, err = rs.Get(mt, id, protocol.StorageRecord_LastLocalVersion)
+	if err != nil || rec[0] != 4 || numbers != 5 {
+		t.Errorf("Get(last) = %v, %v, %v, want [4], 5", rec, numbers, err)
+	}
+	rec, _, _ = rs.Get(mt, id, protocol.StorageRecord_NoVersion)
+	if rec[0] != 2 {
+		t.Errorf("Get(NoVersion) = %v, want oldest retained version [2]", rec)
+	}
+	if _, _, err = rs.Get(mt, id, 1); err != &ErrVersionNotExist {
+		t.Errorf("Get(1) error = %v, want ErrVersionNotExist due to retention", err)
+	}
+	if count, _ := rs.Count(mt, id, 0, 0); count != 3 {
+		t.Errorf("Count() = %v, want 3", count)
+	}
+
+	rs.DeleteVersion(mt, id, 3)
+	if _, _, err = rs.Get(mt, id, 3); err != &ErrVersionDeleted {
+		t.Errorf("Get(3) after DeleteVersion() error = %v, want ErrVersionDeleted", err)
+	}
+	if count, _ := rs.Count(mt, id, 0, 0); count != 2 {
+		t.Errorf("Count() after DeleteVersion() = %v, want 2", count)
+	}
+
+	var last, vo, _ = rs.Lock(mt, id)
+	if last[0] != 4 || vo != 4 {
+		t.Errorf("Lock() = %v, %v, want [4], 4", last, vo)
+	}
+	if err = rs.Save(mt, id, []byte{9}, options); err != &ErrRecordLocked {
+		t.Errorf("Save() on locked record error = %v, want ErrRecordLocked", err)
+	}
+	rs.Unlock(mt, id, []byte{5})
+	if ln, _ := rs.Length(mt, id, 5); ln != 1 {
+		t.Errorf("Length(5) = %v, want 1", ln)
+	}
+
+	// 5 Save, 1 DeleteVersion, 1 Unlock
+	if len(listener.events) != 7 {
+		t.Errorf("dispatched events = %v, want 7", len(listener.events))
+	}
+	var lastEvent = listener.events[len(listener.events)-1]
+	if lastEvent.Operation() != RecordOperation_Save || lastEvent.Version() != 5 || lastEvent.RecordMediaTypeID() != mt {
+		t.Errorf("last event = %+v, want save of version 5", lastEvent)
+	}
+}
+
+func TestRecordsMemory_Batch(t *testing.T) {
+	var rs RecordsMemory
+	rs.Init()
+	const mt protocol.MediaTypeID = 7
+	var order, inventory = [16]byte{1}, [16]byte{2}
+	rs.Save(mt, inventory, []byte{10}, protocol.StorageRecord_SaveOptions{})
+
+	var batch, _ = rs.Batch()
+	batch.Save(mt, order, []byte{1}, protocol.StorageRecord_SaveOptions{})
+	batch.Update(mt, inventory, []byte{9}, protocol.StorageRecord_NoVersion)
+	batch.Update(mt, [16]byte{3}, []byte{9}, protocol.StorageRecord_NoVersion)
+	if err := batch.Commit(); err != &ErrNotExist {
+		t.Fatalf("Commit() error = %v, want ErrNotExist", err)
+	}
+	if num, _ := rs.RecordNumbers(mt); num != 1 {
+		t.Errorf("failed Commit() apply some changes")
+	}
+
+	batch, _ = rs.Batch()
+	batch.Save(mt, order, []byte{1}, protocol.StorageRecord_SaveOptions{})
+	batch.Update(mt, inventory, []byte{9}, protocol.StorageRecord_NoVersion)
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	var rec, _, _ = rs.Get(mt, inventory, protocol.StorageRecord_NoVersion)
+	if rec[0] != 9 {
+		t.Errorf("Get(inventory) = %v, want [9]", rec)
+	}
+	if ids, _ := rs.ListRecords(mt, 0, 10); len(ids) != 2 || ids[0] != order {
+		t.Errorf("ListRecords() = %v", ids)
+	}
+}
+
+func TestRecordsMemory_Partitions(t *testing.T) {
+	var rs RecordsMemory
+	rs.Init()
+	const mt protocol.MediaTypeID = 7
+	var daily = protocol.StorageRecord_SaveOptions{PrimaryIndexSplitting: protocol.StorageRecord_IndexSplitting_Day}
+	rs.Save(mt, [16]byte{1}, []byte{1}, daily)
+	rs.Save(mt, [16]byte{2}, []byte{2}, daily)
+	rs.Save(mt, [16]byte{3}, []byte{3}, protocol.StorageRecord_SaveOptions{})
+	rs.Save(mt, [16]byte{1}, []byte{4}, protocol.StorageRecord_SaveOptions{})
+
+	var now = unix.Now()
+	var start, end = recordsPartitionRange(protocol.StorageRecord_IndexSplitting_Day, int64(now.NanoElapsed()))
+	var from, to, past unix.Time
+	from.ChangeTo(unix.SecElapsed(start/1e9), 0)
+	to.ChangeTo(unix.SecElapsed(end/1e9), 0)
+	past.ChangeTo(unix.SecElapsed(start/1e9-24*60*60), 0)
+
+	if num, _ := rs.RecordNumbersIn(mt, &from, &to); num != 2 {
+		t.Errorf("RecordNumbersIn(today) = %v, want 2", num)
+	}
+	if num, _ := rs.RecordNumbersIn(mt, &past, &from); num != 0 {
+		t.Errorf("RecordNumbersIn(yesterday) = %v, want 0", num)
+	}
+	if ids, _ := rs.ListRecordsIn(mt, &from, &to, 1, 10); len(ids) != 1 || ids[0] != [16]byte{2} {
+		t.Errorf("ListRecordsIn(today, 1, 10) = %v, want second saved record", ids)
+	}
+
+	if num, _ := rs.DropPartitions(mt, &now); num != 0 {
+		t.Errorf("DropPartitions() of open partition = %v, want 0", num)
+	}
+	if num, _ := rs.DropPartitions(mt, &to); num != 2 {
+		t.Errorf("DropPartitions() = %v, want 2", num)
+	}
+	if ids, _ := rs.ListRecords(mt, 0, 10); len(ids) != 1 || ids[0] != [16]byte{3} {
+		t.Errorf("ListRecords() after DropPartitions() = %v, want just not split record", ids)
+	}
+	if len(rs.mediatypes[mt].partitions) != 0 {
+		t.Errorf("DropPartitions() leave %v empty partitions", len(rs.mediatypes[mt].partitions))
+	}
+	if len(rs.mediatypes[mt].partKeys) != 0 {
+		t.Errorf("DropPartitions() leave %v partition keys", len(rs.mediatypes[mt].partKeys))
+	}
+}
+
+func TestRecordsMediatype_PartitionsIn(t *testing.T) {
+	var rm = recordsMediatype{partitions: make(map[recordsPartitionKey]*recordsPartition)}
+	var at = func(month time.Month, day, hour int) int64 {
+		return time.Date(2024, month, day, hour, 0, 0, 0, time.UTC).UnixNano()
+	}
+	var records = []record{
+		{created: at(6, 1, 10), splitting: protocol.StorageRecord_IndexSplitting_Hour},
+		{created: at(3, 1, 0), splitting: protocol.StorageRecord_IndexSplitting_Year},
+		{created: at(5, 31, 23), splitting: protocol.StorageRecord_IndexSplitting_Day},
+		{created: at(6, 1, 12), splitting: protocol.StorageRecord_IndexSplitting_Hour},
+	}
+	for i := range records {
+		rm.partition([16]byte{byte(i)}, &records[i])
+	}
+
+	var got []int64
+	rm.partitionsIn(at(6, 1, 0), at(6, 1, 11), func(p *recordsPartition) { got = append(got, p.entries[0].created) })
+	var want = []int64{at(3, 1, 0), at(6, 1, 10)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("partitionsIn() = %v, want %v", got, want)
+	}
+
+	rm.unpartition([16]byte{1}, &records[1])
+	got = nil
+	rm.partitionsIn(math.MinInt64, at(6, 1, 11), func(p *recordsPartition) { got = append(got, p.entries[0].created) })
+	if want = []int64{at(5, 31, 23), at(6, 1, 10)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("partitionsIn() after unpartition() = %v, want %v", got, want)
+	}
+}
+
+func TestRecordsPartitionRange(t *testing.T) {
+	var at = time.Date(2024, 2, 29, 13, 45, 0, 0, time.UTC) // Thursday
+	var tests = map[protocol.StorageRecord_IndexSplitting][2]time.Time{
+		protocol.StorageRecord_IndexSplitting_Hour:  {time.Date(2024, 2, 29, 13, 0, 0, 0, time.UTC), time.Date(2024, 2, 29, 14, 0, 0, 0, time.UTC)},
+		protocol.StorageRecord_IndexSplitting_Day:   {time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		protocol.StorageRecord_IndexSplitting_Week:  {time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)},
+		protocol.StorageRecord_IndexSplitting_Month: {time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		protocol.StorageRecord_IndexSplitting_Year:  {time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for splitting, want := range tests {
+		var start, end = recordsPartitionRange(splitting, at.UnixNano())
+		if start != want[0].UnixNano() || end != want[1].UnixNano() {
+			t.Errorf("recordsPartitionRange(%v) = %v, %v, want %v", splitting, time.Unix(0, start).UTC(), time.Unix(0, end).UTC(), want)
+		}
+	}
+}
+
+// testUser is a Syllab encoded record with a status(1) on stack index 0 and an email string on stack index 1.
+func testUser(status uint8, email string) (rec []byte) {
+	rec = make([]byte, 9+len(email))
+	syllab.SetUInt8(rec, 0, status)
+	syllab.SetString(rec, email, 1, 9)
+	return
+}
+
+func TestRecordsMemory_Indexes(t *testing.T) {
+	var rs RecordsMemory
+	rs.Init()
+	const mt protocol.MediaTypeID = 7
+	var alice, bob, carol = [16]byte{1}, [16]byte{2}, [16]byte{3}
+	rs.Save(mt, alice, testUser(1, "alice@example.com"), protocol.StorageRecord_SaveOptions{})
+	rs.Save(mt, bob, testUser(1, "alice@example.com"), protocol.StorageRecord_SaveOptions{})
+
+	var email = protocol.StorageRecord_Index{Name: "email", StackIndex: 1, Type: protocol.StorageRecord_IndexType_String, Unique: true}
+	if err := rs.RegisterIndex(mt, email); err != &ErrIndexUnique {
+		t.Fatalf("RegisterIndex() on duplicate values error = %v, want ErrIndexUnique", err)
+	}
+	rs.Save(mt, bob, testUser(1, "bob@example.com"), protocol.StorageRecord_SaveOptions{})
+	if err := rs.RegisterIndex(mt, email); err != nil {
+		t.Fatalf("RegisterIndex() error = %v", err)
+	}
+	rs.RegisterIndex(mt, protocol.StorageRecord_Index{Name: "status", StackIndex: 0, Type: protocol.StorageRecord_IndexType_UInt8})
+
+	if id, _ := rs.FindRecord(mt, "email", []byte("bob@example.com")); id != bob {
+		t.Errorf("FindRecord(bob) = %v", id)
+	}
+	if err := rs.Save(mt, carol, testUser(2, "bob@example.com"), protocol.StorageRecord_SaveOptions{}); err != &ErrIndexUnique {
+		t.Errorf("Save() duplicate email error = %v, want ErrIndexUnique", err)
+	}
+	if num, _ := rs.RecordNumbers(mt); num != 2 {
+		t.Errorf("rejected Save() add the record")
+	}
+
+	// Swap emails in one batch is valid, but a batch that make duplicates must not change anything.
+	var batch, _ = rs.Batch()
+	batch.Save(mt, alice, testUser(1, "bob@example.com"), protocol.StorageRecord_SaveOptions{})
+	batch.Save(mt, bob, testUser(1, "alice@example.com"), protocol.StorageRecord_SaveOptions{})
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Commit() swap error = %v", err)
+	}
+	batch, _ = rs.Batch()
+	batch.Save(mt, carol, testUser(2, "carol@example.com"), protocol.StorageRecord_SaveOptions{})
+	batch.Update(mt, alice, testUser(1, "carol@example.com"), protocol.StorageRecord_LastLocalVersion)
+	if err := batch.Commit(); err != &ErrIndexUnique {
+		t.Fatalf("Commit() duplicate error = %v, want ErrIndexUnique", err)
+	}
+	if id, _ := rs.FindRecord(mt, "email", []byte("bob@example.com")); id != alice {
+		t.Errorf("FindRecord(bob) after swap = %v, want alice", id)
+	}
+
+	rs.Lock(mt, bob)
+	if err := rs.Unlock(mt, bob, testUser(1, "bob@example.com")); err != &ErrIndexUnique {
+		t.Errorf("Unlock() duplicate error = %v, want ErrIndexUnique", err)
+	}
+	rs.Unlock(mt, bob, testUser(2, "bob2@example.com"))
+	if ids, _ := rs.FindRecords(mt, "status", []byte{1}, 0, 10); len(ids) != 1 || ids[0] != alice {
+		t.Errorf("FindRecords(status=1) = %v, want alice", ids)
+	}
+
+	rs.Delete(mt, alice)
+	if _, err := rs.FindRecord(mt, "email", []byte("bob@example.com")); err != &ErrNotExist {
+		t.Errorf("FindRecord() of deleted record error = %v, want ErrNotExist", err)
+	}
+	rs.DeleteVersion(mt, bob, protocol.StorageRecord_LastLocalVersion)
+	if ids, _ := rs.FindRecords(mt, "status", []byte{2}, 0, 10); len(ids) != 0 {
+		t.Errorf("FindRecords() of deleted last version = %v", ids)
+	}
+
+	rs.DropIndex(mt, "email")
+	if _, err := rs.FindRecords(mt, "email", nil, 0, 10); err != &ErrNotExist {
+		t.Errorf("FindRecords() of dropped index error = %v, want ErrNotExist", err)
+	}
+}
@@ -0,0 +1,84 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/protocol"
+	"libgo/syllab"
+)
+
+type snapshotKind uint8
+
+const (
+	snapshotKind_Unset snapshotKind = iota
+	snapshotKind_KeyValue
+	snapshotKind_Object
+	snapshotKind_RecordVersion
+	snapshotKind_Directory
+	snapshotKind_File
+	snapshotKind_End
+)
+
+// snapshotEntry is one frame of a Snapshot stream.
+type snapshotEntry struct {
+	kind    snapshotKind
+	mt      protocol.MediaTypeID
+	id      [16]byte
+	version uint64 // sequence of the record version, or number of entries for snapshotKind_End
+	key     []byte // key of the key-value, or path of the file or directory relative to the files root
+	data    []byte
+	ttl     protocol.Duration // remaining TTL of the key-value at dump time, 0 means no TTL
+
+	// Save options of the record version
+	maxVersion protocol.VersionOffset
+	splitting  protocol.StorageRecord_IndexSplitting
+	created    int64 // unix nano of the first save of the record
+}
+
+//libgo:impl libgo/protocol.Syllab
+func (e *snapshotEntry) CheckSyllab(payload []byte) (err protocol.Error) {
+	var ln = uint64(len(payload))
+	if ln < uint64(e.LenOfSyllabStack()) {
+		return &ErrCorrupted
+	}
+	for _, stackIndex := range [2]uint32{33, 41} {
+		var add = uint64(syllab.GetUInt32(payload, stackIndex))
+		var arrLen = uint64(syllab.GetUInt32(payload, stackIndex+4))
+		if add+arrLen > ln {
+			return &ErrCorrupted
+		}
+	}
+	return
+}
+func (e *snapshotEntry) FromSyllab(payload []byte, stackIndex uint32) {
+	e.kind = snapshotKind(syllab.GetUInt8(payload, stackIndex))
+	e.mt = protocol.MediaTypeID(syllab.GetUInt64(payload, stackIndex+1))
+	copy(e.id[:], payload[stackIndex+9:])
+	e.version = syllab.GetUInt64(payload, stackIndex+25)
+	e.key = syllab.GetByteArray(payload, stackIndex+33)
+	e.data = syllab.GetByteArray(payload, stackIndex+41)
+	e.ttl = protocol.Duration(syllab.GetUInt64(payload, stackIndex+49))
+	e.maxVersion = protocol.VersionOffset(syllab.GetUInt64(payload, stackIndex+57))
+	e.created = int64(syllab.GetUInt64(payload, stackIndex+65))
+	e.splitting = protocol.StorageRecord_IndexSplitting(syllab.GetUInt8(payload, stackIndex+73))
+}
+func (e *snapshotEntry) ToSyllab(payload []byte, stackIndex, heapIndex uint32) (freeHeapIndex uint32) {
+	syllab.SetUInt8(payload, stackIndex, uint8(e.kind))
+	syllab.SetUInt64(payload, stackIndex+1, uint64(e.mt))
+	syllab.SetArray(payload, stackIndex+9, e.id[:])
+	syllab.SetUInt64(payload, stackIndex+25, e.version)
+	syllab.SetUInt64(payload, stackIndex+49, uint64(e.ttl))
+	syllab.SetUInt64(payload, stackIndex+57, uint64(e.maxVersion))
+	syllab.SetUInt64(payload, stackIndex+65, uint64(e.created))
+	syllab.SetUInt8(payload, stackIndex+73, uint8(e.splitting))
+	heapIndex = syllab.SetByteArray(payload, e.key, stackIndex+33, heapIndex)
+	freeHeapIndex = syllab.SetByteArray(payload, e.data, stackIndex+41, heapIndex)
+	return
+}
+func (e *snapshotEntry) LenOfSyllabStack() uint32 { return 74 }
+func (e *snapshotEntry) LenOfSyllabHeap() uint32  { return uint32(len(e.key) + len(e.data)) }
+
+// LenAsSyllab don't use LenOfSyllabHeap() that overflow for entries of 4GiB or more.
+func (e *snapshotEntry) LenAsSyllab() uint64 {
+	return uint64(e.LenOfSyllabStack()) + uint64(len(e.key)) + uint64(len(e.data))
+}
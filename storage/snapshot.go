@@ -0,0 +1,495 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"io"
+	"strings"
+
+	"libgo/binary"
+	"libgo/protocol"
+	"libgo/time/unix"
+)
+
+// Snapshot dump all local storages of an app to a portable stream and restore them from it e.g. to backup or migrate data.
+// Stream is a header and a sequence of frames:
+//   - header: Snapshot_MediaType ID(8) + format version(1) + compress type ID(8) that is zero for no compression.
+//   - frame: payload length(4) + payload. Payload is a Syllab encoded snapshotEntry that is compressed alone if the stream
+//     is compressed, so restore can skip frames without decode them. Payload can't be more than snapshot_MaxFrameLen,
+//     so Dump() fail with ErrFrameTooLarge for a larger entry and Restore() fail with ErrCorrupted for a larger frame.
+//   - The last frame is a snapshotKind_End entry that hold the number of entries before it, to detect a truncated stream.
+//
+// Key-values dump with their remaining TTL if the storage is a protocol.StorageKeyValue_Expiration, and restore with it
+// from the restore time. Records dump all retained versions with their MaxVersion and PrimaryIndexSplitting,
+// and restore with them. First save time of records also restore if both storages are protocol.StorageRecords_Restore,
+// so restored records stay in the same partitions.
+// Shared files aren't in a snapshot due to they belong to the OS GUI app, not the app that own the storages.
+type Snapshot struct {
+	// CompressType compress frames of Dump() stream if it isn't nil.
+	CompressType    protocol.CompressType
+	CompressOptions protocol.CompressOptions
+	// CompressTypes find the compress type of Restore() stream. nil means protocol.OS
+	CompressTypes protocol.CompressTypes
+}
+
+const (
+	snapshot_Version     = 3
+	snapshot_HeaderLen   = 17
+	snapshot_FrameLenLen = 4
+	// snapshot_MaxFrameLen limit the payload of a frame, so a corrupted or hostile stream can't force a huge allocation.
+	snapshot_MaxFrameLen = 1 << 30
+	// snapshot_PageSize is the number of ids that list from storages in each call.
+	snapshot_PageSize = 256
+)
+
+// Dump write all data of stg local storages to w. num is the number of written entries.
+func (s *Snapshot) Dump(stg protocol.StoragesLocal, w io.Writer) (num uint64, err protocol.Error) {
+	var sw = snapshotWriter{s: s, w: w}
+	err = sw.writeHeader()
+	if err != nil {
+		return
+	}
+
+	err = sw.dumpKeyValues(stg.Local_KeyValues())
+	if err != nil {
+		return sw.num, err
+	}
+	err = sw.dumpObjects(stg.Local_Objects())
+	if err != nil {
+		return sw.num, err
+	}
+	err = sw.dumpRecords(stg.Local_Records())
+	if err != nil {
+		return sw.num, err
+	}
+	var root = stg.Local_Files()
+	err = sw.dumpFiles(root, root.Metadata().URI().Path())
+	if err != nil {
+		return sw.num, err
+	}
+
+	num = sw.num
+	err = sw.write(&snapshotEntry{kind: snapshotKind_End, version: num})
+	return
+}
+
+// Restore apply entries of the stream r on stg local storages one by one, so data is visible as soon as it restored.
+// First skip entries read but don't apply, so a failed restore can resume by a new stream of the same snapshot
+// with skip equal to num that the failed call returned. num is the number of read entries include skipped ones.
+// Restore a record version is idempotent, so an entry that apply before a failure can apply again safely.
+func (s *Snapshot) Restore(stg protocol.StoragesLocal, r io.Reader, skip uint64) (num uint64, err protocol.Error) {
+	var sr = snapshotReader{s: s, r: r}
+	err = sr.readHeader()
+	if err != nil {
+		return
+	}
+
+	var e snapshotEntry
+	for {
+		err = sr.read(&e)
+		if err != nil {
+			break
+		}
+		if e.kind == snapshotKind_End {
+			if e.version != num {
+				err = &ErrCorrupted
+			}
+			break
+		}
+		if num >= skip {
+			err = restoreEntry(stg, &e)
+			if err != nil {
+				break
+			}
+		}
+		num++
+	}
+	return
+}
+
+func restoreEntry(stg protocol.StoragesLocal, e *snapshotEntry) (err protocol.Error) {
+	switch e.kind {
+	case snapshotKind_KeyValue:
+		err = stg.Local_KeyValues().Set(e.key, e.data, protocol.StorageKeyValue_SaveOptions{TTL: e.ttl})
+	case snapshotKind_Object:
+		err = stg.Local_Objects().Save(e.mt, e.id, e.data)
+	case snapshotKind_RecordVersion:
+		var rs = stg.Local_Records()
+		// Version sequence of the entry is the absolute version offset in the restored record,
+		// so the version restored before if the record has more versions.
+		var _, numbers, _ = rs.Get(e.mt, e.id, protocol.StorageRecord_LastLocalVersion)
+		if uint64(numbers) > e.version {
+			return
+		}
+		var options = protocol.StorageRecord_SaveOptions{MaxVersion: e.maxVersion, PrimaryIndexSplitting: e.splitting}
+		var restore, ok = rs.(protocol.StorageRecords_Restore)
+		if !ok {
+			return rs.Save(e.mt, e.id, e.data, options)
+		}
+		var created unix.Time
+		created.ChangeTo(unix.SecElapsed(e.created/1e9), int32(e.created%1e9))
+		err = restore.Restore(e.mt, e.id, e.data, options, &created)
+	case snapshotKind_Directory:
+		_, err = snapshotDirectory(stg.Local_Files(), string(e.key))
+	case snapshotKind_File:
+		var path = string(e.key)
+		var i = strings.LastIndexByte(path, '/')
+		var dir protocol.FileDirectory
+		dir, err = snapshotDirectory(stg.Local_Files(), path[:i+1])
+		if err != nil {
+			return
+		}
+		if !validFileName(path[i+1:]) {
+			return &ErrInvalidPath
+		}
+		var f protocol.File
+		f, err = dir.File(path[i+1:])
+		if err != nil {
+			return
+		}
+		var fd = f.Data()
+		_, err = fd.Unmarshal(e.data)
+		if err != nil {
+			return
+		}
+		err = fd.Save()
+	default:
+		err = &ErrCorrupted
+	}
+	return
+}
+
+// snapshotDirectory return the directory in given path relative to root and make it if not exist.
+func snapshotDirectory(root protocol.FileDirectory, path string) (dir protocol.FileDirectory, err protocol.Error) {
+	dir = root
+	for _, name := range splitURIPath(path) {
+		if !validFileName(name) {
+			return nil, &ErrInvalidPath
+		}
+		dir, err = dir.Directory(name)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+type snapshotWriter struct {
+	s   *Snapshot
+	w   io.Writer
+	num uint64
+	buf []byte
+}
+
+func (sw *snapshotWriter) writeHeader() (err protocol.Error) {
+	var header [snapshot_HeaderLen]byte
+	binary.LittleEndian(header[0:]).PutUint64(uint64(Snapshot_MediaType.ID()))
+	header[8] = snapshot_Version
+	if sw.s.CompressType != nil {
+		binary.LittleEndian(header[9:]).PutUint64(uint64(sw.s.CompressType.MediaType().ID()))
+	}
+	var _, goErr = sw.w.Write(header[:])
+	if goErr != nil {
+		err = &ErrStream
+	}
+	return
+}
+
+func (sw *snapshotWriter) write(e *snapshotEntry) (err protocol.Error) {
+	var entryLen = e.LenAsSyllab()
+	if entryLen > snapshot_MaxFrameLen {
+		return &ErrFrameTooLarge
+	}
+	var ln = snapshot_FrameLenLen + int(entryLen)
+	if cap(sw.buf) < ln {
+		sw.buf = make([]byte, ln)
+	}
+	var frame = sw.buf[:ln]
+	var payload = frame[snapshot_FrameLenLen:]
+	e.ToSyllab(payload, 0, e.LenOfSyllabStack())
+
+	if sw.s.CompressType != nil {
+		var compressed protocol.Codec
+		compressed, err = sw.s.CompressType.CompressBySlice(payload, sw.s.CompressOptions)
+		if err != nil {
+			return
+		}
+		payload, err = compressed.Marshal()
+		if err != nil {
+			return
+		}
+		frame = make([]byte, snapshot_FrameLenLen, snapshot_FrameLenLen+len(payload))
+		frame = append(frame, payload...)
+	}
+
+	if len(payload) > snapshot_MaxFrameLen {
+		return &ErrFrameTooLarge
+	}
+	binary.LittleEndian(frame).PutUint32(uint32(len(payload)))
+	var _, goErr = sw.w.Write(frame)
+	if goErr != nil {
+		return &ErrStream
+	}
+	if e.kind != snapshotKind_End {
+		sw.num++
+	}
+	return
+}
+
+func (sw *snapshotWriter) dumpKeyValues(kv protocol.StorageKeyValue) (err protocol.Error) {
+	var it = snapshotKeyValueIterator{sw: sw}
+	it.expiration, _ = kv.(protocol.StorageKeyValue_Expiration)
+	err = kv.Scan(nil, nil, protocol.StorageKeyValue_ScanOptions{}, &it)
+	if err == nil {
+		err = it.err
+	}
+	return
+}
+
+type snapshotKeyValueIterator struct {
+	sw         *snapshotWriter
+	expiration protocol.StorageKeyValue_Expiration // nil if the storage can't tell TTL of keys
+	err        protocol.Error
+}
+
+//libgo:impl libgo/protocol.Iterate_KV
+func (it *snapshotKeyValueIterator) Iterate(key, value []byte) (breaking bool) {
+	var ttl protocol.Duration
+	if it.expiration != nil {
+		ttl, it.err = it.expiration.TTL(key)
+		if it.err == &ErrNotExist {
+			// Expired or deleted after scanned.
+			it.err = nil
+			return
+		}
+		if it.err != nil {
+			return true
+		}
+	}
+	it.err = it.sw.write(&snapshotEntry{kind: snapshotKind_KeyValue, key: key, data: value, ttl: ttl})
+	return it.err != nil
+}
+
+func (sw *snapshotWriter) dumpObjects(objects protocol.StorageObjects) (err protocol.Error) {
+	var mts []uint64
+	mts, err = snapshotMediatypes(objects.MediatypeNumbers, objects.ListMediatypeIDs)
+	if err != nil {
+		return
+	}
+	for _, mt := range mts {
+		for offset := uint64(0); ; offset += snapshot_PageSize {
+			var ids [][16]byte
+			ids, err = objects.ListObjects(protocol.MediaTypeID(mt), offset, snapshot_PageSize)
+			if err != nil {
+				return
+			}
+			for _, id := range ids {
+				var object []byte
+				object, err = objects.Get(protocol.MediaTypeID(mt), id)
+				if err == &ErrNotExist {
+					// Deleted after listed.
+					err = nil
+					continue
+				}
+				if err != nil {
+					return
+				}
+				err = sw.write(&snapshotEntry{kind: snapshotKind_Object, mt: protocol.MediaTypeID(mt), id: id, data: object})
+				if err != nil {
+					return
+				}
+			}
+			if len(ids) < snapshot_PageSize {
+				break
+			}
+		}
+	}
+	return
+}
+
+func (sw *snapshotWriter) dumpRecords(records protocol.StorageRecords) (err protocol.Error) {
+	var mts []uint64
+	mts, err = snapshotMediatypes(records.MediatypeNumbers, records.ListMediatypeIDs)
+	if err != nil {
+		return
+	}
+	for _, mt := range mts {
+		for offset := uint64(0); ; offset += snapshot_PageSize {
+			var ids [][16]byte
+			ids, err = records.ListRecords(protocol.MediaTypeID(mt), offset, snapshot_PageSize)
+			if err != nil {
+				return
+			}
+			for _, id := range ids {
+				err = sw.dumpRecord(records, protocol.MediaTypeID(mt), id)
+				if err != nil {
+					return
+				}
+			}
+			if len(ids) < snapshot_PageSize {
+				break
+			}
+		}
+	}
+	return
+}
+
+// dumpRecord write all retained versions of the record in order. Dropped and deleted versions don't write,
+// so version sequence of entries isn't the absolute version offset in the source.
+// Records of a storage that isn't protocol.StorageRecords_Restore dump without a version limit and partition.
+func (sw *snapshotWriter) dumpRecord(records protocol.StorageRecords, mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	var options = protocol.StorageRecord_SaveOptions{MaxVersion: protocol.StorageRecord_LastSourceVersion}
+	var created int64
+	if restore, ok := records.(protocol.StorageRecords_Restore); ok {
+		var t protocol.Time
+		options, t, err = restore.SaveOptions(mt, id)
+		if err == &ErrNotExist {
+			// Deleted after listed.
+			return nil
+		}
+		if err != nil {
+			return
+		}
+		created, err = unixNano(t)
+		if err != nil {
+			return
+		}
+	}
+	var _, numbers, _ = records.Get(mt, id, protocol.StorageRecord_LastLocalVersion)
+	var seq uint64
+	for vo := protocol.VersionOffset(0); vo < protocol.VersionOffset(numbers); vo++ {
+		if vo == protocol.StorageRecord_NoVersion {
+			// NoVersion address the oldest retained version, so just get it if it is the first version.
+			var count, _ = records.Count(mt, id, 0, 1)
+			if count == 0 {
+				continue
+			}
+		}
+		var rec []byte
+		rec, _, err = records.Get(mt, id, vo)
+		if err == &ErrVersionNotExist || err == &ErrVersionDeleted || err == &ErrNotExist {
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+		err = sw.write(&snapshotEntry{kind: snapshotKind_RecordVersion, mt: mt, id: id, version: seq, data: rec,
+			maxVersion: options.MaxVersion, splitting: options.PrimaryIndexSplitting, created: created})
+		if err != nil {
+			return
+		}
+		seq++
+	}
+	return
+}
+
+// dumpFiles write dir and all files and directories in it recursively. Paths in entries are relative to rootPath.
+func (sw *snapshotWriter) dumpFiles(dir protocol.FileDirectory, rootPath string) (err protocol.Error) {
+	var md = dir.Metadata()
+	for _, f := range dir.Files(0, uint64(md.FileNum())) {
+		var data []byte
+		data, err = f.Data().Marshal()
+		if err != nil {
+			return
+		}
+		var path = strings.TrimPrefix(f.Metadata().URI().Path(), rootPath)
+		err = sw.write(&snapshotEntry{kind: snapshotKind_File, key: []byte(path), data: data})
+		if err != nil {
+			return
+		}
+	}
+	for _, d := range dir.Directories(0, uint64(md.DirNum())) {
+		var path = strings.TrimPrefix(d.Metadata().URI().Path(), rootPath)
+		if !strings.HasSuffix(path, "/") {
+			path += "/"
+		}
+		err = sw.write(&snapshotEntry{kind: snapshotKind_Directory, key: []byte(path)})
+		if err != nil {
+			return
+		}
+		err = sw.dumpFiles(d, rootPath)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// snapshotMediatypes return all mediatype IDs that a storage list.
+func snapshotMediatypes(numbers func() (uint64, protocol.Error), list func(offset, limit uint64) ([]uint64, protocol.Error)) (mts []uint64, err protocol.Error) {
+	var num uint64
+	num, err = numbers()
+	if err != nil {
+		return
+	}
+	mts, err = list(0, num)
+	return
+}
+
+type snapshotReader struct {
+	s            *Snapshot
+	r            io.Reader
+	compressType protocol.CompressType
+	buf          []byte
+}
+
+func (sr *snapshotReader) readHeader() (err protocol.Error) {
+	var header [snapshot_HeaderLen]byte
+	var _, goErr = io.ReadFull(sr.r, header[:])
+	if goErr != nil {
+		return &ErrStream
+	}
+	if binary.LittleEndian(header[0:]).Uint64() != uint64(Snapshot_MediaType.ID()) || header[8] != snapshot_Version {
+		return &ErrCorrupted
+	}
+	var ctID = binary.LittleEndian(header[9:]).Uint64()
+	if ctID != 0 {
+		var cts = sr.s.CompressTypes
+		if cts == nil {
+			cts = protocol.OS
+		}
+		sr.compressType, err = cts.GetCompressTypeByID(ctID)
+	}
+	return
+}
+
+func (sr *snapshotReader) read(e *snapshotEntry) (err protocol.Error) {
+	var frameLen [snapshot_FrameLenLen]byte
+	var _, goErr = io.ReadFull(sr.r, frameLen[:])
+	if goErr != nil {
+		// Stream end before the snapshotKind_End entry.
+		return &ErrStream
+	}
+	var ln = int(binary.LittleEndian(frameLen[:]).Uint32())
+	if ln > snapshot_MaxFrameLen {
+		return &ErrCorrupted
+	}
+	if cap(sr.buf) < ln {
+		sr.buf = make([]byte, ln)
+	}
+	var payload = sr.buf[:ln]
+	_, goErr = io.ReadFull(sr.r, payload)
+	if goErr != nil {
+		return &ErrStream
+	}
+
+	if sr.compressType != nil {
+		var raw protocol.Codec
+		raw, err = sr.compressType.DecompressFromSlice(payload)
+		if err != nil {
+			return
+		}
+		payload, err = raw.Marshal()
+		if err != nil {
+			return
+		}
+	}
+
+	err = e.CheckSyllab(payload)
+	if err != nil {
+		return
+	}
+	e.FromSyllab(payload, 0)
+	return
+}
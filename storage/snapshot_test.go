@@ -0,0 +1,216 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"testing"
+	"time"
+
+	"libgo/protocol"
+)
+
+var _ protocol.Syllab = &snapshotEntry{}
+
+func testSnapshotSource(t *testing.T) (src *StoragesMemory) {
+	src = &StoragesMemory{}
+	src.Init()
+	src.Local_KeyValues().Set([]byte("k1"), []byte("v1"), protocol.StorageKeyValue_SaveOptions{})
+	src.Local_KeyValues().Set([]byte("k2"), []byte("v2"), protocol.StorageKeyValue_SaveOptions{})
+	src.Local_Objects().Save(3, [16]byte{1}, []byte("object"))
+
+	var rs = src.Local_Records()
+	var options = protocol.StorageRecord_SaveOptions{MaxVersion: 3, PrimaryIndexSplitting: protocol.StorageRecord_IndexSplitting_Day}
+	for i := 0; i < 5; i++ {
+		rs.Save(7, [16]byte{2}, []byte{byte(i)}, options)
+	}
+	rs.DeleteVersion(7, [16]byte{2}, 3)
+
+	var f, _ = src.Local_Files().File("index.html")
+	f.Data().Unmarshal([]byte("<html></html>"))
+	var d, _ = src.Local_Files().Directory("css")
+	f, _ = d.File("main.css")
+	f.Data().Unmarshal([]byte("body{}"))
+	src.Local_Files().Directory("empty")
+	return
+}
+
+func testSnapshotCheck(t *testing.T, dst *StoragesMemory) {
+	if v, _ := dst.Local_KeyValues().Get([]byte("k2")); string(v) != "v2" {
+		t.Errorf("key-value = %q, want v2", v)
+	}
+	if o, _ := dst.Local_Objects().Get(3, [16]byte{1}); string(o) != "object" {
+		t.Errorf("object = %q, want object", o)
+	}
+	// Versions 2 and 4 retained and not deleted in the source.
+	var rec, numbers, _ = dst.Local_Records().Get(7, [16]byte{2}, protocol.StorageRecord_LastLocalVersion)
+	if numbers != 2 || !bytes.Equal(rec, []byte{4}) {
+		t.Errorf("record last version = %v, numbers = %v, want [4], 2", rec, numbers)
+	}
+	if rec, _, _ = dst.Local_Records().Get(7, [16]byte{2}, 0); !bytes.Equal(rec, []byte{2}) {
+		t.Errorf("record first version = %v, want [2]", rec)
+	}
+	var f, err = dst.Local_Files().FileByPath("css/main.css")
+	if err != nil {
+		t.Fatalf("FileByPath() error = %v", err)
+	}
+	if data, _ := f.Data().Marshal(); string(data) != "body{}" {
+		t.Errorf("file data = %q, want body{}", data)
+	}
+	if num := dst.Local_Files().Metadata().DirNum(); num != 2 {
+		t.Errorf("DirNum() = %v, want 2", num)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	var src = testSnapshotSource(t)
+	defer src.Deinit()
+
+	var s Snapshot
+	var stream bytes.Buffer
+	var num, err = s.Dump(src, &stream)
+	if err != nil {
+		t.Fatalf("Dump() error = %v", err)
+	}
+	// 2 key-values, 1 object, 2 record versions, 2 directories and 2 files
+	if num != 9 {
+		t.Errorf("Dump() = %v, want 9", num)
+	}
+	// Restore later than the dump, so restored records can't get the source first save time by chance.
+	time.Sleep(time.Millisecond)
+
+	var dst StoragesMemory
+	dst.Init()
+	defer dst.Deinit()
+	num, err = s.Restore(&dst, bytes.NewReader(stream.Bytes()), 0)
+	if err != nil || num != 9 {
+		t.Fatalf("Restore() = %v, %v", num, err)
+	}
+	testSnapshotCheck(t, &dst)
+
+	// Retention, partitioning and first save time of records restore as they were.
+	var wantOptions, wantCreated, _ = src.records.SaveOptions(7, [16]byte{2})
+	var options, created, _ = dst.records.SaveOptions(7, [16]byte{2})
+	var want, _ = unixNano(wantCreated)
+	var got, _ = unixNano(created)
+	if options != wantOptions || got != want {
+		t.Errorf("restored SaveOptions() = %v, %v, want %v, %v", options, got, wantOptions, want)
+	}
+
+	var bad = append([]byte(nil), stream.Bytes()...)
+	bad[0]++
+	if _, err = s.Restore(&dst, bytes.NewReader(bad), 0); err != &ErrCorrupted {
+		t.Errorf("Restore() of bad header error = %v, want ErrCorrupted", err)
+	}
+
+	var huge = append([]byte(nil), stream.Bytes()[:snapshot_HeaderLen]...)
+	huge = append(huge, 0xFF, 0xFF, 0xFF, 0xFF)
+	if _, err = s.Restore(&dst, bytes.NewReader(huge), 0); err != &ErrCorrupted {
+		t.Errorf("Restore() of too large frame error = %v, want ErrCorrupted", err)
+	}
+}
+
+func TestSnapshot_resume(t *testing.T) {
+	var src = testSnapshotSource(t)
+	defer src.Deinit()
+	var s Snapshot
+	var stream bytes.Buffer
+	s.Dump(src, &stream)
+
+	var dst StoragesMemory
+	dst.Init()
+	defer dst.Deinit()
+	var truncated = stream.Bytes()[:stream.Len()*2/3]
+	var num, err = s.Restore(&dst, bytes.NewReader(truncated), 0)
+	if err != &ErrStream || num == 0 || num >= 9 {
+		t.Fatalf("Restore() of truncated stream = %v, %v, want ErrStream", num, err)
+	}
+
+	// Apply the last applied entry again must not duplicate a record version.
+	num, err = s.Restore(&dst, bytes.NewReader(stream.Bytes()), num-1)
+	if err != nil || num != 9 {
+		t.Fatalf("Restore() resume = %v, %v", num, err)
+	}
+	testSnapshotCheck(t, &dst)
+}
+
+// snapshotTestCompress is a flate protocol.CompressType that just implement methods that Snapshot use.
+type snapshotTestCompress struct {
+	protocol.CompressType
+	mt         mediaType
+	compressed int
+}
+
+func (c *snapshotTestCompress) MediaType() protocol.MediaType { return &c.mt }
+func (c *snapshotTestCompress) CompressBySlice(raw []byte, options protocol.CompressOptions) (compressed protocol.Codec, err protocol.Error) {
+	var buf bytes.Buffer
+	var w, _ = flate.NewWriter(&buf, flate.BestSpeed)
+	w.Write(raw)
+	w.Close()
+	c.compressed++
+	return snapshotTestCodec{data: buf.Bytes()}, nil
+}
+func (c *snapshotTestCompress) DecompressFromSlice(compressed []byte) (raw protocol.Codec, err protocol.Error) {
+	var data, goErr = io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+	if goErr != nil {
+		return nil, &ErrCorrupted
+	}
+	return snapshotTestCodec{data: data}, nil
+}
+
+type snapshotTestCodec struct {
+	protocol.Codec
+	data []byte
+}
+
+func (c snapshotTestCodec) Marshal() (data []byte, err protocol.Error) { return c.data, nil }
+
+type snapshotTestCompressTypes struct {
+	protocol.CompressTypes
+	ct protocol.CompressType
+}
+
+func (cts snapshotTestCompressTypes) GetCompressTypeByID(id uint64) (ct protocol.CompressType, err protocol.Error) {
+	if id != uint64(cts.ct.MediaType().ID()) {
+		return nil, &ErrNotExist
+	}
+	return cts.ct, nil
+}
+
+func TestSnapshot_compressAndTTL(t *testing.T) {
+	var src = testSnapshotSource(t)
+	defer src.Deinit()
+	src.Local_KeyValues().Set([]byte("session"), []byte("s1"), protocol.StorageKeyValue_SaveOptions{TTL: protocol.Duration(time.Hour)})
+
+	var ct snapshotTestCompress
+	ct.mt.Init("domain/libgo.scm.geniuses.group; package=storage; type=test; name=flate")
+	var s = Snapshot{CompressType: &ct, CompressTypes: snapshotTestCompressTypes{ct: &ct}}
+	var stream bytes.Buffer
+	var num, err = s.Dump(src, &stream)
+	if err != nil || num != 10 {
+		t.Fatalf("Dump() = %v, %v, want 10", num, err)
+	}
+	// All entries and the end entry compressed.
+	if ct.compressed != 11 {
+		t.Errorf("Dump() compressed %v frames, want 11", ct.compressed)
+	}
+
+	var dst StoragesMemory
+	dst.Init()
+	defer dst.Deinit()
+	num, err = s.Restore(&dst, bytes.NewReader(stream.Bytes()), 0)
+	if err != nil || num != 10 {
+		t.Fatalf("Restore() = %v, %v", num, err)
+	}
+	testSnapshotCheck(t, &dst)
+
+	var kv = dst.Local_KeyValues().(protocol.StorageKeyValue_Expiration)
+	if ttl, _ := kv.TTL([]byte("session")); ttl <= 0 || ttl > protocol.Duration(time.Hour) {
+		t.Errorf("TTL() of restored key = %v, want the source TTL", ttl)
+	}
+	if ttl, _ := kv.TTL([]byte("k1")); ttl != 0 {
+		t.Errorf("TTL() of restored key without TTL = %v, want 0", ttl)
+	}
+}
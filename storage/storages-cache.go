@@ -0,0 +1,55 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/protocol"
+)
+
+// StoragesCache implement protocol.StoragesCache by wrap storages of a protocol.StoragesDistributed,
+// and all of them share the embedded Cache memory budget and metric.
+type StoragesCache struct {
+	Cache
+
+	objects   ObjectsCache
+	records   RecordsCache
+	keyValues KeyValueCache
+	files     FilesCache
+}
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (sc *StoragesCache) Init(mode CacheMode, source protocol.StoragesDistributed) (err protocol.Error) {
+	err = sc.Cache.Init()
+	if err != nil {
+		return
+	}
+	sc.objects.Mode = mode
+	err = sc.objects.Init(&sc.Cache, source.Objects())
+	if err != nil {
+		return
+	}
+	sc.records.Mode = mode
+	err = sc.records.Init(&sc.Cache, source.Records())
+	if err != nil {
+		return
+	}
+	sc.keyValues.Mode = mode
+	err = sc.keyValues.Init(&sc.Cache, source.KeyValues())
+	if err != nil {
+		return
+	}
+	sc.files.Mode = mode
+	err = sc.files.Init(&sc.Cache, source.Files())
+	return
+}
+func (sc *StoragesCache) Deinit() (err protocol.Error) {
+	err = sc.records.Deinit()
+	sc.Cache.Deinit()
+	return
+}
+
+//libgo:impl libgo/protocol.StoragesCache
+func (sc *StoragesCache) Cache_Objects() protocol.StorageObjects    { return &sc.objects }
+func (sc *StoragesCache) Cache_Files() protocol.FileDirectory       { return &sc.files }
+func (sc *StoragesCache) Cache_Records() protocol.StorageRecords    { return &sc.records }
+func (sc *StoragesCache) Cache_KeyValues() protocol.StorageKeyValue { return &sc.keyValues }
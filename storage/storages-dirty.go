@@ -0,0 +1,109 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"sort"
+	"sync"
+)
+
+// storagesDirty track keys that changed on the local tier but not synced to the distributed tier yet.
+type storagesDirty struct {
+	sync    sync.Mutex
+	seq     uint64
+	entries map[string]dirtyEntry
+}
+
+type dirtyEntry struct {
+	seq       uint64 // increase on each change to know a key changed again while it is syncing
+	operation batchOperation
+	extra     uint64 // TTL of key-value Set or MaxVersion of record Save
+}
+
+type dirtyKey struct {
+	key string
+	dirtyEntry
+}
+
+func (sd *storagesDirty) init() { sd.entries = make(map[string]dirtyEntry) }
+
+// mark the key as dirty. An update after a save that isn't synced yet is part of the save.
+func (sd *storagesDirty) mark(key string, op batchOperation, extra uint64) {
+	sd.sync.Lock()
+	if e, ok := sd.entries[key]; ok && e.operation == batchOperation_Save && op == batchOperation_Update {
+		op, extra = e.operation, e.extra
+	}
+	sd.seq++
+	sd.entries[key] = dirtyEntry{seq: sd.seq, operation: op, extra: extra}
+	sd.sync.Unlock()
+}
+
+func (sd *storagesDirty) is(key string) (dirty bool) {
+	sd.sync.Lock()
+	_, dirty = sd.entries[key]
+	sd.sync.Unlock()
+	return
+}
+
+func (sd *storagesDirty) len() (ln int) {
+	sd.sync.Lock()
+	ln = len(sd.entries)
+	sd.sync.Unlock()
+	return
+}
+
+// keys return all dirty keys in stable order.
+func (sd *storagesDirty) keys() (keys []dirtyKey) {
+	sd.sync.Lock()
+	keys = make([]dirtyKey, 0, len(sd.entries))
+	for k, e := range sd.entries {
+		keys = append(keys, dirtyKey{k, e})
+	}
+	sd.sync.Unlock()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].seq < keys[j].seq })
+	return
+}
+
+// clean remove the key if it doesn't change after given dirty key get by keys().
+func (sd *storagesDirty) clean(dk dirtyKey) {
+	sd.sync.Lock()
+	if e, ok := sd.entries[dk.key]; ok && e.seq == dk.seq {
+		delete(sd.entries, dk.key)
+	}
+	sd.sync.Unlock()
+}
+
+// changed report the key changed again after given dirty key get by keys().
+func (sd *storagesDirty) changed(dk dirtyKey) (changed bool) {
+	sd.sync.Lock()
+	var e, ok = sd.entries[dk.key]
+	changed = ok && e.seq != dk.seq
+	sd.sync.Unlock()
+	return
+}
+
+// tierLocks remember which tier locked a key to unlock it on the same tier.
+type tierLocks struct {
+	sync   sync.Mutex
+	remote map[string]bool
+}
+
+func (tl *tierLocks) lock(key string, remote bool) {
+	tl.sync.Lock()
+	if tl.remote == nil {
+		tl.remote = make(map[string]bool)
+	}
+	tl.remote[key] = remote
+	tl.sync.Unlock()
+}
+
+// unlock return the tier that locked the key, or the given default tier if the key not locked by the tiers.
+func (tl *tierLocks) unlock(key string, remote bool) bool {
+	tl.sync.Lock()
+	if r, ok := tl.remote[key]; ok {
+		delete(tl.remote, key)
+		remote = r
+	}
+	tl.sync.Unlock()
+	return remote
+}
@@ -0,0 +1,335 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"sort"
+
+	"libgo/protocol"
+)
+
+// keyValueTiers implement protocol.StorageKeyValue for Storages.
+type keyValueTiers struct {
+	s      *Storages
+	local  protocol.StorageKeyValue
+	remote *KeyValueCache // distributed tier through the cache tier, nil in standalone mode
+	dirty  storagesDirty
+	locks  tierLocks
+}
+
+func (t *keyValueTiers) init(s *Storages, local protocol.StorageKeyValue, remote *KeyValueCache) {
+	t.s = s
+	t.local = local
+	t.remote = remote
+	t.dirty.init()
+}
+
+//libgo:impl libgo/protocol.StorageKeyValue
+func (t *keyValueTiers) KeyNumbers() (num uint64, err protocol.Error) {
+	if t.remoteRead("") {
+		num, err = t.remote.KeyNumbers()
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.KeyNumbers()
+}
+func (t *keyValueTiers) ListKeys(offset, limit uint64) (keys [][]byte, err protocol.Error) {
+	if t.remoteRead("") {
+		keys, err = t.remote.ListKeys(offset, limit)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.ListKeys(offset, limit)
+}
+
+// Scan read the range from the distributed tier and merge keys changed on the local tier and not synced yet.
+func (t *keyValueTiers) Scan(start, end []byte, options protocol.StorageKeyValue_ScanOptions, iterator protocol.Iterate_KV[[]byte]) (err protocol.Error) {
+	if t.remoteRead("") {
+		var remote kvCollector
+		err = t.reader().Scan(start, end, protocol.StorageKeyValue_ScanOptions{}, &remote)
+		if !t.s.unavailable(err) {
+			if err == nil {
+				t.overlay(remote.snapshot, start, end).iterate(options, iterator)
+			}
+			return
+		}
+	}
+	return t.local.Scan(start, end, options, iterator)
+}
+func (t *keyValueTiers) ScanPrefix(prefix []byte, options protocol.StorageKeyValue_ScanOptions, iterator protocol.Iterate_KV[[]byte]) (err protocol.Error) {
+	return t.Scan(prefix, prefixEnd(prefix), options, iterator)
+}
+func (t *keyValueTiers) Lock(key []byte) (value []byte, err protocol.Error) {
+	var k = string(key)
+	if t.remoteRead(k) {
+		value, err = t.remote.Lock(key)
+		if !t.s.unavailable(err) {
+			if err == nil {
+				t.locks.lock(k, true)
+			}
+			return
+		}
+	}
+	value, err = t.local.Lock(key)
+	if err == nil {
+		t.locks.lock(k, false)
+	}
+	return
+}
+func (t *keyValueTiers) Unlock(key []byte, value []byte) (err protocol.Error) {
+	var k = string(key)
+	if t.locks.unlock(k, t.remoteRead(k)) {
+		err = t.remote.Unlock(key, value)
+		return
+	}
+	err = t.local.Unlock(key, value)
+	if err == nil && value != nil {
+		t.mark(k, batchOperation_Set, 0)
+	}
+	return
+}
+func (t *keyValueTiers) Length(key []byte) (ln int, err protocol.Error) {
+	if t.remoteRead(string(key)) {
+		ln, err = t.reader().Length(key)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.Length(key)
+}
+func (t *keyValueTiers) Get(key []byte) (value []byte, err protocol.Error) {
+	if t.remoteRead(string(key)) {
+		value, err = t.reader().Get(key)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.Get(key)
+}
+func (t *keyValueTiers) Set(key []byte, value []byte, options protocol.StorageKeyValue_SaveOptions) (err protocol.Error) {
+	var k = string(key)
+	if t.remoteWrite(k) {
+		err = t.remote.Set(key, value, options)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	err = t.local.Set(key, value, options)
+	if err == nil {
+		t.mark(k, batchOperation_Set, uint64(options.TTL))
+	}
+	return
+}
+func (t *keyValueTiers) Delete(key []byte) (err protocol.Error) {
+	err = t.remove(key, batchOperation_Delete)
+	return
+}
+func (t *keyValueTiers) Erase(key []byte) (err protocol.Error) {
+	err = t.remove(key, batchOperation_Erase)
+	return
+}
+func (t *keyValueTiers) Batch() (batch protocol.StorageKeyValue_Batch, err protocol.Error) {
+	batch = &keyValueTiersBatch{t: t}
+	return
+}
+
+func (t *keyValueTiers) remove(key []byte, op batchOperation) (err protocol.Error) {
+	var k = string(key)
+	if t.remoteWrite(k) {
+		if op == batchOperation_Erase {
+			err = t.remote.Erase(key)
+		} else {
+			err = t.remote.Delete(key)
+		}
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	// Key may exist just on the distributed tier, so copy it to let the local tier remove it.
+	t.fault(k)
+	if op == batchOperation_Erase {
+		err = t.local.Erase(key)
+	} else {
+		err = t.local.Delete(key)
+	}
+	if err == nil {
+		t.mark(k, op, 0)
+	}
+	return
+}
+
+// remoteRead report the key must read from the distributed tier.
+func (t *keyValueTiers) remoteRead(key string) bool {
+	return t.remote != nil && t.s.available() && !t.dirty.is(key)
+}
+
+// remoteWrite report changes on the key must write to the distributed tier.
+func (t *keyValueTiers) remoteWrite(key string) bool {
+	return t.remote != nil && !t.s.writeBack() && !t.dirty.is(key)
+}
+
+func (t *keyValueTiers) reader() protocol.StorageKeyValue {
+	if t.s.ReadPolicy == StoragesReadPolicy_Direct {
+		return t.remote.Source()
+	}
+	return t.remote
+}
+
+// overlay return the snapshot of the distributed tier with dirty keys in [start, end) range apply on it.
+func (t *keyValueTiers) overlay(snapshot kvSnapshot, start, end []byte) kvSnapshot {
+	var dirty = t.dirty.keys()
+	if len(dirty) == 0 {
+		return snapshot
+	}
+	var pairs = make(map[string][]byte, len(snapshot))
+	for _, p := range snapshot {
+		pairs[string(p.key)] = p.value
+	}
+	for _, dk := range dirty {
+		if dk.key < string(start) || (end != nil && dk.key >= string(end)) {
+			continue
+		}
+		if dk.operation == batchOperation_Set {
+			var value, err = t.local.Get([]byte(dk.key))
+			if err == nil {
+				pairs[dk.key] = value
+				continue
+			}
+		}
+		delete(pairs, dk.key)
+	}
+
+	snapshot = snapshot[:0]
+	for k, v := range pairs {
+		snapshot = append(snapshot, kvPair{[]byte(k), v})
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return string(snapshot[i].key) < string(snapshot[j].key) })
+	return snapshot
+}
+
+// fault copy the key from the distributed tier to the local tier if it isn't exist there.
+func (t *keyValueTiers) fault(key string) {
+	if t.remote == nil || t.dirty.is(key) {
+		return
+	}
+	var k = []byte(key)
+	var _, err = t.local.Length(k)
+	if err == nil {
+		return
+	}
+	var value []byte
+	value, err = t.remote.Get(k)
+	if err == nil {
+		t.local.Set(k, value, protocol.StorageKeyValue_SaveOptions{})
+	} else {
+		t.s.unavailable(err)
+	}
+}
+
+func (t *keyValueTiers) mark(key string, op batchOperation, extra uint64) {
+	if t.remote != nil {
+		t.dirty.mark(key, op, extra)
+	}
+}
+
+// flush sync changes made on the local tier to the distributed tier.
+func (t *keyValueTiers) flush() (err protocol.Error) {
+	for _, dk := range t.dirty.keys() {
+		var key = []byte(dk.key)
+		switch dk.operation {
+		case batchOperation_Set:
+			var value []byte
+			value, err = t.local.Get(key)
+			if err == &ErrNotExist && !t.dirty.changed(dk) {
+				// The key expired on the local tier, so it must not remain on the distributed tier.
+				err = t.remote.Delete(key)
+				if t.s.unavailable(err) {
+					return
+				}
+				err = nil
+				break
+			}
+			if err != nil {
+				if t.dirty.changed(dk) {
+					err = nil
+					continue
+				}
+				return
+			}
+			err = t.remote.Set(key, value, protocol.StorageKeyValue_SaveOptions{TTL: protocol.Duration(dk.extra)})
+			if err != nil {
+				t.s.unavailable(err)
+				return
+			}
+		case batchOperation_Delete, batchOperation_Erase:
+			if dk.operation == batchOperation_Erase {
+				err = t.remote.Erase(key)
+			} else {
+				err = t.remote.Delete(key)
+			}
+			if t.s.unavailable(err) {
+				return
+			}
+			// Other errors means the key never synced to the distributed tier.
+			err = nil
+		}
+		t.dirty.clean(dk)
+	}
+	return
+}
+
+// keyValueTiersBatch queue changes and apply them all on one tier on Commit().
+type keyValueTiersBatch struct {
+	t *keyValueTiers
+	kvBatch
+}
+
+//libgo:impl libgo/protocol.StorageBatch
+func (b *keyValueTiersBatch) Commit() (err protocol.Error) {
+	err = b.close()
+	if err != nil {
+		return
+	}
+
+	var t = b.t
+	var remote = true
+	for _, op := range b.ops {
+		remote = remote && t.remoteWrite(op.key)
+	}
+	if remote {
+		err = b.commit(t.remote)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	// Keys that exist just on the distributed tier must copy to the local tier to let the local batch remove them.
+	for _, op := range b.ops {
+		if op.kind != batchOperation_Set {
+			t.fault(op.key)
+		}
+	}
+	err = b.commit(t.local)
+	if err == nil {
+		for _, op := range b.ops {
+			t.mark(op.key, op.kind, uint64(op.options.TTL))
+		}
+	}
+	return
+}
+
+func (b *keyValueTiersBatch) commit(kv protocol.StorageKeyValue) (err protocol.Error) {
+	var batch protocol.StorageKeyValue_Batch
+	batch, err = kv.Batch()
+	if err != nil {
+		return
+	}
+	err = b.replay(batch)
+	if err != nil {
+		batch.Discard()
+		return
+	}
+	err = batch.Commit()
+	return
+}
@@ -0,0 +1,61 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/protocol"
+)
+
+// StoragesMemory implement protocol.StoragesLocal by the in-memory storages of this package.
+// It is the default local tier of Storages and is useful to test apps without any non-volatile storage.
+type StoragesMemory struct {
+	objects     Objects
+	objectsData BlockMemory
+	objectsIdx  KeyValueMemory
+	records     RecordsMemory
+	keyValues   KeyValueMemory
+	files       FileDirectoryMemory
+	sharedFiles FileDirectoryMemory
+}
+
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (sm *StoragesMemory) Init() (err protocol.Error) {
+	err = sm.objectsIdx.Init()
+	if err != nil {
+		return
+	}
+	err = sm.objects.Init(&sm.objectsData, &sm.objectsIdx)
+	if err != nil {
+		return
+	}
+	err = sm.records.Init()
+	if err != nil {
+		return
+	}
+	err = sm.keyValues.Init()
+	if err != nil {
+		return
+	}
+	err = sm.files.Init()
+	if err != nil {
+		return
+	}
+	err = sm.sharedFiles.Init()
+	return
+}
+func (sm *StoragesMemory) Deinit() (err protocol.Error) {
+	sm.objects.Deinit()
+	sm.objectsIdx.Deinit()
+	sm.records.Deinit()
+	sm.keyValues.Deinit()
+	sm.files.Deinit()
+	err = sm.sharedFiles.Deinit()
+	return
+}
+
+//libgo:impl libgo/protocol.StoragesLocal
+func (sm *StoragesMemory) Local_Objects() protocol.StorageObjects    { return &sm.objects }
+func (sm *StoragesMemory) Local_Records() protocol.StorageRecords    { return &sm.records }
+func (sm *StoragesMemory) Local_KeyValues() protocol.StorageKeyValue { return &sm.keyValues }
+func (sm *StoragesMemory) Local_Files() protocol.FileDirectory       { return &sm.files }
+func (sm *StoragesMemory) Local_SharedFiles() protocol.FileDirectory { return &sm.sharedFiles }
@@ -0,0 +1,321 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/protocol"
+)
+
+// objectsTiers implement protocol.StorageObjects for Storages.
+// Any change on the local tier sync the whole object to the distributed tier.
+type objectsTiers struct {
+	s      *Storages
+	local  protocol.StorageObjects
+	remote *ObjectsCache // distributed tier through the cache tier, nil in standalone mode
+	dirty  storagesDirty
+	locks  tierLocks
+}
+
+func (t *objectsTiers) init(s *Storages, local protocol.StorageObjects, remote *ObjectsCache) {
+	t.s = s
+	t.local = local
+	t.remote = remote
+	t.dirty.init()
+}
+
+//libgo:impl libgo/protocol.StorageObjects
+func (t *objectsTiers) MediatypeNumbers() (num uint64, err protocol.Error) {
+	if t.remoteRead("") {
+		num, err = t.remote.MediatypeNumbers()
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.MediatypeNumbers()
+}
+func (t *objectsTiers) ListMediatypeIDs(offset, limit uint64) (ids []uint64, err protocol.Error) {
+	if t.remoteRead("") {
+		ids, err = t.remote.ListMediatypeIDs(offset, limit)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.ListMediatypeIDs(offset, limit)
+}
+func (t *objectsTiers) ObjectNumbers(mt protocol.MediaTypeID) (num uint64, err protocol.Error) {
+	if t.remoteRead("") {
+		num, err = t.remote.ObjectNumbers(mt)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.ObjectNumbers(mt)
+}
+func (t *objectsTiers) ListObjects(mt protocol.MediaTypeID, offset, limit uint64) (ids [][16]byte, err protocol.Error) {
+	if t.remoteRead("") {
+		ids, err = t.remote.ListObjects(mt, offset, limit)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.ListObjects(mt, offset, limit)
+}
+func (t *objectsTiers) Lock(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	var k = objectsTierKey(mt, id)
+	if t.remoteRead(k) {
+		err = t.remote.Lock(mt, id)
+		if !t.s.unavailable(err) {
+			if err == nil {
+				t.locks.lock(k, true)
+			}
+			return
+		}
+	}
+	err = t.local.Lock(mt, id)
+	if err == nil {
+		t.locks.lock(k, false)
+	}
+	return
+}
+func (t *objectsTiers) Unlock(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	var k = objectsTierKey(mt, id)
+	if t.locks.unlock(k, t.remoteRead(k)) {
+		return t.remote.Unlock(mt, id)
+	}
+	return t.local.Unlock(mt, id)
+}
+func (t *objectsTiers) Length(mt protocol.MediaTypeID, id [16]byte) (ln int, err protocol.Error) {
+	if t.remoteRead(objectsTierKey(mt, id)) {
+		ln, err = t.reader().Length(mt, id)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.Length(mt, id)
+}
+func (t *objectsTiers) Get(mt protocol.MediaTypeID, id [16]byte) (object []byte, err protocol.Error) {
+	if t.remoteRead(objectsTierKey(mt, id)) {
+		object, err = t.reader().Get(mt, id)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.Get(mt, id)
+}
+func (t *objectsTiers) Read(mt protocol.MediaTypeID, id [16]byte, offset, limit uint64) (data []byte, err protocol.Error) {
+	if t.remoteRead(objectsTierKey(mt, id)) {
+		data, err = t.reader().Read(mt, id, offset, limit)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.Read(mt, id, offset, limit)
+}
+func (t *objectsTiers) Save(mt protocol.MediaTypeID, id [16]byte, object []byte) (err protocol.Error) {
+	return t.change(mt, id, batchOperation_Save, func(objects protocol.StorageObjects) protocol.Error {
+		return objects.Save(mt, id, object)
+	})
+}
+func (t *objectsTiers) Write(mt protocol.MediaTypeID, id [16]byte, offset uint64, data []byte) (err protocol.Error) {
+	return t.change(mt, id, batchOperation_Write, func(objects protocol.StorageObjects) protocol.Error {
+		return objects.Write(mt, id, offset, data)
+	})
+}
+func (t *objectsTiers) Append(mt protocol.MediaTypeID, id [16]byte, data []byte) (err protocol.Error) {
+	return t.change(mt, id, batchOperation_Append, func(objects protocol.StorageObjects) protocol.Error {
+		return objects.Append(mt, id, data)
+	})
+}
+func (t *objectsTiers) Prepend(mt protocol.MediaTypeID, id [16]byte, data []byte) (err protocol.Error) {
+	return t.change(mt, id, batchOperation_Prepend, func(objects protocol.StorageObjects) protocol.Error {
+		return objects.Prepend(mt, id, data)
+	})
+}
+func (t *objectsTiers) Extend(mt protocol.MediaTypeID, id [16]byte, length uint64) (err protocol.Error) {
+	return t.change(mt, id, batchOperation_Extend, func(objects protocol.StorageObjects) protocol.Error {
+		return objects.Extend(mt, id, length)
+	})
+}
+func (t *objectsTiers) Delete(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	return t.change(mt, id, batchOperation_Delete, func(objects protocol.StorageObjects) protocol.Error {
+		return objects.Delete(mt, id)
+	})
+}
+func (t *objectsTiers) Erase(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	return t.change(mt, id, batchOperation_Erase, func(objects protocol.StorageObjects) protocol.Error {
+		return objects.Erase(mt, id)
+	})
+}
+func (t *objectsTiers) Batch() (batch protocol.StorageObjects_Batch, err protocol.Error) {
+	batch = &objectsTiersBatch{t: t}
+	return
+}
+
+// change do the change on the distributed tier or on the local tier by the storages policies.
+func (t *objectsTiers) change(mt protocol.MediaTypeID, id [16]byte, op batchOperation, do func(objects protocol.StorageObjects) protocol.Error) (err protocol.Error) {
+	var k = objectsTierKey(mt, id)
+	if t.remoteWrite(k) {
+		err = do(t.remote)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	if op != batchOperation_Save {
+		t.fault(mt, id)
+	}
+	err = do(t.local)
+	if err == nil {
+		t.mark(k, op)
+	}
+	return
+}
+
+// remoteRead report the object must read from the distributed tier.
+func (t *objectsTiers) remoteRead(key string) bool {
+	return t.remote != nil && t.s.available() && !t.dirty.is(key)
+}
+
+// remoteWrite report changes on the object must write to the distributed tier.
+func (t *objectsTiers) remoteWrite(key string) bool {
+	return t.remote != nil && !t.s.writeBack() && !t.dirty.is(key)
+}
+
+func (t *objectsTiers) reader() protocol.StorageObjects {
+	if t.s.ReadPolicy == StoragesReadPolicy_Direct {
+		return t.remote.Source()
+	}
+	return t.remote
+}
+
+// fault copy the object from the distributed tier to the local tier if it isn't exist there,
+// to let partial changes apply on the local tier.
+func (t *objectsTiers) fault(mt protocol.MediaTypeID, id [16]byte) {
+	if t.remote == nil || t.dirty.is(objectsTierKey(mt, id)) {
+		return
+	}
+	var _, err = t.local.Length(mt, id)
+	if err == nil {
+		return
+	}
+	var object []byte
+	object, err = t.remote.Get(mt, id)
+	if err == nil {
+		t.local.Save(mt, id, object)
+	} else {
+		t.s.unavailable(err)
+	}
+}
+
+func (t *objectsTiers) mark(key string, op batchOperation) {
+	if t.remote == nil {
+		return
+	}
+	if op != batchOperation_Delete && op != batchOperation_Erase {
+		op = batchOperation_Save
+	}
+	t.dirty.mark(key, op, 0)
+}
+
+// flush sync changes made on the local tier to the distributed tier.
+func (t *objectsTiers) flush() (err protocol.Error) {
+	for _, dk := range t.dirty.keys() {
+		var k objectKey
+		k.decode([]byte(dk.key))
+		switch dk.operation {
+		case batchOperation_Save:
+			var object []byte
+			object, err = t.local.Get(k.mt, k.id)
+			if err == &ErrNotExist && !t.dirty.changed(dk) {
+				// The object removed on the local tier, so it must not remain on the distributed tier.
+				err = t.remote.Delete(k.mt, k.id)
+				if t.s.unavailable(err) {
+					return
+				}
+				err = nil
+				break
+			}
+			if err != nil {
+				if t.dirty.changed(dk) {
+					err = nil
+					continue
+				}
+				return
+			}
+			err = t.remote.Save(k.mt, k.id, object)
+			if err != nil {
+				t.s.unavailable(err)
+				return
+			}
+		case batchOperation_Delete, batchOperation_Erase:
+			if dk.operation == batchOperation_Erase {
+				err = t.remote.Erase(k.mt, k.id)
+			} else {
+				err = t.remote.Delete(k.mt, k.id)
+			}
+			if t.s.unavailable(err) {
+				return
+			}
+			// Other errors means the object never synced to the distributed tier.
+			err = nil
+		}
+		t.dirty.clean(dk)
+	}
+	return
+}
+
+func objectsTierKey(mt protocol.MediaTypeID, id [16]byte) string {
+	return string(objectKey{mt, id}.encode())
+}
+
+// objectsTiersBatch queue changes and apply them all on one tier on Commit().
+type objectsTiersBatch struct {
+	t *objectsTiers
+	objectsBatch
+}
+
+//libgo:impl libgo/protocol.StorageBatch
+func (b *objectsTiersBatch) Commit() (err protocol.Error) {
+	if b.closed {
+		return &ErrBatchClosed
+	}
+	b.closed = true
+
+	var t = b.t
+	var remote = true
+	for _, op := range b.ops {
+		remote = remote && t.remoteWrite(objectsTierKey(op.mt, op.id))
+	}
+	if remote {
+		err = b.commit(t.remote)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	for _, op := range b.ops {
+		if op.kind != batchOperation_Save {
+			t.fault(op.mt, op.id)
+		}
+	}
+	err = b.commit(t.local)
+	if err == nil {
+		for _, op := range b.ops {
+			t.mark(objectsTierKey(op.mt, op.id), op.kind)
+		}
+	}
+	return
+}
+
+func (b *objectsTiersBatch) commit(objects protocol.StorageObjects) (err protocol.Error) {
+	var batch protocol.StorageObjects_Batch
+	batch, err = objects.Batch()
+	if err != nil {
+		return
+	}
+	err = b.replay(batch)
+	if err != nil {
+		batch.Discard()
+		return
+	}
+	err = batch.Commit()
+	return
+}
@@ -0,0 +1,373 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"libgo/protocol"
+)
+
+// recordsTiers implement protocol.StorageRecords for Storages.
+// Version offsets are local to each tier, so changes on the local tier sync to the distributed tier just by
+// the last local version of the record: as a new record for saves, and as a new version for other changes.
+// So write-back keep just the last version of the changes made before a flush, and Update() on the local tier
+// return ErrVersionNotLast for other versions than protocol.StorageRecord_LastLocalVersion.
+type recordsTiers struct {
+	s      *Storages
+	local  protocol.StorageRecords
+	remote *RecordsCache // distributed tier through the cache tier, nil in standalone mode
+	dirty  storagesDirty
+	locks  tierLocks
+}
+
+func (t *recordsTiers) init(s *Storages, local protocol.StorageRecords, remote *RecordsCache) {
+	t.s = s
+	t.local = local
+	t.remote = remote
+	t.dirty.init()
+}
+
+//libgo:impl libgo/protocol.StorageRecords
+func (t *recordsTiers) MediatypeNumbers() (num uint64, err protocol.Error) {
+	if t.remoteRead("") {
+		num, err = t.remote.MediatypeNumbers()
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.MediatypeNumbers()
+}
+func (t *recordsTiers) ListMediatypeIDs(offset, limit uint64) (ids []uint64, err protocol.Error) {
+	if t.remoteRead("") {
+		ids, err = t.remote.ListMediatypeIDs(offset, limit)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.ListMediatypeIDs(offset, limit)
+}
+func (t *recordsTiers) RecordNumbers(mt protocol.MediaTypeID) (num uint64, err protocol.Error) {
+	if t.remoteRead("") {
+		num, err = t.remote.RecordNumbers(mt)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.RecordNumbers(mt)
+}
+func (t *recordsTiers) ListRecords(mt protocol.MediaTypeID, offset, limit uint64) (ids [][16]byte, err protocol.Error) {
+	if t.remoteRead("") {
+		ids, err = t.remote.ListRecords(mt, offset, limit)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.ListRecords(mt, offset, limit)
+}
+func (t *recordsTiers) Lock(mt protocol.MediaTypeID, id [16]byte) (lastVersion []byte, vo protocol.VersionOffset, err protocol.Error) {
+	var k = objectsTierKey(mt, id)
+	if t.remoteRead(k) {
+		lastVersion, vo, err = t.remote.Lock(mt, id)
+		if !t.s.unavailable(err) {
+			if err == nil {
+				t.locks.lock(k, true)
+			}
+			return
+		}
+	}
+	t.fault(mt, id)
+	lastVersion, vo, err = t.local.Lock(mt, id)
+	if err == nil {
+		t.locks.lock(k, false)
+	}
+	return
+}
+func (t *recordsTiers) Unlock(mt protocol.MediaTypeID, id [16]byte, newVersion []byte) (err protocol.Error) {
+	var k = objectsTierKey(mt, id)
+	if t.locks.unlock(k, t.remoteRead(k)) {
+		return t.remote.Unlock(mt, id, newVersion)
+	}
+	err = t.local.Unlock(mt, id, newVersion)
+	if err == nil && newVersion != nil {
+		t.mark(k, batchOperation_Update, 0)
+	}
+	return
+}
+func (t *recordsTiers) Count(mt protocol.MediaTypeID, id [16]byte, offset, limit uint64) (numbers protocol.NumberOfVersion, err protocol.Error) {
+	if t.remoteRead(objectsTierKey(mt, id)) {
+		numbers, err = t.reader().Count(mt, id, offset, limit)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.Count(mt, id, offset, limit)
+}
+func (t *recordsTiers) Length(mt protocol.MediaTypeID, id [16]byte, vo protocol.VersionOffset) (ln int, err protocol.Error) {
+	if t.remoteRead(objectsTierKey(mt, id)) {
+		ln, err = t.reader().Length(mt, id, vo)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.Length(mt, id, vo)
+}
+func (t *recordsTiers) Get(mt protocol.MediaTypeID, id [16]byte, vo protocol.VersionOffset) (record []byte, numbers protocol.NumberOfVersion, err protocol.Error) {
+	if t.remoteRead(objectsTierKey(mt, id)) {
+		record, numbers, err = t.reader().Get(mt, id, vo)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	return t.local.Get(mt, id, vo)
+}
+func (t *recordsTiers) Save(mt protocol.MediaTypeID, id [16]byte, record []byte, options protocol.StorageRecord_SaveOptions) (err protocol.Error) {
+	var k = objectsTierKey(mt, id)
+	if t.remoteWrite(k) {
+		err = t.remote.Save(mt, id, record, options)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	err = t.local.Save(mt, id, record, options)
+	if err == nil {
+		t.mark(k, batchOperation_Save, uint64(options.MaxVersion))
+	}
+	return
+}
+func (t *recordsTiers) Update(mt protocol.MediaTypeID, id [16]byte, record []byte, vo protocol.VersionOffset) (err protocol.Error) {
+	return t.change(mt, id, batchOperation_Update, func(records protocol.StorageRecords) protocol.Error {
+		if records == t.local {
+			var err = t.localUpdate(vo)
+			if err != nil {
+				return err
+			}
+		}
+		return records.Update(mt, id, record, vo)
+	})
+}
+func (t *recordsTiers) Delete(mt protocol.MediaTypeID, id [16]byte) (err protocol.Error) {
+	return t.change(mt, id, batchOperation_Delete, func(records protocol.StorageRecords) protocol.Error {
+		return records.Delete(mt, id)
+	})
+}
+func (t *recordsTiers) DeleteVersion(mt protocol.MediaTypeID, id [16]byte, vo protocol.VersionOffset) (err protocol.Error) {
+	return t.change(mt, id, batchOperation_DeleteVersion, func(records protocol.StorageRecords) protocol.Error {
+		return records.DeleteVersion(mt, id, vo)
+	})
+}
+func (t *recordsTiers) Batch() (batch protocol.StorageRecords_Batch, err protocol.Error) {
+	batch = &recordsTiersBatch{t: t}
+	return
+}
+
+// Event listeners add to both tiers to receive changes on any of them.
+//
+//libgo:impl libgo/protocol.EventTarget
+func (t *recordsTiers) AddEventListener(domain protocol.MediaTypeID, callback protocol.EventListener, options protocol.AddEventListenerOptions) (err protocol.Error) {
+	err = t.local.AddEventListener(domain, callback, options)
+	if err == nil && t.remote != nil {
+		err = t.remote.AddEventListener(domain, callback, options)
+	}
+	return
+}
+func (t *recordsTiers) RemoveEventListener(domain protocol.MediaTypeID, callback protocol.EventListener, options protocol.EventListenerOptions) (err protocol.Error) {
+	err = t.local.RemoveEventListener(domain, callback, options)
+	if err == nil && t.remote != nil {
+		err = t.remote.RemoveEventListener(domain, callback, options)
+	}
+	return
+}
+func (t *recordsTiers) DispatchEvent(event protocol.Event) (err protocol.Error) {
+	return t.local.DispatchEvent(event)
+}
+
+// change do the change on the distributed tier or on the local tier by the storages policies.
+func (t *recordsTiers) change(mt protocol.MediaTypeID, id [16]byte, op batchOperation, do func(records protocol.StorageRecords) protocol.Error) (err protocol.Error) {
+	var k = objectsTierKey(mt, id)
+	if t.remoteWrite(k) {
+		err = do(t.remote)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	t.fault(mt, id)
+	err = do(t.local)
+	if err == nil {
+		t.mark(k, op, 0)
+	}
+	return
+}
+
+// remoteRead report the record must read from the distributed tier.
+func (t *recordsTiers) remoteRead(key string) bool {
+	return t.remote != nil && t.s.available() && !t.dirty.is(key)
+}
+
+// remoteWrite report changes on the record must write to the distributed tier.
+func (t *recordsTiers) remoteWrite(key string) bool {
+	return t.remote != nil && !t.s.writeBack() && !t.dirty.is(key)
+}
+
+// localUpdate check the version that an update on the local tier change, because just the last version sync to
+// the distributed tier.
+func (t *recordsTiers) localUpdate(vo protocol.VersionOffset) (err protocol.Error) {
+	if t.remote != nil && vo != protocol.StorageRecord_LastLocalVersion {
+		err = &ErrVersionNotLast
+	}
+	return
+}
+
+func (t *recordsTiers) reader() protocol.StorageRecords {
+	if t.s.ReadPolicy == StoragesReadPolicy_Direct {
+		return t.remote.Source()
+	}
+	return t.remote
+}
+
+// fault copy the last version of the record from the distributed tier to the local tier if it isn't exist there.
+func (t *recordsTiers) fault(mt protocol.MediaTypeID, id [16]byte) {
+	if t.remote == nil || t.dirty.is(objectsTierKey(mt, id)) {
+		return
+	}
+	var _, err = t.local.Count(mt, id, 0, 1)
+	if err == nil {
+		return
+	}
+	var record []byte
+	record, _, err = t.remote.Get(mt, id, protocol.StorageRecord_LastLocalVersion)
+	if err == nil {
+		t.local.Save(mt, id, record, protocol.StorageRecord_SaveOptions{MaxVersion: protocol.StorageRecord_NoVersion})
+	} else {
+		t.s.unavailable(err)
+	}
+}
+
+func (t *recordsTiers) mark(key string, op batchOperation, extra uint64) {
+	if t.remote == nil {
+		return
+	}
+	if op == batchOperation_DeleteVersion {
+		op = batchOperation_Update
+	}
+	t.dirty.mark(key, op, extra)
+}
+
+// flush sync changes made on the local tier to the distributed tier.
+func (t *recordsTiers) flush() (err protocol.Error) {
+	for _, dk := range t.dirty.keys() {
+		var k objectKey
+		k.decode([]byte(dk.key))
+		switch dk.operation {
+		case batchOperation_Save, batchOperation_Update:
+			var record []byte
+			record, _, err = t.local.Get(k.mt, k.id, protocol.StorageRecord_LastLocalVersion)
+			if err == &ErrNotExist && !t.dirty.changed(dk) {
+				// The record removed on the local tier, so it must not remain on the distributed tier.
+				err = t.remote.Delete(k.mt, k.id)
+				if t.s.unavailable(err) {
+					return
+				}
+				err = nil
+				break
+			}
+			if err != nil {
+				if t.dirty.changed(dk) {
+					err = nil
+					continue
+				}
+				return
+			}
+			err = t.sync(k, dk, record)
+			if err != nil {
+				t.s.unavailable(err)
+				return
+			}
+		case batchOperation_Delete:
+			err = t.remote.Delete(k.mt, k.id)
+			if t.s.unavailable(err) {
+				return
+			}
+			// Other errors means the record never synced to the distributed tier.
+			err = nil
+		}
+		t.dirty.clean(dk)
+	}
+	return
+}
+
+// sync the record as a new version on the distributed tier.
+// Lock() & Unlock() use to respect the record versioning options on the distributed tier.
+func (t *recordsTiers) sync(k objectKey, dk dirtyKey, record []byte) (err protocol.Error) {
+	if dk.operation == batchOperation_Save {
+		return t.remote.Save(k.mt, k.id, record, protocol.StorageRecord_SaveOptions{MaxVersion: protocol.VersionOffset(dk.extra)})
+	}
+	_, _, err = t.remote.Lock(k.mt, k.id)
+	if err != nil {
+		if t.s.unavailable(err) {
+			return
+		}
+		return t.remote.Save(k.mt, k.id, record, protocol.StorageRecord_SaveOptions{MaxVersion: protocol.StorageRecord_NoVersion})
+	}
+	err = t.remote.Unlock(k.mt, k.id, record)
+	return
+}
+
+// recordsTiersBatch queue changes and apply them all on one tier on Commit().
+type recordsTiersBatch struct {
+	t *recordsTiers
+	recordsBatch
+}
+
+//libgo:impl libgo/protocol.StorageBatch
+func (b *recordsTiersBatch) Commit() (err protocol.Error) {
+	err = b.close()
+	if err != nil {
+		return
+	}
+
+	var t = b.t
+	var remote = true
+	for _, op := range b.ops {
+		remote = remote && t.remoteWrite(objectsTierKey(op.mt, op.id))
+	}
+	if remote {
+		err = b.commit(t.remote)
+		if !t.s.unavailable(err) {
+			return
+		}
+	}
+	for _, op := range b.ops {
+		if op.kind == batchOperation_Update {
+			err = t.localUpdate(op.vo)
+			if err != nil {
+				return
+			}
+		}
+	}
+	for _, op := range b.ops {
+		if op.kind != batchOperation_Save {
+			t.fault(op.mt, op.id)
+		}
+	}
+	err = b.commit(t.local)
+	if err == nil {
+		for _, op := range b.ops {
+			t.mark(objectsTierKey(op.mt, op.id), op.kind, uint64(op.options.MaxVersion))
+		}
+	}
+	return
+}
+
+func (b *recordsTiersBatch) commit(records protocol.StorageRecords) (err protocol.Error) {
+	var batch protocol.StorageRecords_Batch
+	batch, err = records.Batch()
+	if err != nil {
+		return
+	}
+	err = b.replay(batch)
+	if err != nil {
+		batch.Discard()
+		return
+	}
+	err = batch.Commit()
+	return
+}
@@ -0,0 +1,228 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"libgo/protocol"
+	"libgo/time/monotonic"
+	"libgo/timer"
+)
+
+// Storages implement protocol.Storages by compose local, cache and distributed tiers of each storage kind,
+// so an app can assign it to protocol.STG and run standalone on one node or as a node of a cluster without glue code.
+//   - Without distributed tier (standalone) all storages serve by the local tier.
+//   - Reads serve by the distributed tier, through the cache tier if ReadPolicy is StoragesReadPolicy_ReadThrough.
+//   - Writes go to the distributed tier if WritePolicy is StoragesWritePolicy_WriteThrough, or go to the local tier
+//     and sync to the distributed tier every FlushInterval or by Flush() if it is StoragesWritePolicy_WriteBack.
+//   - When the distributed tier return a temporary or timeout error, it counts unavailable for RetryInterval and
+//     storages fall back to the local tier. Changes made in this period sync to the distributed tier like write-back.
+//   - Keys changed on the local tier and not synced yet always read from the local tier.
+type Storages struct {
+	ReadPolicy  StoragesReadPolicy
+	WritePolicy StoragesWritePolicy
+	// FlushInterval is the period to sync local changes to the distributed tier. Zero means storages_DefaultFlushInterval.
+	FlushInterval protocol.Duration
+	// RetryInterval is the period that the distributed tier counts unavailable after a temporary or timeout error.
+	// Zero means storages_DefaultRetryInterval.
+	RetryInterval protocol.Duration
+
+	local       protocol.StoragesLocal
+	distributed protocol.StoragesDistributed
+	memory      StoragesMemory // default local tier
+	cache       StoragesCache
+
+	objects   objectsTiers
+	records   recordsTiers
+	keyValues keyValueTiers
+
+	downUntil  atomic.Int64 // monotonic.Time
+	flushSync  sync.Mutex
+	flushing   atomic.Bool
+	flushTimer timer.Async
+}
+
+type StoragesReadPolicy uint8
+
+const (
+	// StoragesReadPolicy_ReadThrough read the cache tier first and fill it by reads from the distributed tier.
+	StoragesReadPolicy_ReadThrough StoragesReadPolicy = iota
+	// StoragesReadPolicy_Direct always read the distributed tier.
+	StoragesReadPolicy_Direct
+)
+
+type StoragesWritePolicy uint8
+
+const (
+	// StoragesWritePolicy_WriteThrough write to the distributed tier before return.
+	StoragesWritePolicy_WriteThrough StoragesWritePolicy = iota
+	// StoragesWritePolicy_WriteBack write to the local tier and sync changes to the distributed tier later.
+	StoragesWritePolicy_WriteBack
+)
+
+const (
+	storages_DefaultFlushInterval = 5 * monotonic.Second
+	storages_DefaultRetryInterval = 10 * monotonic.Second
+)
+
+// Init compose the tiers. nil local means in-memory local tier by StoragesMemory and nil distributed means standalone mode.
+//
+//libgo:impl libgo/protocol.ObjectLifeCycle
+func (s *Storages) Init(local protocol.StoragesLocal, distributed protocol.StoragesDistributed) (err protocol.Error) {
+	if s.FlushInterval == 0 {
+		s.FlushInterval = storages_DefaultFlushInterval
+	}
+	if s.RetryInterval == 0 {
+		s.RetryInterval = storages_DefaultRetryInterval
+	}
+	if local == nil {
+		err = s.memory.Init()
+		if err != nil {
+			return
+		}
+		local = &s.memory
+	}
+	s.local = local
+	s.distributed = distributed
+
+	var cacheMode = CacheMode_ReadThrough
+	if s.WritePolicy == StoragesWritePolicy_WriteThrough {
+		cacheMode = CacheMode_WriteThrough
+	}
+	var cacheSource = distributed
+	if cacheSource == nil {
+		cacheSource = localTier{local}
+	}
+	err = s.cache.Init(cacheMode, cacheSource)
+	if err != nil {
+		return
+	}
+
+	if distributed == nil {
+		s.objects.init(s, local.Local_Objects(), nil)
+		s.records.init(s, local.Local_Records(), nil)
+		s.keyValues.init(s, local.Local_KeyValues(), nil)
+		return
+	}
+	s.objects.init(s, local.Local_Objects(), &s.cache.objects)
+	s.records.init(s, local.Local_Records(), &s.cache.records)
+	s.keyValues.init(s, local.Local_KeyValues(), &s.cache.keyValues)
+
+	err = s.flushTimer.Init(s)
+	if err != nil {
+		return
+	}
+	err = s.flushTimer.Tick(s.FlushInterval, s.FlushInterval)
+	return
+}
+
+// Deinit stop the flush timer and try to sync all local changes to the distributed tier.
+func (s *Storages) Deinit() (err protocol.Error) {
+	if s.distributed != nil {
+		s.flushTimer.Stop()
+		err = s.Flush()
+	}
+	s.cache.Deinit()
+	if s.local == protocol.StoragesLocal(&s.memory) {
+		s.memory.Deinit()
+	}
+	return
+}
+
+// Flush sync all changes made on the local tier to the distributed tier.
+// It stops on the first error and remaining changes will sync by next Flush().
+func (s *Storages) Flush() (err protocol.Error) {
+	if s.distributed == nil {
+		return
+	}
+	s.flushSync.Lock()
+	defer s.flushSync.Unlock()
+
+	err = s.keyValues.flush()
+	if err != nil {
+		return
+	}
+	err = s.objects.flush()
+	if err != nil {
+		return
+	}
+	err = s.records.flush()
+	return
+}
+
+// Dirty return number of changes that are not synced to the distributed tier yet.
+func (s *Storages) Dirty() (num int) {
+	return s.keyValues.dirty.len() + s.objects.dirty.len() + s.records.dirty.len()
+}
+
+//libgo:impl libgo/protocol.TimerListener
+func (s *Storages) TimerHandler() {
+	if s.Dirty() == 0 || !s.flushing.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		s.Flush()
+		s.flushing.Store(false)
+	}()
+}
+
+//libgo:impl libgo/protocol.StoragesLocal
+func (s *Storages) Local_Objects() protocol.StorageObjects    { return s.local.Local_Objects() }
+func (s *Storages) Local_Files() protocol.FileDirectory       { return s.local.Local_Files() }
+func (s *Storages) Local_Records() protocol.StorageRecords    { return s.local.Local_Records() }
+func (s *Storages) Local_KeyValues() protocol.StorageKeyValue { return s.local.Local_KeyValues() }
+func (s *Storages) Local_SharedFiles() protocol.FileDirectory { return s.local.Local_SharedFiles() }
+
+//libgo:impl libgo/protocol.StoragesCache
+func (s *Storages) Cache_Objects() protocol.StorageObjects    { return s.cache.Cache_Objects() }
+func (s *Storages) Cache_Files() protocol.FileDirectory       { return s.cache.Cache_Files() }
+func (s *Storages) Cache_Records() protocol.StorageRecords    { return s.cache.Cache_Records() }
+func (s *Storages) Cache_KeyValues() protocol.StorageKeyValue { return s.cache.Cache_KeyValues() }
+
+//libgo:impl libgo/protocol.StoragesDistributed
+func (s *Storages) Objects() protocol.StorageObjects    { return &s.objects }
+func (s *Storages) Records() protocol.StorageRecords    { return &s.records }
+func (s *Storages) KeyValues() protocol.StorageKeyValue { return &s.keyValues }
+
+// Files return the distributed directory if it is available now, otherwise the local one.
+// Files changes don't sync between tiers.
+func (s *Storages) Files() protocol.FileDirectory {
+	if s.available() {
+		return s.distributed.Files()
+	}
+	return s.local.Local_Files()
+}
+
+// available report the distributed tier exist and isn't in retry interval of a failure.
+func (s *Storages) available() bool {
+	return s.distributed != nil && monotonic.Now() >= monotonic.Time(s.downUntil.Load())
+}
+
+// writeBack report changes must go to the local tier.
+func (s *Storages) writeBack() bool {
+	return s.WritePolicy == StoragesWritePolicy_WriteBack || !s.available()
+}
+
+// unavailable check err of a call to the distributed tier and mark the tier unavailable for RetryInterval
+// if it is a temporary or timeout error.
+func (s *Storages) unavailable(err protocol.Error) bool {
+	if err == nil || !(err.CheckType(protocol.ErrorType_Temporary) || err.CheckType(protocol.ErrorType_Timeout)) {
+		return false
+	}
+	var until = monotonic.Now()
+	until.Add(s.RetryInterval)
+	s.downUntil.Store(int64(until))
+	return true
+}
+
+// localTier present a protocol.StoragesLocal as protocol.StoragesDistributed to use as a cache source.
+type localTier struct {
+	protocol.StoragesLocal
+}
+
+func (lt localTier) Objects() protocol.StorageObjects    { return lt.Local_Objects() }
+func (lt localTier) Files() protocol.FileDirectory       { return lt.Local_Files() }
+func (lt localTier) Records() protocol.StorageRecords    { return lt.Local_Records() }
+func (lt localTier) KeyValues() protocol.StorageKeyValue { return lt.Local_KeyValues() }
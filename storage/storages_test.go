@@ -0,0 +1,216 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	er "libgo/error"
+	"libgo/protocol"
+)
+
+var (
+	_ protocol.Storages      = &Storages{}
+	_ protocol.StoragesLocal = &StoragesMemory{}
+)
+
+// testDistributed is a distributed tier that its key-value storage can go down.
+type testDistributed struct {
+	StoragesMemory
+	keyValues testDownKeyValue
+}
+
+func (td *testDistributed) Objects() protocol.StorageObjects    { return td.Local_Objects() }
+func (td *testDistributed) Files() protocol.FileDirectory       { return nil }
+func (td *testDistributed) Records() protocol.StorageRecords    { return td.Local_Records() }
+func (td *testDistributed) KeyValues() protocol.StorageKeyValue { return &td.keyValues }
+
+type testDownKeyValue struct {
+	*KeyValueMemory
+	down atomic.Bool
+}
+
+var errTestDown er.Error
+
+func init() {
+	errTestDown.Init("domain/libgo.scm.geniuses.group; package=storage; type=error; name=test-down")
+	errTestDown.SetTemporary()
+}
+
+func (kv *testDownKeyValue) Get(key []byte) (value []byte, err protocol.Error) {
+	if kv.down.Load() {
+		return nil, &errTestDown
+	}
+	return kv.KeyValueMemory.Get(key)
+}
+func (kv *testDownKeyValue) Set(key []byte, value []byte, options protocol.StorageKeyValue_SaveOptions) (err protocol.Error) {
+	if kv.down.Load() {
+		return &errTestDown
+	}
+	return kv.KeyValueMemory.Set(key, value, options)
+}
+
+func newTestDistributed(t *testing.T) (td *testDistributed) {
+	td = &testDistributed{}
+	var err = td.StoragesMemory.Init()
+	if err != nil {
+		t.Fatalf("StoragesMemory.Init() error = %v", err)
+	}
+	td.keyValues.KeyValueMemory = &td.StoragesMemory.keyValues
+	return
+}
+
+func TestStorages_Standalone(t *testing.T) {
+	var s Storages
+	var err = s.Init(nil, nil)
+	if err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer s.Deinit()
+
+	var options protocol.StorageKeyValue_SaveOptions
+	s.KeyValues().Set([]byte("k"), []byte("v"), options)
+	var value []byte
+	value, err = s.Local_KeyValues().Get([]byte("k"))
+	if err != nil || string(value) != "v" {
+		t.Errorf("local Get() = %q, %v, want %q", value, err, "v")
+	}
+
+	var id = ObjectID([]byte("object"))
+	err = s.Objects().Save(1, id, []byte("object"))
+	if err != nil {
+		t.Fatalf("Objects().Save() error = %v", err)
+	}
+	var object []byte
+	object, err = s.Local_Objects().Get(1, id)
+	if err != nil || string(object) != "object" {
+		t.Errorf("local Objects().Get() = %q, %v, want %q", object, err, "object")
+	}
+	if s.Dirty() != 0 {
+		t.Errorf("Dirty() = %d in standalone mode, want 0", s.Dirty())
+	}
+}
+
+func TestStorages_WriteBack(t *testing.T) {
+	var td = newTestDistributed(t)
+	var s = Storages{WritePolicy: StoragesWritePolicy_WriteBack, FlushInterval: protocol.Duration(1 << 62)}
+	var err = s.Init(nil, td)
+	if err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer s.Deinit()
+
+	var id = [16]byte{1}
+	s.KeyValues().Set([]byte("k"), []byte("v"), protocol.StorageKeyValue_SaveOptions{})
+	s.Records().Save(1, id, []byte("r1"), protocol.StorageRecord_SaveOptions{MaxVersion: 4})
+	s.Records().Update(1, id, []byte("r2"), protocol.StorageRecord_LastLocalVersion)
+	if err = s.Records().Update(1, id, []byte("r0"), 0); err != &ErrVersionNotLast {
+		t.Errorf("write-back Update() of first version error = %v, want ErrVersionNotLast", err)
+	}
+	if s.Dirty() != 2 {
+		t.Fatalf("Dirty() = %d, want 2", s.Dirty())
+	}
+	if _, err = td.Local_KeyValues().Get([]byte("k")); err == nil {
+		t.Errorf("write-back change reached the distributed tier before Flush()")
+	}
+	var value []byte
+	value, err = s.KeyValues().Get([]byte("k"))
+	if err != nil || string(value) != "v" {
+		t.Errorf("dirty Get() = %q, %v, want %q", value, err, "v")
+	}
+
+	var ts testScan
+	td.Local_KeyValues().Set([]byte("j"), []byte("remote"), protocol.StorageKeyValue_SaveOptions{})
+	s.KeyValues().Scan(nil, nil, protocol.StorageKeyValue_ScanOptions{}, &ts)
+	if len(ts.keys) != 2 || ts.keys[0] != "j=remote" || ts.keys[1] != "k=v" {
+		t.Errorf("Scan() = %q, want dirty keys merged with the distributed tier", ts.keys)
+	}
+
+	err = s.Flush()
+	if err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if s.Dirty() != 0 {
+		t.Errorf("Dirty() = %d after Flush(), want 0", s.Dirty())
+	}
+	value, err = td.Local_KeyValues().Get([]byte("k"))
+	if err != nil || string(value) != "v" {
+		t.Errorf("distributed Get() = %q, %v, want %q", value, err, "v")
+	}
+	var record []byte
+	record, _, err = td.Local_Records().Get(1, id, protocol.StorageRecord_LastLocalVersion)
+	if err != nil || string(record) != "r2" {
+		t.Errorf("distributed record = %q, %v, want %q", record, err, "r2")
+	}
+}
+
+func TestStorages_WriteBackExpired(t *testing.T) {
+	var td = newTestDistributed(t)
+	var s = Storages{WritePolicy: StoragesWritePolicy_WriteBack, FlushInterval: protocol.Duration(1 << 62)}
+	var err = s.Init(nil, td)
+	if err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer s.Deinit()
+
+	td.Local_KeyValues().Set([]byte("a"), []byte("old"), protocol.StorageKeyValue_SaveOptions{})
+	s.KeyValues().Set([]byte("a"), []byte("v"), protocol.StorageKeyValue_SaveOptions{TTL: protocol.Duration(time.Millisecond)})
+	s.KeyValues().Set([]byte("b"), []byte("v"), protocol.StorageKeyValue_SaveOptions{})
+	s.KeyValues().Set([]byte("c"), []byte("v"), protocol.StorageKeyValue_SaveOptions{})
+	time.Sleep(5 * time.Millisecond)
+
+	err = s.Flush()
+	if err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if s.Dirty() != 0 {
+		t.Errorf("Dirty() = %d after Flush(), want 0", s.Dirty())
+	}
+	if _, err = td.Local_KeyValues().Get([]byte("a")); err != &ErrNotExist {
+		t.Errorf("distributed Get() of expired key error = %v, want ErrNotExist", err)
+	}
+	for _, k := range []string{"b", "c"} {
+		if value, _ := td.Local_KeyValues().Get([]byte(k)); string(value) != "v" {
+			t.Errorf("distributed Get(%q) = %q, want %q", k, value, "v")
+		}
+	}
+}
+
+func TestStorages_Fallback(t *testing.T) {
+	var td = newTestDistributed(t)
+	var s = Storages{FlushInterval: protocol.Duration(1 << 62)}
+	var err = s.Init(nil, td)
+	if err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer s.Deinit()
+
+	var options protocol.StorageKeyValue_SaveOptions
+	s.KeyValues().Set([]byte("a"), []byte("1"), options)
+	if _, err = td.Local_KeyValues().Get([]byte("a")); err != nil {
+		t.Errorf("write-through change not reached the distributed tier: %v", err)
+	}
+
+	td.keyValues.down.Store(true)
+	err = s.KeyValues().Set([]byte("b"), []byte("2"), options)
+	if err != nil {
+		t.Fatalf("Set() while distributed tier is down error = %v", err)
+	}
+	if s.available() || s.Dirty() != 1 {
+		t.Errorf("available() = %v, Dirty() = %d, want false and 1", s.available(), s.Dirty())
+	}
+
+	td.keyValues.down.Store(false)
+	s.downUntil.Store(0)
+	err = s.Flush()
+	if err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	var value []byte
+	value, err = td.Local_KeyValues().Get([]byte("b"))
+	if err != nil || string(value) != "2" {
+		t.Errorf("distributed Get() = %q, %v, want %q", value, err, "2")
+	}
+}
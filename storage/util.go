@@ -0,0 +1,31 @@
+/* For license and copyright information please see the LEGAL file in the code repository */
+
+package storage
+
+func cloneBytes(b []byte) (c []byte) {
+	if b == nil {
+		return
+	}
+	c = make([]byte, len(b))
+	copy(c, b)
+	return
+}
+
+// zeroBytes write zero data to given slice location.
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// pageRange return start and end index of the page in a list with ln items.
+func pageRange(ln, offset, limit uint64) (start, end uint64) {
+	if offset >= ln {
+		return ln, ln
+	}
+	end = offset + limit
+	if end > ln || end < offset {
+		end = ln
+	}
+	return offset, end
+}